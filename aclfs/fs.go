@@ -0,0 +1,223 @@
+package aclfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// An Op is the kind of access an operation makes to a path.
+type Op string
+
+const (
+	// OpStat is the access of Stat.
+	OpStat Op = "stat"
+	// OpRead is the access of the files opened read only, and of the
+	// directories listed.
+	OpRead Op = "read"
+	// OpWrite is the access of the files opened for writing, of the
+	// directories created, of the targets of Rename and of the changes of
+	// modes and times.
+	OpWrite Op = "write"
+	// OpDelete is the access of Remove, RemoveAll and of the sources of
+	// Rename.
+	OpDelete Op = "delete"
+)
+
+// A Request is an access to authorize.
+type Request struct {
+	Subject string
+	Path    string
+	Op      Op
+}
+
+// A Policy decides which requests are allowed.
+type Policy interface {
+	Allow(ctx context.Context, req Request) bool
+}
+
+// PolicyFunc is a Policy function.
+type PolicyFunc func(ctx context.Context, req Request) bool
+
+func (f PolicyFunc) Allow(ctx context.Context, req Request) bool {
+	return f(ctx, req)
+}
+
+// An AuditFunc is told about each request and the decision of the policy.
+type AuditFunc func(ctx context.Context, req Request, allowed bool)
+
+type subjectKey struct{}
+
+// WithSubject returns a copy of ctx carrying subject.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext returns the subject carried by ctx.
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey{}).(string)
+	return subject, ok
+}
+
+// The Fs authorizes the operations on its base with a policy, so the
+// services exposing a filesystem, over HTTP or WebDAV, decide who can do
+// what in a single place. The requests denied fail with EACCES.
+//
+// The paths are cleaned before being authorized, and delegated to the
+// base as authorized.
+type Fs struct {
+	base      kafero.Fs
+	policy    Policy
+	audit     AuditFunc
+	auditOnly bool
+}
+
+// NewFs returns an Fs authorizing the operations on base with policy.
+func NewFs(base kafero.Fs, policy Policy) *Fs {
+	return &Fs{base: base, policy: policy}
+}
+
+// SetAudit makes the Fs tell fn about each decision of the policy. In
+// audit only mode, the requests denied are told but not rejected, to try
+// a policy out before enforcing it.
+func (a *Fs) SetAudit(fn AuditFunc, auditOnly bool) {
+	a.audit = fn
+	a.auditOnly = auditOnly
+}
+
+// For returns the filesystem of the subject carried by ctx, the empty
+// subject if none.
+func (a *Fs) For(ctx context.Context) kafero.Fs {
+	subject, _ := SubjectFromContext(ctx)
+	return &subjectFs{acl: a, ctx: ctx, subject: subject}
+}
+
+// subjectFs is the filesystem of a subject.
+type subjectFs struct {
+	acl     *Fs
+	ctx     context.Context
+	subject string
+}
+
+// authorize returns the cleaned name if the op of the subject on name is
+// allowed, and an EACCES error otherwise.
+func (s *subjectFs) authorize(op, name string, access Op) (string, error) {
+	clean := filepath.Clean(name)
+	req := Request{Subject: s.subject, Path: clean, Op: access}
+	allowed := s.acl.policy.Allow(s.ctx, req)
+	if s.acl.audit != nil {
+		s.acl.audit(s.ctx, req, allowed)
+	}
+	if !allowed && !s.acl.auditOnly {
+		return clean, &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+	}
+	return clean, nil
+}
+
+func (s *subjectFs) Name() string {
+	return "AclFs"
+}
+
+// WithContext returns a view of the filesystem of the subject bound to ctx,
+// whatever the subject ctx carries, the policy being told ctx.
+func (s *subjectFs) WithContext(ctx context.Context) kafero.Fs {
+	acl := *s.acl
+	acl.base = kafero.WithContext(s.acl.base, ctx)
+	return &subjectFs{acl: &acl, ctx: ctx, subject: s.subject}
+}
+
+func (s *subjectFs) Create(name string) (kafero.File, error) {
+	clean, err := s.authorize("create", name, OpWrite)
+	if err != nil {
+		return nil, err
+	}
+	return s.acl.base.Create(clean)
+}
+
+func (s *subjectFs) Mkdir(name string, perm os.FileMode) error {
+	clean, err := s.authorize("mkdir", name, OpWrite)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.Mkdir(clean, perm)
+}
+
+func (s *subjectFs) MkdirAll(path string, perm os.FileMode) error {
+	clean, err := s.authorize("mkdir", path, OpWrite)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.MkdirAll(clean, perm)
+}
+
+func (s *subjectFs) Open(name string) (kafero.File, error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (s *subjectFs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	access := OpRead
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		access = OpWrite
+	}
+	clean, err := s.authorize("open", name, access)
+	if err != nil {
+		return nil, err
+	}
+	return s.acl.base.OpenFile(clean, flag, perm)
+}
+
+func (s *subjectFs) Remove(name string) error {
+	clean, err := s.authorize("remove", name, OpDelete)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.Remove(clean)
+}
+
+func (s *subjectFs) RemoveAll(path string) error {
+	clean, err := s.authorize("removeall", path, OpDelete)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.RemoveAll(clean)
+}
+
+func (s *subjectFs) Rename(oldname, newname string) error {
+	oldclean, err := s.authorize("rename", oldname, OpDelete)
+	if err != nil {
+		return err
+	}
+	newclean, err := s.authorize("rename", newname, OpWrite)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.Rename(oldclean, newclean)
+}
+
+func (s *subjectFs) Stat(name string) (os.FileInfo, error) {
+	clean, err := s.authorize("stat", name, OpStat)
+	if err != nil {
+		return nil, err
+	}
+	return s.acl.base.Stat(clean)
+}
+
+func (s *subjectFs) Chmod(name string, mode os.FileMode) error {
+	clean, err := s.authorize("chmod", name, OpWrite)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.Chmod(clean, mode)
+}
+
+func (s *subjectFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	clean, err := s.authorize("chtimes", name, OpWrite)
+	if err != nil {
+		return err
+	}
+	return s.acl.base.Chtimes(clean, atime, mtime)
+}
@@ -0,0 +1,63 @@
+package aclfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+// homePolicy allows the subjects everything in their home, and reading
+// the public directory.
+var homePolicy = PolicyFunc(func(ctx context.Context, req Request) bool {
+	home := filepath.Join("/home", req.Subject)
+	if req.Path == home || strings.HasPrefix(req.Path, home+"/") {
+		return true
+	}
+	return (req.Op == OpRead || req.Op == OpStat) && strings.HasPrefix(req.Path, "/public")
+})
+
+func TestAcl(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	if err := kafero.WriteFile(base, "/public/readme.txt", []byte("readme"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(base, "/home/bob/secret.txt", []byte("bob"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	acl := NewFs(base, homePolicy)
+	alice := acl.For(WithSubject(context.Background(), "alice"))
+
+	if err := kafero.WriteFile(alice, "/home/alice/notes.txt", []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kafero.ReadFile(alice, "/public/readme.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.OpenFile("/public/readme.txt", os.O_WRONLY|os.O_TRUNC, 0644); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+	if _, err := alice.Open("/home/alice/../bob/secret.txt"); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+	if err := alice.Rename("/home/bob/secret.txt", "/home/alice/secret.txt"); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+
+	// In audit only mode, the denials are told but not enforced
+	var denied []string
+	acl.SetAudit(func(ctx context.Context, req Request, allowed bool) {
+		if !allowed {
+			denied = append(denied, string(req.Op)+" "+req.Path)
+		}
+	}, true)
+	if _, err := kafero.ReadFile(alice, "/home/bob/secret.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if len(denied) != 1 || denied[0] != "read /home/bob/secret.txt" {
+		t.Fatalf("was expecting the read to be audited, got %v", denied)
+	}
+}
@@ -0,0 +1,301 @@
+package kafero
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsafeArchivePath is returned when extracting an archive entry, or
+	// symlink target, which would land outside of the destination.
+	ErrUnsafeArchivePath = errors.New("archive entry outside of the destination")
+	// ErrArchiveTooLarge is returned when extracting an archive larger than
+	// the MaxSize of the options.
+	ErrArchiveTooLarge = errors.New("archive too large")
+)
+
+// ExtractOptions are the options of Untar and Unzip.
+type ExtractOptions struct {
+	// Overwrite replaces the existing files, which are an error otherwise.
+	Overwrite bool
+	// MaxSize is the maximum total size of the files extracted, 0 not
+	// limiting it.
+	MaxSize int64
+}
+
+// Untar extracts the tar archive read from r under the directory root of
+// dst, which is created if needed. The files and directories get the
+// permissions of their entries, and their modification times when dst can
+// set them. The symlinks are created if dst supports them, and the other
+// special files are skipped. The entries whose path, or symlink target,
+// would escape root fail with ErrUnsafeArchivePath.
+func Untar(r io.Reader, dst Fs, root string, opts ExtractOptions) error {
+	return newExtractor(dst, root, opts).untar(r)
+}
+
+// Unzip extracts the zip archive of size bytes read from r under the
+// directory root of dst, as Untar does.
+func Unzip(r io.ReaderAt, size int64, dst Fs, root string, opts ExtractOptions) error {
+	return newExtractor(dst, root, opts).unzip(r, size)
+}
+
+type extractor struct {
+	fs     Fs
+	root   string
+	opts   ExtractOptions
+	policy ImportPolicy
+	report ImportReport
+	size   int64
+	// The modification times of the directories, set once their content is
+	// extracted
+	dirTimes map[string]time.Time
+	// The symlinks extracted, that the other entries can't go through
+	links map[string]bool
+}
+
+func newExtractor(fs Fs, root string, opts ExtractOptions) *extractor {
+	policy := FailOnConflict
+	if opts.Overwrite {
+		policy = OverwriteExisting
+	}
+	return &extractor{
+		fs:       fs,
+		root:     filepath.Clean(root),
+		opts:     opts,
+		policy:   policy,
+		dirTimes: make(map[string]time.Time),
+		links:    make(map[string]bool),
+	}
+}
+
+// write returns true if the entry name, modified at mtime, should be
+// written to target depending on the file already there, and if there is
+// one.
+func (x *extractor) write(name, target string, mtime time.Time) (bool, bool, error) {
+	existing, err := lstatIfPossible(x.fs, target)
+	if os.IsNotExist(err) {
+		return true, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	switch x.policy {
+	case OverwriteExisting:
+		return true, true, nil
+	case OverwriteIfNewer:
+		if mtime.After(existing.ModTime()) {
+			return true, true, nil
+		}
+	case FailOnConflict:
+		return false, true, &os.PathError{Op: "extract", Path: name, Err: os.ErrExist}
+	}
+	x.report.Skipped++
+	return false, true, nil
+}
+
+func (x *extractor) untar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading archive: %v", err)
+		}
+		info := hdr.FileInfo()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = x.dir(hdr.Name, info)
+		case tar.TypeReg, tar.TypeRegA:
+			err = x.file(hdr.Name, info, tr)
+		case tar.TypeSymlink:
+			err = x.symlink(hdr.Name, hdr.Linkname, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	x.finish()
+	return nil
+}
+
+func (x *extractor) unzip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+	for _, zf := range zr.File {
+		info := zf.FileInfo()
+		switch {
+		case info.IsDir():
+			err = x.dir(zf.Name, info)
+		case info.Mode()&os.ModeSymlink != 0:
+			err = x.zipSymlink(zf, info)
+		case info.Mode().IsRegular():
+			err = x.zipFile(zf, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	x.finish()
+	return nil
+}
+
+// entryPath returns the cleaned path, relative to the root of the archive,
+// of the entry name, which uses slashes as archives do. The leading slashes
+// are dropped, as tar does.
+func entryPath(name string) string {
+	return path.Clean(strings.TrimLeft(strings.Replace(name, "\\", "/", -1), "/"))
+}
+
+// target returns the path in the destination of the entry name. The entries
+// under the symlinks extracted are rejected, as the links could lead them
+// outside of root.
+func (x *extractor) target(name string) (string, error) {
+	clean := entryPath(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", &os.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	for dir := path.Dir(clean); dir != "."; dir = path.Dir(dir) {
+		if x.links[dir] {
+			return "", &os.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+		}
+	}
+	return filepath.Join(x.root, filepath.FromSlash(clean)), nil
+}
+
+func (x *extractor) dir(name string, info os.FileInfo) error {
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	if err := x.fs.MkdirAll(target, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	x.dirTimes[target] = info.ModTime()
+	return nil
+}
+
+func (x *extractor) file(name string, info os.FileInfo, r io.Reader) error {
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	ok, exists, err := x.write(name, target, info.ModTime())
+	if !ok || err != nil {
+		return err
+	}
+	if err := x.fs.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if x.policy == FailOnConflict {
+		flag |= os.O_EXCL
+	}
+	f, err := x.fs.OpenFile(target, flag, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error opening destination file: %v", err)
+	}
+	if x.opts.MaxSize > 0 {
+		// Read one byte more than allowed to detect the archives too large
+		r = io.LimitReader(r, x.opts.MaxSize-x.size+1)
+	}
+	n, err := io.Copy(f, r)
+	x.size += n
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("error extracting %s: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing destination file: %v", err)
+	}
+	if x.opts.MaxSize > 0 && x.size > x.opts.MaxSize {
+		_ = x.fs.Remove(target)
+		return &os.PathError{Op: "extract", Path: name, Err: ErrArchiveTooLarge}
+	}
+	x.report.add(exists, n)
+	// Not all the filesystems can set the times
+	_ = x.fs.Chtimes(target, info.ModTime(), info.ModTime())
+	return nil
+}
+
+func (x *extractor) symlink(name, linkname string, info os.FileInfo) error {
+	linker, ok := x.fs.(Linker)
+	if !ok {
+		return nil
+	}
+	target, err := x.target(name)
+	if err != nil {
+		return err
+	}
+	// The target is resolved from the directory of the link, and must stay
+	// under root
+	if filepath.IsAbs(linkname) {
+		return &os.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	rel, err := filepath.Rel(x.root, filepath.Join(filepath.Dir(target), linkname))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return &os.PathError{Op: "extract", Path: name, Err: ErrUnsafeArchivePath}
+	}
+	if err := x.fs.MkdirAll(filepath.Dir(target), 0777); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	// The entries under the link are rejected even if it is skipped, as the
+	// file there could be a link too
+	x.links[entryPath(name)] = true
+	ok, exists, err := x.write(name, target, info.ModTime())
+	if !ok || err != nil {
+		return err
+	}
+	if exists {
+		_ = x.fs.Remove(target)
+	}
+	if err := linker.SymlinkIfPossible(linkname, target); err != nil {
+		return fmt.Errorf("error creating symlink: %v", err)
+	}
+	x.report.add(exists, 0)
+	return nil
+}
+
+func (x *extractor) zipFile(zf *zip.File, info os.FileInfo) error {
+	r, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+	defer r.Close()
+	return x.file(zf.Name, info, r)
+}
+
+func (x *extractor) zipSymlink(zf *zip.File, info os.FileInfo) error {
+	r, err := zf.Open()
+	if err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+	defer r.Close()
+	// The target of a link is its content
+	linkname, err := ioutil.ReadAll(io.LimitReader(r, 4096))
+	if err != nil {
+		return fmt.Errorf("error reading archive: %v", err)
+	}
+	return x.symlink(zf.Name, string(linkname), info)
+}
+
+// finish sets the modification times of the directories, which extracting
+// their content changed.
+func (x *extractor) finish() {
+	for dir, mtime := range x.dirTimes {
+		// Not all the filesystems can set the times
+		_ = x.fs.Chtimes(dir, mtime, mtime)
+	}
+}
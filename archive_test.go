@@ -0,0 +1,168 @@
+package kafero
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type archiveEntry struct {
+	name     string
+	content  string
+	linkname string
+	dir      bool
+}
+
+func makeTar(t *testing.T, entries ...archiveEntry) *bytes.Buffer {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	mtime := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0640, ModTime: mtime, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		switch {
+		case e.dir:
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0750
+		case e.linkname != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.linkname
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUntar(t *testing.T) {
+	fs := NewMemMapFs()
+	archive := makeTar(t,
+		archiveEntry{name: "dir/", dir: true},
+		archiveEntry{name: "dir/a.txt", content: "a"},
+		archiveEntry{name: "other/b.txt", content: "bb"},
+	)
+	if err := Untar(archive, fs, "dst", ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"dst/dir/a.txt": "a", "dst/other/b.txt": "bb"} {
+		b, err := ReadFile(fs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != content {
+			t.Fatalf("was expecting %s in %s, got %s", content, name, b)
+		}
+	}
+	fi, err := fs.Stat("dst/dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0640 || !fi.ModTime().Equal(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("was expecting the mode and time of the entry, got %v and %v", fi.Mode(), fi.ModTime())
+	}
+
+	archive = makeTar(t, archiveEntry{name: "dir/a.txt", content: "new"})
+	if err := Untar(archive, fs, "dst", ExtractOptions{}); err == nil {
+		t.Fatal("was expecting an error overwriting a file")
+	}
+	archive = makeTar(t, archiveEntry{name: "dir/a.txt", content: "new"})
+	if err := Untar(archive, fs, "dst", ExtractOptions{Overwrite: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	archive = makeTar(t, archiveEntry{name: "big.txt", content: "0123456789"})
+	if err := Untar(archive, fs, "dst", ExtractOptions{MaxSize: 5}); !isErr(err, ErrArchiveTooLarge) {
+		t.Fatalf("was expecting ErrArchiveTooLarge, got %v", err)
+	}
+	if ok, _ := Exists(fs, "dst/big.txt"); ok {
+		t.Fatal("was expecting the file too large to be removed")
+	}
+}
+
+func isErr(err, target error) bool {
+	if perr, ok := err.(*os.PathError); ok {
+		return perr.Err == target
+	}
+	return false
+}
+
+func TestUntarUnsafe(t *testing.T) {
+	dir, err := TempDir(NewOsFs(), "", "kafero-untar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fs := NewOsFs()
+	root := filepath.Join(dir, "dst")
+
+	for _, entries := range [][]archiveEntry{
+		{{name: "../evil.txt", content: "evil"}},
+		{{name: "dir/../../evil.txt", content: "evil"}},
+		{{name: "link", linkname: "../"}},
+		{{name: "link", linkname: "/etc"}},
+		// The link is safe, but the entries going through it are not
+		{{name: "link", linkname: "."}, {name: "link/sub", linkname: ".."}},
+	} {
+		if err := Untar(makeTar(t, entries...), fs, root, ExtractOptions{}); !isErr(err, ErrUnsafeArchivePath) {
+			t.Fatalf("was expecting ErrUnsafeArchivePath for %v, got %v", entries, err)
+		}
+		if ok, _ := Exists(fs, filepath.Join(dir, "evil.txt")); ok {
+			t.Fatal("was not expecting a file outside of the destination")
+		}
+		_ = fs.RemoveAll(root)
+	}
+
+	archive := makeTar(t, archiveEntry{name: "a.txt", content: "a"}, archiveEntry{name: "dir/link", linkname: "../a.txt"})
+	if err := Untar(archive, fs, root, ExtractOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadFile(fs, filepath.Join(root, "dir", "link"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a" {
+		t.Fatalf("was expecting the link to a.txt, got %s", b)
+	}
+}
+
+func TestUnzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"dir/a.txt": "a", "b.txt": "bb"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := zw.Create("../evil.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := NewMemMapFs()
+	r := bytes.NewReader(buf.Bytes())
+	err := Unzip(r, r.Size(), fs, "dst", ExtractOptions{})
+	if !isErr(err, ErrUnsafeArchivePath) {
+		t.Fatalf("was expecting ErrUnsafeArchivePath, got %v", err)
+	}
+	b, err := ReadFile(fs, "dst/dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a" {
+		t.Fatalf("was expecting a, got %s", b)
+	}
+}
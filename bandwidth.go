@@ -0,0 +1,64 @@
+package kafero
+
+import (
+	"sync/atomic"
+)
+
+// Bandwidth is the traffic of a caching filesystem since it was created,
+// to quantify the transfers from and to its base, such as the egress of a
+// bucket, spared by its cache.
+type Bandwidth struct {
+	// FromCache is the number of bytes read from the cache.
+	FromCache int64
+	// FromBase is the number of bytes fetched from the base, to fill the
+	// cache.
+	FromBase int64
+	// ToBase is the number of bytes uploaded to the base, on sync or close
+	// of the files written.
+	ToBase int64
+}
+
+// BandwidthCounter is an optional interface in Kafero. It is implemented
+// by the filesystems caching a base, the SizeCacheFS and the BufferFs,
+// counting the bytes they move.
+type BandwidthCounter interface {
+	Bandwidth() Bandwidth
+}
+
+var _ BandwidthCounter = (*SizeCacheFS)(nil)
+var _ BandwidthCounter = (*BufferFs)(nil)
+
+// bandwidth counts the Bandwidth of a filesystem atomically, a nil
+// bandwidth counting nothing.
+type bandwidth struct {
+	fromCache, fromBase, toBase int64
+}
+
+func (b *bandwidth) get() Bandwidth {
+	if b == nil {
+		return Bandwidth{}
+	}
+	return Bandwidth{
+		FromCache: atomic.LoadInt64(&b.fromCache),
+		FromBase:  atomic.LoadInt64(&b.fromBase),
+		ToBase:    atomic.LoadInt64(&b.toBase),
+	}
+}
+
+func (b *bandwidth) addFromCache(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.fromCache, n)
+	}
+}
+
+func (b *bandwidth) addFromBase(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.fromBase, n)
+	}
+}
+
+func (b *bandwidth) addToBase(n int64) {
+	if b != nil {
+		atomic.AddInt64(&b.toBase, n)
+	}
+}
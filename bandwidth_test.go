@@ -0,0 +1,49 @@
+package kafero
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSizeCacheFSBandwidth(t *testing.T) {
+	base := NewMemMapFs()
+	content := bytes.Repeat([]byte("content"), 100)
+	if err := WriteFile(base, "file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewSizeCacheFS(base, NewMemMapFs(), 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fetched once, read twice from the cache
+	for i := 0; i < 2; i++ {
+		if _, err := ReadFile(fs, "file.bin"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteFile(fs, "other.bin", content[:10], 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := Bandwidth{FromCache: int64(2 * len(content)), FromBase: int64(len(content)), ToBase: 10}
+	if got := fs.Bandwidth(); got != want {
+		t.Fatalf("was expecting %+v, got %+v", want, got)
+	}
+}
+
+func TestBufferFsBandwidth(t *testing.T) {
+	base := NewMemMapFs()
+	if err := WriteFile(base, "file.bin", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewBufferFs(base, NewMemMapFs())
+	if _, err := ReadFile(fs, "file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "file.bin", []byte("new content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want := Bandwidth{FromCache: 7, FromBase: 7, ToBase: 11}
+	if got := fs.(BandwidthCounter).Bandwidth(); got != want {
+		t.Fatalf("was expecting %+v, got %+v", want, got)
+	}
+}
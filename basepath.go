@@ -8,7 +8,14 @@ import (
 	"time"
 )
 
-var _ Lstater = (*BasePathFs)(nil)
+var (
+	_ Lstater   = (*BasePathFs)(nil)
+	_ Symlinker = (*BasePathFs)(nil)
+	_ Xattrer   = (*BasePathFs)(nil)
+	_ Statfser  = (*BasePathFs)(nil)
+	_ FileIDer  = (*BasePathFs)(nil)
+	_ ReadDirer = (*BasePathFs)(nil)
+)
 
 // The BasePathFs restricts all operations to a given path within an Fs.
 // The given file name to the operations on this Fs will be prepended with
@@ -87,6 +94,10 @@ func (b *BasePathFs) Name() string {
 	return "BasePathFs"
 }
 
+func (b *BasePathFs) Unwrap() Fs {
+	return b.source
+}
+
 func (b *BasePathFs) Stat(name string) (fi os.FileInfo, err error) {
 	if name, err = b.RealPath(name); err != nil {
 		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
@@ -179,4 +190,95 @@ func (b *BasePathFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 	return fi, false, err
 }
 
+func (b *BasePathFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	name, err := b.RealPath(dirname)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: dirname, Err: err}
+	}
+	return readDirLstat(b.source, name)
+}
+
+func (b *BasePathFs) Getxattr(name, attr string) (value []byte, err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: err}
+	}
+	return Getxattr(b.source, name, attr)
+}
+
+func (b *BasePathFs) Setxattr(name, attr string, value []byte) (err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return &os.PathError{Op: "setxattr", Path: name, Err: err}
+	}
+	return Setxattr(b.source, name, attr, value)
+}
+
+func (b *BasePathFs) Listxattr(name string) (attrs []string, err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return nil, &os.PathError{Op: "listxattr", Path: name, Err: err}
+	}
+	return Listxattr(b.source, name)
+}
+
+func (b *BasePathFs) Removexattr(name, attr string) (err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return &os.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	return Removexattr(b.source, name, attr)
+}
+
+func (b *BasePathFs) SymlinkIfPossible(oldname, newname string) error {
+	// Relative targets are resolved from the link, absolute ones from the
+	// base path
+	if filepath.IsAbs(oldname) {
+		var err error
+		if oldname, err = b.RealPath(oldname); err != nil {
+			return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+		}
+	}
+	newname, err := b.RealPath(newname)
+	if err != nil {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: err}
+	}
+	if linker, ok := b.source.(Linker); ok {
+		return linker.SymlinkIfPossible(oldname, newname)
+	}
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: ErrNoSymlink}
+}
+
+func (b *BasePathFs) ReadlinkIfPossible(name string) (string, error) {
+	name, err := b.RealPath(name)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	if reader, ok := b.source.(LinkReader); ok {
+		link, err := reader.ReadlinkIfPossible(name)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(link) {
+			// Absolute targets are relative to the base path
+			link = strings.TrimPrefix(link, filepath.Clean(b.path))
+			if link == "" {
+				link = string(filepath.Separator)
+			}
+		}
+		return link, nil
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+}
+
+func (b *BasePathFs) Statfs(name string) (usage *FsUsage, err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	return Statfs(b.source, name)
+}
+
+func (b *BasePathFs) FileID(name string) (id FileID, err error) {
+	if name, err = b.RealPath(name); err != nil {
+		return "", &os.PathError{Op: "fileid", Path: name, Err: err}
+	}
+	return GetFileID(b.source, name)
+}
+
 // vim: ts=4 sw=4 noexpandtab nolist syn=go
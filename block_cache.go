@@ -0,0 +1,263 @@
+package kafero
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultBlockCache is the BlockCache shared by the whole process, of 1MB
+// blocks up to 256MB.
+var DefaultBlockCache = NewBlockCache(1<<20, 256<<20)
+
+// blockKey identifies a block of a version of a file. The version is told
+// by the size and modification time of the file, so that the blocks of a
+// file rewritten are not served anymore.
+type blockKey struct {
+	fs    Fs
+	path  string
+	size  int64
+	mtime int64
+	idx   int64
+}
+
+type block struct {
+	key  blockKey
+	data []byte
+}
+
+// blockFill is a block being read, that the other readers of the block
+// wait for.
+type blockFill struct {
+	wg   sync.WaitGroup
+	data []byte
+	err  error
+}
+
+// BlockCache is a cache of blocks of files shared by their handles, so
+// that the readers of the same hot files share the blocks instead of
+// fetching them each. The least recently used blocks are evicted when the
+// cache exceeds its size.
+type BlockCache struct {
+	blockSize int64
+	maxSize   int64
+	mu        sync.Mutex
+	size      int64
+	lru       *list.List
+	blocks    map[blockKey]*list.Element
+	fills     map[blockKey]*blockFill
+}
+
+// NewBlockCache returns a BlockCache of blocks of blockSize bytes, up to
+// maxSize bytes.
+func NewBlockCache(blockSize int, maxSize int64) *BlockCache {
+	if blockSize < 1 {
+		blockSize = 1
+	}
+	return &BlockCache{
+		blockSize: int64(blockSize),
+		maxSize:   maxSize,
+		lru:       list.New(),
+		blocks:    make(map[blockKey]*list.Element),
+		fills:     make(map[blockKey]*blockFill),
+	}
+}
+
+// Size returns the size of the blocks cached.
+func (c *BlockCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// get returns the block of key, reading it with read if it is not cached.
+// The concurrent reads of a block are done once.
+func (c *BlockCache) get(key blockKey, read func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if e, ok := c.blocks[key]; ok {
+		c.lru.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*block).data, nil
+	}
+	if fill, ok := c.fills[key]; ok {
+		c.mu.Unlock()
+		fill.wg.Wait()
+		return fill.data, fill.err
+	}
+	fill := &blockFill{}
+	fill.wg.Add(1)
+	c.fills[key] = fill
+	c.mu.Unlock()
+
+	fill.data, fill.err = read()
+
+	c.mu.Lock()
+	delete(c.fills, key)
+	if fill.err == nil {
+		c.add(key, fill.data)
+	}
+	c.mu.Unlock()
+	fill.wg.Done()
+	return fill.data, fill.err
+}
+
+// add caches data as the block of key, evicting the least recently used
+// blocks. Must be called with the cache locked.
+func (c *BlockCache) add(key blockKey, data []byte) {
+	if int64(len(data)) > c.maxSize {
+		return
+	}
+	c.blocks[key] = c.lru.PushFront(&block{key: key, data: data})
+	c.size += int64(len(data))
+	for c.size > c.maxSize {
+		e := c.lru.Back()
+		b := e.Value.(*block)
+		c.lru.Remove(e)
+		delete(c.blocks, b.key)
+		c.size -= int64(len(b.data))
+	}
+}
+
+// BlockCacheFile reads a file opened read only through a BlockCache on
+// ReadAt. The other operations go to the file.
+type BlockCacheFile struct {
+	File
+	cache *BlockCache
+	key   blockKey
+}
+
+// NewBlockCacheFile returns f, opened read only from the file name of fs,
+// reading through cache.
+func NewBlockCacheFile(f File, fs Fs, name string, cache *BlockCache) (*BlockCacheFile, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	key := blockKey{fs: fs, path: name, size: info.Size(), mtime: info.ModTime().UnixNano()}
+	return &BlockCacheFile{File: f, cache: cache, key: key}, nil
+}
+
+func (f *BlockCacheFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.Name(), Err: os.ErrInvalid}
+	}
+	bs := f.cache.blockSize
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= f.key.size {
+			return n, io.EOF
+		}
+		key := f.key
+		key.idx = pos / bs
+		data, err := f.cache.get(key, func() ([]byte, error) {
+			return f.readBlock(key.idx)
+		})
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos-key.idx*bs:])
+	}
+	return n, nil
+}
+
+// readBlock reads the block idx of the file.
+func (f *BlockCacheFile) readBlock(idx int64) ([]byte, error) {
+	bs := f.cache.blockSize
+	size := bs
+	if rest := f.key.size - idx*bs; rest < size {
+		size = rest
+	}
+	data := make([]byte, size)
+	n, err := f.File.ReadAt(data, idx*bs)
+	if err == io.EOF && int64(n) == size {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// The BlockCacheFs wraps the files opened read only from the source
+// filesystem in a BlockCacheFile.
+type BlockCacheFs struct {
+	source Fs
+	cache  *BlockCache
+	// The filesystem identifying the cached blocks, the source before
+	// being bound to a context
+	id Fs
+}
+
+// NewBlockCacheFs returns a BlockCacheFs reading through cache, typically
+// DefaultBlockCache.
+func NewBlockCacheFs(source Fs, cache *BlockCache) Fs {
+	return &BlockCacheFs{source: source, cache: cache, id: source}
+}
+
+func (r *BlockCacheFs) Create(name string) (File, error) {
+	return r.source.Create(name)
+}
+
+func (r *BlockCacheFs) Mkdir(name string, perm os.FileMode) error {
+	return r.source.Mkdir(name, perm)
+}
+
+func (r *BlockCacheFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.source.MkdirAll(path, perm)
+}
+
+func (r *BlockCacheFs) Open(name string) (File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (r *BlockCacheFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := r.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 {
+		return f, nil
+	}
+	bf, err := NewBlockCacheFile(f, r.id, filepath.Clean(name), r.cache)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return bf, nil
+}
+
+func (r *BlockCacheFs) Remove(name string) error {
+	return r.source.Remove(name)
+}
+
+func (r *BlockCacheFs) RemoveAll(path string) error {
+	return r.source.RemoveAll(path)
+}
+
+func (r *BlockCacheFs) Rename(oldname, newname string) error {
+	return r.source.Rename(oldname, newname)
+}
+
+func (r *BlockCacheFs) Stat(name string) (os.FileInfo, error) {
+	return r.source.Stat(name)
+}
+
+func (r *BlockCacheFs) Name() string {
+	return "BlockCacheFs"
+}
+
+func (r *BlockCacheFs) Unwrap() Fs {
+	return r.source
+}
+
+func (r *BlockCacheFs) Chmod(name string, mode os.FileMode) error {
+	return r.source.Chmod(name, mode)
+}
+
+func (r *BlockCacheFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.source.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,101 @@
+package kafero
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// readAtCountingFs counts the ReadAt of the files it opens.
+type readAtCountingFs struct {
+	Fs
+	readAts int64
+}
+
+type readAtCountingFile struct {
+	File
+	fs *readAtCountingFs
+}
+
+func (f readAtCountingFile) ReadAt(p []byte, off int64) (int, error) {
+	atomic.AddInt64(&f.fs.readAts, 1)
+	return f.File.ReadAt(p, off)
+}
+
+func (fs *readAtCountingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := fs.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return readAtCountingFile{File: f, fs: fs}, nil
+}
+
+func TestBlockCache(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	base := &readAtCountingFs{Fs: NewMemMapFsWithClock(clock)}
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	if err := WriteFile(base, "/file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewBlockCache(1000, 5000)
+	fs := NewBlockCacheFs(base, cache)
+
+	// The handles share the blocks
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := fs.Open("/file.bin")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer f.Close()
+			buf := make([]byte, 1500)
+			if _, err := f.ReadAt(buf, 500); err != nil || !bytes.Equal(buf, content[500:2000]) {
+				t.Errorf("error reading at 500: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if base.readAts != 2 {
+		t.Fatalf("was expecting 2 blocks read, got %d", base.readAts)
+	}
+
+	f, err := fs.Open("/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 100)
+	n, err := f.ReadAt(buf, 9950)
+	if err != io.EOF || n != 50 || !bytes.Equal(buf[:n], content[9950:]) {
+		t.Fatalf("was expecting the last 50 bytes and io.EOF, got %d, %v", n, err)
+	}
+	_ = f.Close()
+
+	// The blocks of a file rewritten are not served anymore
+	clock.Advance(time.Second)
+	if err := WriteFile(base, "/file.bin", bytes.Repeat([]byte{1}, 10000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.Open("/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadAt(buf, 500); err != nil || buf[0] != 1 {
+		t.Fatalf("was expecting the new content, got %v", err)
+	}
+	_ = f.Close()
+
+	if cache.Size() > 5000 {
+		t.Fatalf("was expecting the cache to stay under 5000 bytes, got %d", cache.Size())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"time"
 )
 
 type BufferFile struct {
@@ -11,6 +12,12 @@ type BufferFile struct {
 	Base    File
 	Buffer  File
 	Flag    int
+	// The modification time to restore on close, if any, to name of baseFs
+	baseFs Fs
+	name   string
+	mtime  time.Time
+	// The counters of the BufferFs, if any
+	bandwidth *bandwidth
 }
 
 func NewBufferFile(base File, buffer File, flag int, layerFs Fs) File {
@@ -33,22 +40,60 @@ func (f *BufferFile) Close() error {
 		return fmt.Errorf("error closing base file: %v", err)
 	}
 	_ = f.LayerFs.Remove(f.Buffer.Name())
+	if !f.mtime.IsZero() {
+		// Not all the filesystems can set the times
+		_ = f.baseFs.Chtimes(f.name, f.mtime, f.mtime)
+	}
 	return nil
 }
 
 func (f *BufferFile) Read(b []byte) (int, error) {
-	return f.Buffer.Read(b)
+	n, err := f.Buffer.Read(b)
+	f.bandwidth.addFromCache(int64(n))
+	return n, err
 }
 
+// ReadAt reads len(b) bytes, fewer only at the end of the file, the read
+// then returning io.EOF, as os.File does, whatever the reads of the buffer
+// file return.
 func (f *BufferFile) ReadAt(b []byte, o int64) (int, error) {
-	return f.Buffer.Read(b)
+	n := 0
+	for n < len(b) {
+		m, err := f.Buffer.ReadAt(b[n:], o+int64(n))
+		f.bandwidth.addFromCache(int64(m))
+		n += m
+		if err != nil {
+			return n, err
+		}
+		if m == 0 {
+			return n, io.ErrNoProgress
+		}
+	}
+	return n, nil
 }
 
 func (f *BufferFile) Seek(o int64, w int) (int64, error) {
 	return f.Buffer.Seek(o, w)
 }
 
+// writable returns an error if the file was not opened for writing.
+func (f *BufferFile) writable(op string) error {
+	if f.Flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &os.PathError{Op: op, Path: f.Name(), Err: ErrReadOnlyHandle}
+	}
+	return nil
+}
+
 func (f *BufferFile) Write(b []byte) (int, error) {
+	if err := f.writable("write"); err != nil {
+		return 0, err
+	}
+	// The buffer file is created without O_APPEND, to be filled
+	if f.Flag&os.O_APPEND != 0 {
+		if _, err := f.Buffer.Seek(0, io.SeekEnd); err != nil {
+			return 0, err
+		}
+	}
 	n, err := f.Buffer.Write(b)
 	if err != nil {
 		return 0, err
@@ -58,6 +103,9 @@ func (f *BufferFile) Write(b []byte) (int, error) {
 }
 
 func (f *BufferFile) WriteAt(b []byte, o int64) (int, error) {
+	if err := f.writable("write"); err != nil {
+		return 0, err
+	}
 	n, err := f.Buffer.WriteAt(b, o)
 	if err != nil {
 		return 0, err
@@ -78,12 +126,31 @@ func (f *BufferFile) Readdirnames(c int) ([]string, error) {
 	return f.Base.Readdirnames(c)
 }
 
+// sizedFileInfo is a FileInfo with another size, such as the size of the
+// buffer of a base file.
+type sizedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (i sizedFileInfo) Size() int64 {
+	return i.size
+}
+
 func (f *BufferFile) Stat() (os.FileInfo, error) {
-	return f.Buffer.Stat()
+	info, err := f.Base.Stat()
+	if err != nil {
+		return nil, err
+	}
+	binfo, err := f.Buffer.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sizedFileInfo{FileInfo: info, size: binfo.Size()}, nil
 }
 
 func (f *BufferFile) Sync() error {
-	if f.Flag == os.O_RDONLY {
+	if f.Flag&(os.O_WRONLY|os.O_RDWR) == 0 {
 		return nil
 	}
 	if err := f.Base.Truncate(0); err != nil {
@@ -99,7 +166,9 @@ func (f *BufferFile) Sync() error {
 	if _, err := f.Buffer.Seek(0, 0); err != nil {
 		return fmt.Errorf("error seeking buffer file to start: %v", err)
 	}
-	if _, err := io.Copy(f.Base, f.Buffer); err != nil {
+	n, err := io.Copy(f.Base, f.Buffer)
+	f.bandwidth.addToBase(n)
+	if err != nil {
 		return fmt.Errorf("error copying buffer to base file: %v", err)
 	}
 	if _, err := f.Buffer.Seek(idx, 0); err != nil {
@@ -112,11 +181,14 @@ func (f *BufferFile) Sync() error {
 }
 
 func (f *BufferFile) Truncate(s int64) error {
+	if err := f.writable("truncate"); err != nil {
+		return err
+	}
 	return f.Buffer.Truncate(s)
 }
 
 func (f *BufferFile) WriteString(s string) (int, error) {
-	return f.Buffer.Write([]byte(s))
+	return f.Write([]byte(s))
 }
 
 func (f *BufferFile) CanMmap() bool {
@@ -4,21 +4,36 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 )
 
+var _ Lstater = (*BufferFs)(nil)
+
 type BufferFs struct {
-	base  Fs
-	layer Fs
+	base      Fs
+	layer     Fs
+	bandwidth *bandwidth
+	// Whether the files written keep their modification time
+	preserveTimes bool
 }
 
 func NewBufferFs(base Fs, layer Fs) Fs {
 	return &BufferFs{
-		base:  base,
-		layer: layer,
+		base:      base,
+		layer:     layer,
+		bandwidth: &bandwidth{},
 	}
 }
 
+// SetPreserveTimes makes the files written through the BufferFs keep the
+// modification time they had before being opened, when the base can set
+// it. Otherwise the files get the modification time the base gives them on
+// close.
+func (u *BufferFs) SetPreserveTimes(preserve bool) {
+	u.preserveTimes = preserve
+}
+
 func (u *BufferFs) Chtimes(name string, atime, mtime time.Time) error {
 	exists, err := Exists(u.layer, name)
 	if err != nil {
@@ -44,97 +59,129 @@ func (u *BufferFs) Chmod(name string, mode os.FileMode) error {
 }
 
 func (u *BufferFs) Stat(name string) (os.FileInfo, error) {
-	exists, err := Exists(u.layer, name)
-	if err != nil {
-		return nil, err
+	info, err := u.base.Stat(name)
+	if err != nil || info.IsDir() {
+		return info, err
 	}
-	if exists {
-		return u.layer.Stat(name)
-	} else {
-		return u.base.Stat(name)
+	// The file may be open, with its content in a buffer of the layer
+	if binfo, err := u.layer.Stat(name); err == nil && !binfo.IsDir() {
+		return sizedFileInfo{FileInfo: info, size: binfo.Size()}, nil
 	}
+	return info, nil
+}
+
+// LstatIfPossible lstats the base if it can, the size of the regular files
+// open being that of their buffer, as for Stat.
+func (u *BufferFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lsf, ok := u.base.(Lstater)
+	if !ok {
+		info, err := u.Stat(name)
+		return info, false, err
+	}
+	info, lstat, err := lsf.LstatIfPossible(name)
+	if err != nil || !info.Mode().IsRegular() {
+		return info, lstat, err
+	}
+	if binfo, err := u.layer.Stat(name); err == nil && !binfo.IsDir() {
+		return sizedFileInfo{FileInfo: info, size: binfo.Size()}, lstat, nil
+	}
+	return info, lstat, nil
 }
 
 func (u *BufferFs) Rename(oldname, newname string) error {
+	if err := u.base.Rename(oldname, newname); err != nil {
+		return err
+	}
+	// The layer follows the base, whatever it held at newname is replaced
+	if err := u.layer.RemoveAll(newname); err != nil {
+		return err
+	}
 	exists, err := Exists(u.layer, oldname)
 	if err != nil {
 		return err
 	}
 	if exists {
-		if err := u.layer.Rename(oldname, newname); err != nil {
+		if err := u.layer.MkdirAll(filepath.Dir(newname), 0777); err != nil {
 			return err
 		}
+		return u.layer.Rename(oldname, newname)
 	}
-	return u.base.Rename(oldname, newname)
+	return nil
 }
 
 func (u *BufferFs) Remove(name string) error {
-	// It can exist in layer and base at the same time
-	exists, err := Exists(u.layer, name)
-	if err != nil {
+	if err := u.base.Remove(name); err != nil {
 		return err
 	}
-	if exists {
-		if err := u.layer.Remove(name); err != nil {
-			return err
-		}
-	}
-	return u.base.Remove(name)
+	// It can exist in layer and base at the same time
+	return u.layer.RemoveAll(name)
 }
 
 func (u *BufferFs) RemoveAll(name string) error {
-	// It can exist in layer and base at the same time
-	err1 := u.layer.RemoveAll(name)
-	err2 := u.base.RemoveAll(name)
-	if err1 != nil || err2 != nil {
-		return fmt.Errorf("layer error: %v, base error: %v", err1, err2)
-	} else {
-		return nil
+	// It can exist in layer and base at the same time, the base holding
+	// the actual content
+	if err := u.base.RemoveAll(name); err != nil {
+		return err
 	}
+	return u.layer.RemoveAll(name)
 }
 
 func (u *BufferFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
-	// Open file in base, open a buffer file in layer, return a buffer file
-	baseFile, err := u.base.OpenFile(name, os.O_RDWR|os.O_CREATE, perm)
+	// Open file in base, open a buffer file in layer, return a buffer file.
+	// The base file is read to fill the buffer, and rewritten entirely on
+	// sync, so O_APPEND only applies to the buffer.
+	baseFlag := flag &^ os.O_APPEND
+	var mtime time.Time
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		baseFlag = baseFlag&^os.O_WRONLY | os.O_RDWR
+		if u.preserveTimes {
+			// Stated before the file is truncated
+			if info, err := u.base.Stat(name); err == nil && !info.IsDir() {
+				mtime = info.ModTime()
+			}
+		}
+	}
+	baseFile, err := u.base.OpenFile(name, baseFlag, perm)
 	if err != nil {
 		return nil, err
 	}
+	if info, err := baseFile.Stat(); err == nil && info.IsDir() {
+		return baseFile, nil
+	}
 
 	// copy base file content in a new layer file
+	if err := u.layer.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		_ = baseFile.Close()
+		return nil, fmt.Errorf("error creating buffer directory on layer: %v", err)
+	}
 	layerFile, err := u.layer.Create(name)
 	if err != nil {
+		_ = baseFile.Close()
 		return nil, fmt.Errorf("error opening a buffer file on layer: %v", err)
 	}
 	// Read from base and copy to layer
-	if _, err := io.Copy(layerFile, baseFile); err != nil {
+	n, err := io.Copy(layerFile, baseFile)
+	u.bandwidth.addFromBase(n)
+	if err != nil {
+		_ = baseFile.Close()
+		_ = layerFile.Close()
 		return nil, fmt.Errorf("error reading base file content: %v", err)
 	}
-	if _, err := layerFile.Seek(0, 0); err != nil {
+	whence := io.SeekStart
+	if flag&os.O_APPEND != 0 {
+		whence = io.SeekEnd
+	}
+	if _, err := layerFile.Seek(0, whence); err != nil {
+		_ = baseFile.Close()
+		_ = layerFile.Close()
 		return nil, fmt.Errorf("error seeking buffer file: %v", err)
 	}
 
-	return NewBufferFile(baseFile, layerFile, flag, u.layer), nil
+	return &BufferFile{LayerFs: u.layer, Base: baseFile, Buffer: layerFile, Flag: flag, baseFs: u.base, name: name, mtime: mtime, bandwidth: u.bandwidth}, nil
 }
 
 func (u *BufferFs) Open(name string) (File, error) {
-	baseFile, err := u.base.Open(name)
-	if err != nil {
-		return nil, err
-	}
-	// copy base file content in a new layer file
-	layerFile, err := u.layer.Create(name)
-	if err != nil {
-		return nil, fmt.Errorf("error opening a buffer file on layer: %v", err)
-	}
-	// Read from base and copy to layer
-	if _, err := io.Copy(layerFile, baseFile); err != nil {
-		return nil, fmt.Errorf("error reading base file content: %v", err)
-	}
-	if _, err := layerFile.Seek(0, 0); err != nil {
-		return nil, fmt.Errorf("error seeking buffer file: %v", err)
-	}
-
-	return NewBufferFile(baseFile, layerFile, os.O_RDONLY, u.layer), nil
+	return u.OpenFile(name, os.O_RDONLY, 0)
 }
 
 func (u *BufferFs) Mkdir(name string, perm os.FileMode) error {
@@ -145,10 +192,21 @@ func (u *BufferFs) Mkdir(name string, perm os.FileMode) error {
 	return u.layer.MkdirAll(name, perm) // yes, MkdirAll... we cannot assume it exists in the cache
 }
 
+// Bandwidth returns the bytes read from the buffers, fetched from the base
+// to fill them, and written back to the base.
+func (u *BufferFs) Bandwidth() Bandwidth {
+	return u.bandwidth.get()
+}
+
 func (u *BufferFs) Name() string {
 	return "BufferFs"
 }
 
+// Unwrap returns the base filesystem, the layer being only a buffer.
+func (u *BufferFs) Unwrap() Fs {
+	return u.base
+}
+
 func (u *BufferFs) MkdirAll(name string, perm os.FileMode) error {
 	err := u.base.MkdirAll(name, perm)
 	if err != nil {
@@ -158,19 +216,5 @@ func (u *BufferFs) MkdirAll(name string, perm os.FileMode) error {
 }
 
 func (u *BufferFs) Create(name string) (File, error) {
-	baseFile, err := u.base.Create(name)
-	if err != nil {
-		return nil, err
-	}
-	layerFile, err := u.layer.Create(name)
-	if err != nil {
-		// oops, see comment about OS_TRUNC above, should we remove? then we have to
-		// remember if the file did not exist before
-		_ = baseFile.Close()
-		return nil, err
-	}
-	return &BufferFile{
-		LayerFs: u.layer,
-		Base:    baseFile,
-		Buffer:  layerFile}, nil
+	return u.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 }
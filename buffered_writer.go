@@ -0,0 +1,94 @@
+package kafero
+
+import (
+	"bufio"
+	"os"
+)
+
+// BufferedWriterFile coalesces the small writes to a file into writes of
+// up to size bytes, for backends with a high cost per write. The buffered
+// data is written on Flush, Sync and Close, and before any other
+// operation on the file.
+type BufferedWriterFile struct {
+	File
+	w *bufio.Writer
+}
+
+func NewBufferedWriterFile(f File, size int) *BufferedWriterFile {
+	return &BufferedWriterFile{File: f, w: bufio.NewWriterSize(f, size)}
+}
+
+// Flush writes the buffered data to the file.
+func (f *BufferedWriterFile) Flush() error {
+	return f.w.Flush()
+}
+
+// Buffered returns the number of bytes not yet written to the file.
+func (f *BufferedWriterFile) Buffered() int {
+	return f.w.Buffered()
+}
+
+func (f *BufferedWriterFile) Write(p []byte) (int, error) {
+	return f.w.Write(p)
+}
+
+func (f *BufferedWriterFile) WriteString(s string) (int, error) {
+	return f.w.WriteString(s)
+}
+
+func (f *BufferedWriterFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *BufferedWriterFile) Read(p []byte) (int, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *BufferedWriterFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *BufferedWriterFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.w.Flush(); err != nil {
+		return 0, err
+	}
+	return f.File.Seek(offset, whence)
+}
+
+func (f *BufferedWriterFile) Stat() (os.FileInfo, error) {
+	if err := f.w.Flush(); err != nil {
+		return nil, err
+	}
+	return f.File.Stat()
+}
+
+func (f *BufferedWriterFile) Truncate(size int64) error {
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	return f.File.Truncate(size)
+}
+
+func (f *BufferedWriterFile) Sync() error {
+	if err := f.w.Flush(); err != nil {
+		return err
+	}
+	return f.File.Sync()
+}
+
+func (f *BufferedWriterFile) Close() error {
+	ferr := f.w.Flush()
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return ferr
+}
@@ -0,0 +1,53 @@
+package kafero
+
+import (
+	"fmt"
+	"testing"
+)
+
+// countingWriteFile counts the calls to Write.
+type countingWriteFile struct {
+	File
+	writes int
+}
+
+func (c *countingWriteFile) Write(p []byte) (int, error) {
+	c.writes++
+	return c.File.Write(p)
+}
+
+func TestBufferedWriterFile(t *testing.T) {
+	fs := NewMemMapFs()
+	f, err := fs.Create("/records.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingWriteFile{File: f}
+	bf := NewBufferedWriterFile(counting, 1000)
+
+	var expected string
+	for i := 0; i < 100; i++ {
+		record := fmt.Sprintf("record %02d\n", i)
+		expected += record
+		if _, err := bf.WriteString(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bf.Buffered() == 0 {
+		t.Fatal("was expecting buffered data")
+	}
+	// Stat sees the buffered data
+	if info, err := bf.Stat(); err != nil || info.Size() != int64(len(expected)) {
+		t.Fatalf("was expecting size %d, got %v", len(expected), err)
+	}
+	if err := bf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if counting.writes != 1 {
+		t.Fatalf("was expecting a single write, got %d", counting.writes)
+	}
+	data, err := ReadFile(fs, "/records.txt")
+	if err != nil || string(data) != expected {
+		t.Fatalf("error reading records: %v", err)
+	}
+}
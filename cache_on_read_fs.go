@@ -4,6 +4,8 @@ import (
 	"os"
 	"syscall"
 	"time"
+
+	"github.com/golang/groupcache/singleflight"
 )
 
 // If the cache duration is 0, cache time will be unlimited, i.e. once
@@ -23,12 +25,28 @@ type CacheOnReadFs struct {
 	base      Fs
 	layer     Fs
 	cacheTime time.Duration
+	fill      singleflight.Group
+	refresher *refresher
+	// The CacheOnReadFs a view bound to a context was made of, sharing
+	// its fills
+	origin *CacheOnReadFs
 }
 
 func NewCacheOnReadFs(base Fs, layer Fs, cacheTime time.Duration) Fs {
 	return &CacheOnReadFs{base: base, layer: layer, cacheTime: cacheTime}
 }
 
+// SetStaleWhileRevalidate makes the CacheOnReadFs serve the stale cached
+// files immediately, refreshing them from the base in the background, at
+// most concurrency at a time, instead of refreshing them before opening
+// them. The files are served stale until refreshed, the refreshes beyond
+// concurrency being retried on the next opens. A concurrency of 0 restores
+// the refresh before opening. It must be called before the CacheOnReadFs
+// is used.
+func (u *CacheOnReadFs) SetStaleWhileRevalidate(concurrency int) {
+	u.refresher = newRefresher(concurrency)
+}
+
 type cacheState int
 
 const (
@@ -72,8 +90,17 @@ func (u *CacheOnReadFs) cacheStatus(name string) (state cacheState, fi os.FileIn
 	return cacheMiss, nil, err
 }
 
+// copyToLayer copies name from the base once, however many goroutines are
+// asking for it concurrently.
 func (u *CacheOnReadFs) copyToLayer(name string) error {
-	return copyToLayer(u.base, u.layer, name)
+	fill := &u.fill
+	if u.origin != nil {
+		fill = &u.origin.fill
+	}
+	_, err := fill.Do(name, func() (interface{}, error) {
+		return nil, copyToLayer(u.base, u.layer, name)
+	})
+	return err
 }
 
 func (u *CacheOnReadFs) Chtimes(name string, atime, mtime time.Time) error {
@@ -212,7 +239,7 @@ func (u *CacheOnReadFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 			bfi.Close() // oops, what if O_TRUNC was set and file opening in the layer failed...?
 			return nil, err
 		}
-		return &UnionFile{Base: bfi, Layer: lfi}, nil
+		return &cacheOnReadFile{UnionFile: &UnionFile{Base: bfi, Layer: lfi}, fs: u, name: name}, nil
 	} else {
 		return u.layer.OpenFile(name, flag, perm)
 	}
@@ -243,6 +270,13 @@ func (u *CacheOnReadFs) Open(name string) (File, error) {
 
 	case cacheStale:
 		if !fi.IsDir() {
+			if u.refresher != nil {
+				u.refresher.refresh(name, func() {
+					// Retried on the next open if it fails
+					_ = refreshLayer(u.base, u.layer, name)
+				})
+				return u.layer.Open(name)
+			}
 			if err := u.copyToLayer(name); err != nil {
 				return nil, err
 			}
@@ -274,6 +308,12 @@ func (u *CacheOnReadFs) Name() string {
 	return "CacheOnReadFs"
 }
 
+// Unwrap returns the base filesystem, the layer holding only copies of
+// its files.
+func (u *CacheOnReadFs) Unwrap() Fs {
+	return u.base
+}
+
 func (u *CacheOnReadFs) MkdirAll(name string, perm os.FileMode) error {
 	err := u.base.MkdirAll(name, perm)
 	if err != nil {
@@ -294,5 +334,43 @@ func (u *CacheOnReadFs) Create(name string) (File, error) {
 		bfh.Close()
 		return nil, err
 	}
-	return &UnionFile{Base: bfh, Layer: lfh}, nil
+	return &cacheOnReadFile{UnionFile: &UnionFile{Base: bfh, Layer: lfh}, fs: u, name: name}, nil
+}
+
+// cacheOnReadFile is a file written to both the base and the layer, the
+// layer file getting the modification time of the base file once closed,
+// as when copied to the layer.
+type cacheOnReadFile struct {
+	*UnionFile
+	fs   *CacheOnReadFs
+	name string
+}
+
+func (f *cacheOnReadFile) Close() error {
+	if err := f.UnionFile.Close(); err != nil {
+		return err
+	}
+	if bfi, err := f.fs.base.Stat(f.name); err == nil {
+		// Not all the filesystems can set the times
+		_ = f.fs.layer.Chtimes(f.name, bfi.ModTime(), bfi.ModTime())
+	}
+	return nil
+}
+
+// The extended attributes are those of the base file.
+
+func (u *CacheOnReadFs) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(u.base, name, attr)
+}
+
+func (u *CacheOnReadFs) Setxattr(name, attr string, value []byte) error {
+	return Setxattr(u.base, name, attr, value)
+}
+
+func (u *CacheOnReadFs) Listxattr(name string) ([]string, error) {
+	return Listxattr(u.base, name)
+}
+
+func (u *CacheOnReadFs) Removexattr(name, attr string) error {
+	return Removexattr(u.base, name, attr)
 }
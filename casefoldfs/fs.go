@@ -0,0 +1,233 @@
+package casefoldfs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melaurent/kafero"
+	"golang.org/x/text/cases"
+)
+
+// dirIndex maps the names of the entries of a directory, and their folded
+// version, to the stored names.
+type dirIndex struct {
+	names  map[string]bool
+	folded map[string]string
+}
+
+// The Fs makes its base case insensitive: every component of a requested
+// path is mapped to the stored entry with the same case folding. An exact
+// match is preferred when several stored entries fold to the same name.
+// New files and directories are created with the requested case.
+//
+// The directory listings are indexed, so changes made to the base
+// directly are only picked up when a lookup misses.
+type Fs struct {
+	*state
+	base kafero.Fs
+}
+
+// state is the state of a Fs, shared with its views bound to contexts.
+type state struct {
+	caser  cases.Caser
+	caserL sync.Mutex
+	mu     sync.Mutex
+	index  map[string]*dirIndex
+}
+
+func NewFs(base kafero.Fs) *Fs {
+	return &Fs{
+		state: &state{
+			caser: cases.Fold(),
+			index: make(map[string]*dirIndex),
+		},
+		base: base,
+	}
+}
+
+func (c *Fs) fold(s string) string {
+	// Casers are not safe for concurrent use
+	c.caserL.Lock()
+	defer c.caserL.Unlock()
+	return c.caser.String(s)
+}
+
+func (c *Fs) loadIndex(dir string) *dirIndex {
+	idx := &dirIndex{names: make(map[string]bool), folded: make(map[string]string)}
+	names, err := kafero.ReadDirNames(c.base, dir)
+	if err != nil {
+		return idx
+	}
+	// Names are sorted, keep the first one of each fold
+	for _, n := range names {
+		idx.names[n] = true
+		f := c.fold(n)
+		if _, ok := idx.folded[f]; !ok {
+			idx.folded[f] = n
+		}
+	}
+	return idx
+}
+
+// lookup returns the stored name of the entry of dir matching name.
+func (c *Fs) lookup(dir, name string) (string, bool) {
+	c.mu.Lock()
+	idx, ok := c.index[dir]
+	c.mu.Unlock()
+	if ok {
+		if stored, ok := idx.match(c, name); ok {
+			return stored, true
+		}
+	}
+	// The directory may have changed in the base
+	idx = c.loadIndex(dir)
+	c.mu.Lock()
+	c.index[dir] = idx
+	c.mu.Unlock()
+	return idx.match(c, name)
+}
+
+func (idx *dirIndex) match(c *Fs, name string) (string, bool) {
+	if idx.names[name] {
+		return name, true
+	}
+	stored, ok := idx.folded[c.fold(name)]
+	return stored, ok
+}
+
+// resolve maps name to the stored path. The components without stored
+// match are kept as requested.
+func (c *Fs) resolve(name string) string {
+	name = filepath.Clean(name)
+	var dir string
+	rest := name
+	if filepath.IsAbs(name) {
+		dir = string(filepath.Separator)
+		rest = strings.TrimPrefix(name, dir)
+	} else {
+		dir = "."
+	}
+	if rest == "" || rest == "." {
+		return name
+	}
+	parts := strings.Split(rest, string(filepath.Separator))
+	for i, part := range parts {
+		stored, ok := c.lookup(dir, part)
+		if !ok {
+			return filepath.Join(append([]string{dir}, parts[i:]...)...)
+		}
+		dir = filepath.Join(dir, stored)
+	}
+	return dir
+}
+
+// invalidate drops the index of the parent of name, and the indexes of
+// name and its children.
+func (c *Fs) invalidate(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.index, filepath.Dir(name))
+	prefix := name + string(filepath.Separator)
+	for dir := range c.index {
+		if dir == name || strings.HasPrefix(dir, prefix) {
+			delete(c.index, dir)
+		}
+	}
+}
+
+func (c *Fs) Name() string {
+	return "CaseFoldFs"
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (c *Fs) Unwrap() kafero.Fs {
+	return c.base
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (c *Fs) WithContext(ctx context.Context) kafero.Fs {
+	return &Fs{state: c.state, base: kafero.WithContext(c.base, ctx)}
+}
+
+func (c *Fs) Create(name string) (kafero.File, error) {
+	name = c.resolve(name)
+	f, err := c.base.Create(name)
+	c.invalidate(name)
+	return f, err
+}
+
+func (c *Fs) Mkdir(name string, perm os.FileMode) error {
+	name = c.resolve(name)
+	err := c.base.Mkdir(name, perm)
+	c.invalidate(name)
+	return err
+}
+
+func (c *Fs) MkdirAll(path string, perm os.FileMode) error {
+	path = c.resolve(path)
+	err := c.base.MkdirAll(path, perm)
+	// Any of the parents may have been created
+	c.mu.Lock()
+	c.index = make(map[string]*dirIndex)
+	c.mu.Unlock()
+	return err
+}
+
+func (c *Fs) Open(name string) (kafero.File, error) {
+	return c.base.Open(c.resolve(name))
+}
+
+func (c *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	name = c.resolve(name)
+	f, err := c.base.OpenFile(name, flag, perm)
+	if flag&os.O_CREATE != 0 {
+		c.invalidate(name)
+	}
+	return f, err
+}
+
+func (c *Fs) Remove(name string) error {
+	name = c.resolve(name)
+	err := c.base.Remove(name)
+	c.invalidate(name)
+	return err
+}
+
+func (c *Fs) RemoveAll(path string) error {
+	path = c.resolve(path)
+	err := c.base.RemoveAll(path)
+	c.invalidate(path)
+	return err
+}
+
+func (c *Fs) Rename(oldname, newname string) error {
+	requested := newname
+	oldname = c.resolve(oldname)
+	newname = c.resolve(newname)
+	if newname == oldname {
+		// Renaming to a different case of the same name
+		newname = filepath.Join(filepath.Dir(oldname), filepath.Base(requested))
+	}
+	err := c.base.Rename(oldname, newname)
+	c.invalidate(oldname)
+	c.invalidate(newname)
+	return err
+}
+
+func (c *Fs) Stat(name string) (os.FileInfo, error) {
+	return c.base.Stat(c.resolve(name))
+}
+
+func (c *Fs) Chmod(name string, mode os.FileMode) error {
+	return c.base.Chmod(c.resolve(name), mode)
+}
+
+func (c *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return c.base.Chtimes(c.resolve(name), atime, mtime)
+}
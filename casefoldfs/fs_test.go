@@ -0,0 +1,60 @@
+package casefoldfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestCaseFold(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	if err := base.MkdirAll("/Data/Raw", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(base, "/Data/Raw/File.TXT", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewFs(base)
+
+	data, err := kafero.ReadFile(fs, "/data/RAW/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "content" {
+		t.Fatalf("was expecting content, got %s", data)
+	}
+
+	// New files are created in the existing directories, with the requested case
+	if err := kafero.WriteFile(fs, "/DATA/raw/New.txt", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat("/Data/Raw/New.txt"); err != nil {
+		t.Fatalf("was expecting /Data/Raw/New.txt in the base: %v", err)
+	}
+	if _, err := fs.Stat("/data/raw/NEW.TXT"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files added to the base directly are found
+	if err := kafero.WriteFile(base, "/Data/Raw/Other.txt", []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/data/raw/other.TXT"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Rename("/data/raw/file.txt", "/data/raw/FILE.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat("/Data/Raw/FILE.txt"); err != nil {
+		t.Fatalf("was expecting /Data/Raw/FILE.txt in the base: %v", err)
+	}
+
+	if err := fs.Remove("/data/raw/file.TXT"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("/data/raw/file.txt"); !os.IsNotExist(err) {
+		t.Fatalf("was expecting a not exist error, got %v", err)
+	}
+}
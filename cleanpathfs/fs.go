@@ -0,0 +1,167 @@
+package cleanpathfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// ErrUncleanPath is returned for the paths the Fs refuses to delegate.
+var ErrUncleanPath = errors.New("path is not clean")
+
+// The Fs cleans the paths before delegating to its base, so all the
+// backends see the same canonical path whatever the spelling used, e.g.
+// "./a//b/" becomes "a/b". Paths escaping their root with ".." are always
+// rejected.
+//
+// In strict mode, the paths are not normalized but rejected unless
+// already clean.
+type Fs struct {
+	base   kafero.Fs
+	strict bool
+}
+
+// NewFs returns an Fs normalizing the paths.
+func NewFs(base kafero.Fs) *Fs {
+	return &Fs{base: base}
+}
+
+// NewStrictFs returns an Fs rejecting the paths which are not clean.
+func NewStrictFs(base kafero.Fs) *Fs {
+	return &Fs{base: base, strict: true}
+}
+
+func hasDotDot(name string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// Clean returns the path delegated to the base for name.
+func (c *Fs) Clean(name string) (string, error) {
+	clean := filepath.Clean(name)
+	if c.strict && (clean != name || hasDotDot(name)) {
+		return name, ErrUncleanPath
+	}
+	if hasDotDot(clean) {
+		// Going above the root of a relative path
+		return name, ErrUncleanPath
+	}
+	return clean, nil
+}
+
+func (c *Fs) Name() string {
+	return "CleanPathFs"
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (c *Fs) Unwrap() kafero.Fs {
+	return c.base
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (c *Fs) WithContext(ctx context.Context) kafero.Fs {
+	return &Fs{base: kafero.WithContext(c.base, ctx), strict: c.strict}
+}
+
+func (c *Fs) Create(name string) (kafero.File, error) {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "create", Path: name, Err: err}
+	}
+	return c.base.Create(clean)
+}
+
+func (c *Fs) Mkdir(name string, perm os.FileMode) error {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+	return c.base.Mkdir(clean, perm)
+}
+
+func (c *Fs) MkdirAll(path string, perm os.FileMode) error {
+	clean, err := c.Clean(path)
+	if err != nil {
+		return &os.PathError{Op: "mkdir", Path: path, Err: err}
+	}
+	return c.base.MkdirAll(clean, perm)
+}
+
+func (c *Fs) Open(name string) (kafero.File, error) {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return c.base.Open(clean)
+}
+
+func (c *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "openfile", Path: name, Err: err}
+	}
+	return c.base.OpenFile(clean, flag, perm)
+}
+
+func (c *Fs) Remove(name string) error {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: name, Err: err}
+	}
+	return c.base.Remove(clean)
+}
+
+func (c *Fs) RemoveAll(path string) error {
+	clean, err := c.Clean(path)
+	if err != nil {
+		return &os.PathError{Op: "remove", Path: path, Err: err}
+	}
+	return c.base.RemoveAll(clean)
+}
+
+func (c *Fs) Rename(oldname, newname string) error {
+	oldclean, err := c.Clean(oldname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	newclean, err := c.Clean(newname)
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+	return c.base.Rename(oldclean, newclean)
+}
+
+func (c *Fs) Stat(name string) (os.FileInfo, error) {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return c.base.Stat(clean)
+}
+
+func (c *Fs) Chmod(name string, mode os.FileMode) error {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return &os.PathError{Op: "chmod", Path: name, Err: err}
+	}
+	return c.base.Chmod(clean, mode)
+}
+
+func (c *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	clean, err := c.Clean(name)
+	if err != nil {
+		return &os.PathError{Op: "chtimes", Path: name, Err: err}
+	}
+	return c.base.Chtimes(clean, atime, mtime)
+}
@@ -0,0 +1,51 @@
+package cleanpathfs
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestClean(t *testing.T) {
+	fs := NewFs(kafero.NewMemMapFs())
+	strict := NewStrictFs(kafero.NewMemMapFs())
+
+	tests := []struct {
+		name      string
+		clean     string
+		unclean   bool
+		rejection bool
+	}{
+		{"a/b", "a/b", false, false},
+		{"/a/b", "/a/b", false, false},
+		{"./a//b/", "a/b", true, false},
+		{"a/../b", "b", true, false},
+		{"/../a", "/a", true, false},
+		{"../a", "", true, true},
+		{"a/../../b", "", true, true},
+	}
+	for _, test := range tests {
+		clean, err := fs.Clean(test.name)
+		if test.rejection {
+			if !errors.Is(err, ErrUncleanPath) {
+				t.Errorf("was expecting %s to be rejected, got %v", test.name, err)
+			}
+		} else if err != nil || clean != test.clean {
+			t.Errorf("was expecting %s to be cleaned to %s, got %s, %v", test.name, test.clean, clean, err)
+		}
+		if _, err := strict.Clean(test.name); errors.Is(err, ErrUncleanPath) != test.unclean {
+			t.Errorf("strict mode: was expecting rejection %v for %s, got %v", test.unclean, test.name, err)
+		}
+	}
+
+	if err := kafero.WriteFile(fs, "./dir//file.txt", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("dir/file.txt/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strict.Stat("dir/file.txt/"); !errors.Is(err, ErrUncleanPath) {
+		t.Fatalf("was expecting an unclean path error, got %v", err)
+	}
+}
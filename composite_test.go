@@ -2,10 +2,13 @@ package kafero
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -368,6 +371,37 @@ func TestUnionCacheExpire(t *testing.T) {
 	}
 }
 
+func TestCacheOnReadFsConcurrentFill(t *testing.T) {
+	base := &countingOpenFs{Fs: NewMemMapFs()}
+	if err := WriteFile(base, "/file.txt", []byte("This is a test"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The views bound to contexts share the fills of their CacheOnReadFs
+	ufs := &CacheOnReadFs{base: base, layer: NewMemMapFs()}
+	view := ufs.WithContext(context.Background())
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		fs := Fs(ufs)
+		if i%2 == 1 {
+			fs = view
+		}
+		go func() {
+			defer wg.Done()
+			data, err := ReadFile(fs, "/file.txt")
+			if err != nil || string(data) != "This is a test" {
+				t.Errorf("error reading file: %q, %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if opens := atomic.LoadInt32(&base.opens); opens != 1 {
+		t.Fatalf("was expecting a single base open, got %d", opens)
+	}
+}
+
 func TestCacheOnReadFsNotInLayer(t *testing.T) {
 	base := NewMemMapFs()
 	layer := NewMemMapFs()
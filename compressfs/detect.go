@@ -0,0 +1,68 @@
+package compressfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A Detector is a Codec recognizing its compressed streams from their first
+// bytes, for AutoDetect.
+type Detector interface {
+	// Detect returns whether head, the first bytes of a file, up to
+	// DetectLen, are those of a stream of the codec.
+	Detect(head []byte) bool
+}
+
+// DetectLen is the number of bytes read from the start of the files to
+// detect their format.
+const DetectLen = 16
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// AutoDetect detects the format of the files read from their first bytes:
+// the files compressed with the codec of the Fs, if it is a Detector, are
+// decompressed with it, the gzip and zstd files are decompressed with gzip
+// and zstd, and the other files are read unmodified, so that a directory
+// of files written uncompressed or compressed elsewhere can be read through
+// the Fs. The files written are still compressed with the codec.
+func AutoDetect() Option {
+	return func(b *Fs) {
+		b.autoDetect = true
+	}
+}
+
+// newReader returns a reader decompressing r, detecting its format if
+// enabled.
+func (b *Fs) newReader(r io.Reader) (io.ReadCloser, error) {
+	if !b.autoDetect {
+		return b.codec.NewReader(r)
+	}
+	br := bufio.NewReader(r)
+	head, err := br.Peek(DetectLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if d, ok := b.codec.(Detector); ok && d.Detect(head) {
+		return b.codec.NewReader(br)
+	}
+	switch {
+	case bytes.HasPrefix(head, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(head, zstdMagic):
+		dec, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(br), nil
+	}
+}
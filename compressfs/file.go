@@ -0,0 +1,200 @@
+package compressfs
+
+import (
+	"github.com/melaurent/kafero"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// A File is a compressed file of a Fs.
+type File struct {
+	kafero.File
+	flag          int
+	parent        *Fs
+	reader        io.ReadCloser
+	writer        io.WriteCloser
+	readOffset    int64
+	isdir, closed bool
+	// The uncompressed size of the file written, if known
+	written   int64
+	sizeKnown bool
+	// The source file, counting the compressed bytes written
+	sink io.Writer
+}
+
+func (f *File) Close() error {
+	f.closed = true
+	if f.writer != nil {
+		start := time.Now()
+		err := f.writer.Close()
+		since(&f.parent.counters.encodeTime, start)
+		if err != nil {
+			return err
+		}
+		f.writer = nil
+		if f.sizeKnown {
+			if _, err := f.sink.Write(f.parent.footer(f.written)); err != nil {
+				return err
+			}
+		}
+	}
+	if f.reader != nil {
+		f.reader.Close()
+		f.reader = nil
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *File) Read(p []byte) (n int, err error) {
+	if f.closed {
+		return 0, kafero.ErrFileClosed
+	}
+	// Cannot read from a writer
+	if f.writer != nil {
+		return 0, syscall.EPERM
+	}
+	c := f.parent.counters
+	if f.reader == nil {
+		f.reader, err = f.parent.newReader(&countingReader{Reader: f.File, n: &c.compressedRead})
+		if err != nil {
+			return 0, err
+		}
+	}
+	start := time.Now()
+	n, err = f.reader.Read(p)
+	since(&c.decodeTime, start)
+	atomic.AddInt64(&c.rawRead, int64(n))
+	if err != nil {
+		return n, err
+	}
+	// progress
+	f.readOffset += int64(n)
+	return n, nil
+}
+
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	return 0, syscall.EPERM
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	// The size of the decompressed content is unknown
+	if whence == io.SeekEnd {
+		return 0, syscall.EPERM
+	}
+	offset, err := kafero.SeekOffset(f.Name(), f.readOffset, 0, offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	// Allow seek if it would result in a seek forward, by reading and
+	// discarding the content up to offset.
+	if offset < f.readOffset {
+		return 0, syscall.EPERM
+	}
+	if offset > f.readOffset {
+		if _, err := io.CopyN(ioutil.Discard, f, offset-f.readOffset); err != nil {
+			return 0, err
+		}
+	}
+	return f.readOffset, nil
+}
+
+func (f *File) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *File) Write(p []byte) (n int, err error) {
+	if f.flag&syscall.O_WRONLY == 0 && f.flag&syscall.O_RDWR == 0 {
+		return 0, &os.PathError{Op: "write", Path: f.Name(), Err: kafero.ErrReadOnlyHandle}
+	}
+	if f.closed {
+		return 0, kafero.ErrFileClosed
+	}
+	// Cannot write to a reader
+	if f.reader != nil {
+		return 0, syscall.EPERM
+	}
+	if f.writer == nil {
+		// Compressed content can't be rewritten in place, only replaced
+		// or appended to as a new frame
+		info, err := f.File.Stat()
+		if f.flag&(syscall.O_TRUNC|syscall.O_APPEND) == 0 {
+			if err != nil || info.Size() > 0 {
+				return 0, syscall.EPERM
+			}
+		}
+		// The frames appended continue the size of the previous ones
+		f.sizeKnown = f.flag&syscall.O_TRUNC != 0 || (err == nil && info.Size() == 0)
+		if !f.sizeKnown && err == nil {
+			f.written, f.sizeKnown = f.parent.logicalSize(f.Name(), info.Size())
+		}
+		f.sink = &countingWriter{Writer: f.File, n: &f.parent.counters.compressedWritten}
+		f.writer, err = f.parent.codec.NewWriter(f.sink)
+		if err != nil {
+			return 0, err
+		}
+	}
+	start := time.Now()
+	n, err = f.writer.Write(p)
+	since(&f.parent.counters.encodeTime, start)
+	atomic.AddInt64(&f.parent.counters.rawWritten, int64(n))
+	f.written += int64(n)
+	return n, err
+}
+
+// Stat returns the FileInfo of the file, with its uncompressed size when
+// known.
+func (f *File) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil || !fi.Mode().IsRegular() || f.writer != nil {
+		return fi, err
+	}
+	if f.flag&(syscall.O_WRONLY|syscall.O_RDWR) == syscall.O_WRONLY {
+		return f.parent.logicalInfo(f.Name(), fi), nil
+	}
+	if size, ok := f.parent.readFooter(f.File, fi.Size()); ok {
+		return &sizedInfo{FileInfo: fi, size: size}, nil
+	}
+	return fi, nil
+}
+
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	return f.parent.readdir(f.File, count)
+}
+
+func (f *File) WriteAt(p []byte, off int64) (n int, err error) {
+	return 0, syscall.EPERM
+}
+
+func (f *File) Truncate(size int64) error {
+	return syscall.EPERM
+}
+
+func (f *File) CanMmap() bool {
+	return false
+}
+
+func (f *File) Mmap(off int64, len int, prot, flags int) ([]byte, error) {
+	return nil, syscall.EPERM
+}
+
+func (f *File) Munmap() error {
+	return syscall.EPERM
+}
+
+// Flush writes the content compressed so far to the source file, if the
+// writer of the codec supports it.
+func (f *File) Flush() error {
+	if w, ok := f.writer.(interface{ Flush() error }); ok {
+		defer since(&f.parent.counters.encodeTime, time.Now())
+		return w.Flush()
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+// Package compressfs is the framework of the compression layers, such as
+// zstfs, lz4fs and snappyfs, compressing the files of a source Fs with a
+// Codec. The compressed files can't be seeked, but forward, nor written in
+// place, only replaced or appended to.
+package compressfs
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/melaurent/kafero"
+)
+
+// A Codec compresses the content of the files of a Fs.
+type Codec interface {
+	// NewWriter returns a writer compressing to w, whose Close ends the
+	// compressed stream without closing w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader decompressing r, including the streams
+	// appended one after the other.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+	// Skippable returns a frame skipped by the readers, ending with
+	// payload.
+	Skippable(payload []byte) []byte
+}
+
+// The Fs compresses its files with its codec.
+type Fs struct {
+	kafero.Fs
+	name     string
+	codec    Codec
+	patterns []string
+	counters *counters
+	// Whether the format of the files read is detected
+	autoDetect bool
+}
+
+// An Option configures a Fs.
+type Option func(b *Fs)
+
+// CompressOnly compresses only the files whose base name matches one of
+// patterns, with the syntax of filepath.Match, such as "*.bin", the other
+// files being read and written unmodified, and seekable. The malformed
+// patterns match no file.
+func CompressOnly(patterns ...string) Option {
+	return func(b *Fs) {
+		b.patterns = append(b.patterns, patterns...)
+	}
+}
+
+// NewFs returns a Fs named name compressing the files of source with
+// codec.
+func NewFs(source kafero.Fs, name string, codec Codec, opts ...Option) *Fs {
+	b := &Fs{Fs: source, name: name, codec: codec, counters: &counters{}}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// compressed returns whether the named file is compressed.
+func (b *Fs) compressed(name string) bool {
+	if b.patterns == nil {
+		return true
+	}
+	base := filepath.Base(name)
+	for _, pattern := range b.patterns {
+		if ok, _ := filepath.Match(pattern, base); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Fs) Name() string {
+	return b.name
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (b *Fs) Unwrap() kafero.Fs {
+	return b.Fs
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (b *Fs) WithContext(ctx context.Context) kafero.Fs {
+	v := *b
+	v.Fs = kafero.WithContext(b.Fs, ctx)
+	return &v
+}
+
+func (b *Fs) OpenFile(name string, flag int, mode os.FileMode) (f kafero.File, err error) {
+	sourcef, err := b.Fs.OpenFile(name, flag, mode)
+	if err != nil {
+		return nil, err
+	}
+	if !b.compressed(name) {
+		return &plainFile{File: sourcef, parent: b}, nil
+	}
+	return &File{File: sourcef, parent: b, flag: flag}, nil
+}
+
+func (b *Fs) Open(name string) (f kafero.File, err error) {
+	sourcef, err := b.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !b.compressed(name) {
+		return &plainFile{File: sourcef, parent: b}, nil
+	}
+	return &File{File: sourcef, parent: b, flag: os.O_RDONLY}, nil
+}
+
+func (b *Fs) Create(name string) (f kafero.File, err error) {
+	sourcef, err := b.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	if !b.compressed(name) {
+		return &plainFile{File: sourcef, parent: b}, nil
+	}
+	return &File{File: sourcef, parent: b, flag: os.O_RDWR}, nil
+}
+
+// Stat returns the FileInfo of the named file, with its uncompressed size
+// when known.
+func (b *Fs) Stat(name string) (os.FileInfo, error) {
+	fi, err := b.Fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return b.logicalInfo(name, fi), nil
+}
+
+var _ kafero.Lstater = (*Fs)(nil)
+
+func (b *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := b.Fs.(kafero.Lstater); ok {
+		fi, lstat, err := lsf.LstatIfPossible(name)
+		if err != nil {
+			return nil, lstat, err
+		}
+		return b.logicalInfo(name, fi), lstat, nil
+	}
+	fi, err := b.Stat(name)
+	return fi, false, err
+}
+
+// The extended attributes are those of the source file, they describe the
+// uncompressed content.
+
+func (b *Fs) Getxattr(name, attr string) ([]byte, error) {
+	return kafero.Getxattr(b.Fs, name, attr)
+}
+
+func (b *Fs) Setxattr(name, attr string, value []byte) error {
+	return kafero.Setxattr(b.Fs, name, attr, value)
+}
+
+func (b *Fs) Listxattr(name string) ([]string, error) {
+	return kafero.Listxattr(b.Fs, name)
+}
+
+func (b *Fs) Removexattr(name, attr string) error {
+	return kafero.Removexattr(b.Fs, name, attr)
+}
+
+var _ kafero.Describer = (*Fs)(nil)
+
+func (b *Fs) Describe() kafero.Description {
+	var params []string
+	if b.patterns != nil {
+		params = append(params, "compress_only="+strings.Join(b.patterns, ","))
+	}
+	if b.autoDetect {
+		params = append(params, "auto_detect=true")
+	}
+	return kafero.Description{
+		Name:    b.name,
+		Params:  params,
+		Wrapped: []kafero.WrappedFs{{Role: "source", Fs: b.Fs}},
+	}
+}
@@ -0,0 +1,97 @@
+package compressfs
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics are the counters of the compression of the files of a Fs since
+// it was created, to choose the codec and its level from the data stored.
+type Metrics struct {
+	// RawWritten is the number of bytes written to the compressed files,
+	// and CompressedWritten the number of bytes they were compressed to.
+	RawWritten, CompressedWritten int64
+	// RawRead is the number of bytes read from the compressed files, and
+	// CompressedRead the number of compressed bytes they were read from.
+	RawRead, CompressedRead int64
+	// EncodeTime is the time spent compressing, and DecodeTime the time
+	// spent decompressing.
+	EncodeTime, DecodeTime time.Duration
+}
+
+// Ratio returns the compression ratio of the bytes written, the raw size
+// over the compressed size, 0 if nothing was written.
+func (m Metrics) Ratio() float64 {
+	if m.CompressedWritten == 0 {
+		return 0
+	}
+	return float64(m.RawWritten) / float64(m.CompressedWritten)
+}
+
+// EncodeThroughput returns the number of raw bytes compressed per second,
+// 0 if nothing was written.
+func (m Metrics) EncodeThroughput() float64 {
+	if m.EncodeTime <= 0 {
+		return 0
+	}
+	return float64(m.RawWritten) / m.EncodeTime.Seconds()
+}
+
+// DecodeThroughput returns the number of raw bytes decompressed per
+// second, 0 if nothing was read.
+func (m Metrics) DecodeThroughput() float64 {
+	if m.DecodeTime <= 0 {
+		return 0
+	}
+	return float64(m.RawRead) / m.DecodeTime.Seconds()
+}
+
+// counters are the Metrics of a Fs, updated atomically by its files.
+type counters struct {
+	rawWritten, compressedWritten int64
+	rawRead, compressedRead       int64
+	encodeTime, decodeTime        int64
+}
+
+// Metrics returns the counters of the compression of the files of b.
+func (b *Fs) Metrics() Metrics {
+	c := b.counters
+	return Metrics{
+		RawWritten:        atomic.LoadInt64(&c.rawWritten),
+		CompressedWritten: atomic.LoadInt64(&c.compressedWritten),
+		RawRead:           atomic.LoadInt64(&c.rawRead),
+		CompressedRead:    atomic.LoadInt64(&c.compressedRead),
+		EncodeTime:        time.Duration(atomic.LoadInt64(&c.encodeTime)),
+		DecodeTime:        time.Duration(atomic.LoadInt64(&c.decodeTime)),
+	}
+}
+
+// countingWriter counts the compressed bytes written to a source file.
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+// countingReader counts the compressed bytes read from a source file.
+type countingReader struct {
+	io.Reader
+	n *int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+// since adds the time elapsed since start to the counter d.
+func since(d *int64, start time.Time) {
+	atomic.AddInt64(d, int64(time.Since(start)))
+}
@@ -0,0 +1,94 @@
+package compressfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/melaurent/kafero"
+)
+
+// The compressed files end with a skippable frame of the codec, ignored by
+// its readers, holding their uncompressed size, so that Stat and Readdir
+// report the logical sizes without decompressing the files. The files
+// without it, written before or appended to by other tools, report their
+// compressed size.
+
+// footer returns the skippable frame holding the uncompressed size.
+func (b *Fs) footer(size int64) []byte {
+	var payload [8]byte
+	binary.LittleEndian.PutUint64(payload[:], uint64(size))
+	return b.codec.Skippable(payload[:])
+}
+
+// readFooter returns the uncompressed size held by the footer of the
+// compressed content r of the given size, false if it has none.
+func (b *Fs) readFooter(r io.ReaderAt, size int64) (int64, bool) {
+	empty := b.footer(0)
+	if size < int64(len(empty)) {
+		return 0, false
+	}
+	footer := make([]byte, len(empty))
+	if _, err := r.ReadAt(footer, size-int64(len(footer))); err != nil {
+		return 0, false
+	}
+	header := len(footer) - 8
+	if !bytes.Equal(footer[:header], empty[:header]) {
+		return 0, false
+	}
+	return int64(binary.LittleEndian.Uint64(footer[header:])), true
+}
+
+// logicalSize returns the uncompressed size of the named compressed file
+// of the given size, false if unknown.
+func (b *Fs) logicalSize(name string, size int64) (int64, bool) {
+	f, err := b.Fs.Open(name)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	return b.readFooter(f, size)
+}
+
+// logicalInfo returns fi with the uncompressed size of the named file if
+// it is compressed and its size known.
+func (b *Fs) logicalInfo(name string, fi os.FileInfo) os.FileInfo {
+	if !fi.Mode().IsRegular() || !b.compressed(name) {
+		return fi
+	}
+	if size, ok := b.logicalSize(name, fi.Size()); ok {
+		return &sizedInfo{FileInfo: fi, size: size}
+	}
+	return fi
+}
+
+// readdir returns the entries of dir with their uncompressed sizes.
+func (b *Fs) readdir(dir kafero.File, count int) ([]os.FileInfo, error) {
+	fis, err := dir.Readdir(count)
+	for i, fi := range fis {
+		fis[i] = b.logicalInfo(filepath.Join(dir.Name(), fi.Name()), fi)
+	}
+	return fis, err
+}
+
+type sizedInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (fi *sizedInfo) Size() int64 {
+	return fi.size
+}
+
+// plainFile is a file passed through, the entries of the directories being
+// listed with their uncompressed sizes.
+type plainFile struct {
+	kafero.File
+	parent *Fs
+}
+
+func (f *plainFile) Readdir(count int) ([]os.FileInfo, error) {
+	return f.parent.readdir(f.File, count)
+}
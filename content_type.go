@@ -0,0 +1,33 @@
+package kafero
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+func (a Afero) DetectContentType(name string) (string, error) {
+	return DetectContentType(a.Fs, name)
+}
+
+// DetectContentType returns the MIME type of the named file, from its
+// extension when it is known, else by sniffing its first bytes like
+// http.DetectContentType does.
+func DetectContentType(fs Fs, name string) (string, error) {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct, nil
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// http.DetectContentType considers at most 512 bytes
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
@@ -0,0 +1,30 @@
+package kafero
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDetectContentType(t *testing.T) {
+	fs := NewMemMapFs()
+	WriteFile(fs, "/page.html", []byte("not html"), 0644)
+	WriteFile(fs, "/image", []byte("\x89PNG\x0D\x0A\x1A\x0A"), 0644)
+	WriteFile(fs, "/empty", nil, 0644)
+
+	for name, expected := range map[string]string{
+		"/page.html": "text/html",
+		"/image":     "image/png",
+		"/empty":     "text/plain",
+	} {
+		ct, err := DetectContentType(fs, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(ct, expected) {
+			t.Fatalf("was expecting %s to be %s, got %s", name, expected, ct)
+		}
+	}
+	if _, err := DetectContentType(fs, "/missing"); err == nil {
+		t.Fatal("was expecting an error for a missing file")
+	}
+}
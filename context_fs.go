@@ -0,0 +1,125 @@
+package kafero
+
+import "context"
+
+// ContextFs is an optional interface in Kafero. It is implemented by the
+// filesystems whose operations can be bound to a context, so that the
+// deadlines, cancellations and values, such as trace IDs, set on top of a
+// stack reach the backends at its bottom. The decorators bind the
+// filesystems they wrap, the backends use the context in their requests.
+type ContextFs interface {
+	// WithContext returns a view of the filesystem whose operations are
+	// bound to ctx, sharing its state, such as the content of its
+	// caches.
+	WithContext(ctx context.Context) Fs
+}
+
+var (
+	_ ContextFs = (*BufferFs)(nil)
+	_ ContextFs = (*SizeCacheFS)(nil)
+	_ ContextFs = (*CacheOnReadFs)(nil)
+	_ ContextFs = (*CopyOnWriteFs)(nil)
+	_ ContextFs = (*BasePathFs)(nil)
+	_ ContextFs = (*ReadOnlyFs)(nil)
+	_ ContextFs = (*RegexpFs)(nil)
+	_ ContextFs = (*ReadaheadFs)(nil)
+	_ ContextFs = (*ListingCacheFs)(nil)
+	_ ContextFs = (*BlockCacheFs)(nil)
+	_ ContextFs = (*ScannerFs)(nil)
+	_ ContextFs = (*HookFs)(nil)
+	_ ContextFs = (*IntegrityFs)(nil)
+	_ ContextFs = (*GcsFs)(nil)
+)
+
+// WithContext returns fs with its operations bound to ctx, through all
+// the layers of the stack implementing ContextFs. The filesystems which
+// don't, such as MemMapFs and OsFs, are returned unchanged. A single
+// operation is bound to a context with:
+//
+//	f, err := kafero.WithContext(fs, ctx).Open(name)
+//
+// See WalkContext to stop a walk on any filesystem.
+func WithContext(fs Fs, ctx context.Context) Fs {
+	if c, ok := fs.(ContextFs); ok {
+		return c.WithContext(ctx)
+	}
+	return fs
+}
+
+func (u *BufferFs) WithContext(ctx context.Context) Fs {
+	v := *u
+	v.base, v.layer = WithContext(u.base, ctx), WithContext(u.layer, ctx)
+	return &v
+}
+
+func (u *SizeCacheFS) WithContext(ctx context.Context) Fs {
+	v := *u
+	v.base, v.cache = WithContext(u.base, ctx), WithContext(u.cache, ctx)
+	return &v
+}
+
+func (u *CacheOnReadFs) WithContext(ctx context.Context) Fs {
+	origin := u
+	if u.origin != nil {
+		origin = u.origin
+	}
+	return &CacheOnReadFs{
+		base:      WithContext(u.base, ctx),
+		layer:     WithContext(u.layer, ctx),
+		cacheTime: u.cacheTime,
+		refresher: u.refresher,
+		origin:    origin,
+	}
+}
+
+func (u *CopyOnWriteFs) WithContext(ctx context.Context) Fs {
+	return &CopyOnWriteFs{base: WithContext(u.base, ctx), layer: WithContext(u.layer, ctx)}
+}
+
+func (b *BasePathFs) WithContext(ctx context.Context) Fs {
+	return &BasePathFs{source: WithContext(b.source, ctx), path: b.path}
+}
+
+func (r *ReadOnlyFs) WithContext(ctx context.Context) Fs {
+	return &ReadOnlyFs{source: WithContext(r.source, ctx)}
+}
+
+func (r *RegexpFs) WithContext(ctx context.Context) Fs {
+	return &RegexpFs{re: r.re, source: WithContext(r.source, ctx)}
+}
+
+func (r *ReadaheadFs) WithContext(ctx context.Context) Fs {
+	v := *r
+	v.source = WithContext(r.source, ctx)
+	return &v
+}
+
+func (l *ListingCacheFs) WithContext(ctx context.Context) Fs {
+	v := *l
+	v.source = WithContext(l.source, ctx)
+	return &v
+}
+
+func (r *BlockCacheFs) WithContext(ctx context.Context) Fs {
+	return &BlockCacheFs{source: WithContext(r.source, ctx), cache: r.cache, id: r.id}
+}
+
+func (s *ScannerFs) WithContext(ctx context.Context) Fs {
+	return &ScannerFs{source: WithContext(s.source, ctx), scanner: s.scanner}
+}
+
+func (h *HookFs) WithContext(ctx context.Context) Fs {
+	return &HookFs{source: WithContext(h.source, ctx), hooks: h.hooks}
+}
+
+func (i *IntegrityFs) WithContext(ctx context.Context) Fs {
+	return &IntegrityFs{source: WithContext(i.source, ctx), verify: i.verify}
+}
+
+// WithContext returns a view of the GcsFs issuing its requests, and those
+// of the files it opens, with ctx.
+func (fs *GcsFs) WithContext(ctx context.Context) Fs {
+	v := *fs
+	v.ctx = ctx
+	return &v
+}
@@ -0,0 +1,55 @@
+package kafero
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type ctxKey struct{}
+
+// contextRecordingFs records the context it is bound to.
+type contextRecordingFs struct {
+	Fs
+	ctx context.Context
+}
+
+func (c *contextRecordingFs) WithContext(ctx context.Context) Fs {
+	return &contextRecordingFs{Fs: c.Fs, ctx: ctx}
+}
+
+func TestWithContext(t *testing.T) {
+	leaf := &contextRecordingFs{Fs: NewMemMapFs(), ctx: context.Background()}
+	if err := WriteFile(leaf, "/data/a.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache, err := NewSizeCacheFS(NewReadOnlyFs(NewBasePathFs(leaf, "/data")), NewMemMapFs(), 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewBufferFs(cache, NewMemMapFs())
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "trace")
+	scoped := WithContext(fs, ctx)
+	var rec *contextRecordingFs
+	if !As(scoped, &rec) || rec.ctx.Value(ctxKey{}) != "trace" {
+		t.Fatal("was expecting the context to reach the leaf")
+	}
+	if !As(fs, &rec) || rec.ctx.Value(ctxKey{}) != nil {
+		t.Fatal("was expecting the stack unchanged")
+	}
+
+	// The views share the state of the filesystems
+	if data, err := ReadFile(scoped, "a.txt"); err != nil || string(data) != "0123456789" {
+		t.Fatalf("was expecting the content, got %q, %v", data, err)
+	}
+	if cache.currSize != 10 {
+		t.Fatalf("was expecting the file cached, got a cache size of %d", cache.currSize)
+	}
+
+	// The filesystems not implementing ContextFs are returned unchanged
+	mem := NewMemMapFs()
+	if WithContext(mem, ctx) != mem {
+		t.Fatal("was expecting the MemMapFs unchanged")
+	}
+}
@@ -0,0 +1,190 @@
+package kafero
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// CopyStats are the statistics of a copy of CopyDir or Sync.
+type CopyStats struct {
+	Copied int
+	// Skipped is the number of files not transferred, unchanged or, with
+	// Dedup, identical.
+	Skipped int
+	// Deduplicated is the number of the skipped files found identical.
+	Deduplicated int
+	BytesCopied  int64
+	// BytesAvoided is the size of the files skipped.
+	BytesAvoided int64
+}
+
+type copyOptions struct {
+	dedup bool
+	stats *CopyStats
+}
+
+type CopyOption func(opts *copyOptions)
+
+// Dedup skips the files whose destination already has the same content,
+// told by their XattrSHA256 digests if both have one, or by comparing
+// their contents otherwise. Reading both sides is cheaper than writing to
+// many backends, and the times of the files skipped are updated so that
+// Sync doesn't compare them again. The digests of the files copied are
+// copied along with their metadata.
+func Dedup() CopyOption {
+	return func(opts *copyOptions) {
+		opts.dedup = true
+	}
+}
+
+// WithCopyStats fills stats with the statistics of the copy.
+func WithCopyStats(stats *CopyStats) CopyOption {
+	return func(opts *copyOptions) {
+		opts.stats = stats
+	}
+}
+
+// CopyDir copies the tree rooted at srcDir in src to dstDir in dst,
+// overwriting the existing files.
+func CopyDir(src Fs, srcDir string, dst Fs, dstDir string, opts ...CopyOption) error {
+	return copyTree(src, srcDir, dst, dstDir, false, opts)
+}
+
+// Sync copies the tree rooted at srcDir in src to dstDir in dst, only
+// transferring the files missing from dst, with a different size, or
+// modified in src since they were copied. Files only present in dst are
+// kept. TwoWaySync synchronizes both trees with each other.
+func Sync(src Fs, srcDir string, dst Fs, dstDir string, opts ...CopyOption) error {
+	return copyTree(src, srcDir, dst, dstDir, true, opts)
+}
+
+type copyEntry struct {
+	src  string
+	dst  string
+	info os.FileInfo
+}
+
+func copyTree(src Fs, srcDir string, dst Fs, dstDir string, onlyChanged bool, opts []CopyOption) error {
+	o := &copyOptions{stats: &CopyStats{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+	stats := o.stats
+	var dirs, files []copyEntry
+	err := Walk(src, srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, path)
+		if err != nil {
+			return err
+		}
+		e := copyEntry{src: path, dst: filepath.Join(dstDir, rel), info: info}
+		if info.IsDir() {
+			dirs = append(dirs, e)
+		} else {
+			files = append(files, e)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error listing source directory: %v", err)
+	}
+
+	// Get the state of all the destinations at once to plan the transfers
+	names := make([]string, 0, len(dirs)+len(files))
+	for _, e := range dirs {
+		names = append(names, e.dst)
+	}
+	for _, e := range files {
+		names = append(names, e.dst)
+	}
+	existing, err := statPaths(dst, names)
+	if err != nil {
+		return fmt.Errorf("error listing destination directory: %v", err)
+	}
+
+	for _, e := range dirs {
+		if fi, ok := existing[e.dst]; ok {
+			if !fi.IsDir() {
+				return &os.PathError{Op: "copy", Path: e.dst, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if err := dst.MkdirAll(e.dst, e.info.Mode().Perm()); err != nil {
+			return fmt.Errorf("error creating directory: %v", err)
+		}
+	}
+	for _, e := range files {
+		fi, ok := existing[e.dst]
+		if ok && fi.Size() == e.info.Size() {
+			skip := onlyChanged && !e.info.ModTime().After(fi.ModTime())
+			if !skip && o.dedup && fi.Mode().IsRegular() {
+				if skip, err = sameDigest(src, e.src, dst, e.dst); err != nil {
+					return err
+				}
+				if skip {
+					stats.Deduplicated++
+					_ = dst.Chtimes(e.dst, e.info.ModTime(), e.info.ModTime())
+				}
+			}
+			if skip {
+				stats.Skipped++
+				stats.BytesAvoided += e.info.Size()
+				continue
+			}
+		}
+		if err := copyFile(src, e.src, dst, e.dst, e.info); err != nil {
+			return err
+		}
+		stats.Copied++
+		stats.BytesCopied += e.info.Size()
+	}
+	return nil
+}
+
+// sameDigest returns true if the files have the same content, comparing
+// their XattrSHA256 digests if both have one.
+func sameDigest(src Fs, srcName string, dst Fs, dstName string) (bool, error) {
+	srcSum, err := Getxattr(src, srcName, XattrSHA256)
+	if err == nil && len(srcSum) > 0 {
+		if dstSum, err := Getxattr(dst, dstName, XattrSHA256); err == nil && len(dstSum) > 0 {
+			return bytes.Equal(srcSum, dstSum), nil
+		}
+	}
+	same, err := sameContent(src, srcName, dst, dstName)
+	if err != nil {
+		return false, fmt.Errorf("error comparing %s: %v", srcName, err)
+	}
+	return same, nil
+}
+
+func copyFile(src Fs, srcName string, dst Fs, dstName string, info os.FileInfo) error {
+	sf, err := src.Open(srcName)
+	if err != nil {
+		return fmt.Errorf("error opening source file: %v", err)
+	}
+	defer sf.Close()
+	df, err := dst.OpenFile(dstName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("error opening destination file: %v", err)
+	}
+	if _, err := io.Copy(df, sf); err != nil {
+		_ = df.Close()
+		return fmt.Errorf("error copying %s: %v", srcName, err)
+	}
+	if err := df.Close(); err != nil {
+		return fmt.Errorf("error closing destination file: %v", err)
+	}
+	if err := copyMeta(src, srcName, dst, dstName); err != nil {
+		return err
+	}
+	// Not all the filesystems can set the times, Sync then relies on the
+	// destination being more recent
+	_ = dst.Chtimes(dstName, info.ModTime(), info.ModTime())
+	return nil
+}
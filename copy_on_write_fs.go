@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -16,21 +17,123 @@ var _ Lstater = (*CopyOnWriteFs)(nil)
 // is not present in the overlay will copy the file to the overlay ("changing"
 // includes also calls to e.g. Chtimes() and Chmod()).
 //
+// Removing or renaming a file of the base layer leaves a whiteout in the
+// overlay, an empty file named after it with the WhiteoutPrefix, hiding it.
+// A directory created in the overlay where one of the base layer was
+// removed is marked opaque, with a WhiteoutOpaque file, so that the content
+// of the base layer doesn't show through. The files of the overlay named
+// with the WhiteoutPrefix are thus not listed.
+//
 // Reading directories is currently only supported via Open(), not OpenFile().
 type CopyOnWriteFs struct {
 	base  Fs
 	layer Fs
 }
 
+const (
+	// WhiteoutPrefix prefixes the name of the whiteouts in the overlay of a
+	// CopyOnWriteFs.
+	WhiteoutPrefix = ".wh."
+	// WhiteoutOpaque is the name of the file marking a directory of the
+	// overlay of a CopyOnWriteFs as opaque.
+	WhiteoutOpaque = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
 func NewCopyOnWriteFs(base Fs, layer Fs) Fs {
 	return &CopyOnWriteFs{base: base, layer: layer}
 }
 
+// whiteoutName returns the name of the whiteout of name.
+func whiteoutName(name string) string {
+	return filepath.Join(filepath.Dir(name), WhiteoutPrefix+filepath.Base(name))
+}
+
+// baseHidden returns whether name in the base layer is hidden by a whiteout
+// of it or of one of its parents, or by an opaque parent.
+func (u *CopyOnWriteFs) baseHidden(name string) bool {
+	name = filepath.Clean(name)
+	for p := name; ; {
+		if p != name {
+			if _, err := u.layer.Stat(filepath.Join(p, WhiteoutOpaque)); err == nil {
+				return true
+			}
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return false
+		}
+		if _, err := u.layer.Stat(whiteoutName(p)); err == nil {
+			return true
+		}
+		p = parent
+	}
+}
+
+// inBase returns the info of name in the base layer, unless hidden.
+func (u *CopyOnWriteFs) inBase(name string) (os.FileInfo, bool) {
+	if u.baseHidden(name) {
+		return nil, false
+	}
+	info, err := u.base.Stat(name)
+	return info, err == nil
+}
+
+// whiteout hides name of the base layer.
+func (u *CopyOnWriteFs) whiteout(name string) error {
+	wh := whiteoutName(name)
+	if err := u.layer.MkdirAll(filepath.Dir(wh), 0777); err != nil {
+		return err
+	}
+	f, err := u.layer.Create(wh)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// clearWhiteout removes the whiteout of name, if any, returning whether
+// there was one.
+func (u *CopyOnWriteFs) clearWhiteout(name string) bool {
+	return u.layer.Remove(whiteoutName(name)) == nil
+}
+
+// notWhiteout tells the files of the overlay which are not whiteouts.
+func notWhiteout(name string) bool {
+	return !strings.HasPrefix(filepath.Base(name), WhiteoutPrefix)
+}
+
+// mergeWhiteouts merges the directories of the overlay and of the base
+// layer, leaving out the whiteouts and the files of the base layer they
+// hide.
+func mergeWhiteouts(lofi, bofi []os.FileInfo) ([]os.FileInfo, error) {
+	var visible []os.FileInfo
+	hidden := make(map[string]bool)
+	for _, fi := range lofi {
+		if fi.Name() == WhiteoutOpaque {
+			bofi = nil
+		} else if strings.HasPrefix(fi.Name(), WhiteoutPrefix) {
+			hidden[strings.TrimPrefix(fi.Name(), WhiteoutPrefix)] = true
+		} else {
+			visible = append(visible, fi)
+		}
+	}
+	var base []os.FileInfo
+	for _, fi := range bofi {
+		if !hidden[fi.Name()] {
+			base = append(base, fi)
+		}
+	}
+	return defaultUnionMergeDirsFn(visible, base)
+}
+
 // Returns true if the file is not in the overlay
 func (u *CopyOnWriteFs) isBaseFile(name string) (bool, error) {
 	if _, err := u.layer.Stat(name); err == nil {
 		return false, nil
 	}
+	if u.baseHidden(name) {
+		return false, nil
+	}
 	_, err := u.base.Stat(name)
 	if err != nil {
 		if oerr, ok := err.(*os.PathError); ok {
@@ -80,6 +183,9 @@ func (u *CopyOnWriteFs) Stat(name string) (os.FileInfo, error) {
 	if err != nil {
 		isNotExist := u.isNotExist(err)
 		if isNotExist {
+			if u.baseHidden(name) {
+				return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+			}
 			return u.base.Stat(name)
 		}
 		return nil, err
@@ -102,6 +208,10 @@ func (u *CopyOnWriteFs) LstatIfPossible(name string) (os.FileInfo, bool, error)
 		}
 	}
 
+	if u.baseHidden(name) {
+		return nil, false, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+
 	if ok2 {
 		fi, b, err := lbase.LstatIfPossible(name)
 		if err == nil {
@@ -127,47 +237,87 @@ func (u *CopyOnWriteFs) isNotExist(err error) bool {
 	return false
 }
 
-// Renaming files present only in the base layer is not permitted
+// Renaming a file of the base layer copies it to the overlay, leaving a
+// whiteout. Renaming directories present in the base layer is not
+// permitted.
 func (u *CopyOnWriteFs) Rename(oldname, newname string) error {
+	info, err := u.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	_, inBase := u.inBase(oldname)
+	if inBase && info.IsDir() {
+		return syscall.EPERM
+	}
 	b, err := u.isBaseFile(oldname)
 	if err != nil {
 		return err
 	}
 	if b {
-		return syscall.EPERM
+		if err := u.copyToLayer(oldname); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Dir(newname)
+	if info, ok := u.inBase(dir); ok && info.IsDir() {
+		if err := u.layer.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
+	}
+	if err := u.layer.Rename(oldname, newname); err != nil {
+		return err
+	}
+	u.clearWhiteout(newname)
+	if inBase {
+		return u.whiteout(oldname)
 	}
-	return u.layer.Rename(oldname, newname)
+	return nil
 }
 
-// Removing files present only in the base layer is not permitted. If
-// a file is present in the base layer and the overlay, only the overlay
-// will be removed.
+// Removing a file of the base layer leaves a whiteout hiding it.
 func (u *CopyOnWriteFs) Remove(name string) error {
-	err := u.layer.Remove(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	info, err := u.Stat(name)
+	if err != nil {
 		return err
 	}
+	_, err = u.layer.Stat(name)
+	inLayer := err == nil
+	_, inBase := u.inBase(name)
+	if info.IsDir() {
+		// The directory of the overlay may hold whiteouts
+		names, err := ReadDirNames(u, name)
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+		if inLayer {
+			if err := u.layer.RemoveAll(name); err != nil {
+				return err
+			}
+		}
+	} else if inLayer {
+		if err := u.layer.Remove(name); err != nil {
+			return err
+		}
+	}
+	if inBase {
+		return u.whiteout(name)
+	}
+	return nil
 }
 
+// Removing a directory of the base layer leaves a whiteout hiding its
+// whole tree.
 func (u *CopyOnWriteFs) RemoveAll(name string) error {
-	err := u.layer.RemoveAll(name)
-	switch err {
-	case syscall.ENOENT:
-		_, err = u.base.Stat(name)
-		if err == nil {
-			return syscall.EPERM
-		}
-		return syscall.ENOENT
-	default:
+	if err := u.layer.RemoveAll(name); err != nil {
 		return err
 	}
+	if _, inBase := u.inBase(name); inBase {
+		return u.whiteout(name)
+	}
+	return nil
 }
 
 func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
@@ -206,11 +356,11 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 		if err != nil && !os.IsNotExist(err) {
 			return nil, err
 		}
-		if isaDir {
+		if isaDir && !u.baseHidden(dir) {
 			if err = u.layer.MkdirAll(dir, 0777); err != nil {
 				return nil, err
 			}
-			return u.layer.OpenFile(name, flag, perm)
+			return u.openLayerFile(name, flag, perm)
 		}
 
 		isaDir, err = IsDir(u.layer, dir)
@@ -218,7 +368,7 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 			return nil, err
 		}
 		if isaDir {
-			return u.layer.OpenFile(name, flag, perm)
+			return u.openLayerFile(name, flag, perm)
 		}
 
 		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOTDIR} // ...or os.ErrNotExist?
@@ -230,6 +380,19 @@ func (u *CopyOnWriteFs) OpenFile(name string, flag int, perm os.FileMode) (File,
 	return u.layer.OpenFile(name, flag, perm)
 }
 
+// openLayerFile opens name of the overlay, clearing its whiteout if
+// created.
+func (u *CopyOnWriteFs) openLayerFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := u.layer.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 {
+		u.clearWhiteout(name)
+	}
+	return f, nil
+}
+
 // This function handles the 9 different possibilities caused
 // by the union which are the intersection of the following...
 //  layer: doesn't exist, exists as a file, and exists as a directory
@@ -254,6 +417,8 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 	if !dir {
 		return u.layer.Open(name)
 	}
+	// Without its whiteouts
+	layer := NewFilterFs(u.layer, notWhiteout)
 
 	// Overlay is a directory, base state now matters.
 	// Base state has 3 states to check but 2 outcomes:
@@ -262,8 +427,8 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 
 	// If base is file or nonreadable, return overlay
 	dir, err = IsDir(u.base, name)
-	if !dir || err != nil {
-		return u.layer.Open(name)
+	if !dir || err != nil || u.baseHidden(name) {
+		return layer.Open(name)
 	}
 
 	// Both base & layer are directories
@@ -276,25 +441,50 @@ func (u *CopyOnWriteFs) Open(name string) (File, error) {
 		return nil, fmt.Errorf("BaseErr: %v\nOverlayErr: %v", bErr, lErr)
 	}
 
-	return &UnionFile{Base: bfile, Layer: lfile}, nil
+	return &UnionFile{Base: bfile, Layer: lfile, Merger: mergeWhiteouts}, nil
 }
 
 func (u *CopyOnWriteFs) Mkdir(name string, perm os.FileMode) error {
-	dir, err := IsDir(u.base, name)
-	if err != nil {
-		return u.layer.MkdirAll(name, perm)
+	// The directory may exist in the layer only, and its parent in the base only
+	if _, err := u.Stat(name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: ErrFileExists}
 	}
-	if dir {
-		return ErrFileExists
+	dir := filepath.Dir(name)
+	if isDir, _ := IsDir(u.base, dir); isDir && !u.baseHidden(dir) {
+		if err := u.layer.MkdirAll(dir, 0777); err != nil {
+			return err
+		}
 	}
-	return u.layer.MkdirAll(name, perm)
+	if err := u.layer.Mkdir(name, perm); err != nil {
+		return err
+	}
+	if _, err := u.layer.Stat(whiteoutName(name)); err == nil {
+		// Hide the directory of the base layer removed
+		f, err := u.layer.Create(filepath.Join(name, WhiteoutOpaque))
+		if err != nil {
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		u.clearWhiteout(name)
+	}
+	return nil
 }
 
 func (u *CopyOnWriteFs) Name() string {
 	return "CopyOnWriteFs"
 }
 
+// Unwrap returns the base filesystem, read only under the layer.
+func (u *CopyOnWriteFs) Unwrap() Fs {
+	return u.base
+}
+
 func (u *CopyOnWriteFs) MkdirAll(name string, perm os.FileMode) error {
+	if u.baseHidden(name) {
+		return u.mkdirAll(name, perm)
+	}
 	dir, err := IsDir(u.base, name)
 	if err != nil {
 		return u.layer.MkdirAll(name, perm)
@@ -303,9 +493,26 @@ func (u *CopyOnWriteFs) MkdirAll(name string, perm os.FileMode) error {
 		// This is in line with how os.MkdirAll behaves.
 		return nil
 	}
-	return u.layer.MkdirAll(name, perm)
+	return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
 }
 
 func (u *CopyOnWriteFs) Create(name string) (File, error) {
 	return u.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666)
 }
+
+// mkdirAll creates the missing directories of name one by one, so that
+// the ones hiding a directory of the base layer are marked opaque.
+func (u *CopyOnWriteFs) mkdirAll(name string, perm os.FileMode) error {
+	if info, err := u.Stat(name); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	if parent := filepath.Dir(name); parent != name {
+		if err := u.mkdirAll(parent, perm); err != nil {
+			return err
+		}
+	}
+	return u.Mkdir(name, perm)
+}
@@ -60,3 +60,79 @@ func TestCopyOnWriteFileInMemMapBase(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestCopyOnWriteWhiteouts(t *testing.T) {
+	base := &MemMapFs{}
+	layer := &MemMapFs{}
+	base.MkdirAll("/data/sub", 0777)
+	for _, name := range []string{"/data/a", "/data/b", "/data/sub/c"} {
+		if err := WriteFile(base, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ufs := NewCopyOnWriteFs(NewReadOnlyFs(base), layer)
+
+	if err := ufs.Remove("/data/a"); err != nil {
+		t.Fatalf("Remove of a base file: %v", err)
+	}
+	if _, err := ufs.Stat("/data/a"); !os.IsNotExist(err) {
+		t.Errorf("Removed file still present: %v", err)
+	}
+	if _, err := base.Stat("/data/a"); err != nil {
+		t.Errorf("Base file removed: %v", err)
+	}
+	if err := ufs.Remove("/data/a"); !os.IsNotExist(err) {
+		t.Errorf("Remove of a removed file: expected not exist error, got %v", err)
+	}
+
+	if err := ufs.Rename("/data/b", "/data/sub/b"); err != nil {
+		t.Fatalf("Rename of a base file: %v", err)
+	}
+	if _, err := ufs.Stat("/data/b"); !os.IsNotExist(err) {
+		t.Errorf("Renamed file still present: %v", err)
+	}
+	if data, err := ReadFile(ufs, "/data/sub/b"); err != nil || string(data) != "/data/b" {
+		t.Errorf("Got %q, %v reading the renamed file", data, err)
+	}
+
+	names, err := ReadDirNames(ufs, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "sub" {
+		t.Errorf("Got wrong names: %v", names)
+	}
+
+	// Recreate a file removed
+	if err := WriteFile(ufs, "/data/a", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(ufs, "/data/a"); err != nil || string(data) != "new" {
+		t.Errorf("Got %q, %v reading the recreated file", data, err)
+	}
+
+	// Recreate a directory removed, without its base content
+	if err := ufs.RemoveAll("/data/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ufs.Stat("/data/sub/c"); !os.IsNotExist(err) {
+		t.Errorf("File of a removed directory still present: %v", err)
+	}
+	if err := ufs.MkdirAll("/data/sub/new", 0777); err != nil {
+		t.Fatal(err)
+	}
+	names, err = ReadDirNames(ufs, "/data/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "new" {
+		t.Errorf("Got wrong names in the recreated directory: %v", names)
+	}
+	if _, err := ufs.Stat("/data/sub/c"); !os.IsNotExist(err) {
+		t.Errorf("File of a recreated directory present: %v", err)
+	}
+
+	if err := ufs.Remove("/data/sub"); err == nil {
+		t.Errorf("Removed a non empty directory")
+	}
+}
@@ -0,0 +1,244 @@
+package kafero
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	_ Lstater    = (*DefaultPermFs)(nil)
+	_ Xattrer    = (*DefaultPermFs)(nil)
+	_ Unwrapper  = (*DefaultPermFs)(nil)
+	_ Describer  = (*DefaultPermFs)(nil)
+	_ ContextFs  = (*DefaultPermFs)(nil)
+	_ FileIDer   = (*DefaultPermFs)(nil)
+	_ Statfser   = (*DefaultPermFs)(nil)
+	_ ReadDirer  = (*DefaultPermFs)(nil)
+	_ LinkReader = (*DefaultPermFs)(nil)
+)
+
+// A PermRule gives the modes of the files and directories created under
+// the paths matching Pattern, with the syntax of filepath.Match, such as
+// "secrets" or "*/private". A pattern matching a directory matches all the
+// paths under it. The zero modes are the defaults of the DefaultPermFs.
+type PermRule struct {
+	Pattern  string
+	FileMode os.FileMode
+	DirMode  os.FileMode
+}
+
+// The DefaultPermFs creates the files and directories of the source
+// filesystem with the modes given by the first rule matching their path,
+// the default modes if none, whatever the perms passed by the callers.
+// The modes are also set with Chmod once created, as many backends ignore
+// the perms, the filesystems which can't set the modes keeping theirs.
+type DefaultPermFs struct {
+	source   Fs
+	rules    []PermRule
+	fileMode os.FileMode
+	dirMode  os.FileMode
+}
+
+// NewDefaultPermFs returns a DefaultPermFs creating the files of source
+// with fileMode and its directories with dirMode, but for the paths
+// matching rules.
+func NewDefaultPermFs(source Fs, fileMode, dirMode os.FileMode, rules ...PermRule) (*DefaultPermFs, error) {
+	for _, r := range rules {
+		if _, err := filepath.Match(r.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+		}
+	}
+	return &DefaultPermFs{source: source, rules: rules, fileMode: fileMode, dirMode: dirMode}, nil
+}
+
+// permMatches returns whether pattern matches name or one of its parents.
+func permMatches(pattern, name string) bool {
+	name = strings.TrimPrefix(filepath.Clean(name), string(filepath.Separator))
+	for name != "" && name != "." {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		name = filepath.Dir(name)
+	}
+	return false
+}
+
+// modes returns the modes of the file and directory name.
+func (p *DefaultPermFs) modes(name string) (file, dir os.FileMode) {
+	file, dir = p.fileMode, p.dirMode
+	for _, r := range p.rules {
+		if permMatches(r.Pattern, name) {
+			if r.FileMode != 0 {
+				file = r.FileMode
+			}
+			if r.DirMode != 0 {
+				dir = r.DirMode
+			}
+			break
+		}
+	}
+	return file, dir
+}
+
+func (p *DefaultPermFs) fileModeOf(name string) os.FileMode {
+	mode, _ := p.modes(name)
+	return mode
+}
+
+func (p *DefaultPermFs) dirModeOf(name string) os.FileMode {
+	_, mode := p.modes(name)
+	return mode
+}
+
+func (p *DefaultPermFs) Name() string {
+	return "DefaultPermFs"
+}
+
+func (p *DefaultPermFs) Unwrap() Fs {
+	return p.source
+}
+
+func (p *DefaultPermFs) Describe() Description {
+	params := []string{param("file_mode", p.fileMode), param("dir_mode", p.dirMode)}
+	for _, r := range p.rules {
+		params = append(params, param("rule", fmt.Sprintf("%s:%v:%v", r.Pattern, r.FileMode, r.DirMode)))
+	}
+	return Description{Name: p.Name(), Params: params, Wrapped: []WrappedFs{{"source", p.source}}}
+}
+
+func (p *DefaultPermFs) WithContext(ctx context.Context) Fs {
+	v := *p
+	v.source = WithContext(p.source, ctx)
+	return &v
+}
+
+func (p *DefaultPermFs) Create(name string) (File, error) {
+	return p.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0)
+}
+
+func (p *DefaultPermFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if flag&os.O_CREATE == 0 {
+		return p.source.OpenFile(name, flag, perm)
+	}
+	created := flag&os.O_EXCL != 0
+	if !created {
+		_, err := p.source.Stat(name)
+		created = os.IsNotExist(err)
+	}
+	mode := p.fileModeOf(name)
+	f, err := p.source.OpenFile(name, flag, mode)
+	if err != nil {
+		return nil, err
+	}
+	if created {
+		// Not all the filesystems can set the modes
+		_ = p.source.Chmod(name, mode)
+	}
+	return f, nil
+}
+
+func (p *DefaultPermFs) Mkdir(name string, perm os.FileMode) error {
+	mode := p.dirModeOf(name)
+	if err := p.source.Mkdir(name, mode); err != nil {
+		return err
+	}
+	_ = p.source.Chmod(name, mode)
+	return nil
+}
+
+// MkdirAll creates the directories missing with the modes of their own
+// path.
+func (p *DefaultPermFs) MkdirAll(path string, perm os.FileMode) error {
+	var missing []string
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := p.source.Stat(dir); !os.IsNotExist(err) {
+			break
+		}
+		missing = append(missing, dir)
+		if parent := filepath.Dir(dir); parent == dir {
+			break
+		}
+	}
+	if err := p.source.MkdirAll(path, p.dirModeOf(path)); err != nil {
+		return err
+	}
+	for _, dir := range missing {
+		_ = p.source.Chmod(dir, p.dirModeOf(dir))
+	}
+	return nil
+}
+
+func (p *DefaultPermFs) Open(name string) (File, error) {
+	return p.source.Open(name)
+}
+
+func (p *DefaultPermFs) Remove(name string) error {
+	return p.source.Remove(name)
+}
+
+func (p *DefaultPermFs) RemoveAll(path string) error {
+	return p.source.RemoveAll(path)
+}
+
+func (p *DefaultPermFs) Rename(oldname, newname string) error {
+	return p.source.Rename(oldname, newname)
+}
+
+func (p *DefaultPermFs) Stat(name string) (os.FileInfo, error) {
+	return p.source.Stat(name)
+}
+
+func (p *DefaultPermFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := p.source.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := p.Stat(name)
+	return fi, false, err
+}
+
+func (p *DefaultPermFs) ReadlinkIfPossible(name string) (string, error) {
+	if srdr, ok := p.source.(LinkReader); ok {
+		return srdr.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+}
+
+func (p *DefaultPermFs) ReadDir(name string) ([]os.FileInfo, error) {
+	return readDirLstat(p.source, name)
+}
+
+func (p *DefaultPermFs) Chmod(name string, mode os.FileMode) error {
+	return p.source.Chmod(name, mode)
+}
+
+func (p *DefaultPermFs) Chtimes(name string, atime, mtime time.Time) error {
+	return p.source.Chtimes(name, atime, mtime)
+}
+
+func (p *DefaultPermFs) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(p.source, name, attr)
+}
+
+func (p *DefaultPermFs) Setxattr(name, attr string, value []byte) error {
+	return Setxattr(p.source, name, attr, value)
+}
+
+func (p *DefaultPermFs) Listxattr(name string) ([]string, error) {
+	return Listxattr(p.source, name)
+}
+
+func (p *DefaultPermFs) Removexattr(name, attr string) error {
+	return Removexattr(p.source, name, attr)
+}
+
+func (p *DefaultPermFs) Statfs(name string) (*FsUsage, error) {
+	return Statfs(p.source, name)
+}
+
+func (p *DefaultPermFs) FileID(name string) (FileID, error) {
+	return GetFileID(p.source, name)
+}
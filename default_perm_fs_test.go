@@ -0,0 +1,74 @@
+package kafero
+
+import (
+	"os"
+	"testing"
+)
+
+// permIgnoringFs creates the files and directories with 0777, as the
+// backends ignoring the perms.
+type permIgnoringFs struct {
+	Fs
+}
+
+func (p *permIgnoringFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return p.Fs.OpenFile(name, flag, 0777)
+}
+
+func (p *permIgnoringFs) Mkdir(name string, perm os.FileMode) error {
+	return p.Fs.Mkdir(name, 0777)
+}
+
+func (p *permIgnoringFs) MkdirAll(path string, perm os.FileMode) error {
+	return p.Fs.MkdirAll(path, 0777)
+}
+
+func TestDefaultPermFs(t *testing.T) {
+	source := &permIgnoringFs{Fs: NewMemMapFs()}
+	fs, err := NewDefaultPermFs(source, 0644, 0755, PermRule{Pattern: "secrets", FileMode: 0600, DirMode: 0700})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/secrets/keys", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Mkdir("/public", 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/secrets/keys/a.pem", []byte("key"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/public/index.html", []byte("index"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for name, mode := range map[string]os.FileMode{
+		"/secrets":            os.ModeDir | 0700,
+		"/secrets/keys":       os.ModeDir | 0700,
+		"/secrets/keys/a.pem": 0600,
+		"/public":             os.ModeDir | 0755,
+		"/public/index.html":  0644,
+	} {
+		info, err := source.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != mode {
+			t.Errorf("was expecting %s to have mode %v, got %v", name, mode, info.Mode())
+		}
+	}
+
+	// The modes of the existing files are kept
+	if err := fs.Chmod("/public/index.html", 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/public/index.html", []byte("index"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := source.Stat("/public/index.html"); info.Mode() != 0640 {
+		t.Fatalf("was expecting the mode kept, got %v", info.Mode())
+	}
+
+	if _, err := NewDefaultPermFs(source, 0644, 0755, PermRule{Pattern: "["}); err == nil {
+		t.Fatal("was expecting an invalid pattern error")
+	}
+}
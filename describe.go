@@ -0,0 +1,224 @@
+package kafero
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Describer is an optional interface in Kafero. It is implemented by the
+// filesystems telling their key parameters and the filesystems they wrap,
+// for DescribeStack to print the composition of a stack.
+type Describer interface {
+	Describe() Description
+}
+
+// A Description describes a filesystem of a stack.
+type Description struct {
+	// Name is the name of the filesystem, as Fs.Name.
+	Name string
+	// Params are its key parameters, as "key=value".
+	Params []string
+	// Wrapped are the filesystems it wraps, from the first one accessed.
+	Wrapped []WrappedFs
+}
+
+// A WrappedFs is a filesystem wrapped by another, in a role such as "base"
+// or "cache".
+type WrappedFs struct {
+	Role string
+	Fs   Fs
+}
+
+// Describe returns the description of fs, only its name if it isn't a
+// Describer.
+func Describe(fs Fs) Description {
+	if d, ok := fs.(Describer); ok {
+		return d.Describe()
+	}
+	return Description{Name: fs.Name()}
+}
+
+// DescribeStack returns the composition of the stack of filesystems fs,
+// one filesystem per line with its parameters, indented under the one
+// wrapping it, as:
+//
+//	BufferFs
+//	  base: SizeCacheFS size=1000000 cache_time=1m0s
+//	    base: ZSTFs
+//	      source: GcsFs bucket=data
+//	    cache: OsFs
+//	  layer: MemMapFS
+func DescribeStack(fs Fs) string {
+	var b strings.Builder
+	describeStack(&b, fs, "", 0)
+	return b.String()
+}
+
+func describeStack(b *strings.Builder, fs Fs, role string, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	if role != "" {
+		b.WriteString(role + ": ")
+	}
+	if fs == nil {
+		b.WriteString("<nil>\n")
+		return
+	}
+	d := Describe(fs)
+	b.WriteString(d.Name)
+	for _, param := range d.Params {
+		b.WriteString(" " + param)
+	}
+	b.WriteString("\n")
+	for _, w := range d.Wrapped {
+		describeStack(b, w.Fs, w.Role, depth+1)
+	}
+}
+
+// param formats a parameter of a Description.
+func param(key string, value interface{}) string {
+	return fmt.Sprintf("%s=%v", key, value)
+}
+
+var (
+	_ Describer = (*BufferFs)(nil)
+	_ Describer = (*SizeCacheFS)(nil)
+	_ Describer = (*CacheOnReadFs)(nil)
+	_ Describer = (*CopyOnWriteFs)(nil)
+	_ Describer = (*BasePathFs)(nil)
+	_ Describer = (*ReadOnlyFs)(nil)
+	_ Describer = (*RegexpFs)(nil)
+	_ Describer = (*FilterFs)(nil)
+	_ Describer = (*ReadaheadFs)(nil)
+	_ Describer = (*ListingCacheFs)(nil)
+	_ Describer = (*BlockCacheFs)(nil)
+	_ Describer = (*ScannerFs)(nil)
+	_ Describer = (*HookFs)(nil)
+	_ Describer = (*InstrumentedFs)(nil)
+	_ Describer = (*IntegrityFs)(nil)
+	_ Describer = (*GcsFs)(nil)
+)
+
+func (u *BufferFs) Describe() Description {
+	var params []string
+	if u.preserveTimes {
+		params = append(params, param("preserve_times", true))
+	}
+	return Description{
+		Name:    u.Name(),
+		Params:  params,
+		Wrapped: []WrappedFs{{"base", u.base}, {"layer", u.layer}},
+	}
+}
+
+func (u *SizeCacheFS) Describe() Description {
+	params := []string{param("size", u.cacheSize), param("cache_time", u.cacheTime)}
+	if u.disk != nil {
+		params = append(params, param("min_free", u.disk.minFree))
+	}
+	if u.refresher != nil {
+		params = append(params, param("stale_while_revalidate", cap(u.refresher.slots)))
+	}
+	if u.attached {
+		params = append(params, param("attached", true))
+	}
+	return Description{
+		Name:    u.Name(),
+		Params:  params,
+		Wrapped: []WrappedFs{{"base", u.base}, {"cache", u.cache}},
+	}
+}
+
+func (u *CacheOnReadFs) Describe() Description {
+	params := []string{param("cache_time", u.cacheTime)}
+	if u.refresher != nil {
+		params = append(params, param("stale_while_revalidate", cap(u.refresher.slots)))
+	}
+	return Description{
+		Name:    u.Name(),
+		Params:  params,
+		Wrapped: []WrappedFs{{"base", u.base}, {"layer", u.layer}},
+	}
+}
+
+func (u *CopyOnWriteFs) Describe() Description {
+	return Description{Name: u.Name(), Wrapped: []WrappedFs{{"base", u.base}, {"layer", u.layer}}}
+}
+
+func (b *BasePathFs) Describe() Description {
+	return Description{
+		Name:    b.Name(),
+		Params:  []string{param("path", b.path)},
+		Wrapped: []WrappedFs{{"source", b.source}},
+	}
+}
+
+func (r *ReadOnlyFs) Describe() Description {
+	return Description{Name: r.Name(), Wrapped: []WrappedFs{{"source", r.source}}}
+}
+
+func (r *RegexpFs) Describe() Description {
+	return Description{
+		Name:    r.Name(),
+		Params:  []string{param("regexp", r.re)},
+		Wrapped: []WrappedFs{{"source", r.source}},
+	}
+}
+
+func (r *FilterFs) Describe() Description {
+	return Description{Name: r.Name(), Wrapped: []WrappedFs{{"source", r.source}}}
+}
+
+func (r *ReadaheadFs) Describe() Description {
+	return Description{
+		Name:    r.Name(),
+		Params:  []string{param("buffers", r.buffers), param("size", r.size)},
+		Wrapped: []WrappedFs{{"source", r.source}},
+	}
+}
+
+func (l *ListingCacheFs) Describe() Description {
+	return Description{
+		Name:    l.Name(),
+		Params:  []string{param("ttl", l.ttl), param("max_dirs", l.maxDirs)},
+		Wrapped: []WrappedFs{{"source", l.source}},
+	}
+}
+
+func (r *BlockCacheFs) Describe() Description {
+	return Description{Name: r.Name(), Wrapped: []WrappedFs{{"source", r.source}}}
+}
+
+func (s *ScannerFs) Describe() Description {
+	return Description{Name: s.Name(), Wrapped: []WrappedFs{{"source", s.source}}}
+}
+
+func (h *HookFs) Describe() Description {
+	return Description{Name: h.Name(), Wrapped: []WrappedFs{{"source", h.source}}}
+}
+
+func (m *InstrumentedFs) Describe() Description {
+	return Description{
+		Name:    m.Name(),
+		Params:  []string{param("layer", m.layer)},
+		Wrapped: []WrappedFs{{"source", m.source}},
+	}
+}
+
+func (i *IntegrityFs) Describe() Description {
+	var params []string
+	if i.verify {
+		params = append(params, param("verify", true))
+	}
+	return Description{Name: i.Name(), Params: params, Wrapped: []WrappedFs{{"source", i.source}}}
+}
+
+func (fs *GcsFs) Describe() Description {
+	params := []string{param("bucket", fs.bucketName)}
+	if fs.root != "" {
+		params = append(params, param("root", fs.root))
+	}
+	if fs.storageClass != "" {
+		params = append(params, param("storage_class", fs.storageClass))
+	}
+	return Description{Name: fs.Name(), Params: params}
+}
@@ -0,0 +1,27 @@
+package kafero
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestDescribeStack(t *testing.T) {
+	sfs, err := NewSizeCacheFS(NewReadOnlyFs(NewBasePathFs(NewMemMapFs(), "/data")), NewMemMapFs(), 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := NewBufferFs(sfs, NewRegexpFs(NewMemMapFs(), regexp.MustCompile(`\.txt$`)))
+	expected := `BufferFs
+  base: SizeCacheFS size=1000 cache_time=1m0s
+    base: ReadOnlyFilter
+      source: BasePathFs path=/data
+        source: MemMapFS
+    cache: MemMapFS
+  layer: RegexpFs regexp=\.txt$
+    source: MemMapFS
+`
+	if s := DescribeStack(fs); s != expected {
+		t.Fatalf("was expecting\n%s\ngot\n%s", expected, s)
+	}
+}
@@ -0,0 +1,56 @@
+package kafero
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+)
+
+// A DistributedLock coordinates the processes sharing a filesystem, such
+// as several SizeCacheFS on the same cache directory, with lock files or
+// an external lock service.
+type DistributedLock interface {
+	// Lock blocks until it holds the lock of key, a slash separated path,
+	// and returns the function releasing it.
+	Lock(key string) (unlock func(), err error)
+}
+
+// LockFiles is a DistributedLock holding the locks as lock files of a
+// filesystem, taken with LockFile, named after their key with a leading
+// dot and a .lock suffix. The lock files older than Stale are taken for
+// those of crashed processes and taken over.
+type LockFiles struct {
+	Fs Fs
+	// Stale is the age from which the lock files are removed, never if 0.
+	Stale time.Duration
+	// Poll is the interval between the attempts to take a lock, 10ms if 0.
+	Poll time.Duration
+}
+
+var _ DistributedLock = (*LockFiles)(nil)
+
+// LockPath returns the name of the lock file of key.
+func LockPath(key string) string {
+	return filepath.Join(filepath.Dir(key), "."+filepath.Base(key)+".lock")
+}
+
+func (l *LockFiles) Lock(key string) (func(), error) {
+	name := LockPath(key)
+	poll := l.Poll
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	if err := l.Fs.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		return nil, err
+	}
+	for {
+		lock, err := LockFile(l.Fs, name, l.Stale)
+		if err == nil {
+			return func() { _ = lock.Unlock() }, nil
+		}
+		if !errors.Is(err, ErrLocked) {
+			return nil, err
+		}
+		time.Sleep(poll)
+	}
+}
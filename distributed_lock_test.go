@@ -0,0 +1,85 @@
+package kafero
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLockFiles(t *testing.T) {
+	l := &LockFiles{Fs: NewMemMapFs(), Poll: time.Millisecond}
+	unlock, err := l.Lock("dir/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(l.Fs, LockPath("dir/file.txt")); !exists {
+		t.Fatal("was expecting the lock file")
+	}
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := l.Lock("dir/file.txt")
+		if err == nil {
+			unlock()
+		}
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("was expecting the second lock to wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	// The lock files of crashed processes expire
+	l.Stale = time.Millisecond
+	if _, err := l.Lock("stale"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := l.Lock("stale"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSizeCacheFSDistributedLock(t *testing.T) {
+	base := &countingOpenFs{Fs: &MemMapFs{}}
+	if err := WriteFile(base, "a.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Two processes sharing the cache directory
+	cache, lock := NewMemMapFs(), &LockFiles{Fs: NewMemMapFs(), Poll: time.Millisecond}
+	var fss []*SizeCacheFS
+	for i := 0; i < 2; i++ {
+		fs, err := NewSizeCacheFS(base, cache, 1e+9, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs.SetDistributedLock(lock)
+		fss = append(fss, fs)
+	}
+	var wg sync.WaitGroup
+	for _, fs := range fss {
+		wg.Add(1)
+		go func(fs *SizeCacheFS) {
+			defer wg.Done()
+			if data, err := ReadFile(fs, "a.txt"); err != nil || string(data) != "0123456789" {
+				t.Errorf("was expecting the content, got %q, %v", data, err)
+			}
+		}(fs)
+	}
+	wg.Wait()
+	// Every open also opens the base file, only one of them fills the cache
+	if opens := atomic.LoadInt32(&base.opens); opens != 3 {
+		t.Fatalf("was expecting 3 base opens, got %d", opens)
+	}
+	for _, fs := range fss {
+		if err := fs.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if exists, _ := Exists(lock.Fs, LockPath(".cacheindex")); exists {
+		t.Fatal("was expecting the index lock released")
+	}
+}
@@ -0,0 +1,118 @@
+package kafero
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Maximum number of directories listed concurrently by DirSize and Du
+const duWorkers = 16
+
+// DuEntry is the usage of the subtree rooted at Path: the total size of
+// its files and their count. Directories are not counted as files.
+type DuEntry struct {
+	Path  string
+	Size  int64
+	Files int64
+}
+
+func (a Afero) DirSize(root string) (int64, error) {
+	return DirSize(a.Fs, root)
+}
+
+func (a Afero) Du(root string, depth int) ([]DuEntry, error) {
+	return Du(a.Fs, root, depth)
+}
+
+// DirSize returns the total size of the files of the tree rooted at root.
+// Symlinks are not followed.
+func DirSize(fs Fs, root string) (int64, error) {
+	entries, err := Du(fs, root, 0)
+	if err != nil {
+		return 0, err
+	}
+	return entries[0].Size, nil
+}
+
+// Du returns the usage of the tree rooted at root and of its subtrees up to
+// depth levels below it, sorted by path, root first. The directories are
+// listed concurrently, which pays off on the remote backends. Symlinks are
+// not followed, and the files removed during the walk are skipped.
+func Du(fs Fs, root string, depth int) ([]DuEntry, error) {
+	w := &duWalker{fs: fs, sem: make(chan struct{}, duWorkers)}
+	res, err := w.walk(filepath.Clean(root), depth)
+	if err != nil {
+		return nil, err
+	}
+	entries := append([]DuEntry{res.entry}, res.subs...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, nil
+}
+
+type duWalker struct {
+	fs  Fs
+	sem chan struct{}
+}
+
+type duResult struct {
+	entry DuEntry
+	// The entries of the subtrees up to the depth of the walk
+	subs []DuEntry
+}
+
+// walk returns the usage of the directory at path and of its subtrees up
+// to depth levels below it. The subdirectories are walked in new goroutines
+// while workers are available, and in the calling one otherwise, so that
+// the walk can't deadlock waiting for workers.
+func (w *duWalker) walk(path string, depth int) (res duResult, err error) {
+	infos, err := readDirLstat(w.fs, path)
+	if err != nil {
+		return res, err
+	}
+	res.entry.Path = path
+	var dirs []string
+	for _, info := range infos {
+		if info.IsDir() {
+			dirs = append(dirs, filepath.Join(path, info.Name()))
+			continue
+		}
+		res.entry.Size += info.Size()
+		res.entry.Files++
+	}
+
+	subs := make([]duResult, len(dirs))
+	errs := make([]error, len(dirs))
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		select {
+		case w.sem <- struct{}{}:
+			wg.Add(1)
+			go func(i int, dir string) {
+				defer wg.Done()
+				subs[i], errs[i] = w.walk(dir, depth-1)
+				<-w.sem
+			}(i, dir)
+		default:
+			subs[i], errs[i] = w.walk(dir, depth-1)
+		}
+	}
+	wg.Wait()
+
+	for i, sub := range subs {
+		if os.IsNotExist(errs[i]) {
+			continue
+		}
+		if errs[i] != nil {
+			return res, errs[i]
+		}
+		res.entry.Size += sub.entry.Size
+		res.entry.Files += sub.entry.Files
+		if depth > 0 {
+			res.subs = append(res.subs, sub.entry)
+			res.subs = append(res.subs, sub.subs...)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,59 @@
+package kafero_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+func TestDu(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	fixture := tests.Fixture{
+		"a.txt":         "a",
+		"dir/b.txt":     "bb",
+		"dir/sub/c.txt": "ccc",
+		"dir/sub/d.txt": "dddd",
+		"other/e.txt":   "eeeee",
+		"empty/":        "",
+	}
+	if err := fixture.Load(fs, "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := kafero.DirSize(fs, "root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 15 {
+		t.Fatalf("was expecting a size of 15, got %d", size)
+	}
+
+	entries, err := kafero.Du(fs, "root", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []kafero.DuEntry{
+		{Path: "root", Size: 15, Files: 5},
+		{Path: filepath.Join("root", "dir"), Size: 9, Files: 3},
+		{Path: filepath.Join("root", "empty")},
+		{Path: filepath.Join("root", "other"), Size: 5, Files: 1},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Fatalf("was expecting %v, got %v", expected, entries)
+	}
+
+	entries, err = kafero.Du(fs, "root", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 5 || entries[2] != (kafero.DuEntry{Path: filepath.Join("root", "dir", "sub"), Size: 7, Files: 2}) {
+		t.Fatalf("was expecting root/dir/sub in the entries, got %v", entries)
+	}
+
+	if _, err := kafero.DirSize(fs, "missing"); err == nil {
+		t.Fatal("was expecting an error for a missing root")
+	}
+}
@@ -0,0 +1,169 @@
+package kafero
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ElectionOptions are the options of an Election.
+type ElectionOptions struct {
+	// TTL is the time after which the lock of a leader which stopped
+	// renewing it is taken over, 30s if 0.
+	TTL time.Duration
+	// RenewInterval is the interval between the renewals of the lock by
+	// the leader, TTL/3 if 0.
+	RenewInterval time.Duration
+	// Poll is the interval between the attempts of a candidate to take
+	// the lock, RenewInterval if 0.
+	Poll time.Duration
+	// OnElected is called once the instance is elected.
+	OnElected func()
+	// OnLost is called once the instance loses the lead, with the error of
+	// the renewal, unless it resigned: the instance must stop acting as
+	// the leader.
+	OnLost func(err error)
+}
+
+// An Election elects a single leader among the instances sharing a
+// filesystem, such as the instances of a pipeline writing to the same
+// output directory of an object store, with a lock file renewed by the
+// leader, taken with LockFile. A leader which stops renewing the lock,
+// such as a crashed instance, is replaced once the lock is TTL old.
+//
+// As with any lease, the lead is only known to be held up to the last
+// renewal: the writes of a leader must be short compared to TTL.
+type Election struct {
+	fs   Fs
+	path string
+	opts ElectionOptions
+
+	mu   sync.Mutex
+	lock *FileLock
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewElection returns an Election on the lock file path of fs.
+func NewElection(fs Fs, path string, opts ElectionOptions) *Election {
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.RenewInterval <= 0 {
+		opts.RenewInterval = opts.TTL / 3
+	}
+	if opts.Poll <= 0 {
+		opts.Poll = opts.RenewInterval
+	}
+	return &Election{fs: fs, path: path, opts: opts}
+}
+
+// Leader returns whether the instance is the leader.
+func (e *Election) Leader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.lock != nil
+}
+
+// Campaign blocks until the instance is elected, renewing the lock in the
+// background afterwards, or until ctx is done, returning its error.
+func (e *Election) Campaign(ctx context.Context) error {
+	for {
+		elected, err := e.TryCampaign()
+		if err != nil || elected {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.opts.Poll):
+		}
+	}
+}
+
+// TryCampaign tries to take the lead once, and returns whether the
+// instance is the leader.
+func (e *Election) TryCampaign() (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.lock != nil {
+		return true, nil
+	}
+	lock, err := LockFile(e.fs, e.path, e.opts.TTL)
+	if errors.Is(err, ErrLocked) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	e.lock = lock
+	e.stop, e.done = make(chan struct{}), make(chan struct{})
+	go e.renew(lock, e.stop, e.done)
+	if e.opts.OnElected != nil {
+		e.opts.OnElected()
+	}
+	return true, nil
+}
+
+// renew renews lock until stopped or lost.
+func (e *Election) renew(lock *FileLock, stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(e.opts.RenewInterval)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		err := lock.Refresh()
+		if err == nil {
+			renewed = time.Now()
+			continue
+		}
+		// The transient errors are retried until the lock may have been
+		// taken over
+		if !errors.Is(err, ErrLockLost) && time.Since(renewed) < e.opts.TTL {
+			continue
+		}
+		e.mu.Lock()
+		lost := e.lock == lock
+		if lost {
+			e.lock = nil
+		}
+		e.mu.Unlock()
+		if lost && e.opts.OnLost != nil {
+			e.opts.OnLost(err)
+		}
+		return
+	}
+}
+
+// Renew renews the lock immediately, such as before a write of the
+// leader, failing with ErrLockLost if the lead was lost.
+func (e *Election) Renew() error {
+	e.mu.Lock()
+	lock := e.lock
+	e.mu.Unlock()
+	if lock == nil {
+		return ErrLockLost
+	}
+	return lock.Refresh()
+}
+
+// Resign gives up the lead, if held, releasing the lock for the other
+// candidates.
+func (e *Election) Resign() error {
+	e.mu.Lock()
+	lock, stop, done := e.lock, e.stop, e.done
+	e.lock = nil
+	e.mu.Unlock()
+	if lock == nil {
+		return nil
+	}
+	close(stop)
+	<-done
+	return lock.Unlock()
+}
@@ -0,0 +1,65 @@
+package kafero
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestElection(t *testing.T) {
+	fs := NewMemMapFs()
+	elected := make(chan string, 2)
+	lost := make(chan error, 1)
+	newElection := func(name string) *Election {
+		return NewElection(fs, "/out/.leader", ElectionOptions{
+			TTL:           200 * time.Millisecond,
+			RenewInterval: 10 * time.Millisecond,
+			OnElected:     func() { elected <- name },
+			OnLost:        func(err error) { lost <- err },
+		})
+	}
+	a, b := newElection("a"), newElection("b")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.Campaign(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if <-elected != "a" || !a.Leader() {
+		t.Fatal("was expecting a elected")
+	}
+	if ok, err := b.TryCampaign(); err != nil || ok {
+		t.Fatalf("was expecting b not elected, got %v, %v", ok, err)
+	}
+	// The lock is renewed beyond its TTL
+	time.Sleep(400 * time.Millisecond)
+	if ok, _ := b.TryCampaign(); ok {
+		t.Fatal("was expecting the lock renewed")
+	}
+
+	campaign := make(chan error, 1)
+	go func() { campaign <- b.Campaign(ctx) }()
+	if err := a.Resign(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-campaign; err != nil {
+		t.Fatal(err)
+	}
+	if <-elected != "b" || a.Leader() {
+		t.Fatal("was expecting b elected")
+	}
+
+	// The leader whose lock is taken over loses the lead
+	if err := WriteFile(fs, "/out/.leader", []byte("other"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-lost; !errors.Is(err, ErrLockLost) {
+		t.Fatalf("was expecting ErrLockLost, got %v", err)
+	}
+	if b.Leader() {
+		t.Fatal("was expecting b to lose the lead")
+	}
+	if err := b.Renew(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("was expecting ErrLockLost, got %v", err)
+	}
+}
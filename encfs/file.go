@@ -0,0 +1,401 @@
+package encfs
+
+import (
+	"crypto/cipher"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/melaurent/kafero"
+)
+
+// A File is an encrypted file of a Fs. It can be read at any offset, and
+// written only sequentially, from its start if created or truncated, or
+// from its end if opened with os.O_APPEND. ReadAt is safe for concurrent
+// use.
+type File struct {
+	kafero.File
+	flag   int
+	parent *Fs
+	// The plain name of the file
+	name   string
+	closed bool
+	// Held by ReadAt
+	mu sync.Mutex
+	// The offset of Read and Seek
+	offset int64
+	// Set once read
+	reader *reader
+	// Set once written
+	writer *writer
+}
+
+// reader is the state of a File read.
+type reader struct {
+	header *header
+	aead   cipher.AEAD
+	// The plain size of the file, and its number of chunks
+	size   int64
+	chunks int64
+	// The last chunk decrypted
+	idx  int64
+	data []byte
+}
+
+// writer is the state of a File written.
+type writer struct {
+	header *header
+	aead   cipher.AEAD
+	// The plain content of the chunk being written, at offset in the
+	// source file
+	idx    int64
+	offset int64
+	buf    []byte
+	// Whether buf was written as the last chunk by Sync
+	synced bool
+	// The plain size of the file
+	size int64
+}
+
+// Name returns the plain name of the file.
+func (f *File) Name() string {
+	return f.name
+}
+
+func (f *File) writable() bool {
+	return f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+}
+
+// cipher returns the cipher of the file of header h.
+func (f *File) cipher(h *header) (cipher.AEAD, error) {
+	key, err := f.parent.keys.Key(h.keyID)
+	if err != nil {
+		return nil, err
+	}
+	return fileCipher(key, h.salt)
+}
+
+// openReader reads the header of the file.
+func (f *File) openReader() (*reader, error) {
+	if f.reader != nil {
+		return f.reader, nil
+	}
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := &reader{idx: -1}
+	if fi.Size() > 0 {
+		if r.header, err = readHeader(f.File); err != nil {
+			return nil, err
+		}
+		if r.aead, err = f.cipher(r.header); err != nil {
+			return nil, err
+		}
+		if r.chunks, err = r.header.chunks(fi.Size()); err != nil {
+			return nil, err
+		}
+		if r.size, err = r.header.plainSize(fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	f.reader = r
+	return r, nil
+}
+
+// chunk returns the plain content of the chunk idx.
+func (f *File) chunk(r *reader, idx int64) ([]byte, error) {
+	if idx == r.idx {
+		return r.data, nil
+	}
+	h := r.header
+	chunk := make([]byte, h.chunkSize+overhead)
+	n, err := f.File.ReadAt(chunk, h.chunkOffset(idx))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	last := idx == r.chunks-1
+	if !last && n < len(chunk) {
+		return nil, ErrCorrupted
+	}
+	data, err := h.open(r.aead, idx, last, chunk[:n])
+	if err != nil {
+		return nil, err
+	}
+	r.idx, r.data = idx, data
+	return data, nil
+}
+
+func (f *File) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, kafero.ErrFileClosed
+	}
+	if f.writer != nil {
+		return 0, syscall.EPERM
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.Name(), Err: syscall.EINVAL}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, err := f.openReader()
+	if err != nil {
+		return 0, err
+	}
+	// The files empty in the source have no header
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	cs := int64(r.header.chunkSize)
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		data, err := f.chunk(r, pos/cs)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], data[pos%cs:])
+	}
+	return n, nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek moves the offset of Read, the files written can't be seeked.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, kafero.ErrFileClosed
+	}
+	if f.writer != nil {
+		if whence == io.SeekCurrent && offset == 0 {
+			return f.writer.size, nil
+		}
+		return 0, syscall.EPERM
+	}
+	r, err := f.openReader()
+	if err != nil {
+		return 0, err
+	}
+	offset, err = kafero.SeekOffset(f.Name(), f.offset, r.size, offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// openWriter starts writing the file, from its end if appended to.
+func (f *File) openWriter() (*writer, error) {
+	if f.writer != nil {
+		return f.writer, nil
+	}
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.Size() > 0 && f.flag&os.O_TRUNC == 0 {
+		// The content can't be written in place, only appended to
+		if f.flag&os.O_APPEND == 0 {
+			return nil, syscall.EPERM
+		}
+		return f.openAppender()
+	}
+	id, key, err := f.parent.keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	h, err := newHeader(f.parent.chunkSize, id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := fileCipher(key, h.salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.File.Write(h.raw); err != nil {
+		return nil, err
+	}
+	f.writer = &writer{header: h, aead: aead, offset: int64(headerSize)}
+	return f.writer, nil
+}
+
+// openAppender starts writing the file from the content of its last
+// chunk, which is written again once not the last one anymore.
+func (f *File) openAppender() (*writer, error) {
+	r, err := f.openReader()
+	if err != nil {
+		return nil, err
+	}
+	f.reader = nil
+	idx := r.chunks - 1
+	data, err := f.chunk(r, idx)
+	if err != nil {
+		return nil, err
+	}
+	w := &writer{
+		header: r.header,
+		aead:   r.aead,
+		idx:    idx,
+		offset: r.header.chunkOffset(idx),
+		buf:    append(make([]byte, 0, r.header.chunkSize), data...),
+		size:   r.size,
+	}
+	if err := f.rewind(w); err != nil {
+		return nil, err
+	}
+	f.writer = w
+	return w, nil
+}
+
+// rewind truncates the source file to the chunk being written.
+func (f *File) rewind(w *writer) error {
+	if err := f.File.Truncate(w.offset); err != nil {
+		return err
+	}
+	_, err := f.File.Seek(w.offset, io.SeekStart)
+	return err
+}
+
+// flush writes the chunk being written, continuing with the next one if
+// not the last.
+func (f *File) flush(w *writer, last bool) error {
+	chunk, err := w.header.seal(w.aead, w.idx, last, w.buf)
+	if err != nil {
+		return err
+	}
+	if _, err := f.File.Write(chunk); err != nil {
+		return err
+	}
+	if !last {
+		w.idx++
+		w.offset += int64(len(chunk))
+		w.buf = w.buf[:0]
+	}
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	if !f.writable() {
+		return 0, &os.PathError{Op: "write", Path: f.Name(), Err: kafero.ErrReadOnlyHandle}
+	}
+	if f.closed {
+		return 0, kafero.ErrFileClosed
+	}
+	if f.reader != nil {
+		return 0, syscall.EPERM
+	}
+	w, err := f.openWriter()
+	if err != nil {
+		return 0, err
+	}
+	if w.synced && len(p) > 0 {
+		if err := f.rewind(w); err != nil {
+			return 0, err
+		}
+		w.synced = false
+	}
+	n := 0
+	for n < len(p) {
+		// The chunk full is the last one until more is written
+		if len(w.buf) == w.header.chunkSize {
+			if err := f.flush(w, false); err != nil {
+				return n, err
+			}
+		}
+		m := len(p) - n
+		if room := w.header.chunkSize - len(w.buf); m > room {
+			m = room
+		}
+		w.buf = append(w.buf, p[n:n+m]...)
+		n += m
+		w.size += int64(m)
+	}
+	return n, nil
+}
+
+func (f *File) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+// Sync writes the chunk being written as the last one, and syncs the
+// source file. The chunk is written again by the next write.
+func (f *File) Sync() error {
+	if w := f.writer; w != nil && !w.synced {
+		if err := f.flush(w, true); err != nil {
+			return err
+		}
+		w.synced = true
+	}
+	return f.File.Sync()
+}
+
+func (f *File) Close() error {
+	if f.closed {
+		return kafero.ErrFileClosed
+	}
+	f.closed = true
+	if w := f.writer; w != nil && !w.synced {
+		if err := f.flush(w, true); err != nil {
+			_ = f.File.Close()
+			return err
+		}
+	}
+	return f.File.Close()
+}
+
+// Stat returns the FileInfo of the file, with its plain size and name.
+func (f *File) Stat() (os.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return fi, err
+	}
+	info := &sizedInfo{FileInfo: fi, size: fi.Size()}
+	if f.parent.names != nil {
+		info.name = filepath.Base(f.name)
+	}
+	if f.writer != nil {
+		info.size = f.writer.size
+	} else if fi.Mode().IsRegular() && fi.Size() > 0 {
+		if h, err := readHeader(f.File); err == nil {
+			if size, err := h.plainSize(fi.Size()); err == nil {
+				info.size = size
+			}
+		}
+	}
+	if info.size == fi.Size() && info.name == "" {
+		return fi, nil
+	}
+	return info, nil
+}
+
+func (f *File) WriteAt(p []byte, off int64) (int, error) {
+	return 0, syscall.EPERM
+}
+
+func (f *File) Truncate(size int64) error {
+	return syscall.EPERM
+}
+
+func (f *File) CanMmap() bool {
+	return false
+}
+
+func (f *File) Mmap(off int64, len int, prot, flags int) ([]byte, error) {
+	return nil, syscall.EPERM
+}
+
+func (f *File) Munmap() error {
+	return syscall.EPERM
+}
@@ -0,0 +1,162 @@
+package encfs
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// An encrypted file starts with a header, holding the size of its chunks,
+// the salt deriving its key and the identifier of the key, padded with
+// zeros to maxKeyIDSize bytes, followed by its chunks, each made of its
+// nonce, its encrypted content and its tag. The header being of a fixed
+// size, the plain size of a file is computed from its size and the size of
+// its chunks.
+// The header is authenticated with every chunk, along with the index of
+// the chunk and whether it is the last one. Every file holds at least one
+// chunk, the last one, empty for an empty file. The files of the source
+// which are empty are read as empty files.
+
+const (
+	magic     = "KENC"
+	version   = 1
+	saltSize  = 32
+	nonceSize = 12
+	tagSize   = 16
+	// The size added to the plain content of a chunk
+	overhead = nonceSize + tagSize
+	// The size of the header up to the identifier of the key
+	fixedHeaderSize = len(magic) + 1 + 4 + saltSize + 1
+	maxKeyIDSize    = 255
+	headerSize      = fixedHeaderSize + maxKeyIDSize
+)
+
+type header struct {
+	// The encoded header
+	raw       []byte
+	chunkSize int
+	salt      []byte
+	keyID     string
+}
+
+// newHeader returns the header of a new file, with a random salt.
+func newHeader(chunkSize int, keyID string) (*header, error) {
+	if len(keyID) > maxKeyIDSize {
+		return nil, fmt.Errorf("key identifier %q too long", keyID)
+	}
+	raw := make([]byte, headerSize)
+	copy(raw, magic)
+	raw[len(magic)] = version
+	binary.BigEndian.PutUint32(raw[len(magic)+1:], uint32(chunkSize))
+	salt := raw[len(magic)+5 : len(magic)+5+saltSize]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	raw[fixedHeaderSize-1] = byte(len(keyID))
+	copy(raw[fixedHeaderSize:], keyID)
+	return &header{raw: raw, chunkSize: chunkSize, salt: salt, keyID: keyID}, nil
+}
+
+// readHeader reads the header at the start of r.
+func readHeader(r io.ReaderAt) (*header, error) {
+	raw := make([]byte, headerSize)
+	n, err := r.ReadAt(raw, 0)
+	if n < fixedHeaderSize {
+		if err == io.EOF {
+			return nil, ErrNotEncrypted
+		}
+		return nil, err
+	}
+	if string(raw[:len(magic)]) != magic || raw[len(magic)] != version {
+		return nil, ErrNotEncrypted
+	}
+	// The chunk size isn't authenticated before the first chunk is read
+	chunkSize := binary.BigEndian.Uint32(raw[len(magic)+1:])
+	if chunkSize == 0 || chunkSize > MaxChunkSize {
+		return nil, ErrCorrupted
+	}
+	if n < headerSize {
+		if err == io.EOF {
+			return nil, ErrCorrupted
+		}
+		return nil, err
+	}
+	keyID := raw[fixedHeaderSize : fixedHeaderSize+int(raw[fixedHeaderSize-1])]
+	return &header{
+		raw:       raw,
+		chunkSize: int(chunkSize),
+		salt:      raw[len(magic)+5 : len(magic)+5+saltSize],
+		keyID:     string(keyID),
+	}, nil
+}
+
+// chunkOffset returns the offset of the chunk idx in the file.
+func (h *header) chunkOffset(idx int64) int64 {
+	return int64(headerSize) + idx*int64(h.chunkSize+overhead)
+}
+
+// chunks returns the number of chunks of the file, of the given size.
+func (h *header) chunks(size int64) (int64, error) {
+	return chunks(size, h.chunkSize)
+}
+
+// plainSize returns the plain size of the file, of the given size.
+func (h *header) plainSize(size int64) (int64, error) {
+	return plainSize(size, h.chunkSize)
+}
+
+// chunks returns the number of chunks of an encrypted file of the given
+// size, with chunks of chunkSize bytes.
+func chunks(size int64, chunkSize int) (int64, error) {
+	body := size - int64(headerSize)
+	full := int64(chunkSize + overhead)
+	n := (body + full - 1) / full
+	if body < overhead || body-(n-1)*full < overhead {
+		return 0, ErrCorrupted
+	}
+	return n, nil
+}
+
+// plainSize returns the plain size of an encrypted file of the given size,
+// with chunks of chunkSize bytes.
+func plainSize(size int64, chunkSize int) (int64, error) {
+	n, err := chunks(size, chunkSize)
+	if err != nil {
+		return 0, err
+	}
+	return size - int64(headerSize) - n*overhead, nil
+}
+
+// aad returns the data authenticated with the chunk idx.
+func (h *header) aad(idx int64, last bool) []byte {
+	aad := make([]byte, len(h.raw)+9)
+	copy(aad, h.raw)
+	binary.BigEndian.PutUint64(aad[len(h.raw):], uint64(idx))
+	if last {
+		aad[len(aad)-1] = 1
+	}
+	return aad
+}
+
+// seal encrypts the chunk idx of plain content p, with a random nonce.
+func (h *header) seal(aead cipher.AEAD, idx int64, last bool, p []byte) ([]byte, error) {
+	chunk := make([]byte, nonceSize, nonceSize+len(p)+tagSize)
+	if _, err := io.ReadFull(rand.Reader, chunk); err != nil {
+		return nil, err
+	}
+	return aead.Seal(chunk, chunk, p, h.aad(idx, last)), nil
+}
+
+// open decrypts the chunk idx.
+func (h *header) open(aead cipher.AEAD, idx int64, last bool, chunk []byte) ([]byte, error) {
+	if len(chunk) < overhead {
+		return nil, ErrCorrupted
+	}
+	p, err := aead.Open(nil, chunk[:nonceSize], chunk[nonceSize:], h.aad(idx, last))
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+	return p, nil
+}
@@ -0,0 +1,382 @@
+// Package encfs encrypts the content of the files of a source Fs with
+// AES-GCM, so that they are stored encrypted at rest under keys of choice
+// while being read and written through the Fs interface as plain files.
+//
+// The files are encrypted in chunks, each with its own random nonce, under
+// a key derived for each file from a key of a KeyProvider and a random
+// salt. The chunks are bound to their position and to the end of the file,
+// so that the chunks reordered or the files truncated fail to decrypt. The
+// files can be read at any offset, but written only sequentially: created,
+// truncated or appended to. The names of the files and directories can be
+// encrypted as well, with EncryptNames.
+//
+// The plain sizes of the files are computed from their sizes in the source,
+// so that they are listed without being read: the size of the chunks must
+// stay the same for the life of the tree.
+package encfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// DefaultChunkSize is the size of the plain content of the chunks, 64KB.
+const DefaultChunkSize = 64 << 10
+
+// MaxChunkSize is the largest size of the plain content of the chunks,
+// 64MB. The headers of larger chunks are taken for corrupted, rather than
+// allocating them before their first chunk is authenticated.
+const MaxChunkSize = 64 << 20
+
+var (
+	// ErrNotEncrypted is returned reading a file which was not encrypted
+	// by an encfs Fs.
+	ErrNotEncrypted = errors.New("file not encrypted")
+	// ErrCorrupted is returned reading a file whose content doesn't
+	// decrypt: modified, truncated or encrypted under another key.
+	ErrCorrupted = errors.New("encrypted file corrupted")
+)
+
+// The Fs encrypts the files of its source with the keys of its
+// KeyProvider.
+type Fs struct {
+	kafero.Fs
+	keys      KeyProvider
+	chunkSize int
+	// Set if the names are encrypted
+	names *nameCipher
+}
+
+// An Option configures a Fs.
+type Option func(e *Fs)
+
+// ChunkSize sets the size of the plain content of the chunks of the files,
+// DefaultChunkSize by default. The reads fetch whole chunks, the writes
+// buffer one. The files written with chunks of another size are still
+// read, but listed with wrong sizes by Stat and Readdir, which compute
+// them from the size of the chunks. The sizes above MaxChunkSize are
+// ignored.
+func ChunkSize(size int) Option {
+	return func(e *Fs) {
+		if size > 0 && size <= MaxChunkSize {
+			e.chunkSize = size
+		}
+	}
+}
+
+// EncryptNames encrypts the names of the files and directories as well,
+// under keys derived from key, which must stay the same for the life of
+// the tree: unlike the keys of the content, it can't be rotated. The names
+// being bound to the path of their directory, renaming a directory renames
+// its entries one by one. The entries of the source whose names don't
+// decrypt, such as the files written to the source directly, aren't
+// listed.
+func EncryptNames(key []byte) Option {
+	return func(e *Fs) {
+		e.names = newNameCipher(key)
+	}
+}
+
+// NewFs returns a Fs encrypting the files of source with the keys of keys.
+func NewFs(source kafero.Fs, keys KeyProvider, opts ...Option) *Fs {
+	e := &Fs{Fs: source, keys: keys, chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+func (e *Fs) Name() string {
+	return "EncFs"
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (e *Fs) Unwrap() kafero.Fs {
+	return e.Fs
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (e *Fs) WithContext(ctx context.Context) kafero.Fs {
+	v := *e
+	v.Fs = kafero.WithContext(e.Fs, ctx)
+	return &v
+}
+
+var _ kafero.Describer = (*Fs)(nil)
+
+func (e *Fs) Describe() kafero.Description {
+	params := []string{"chunk_size=" + strconv.Itoa(e.chunkSize)}
+	if e.names != nil {
+		params = append(params, "encrypt_names=true")
+	}
+	return kafero.Description{
+		Name:    e.Name(),
+		Params:  params,
+		Wrapped: []kafero.WrappedFs{{Role: "source", Fs: e.Fs}},
+	}
+}
+
+// sourcePath returns the path in the source of the named file.
+func (e *Fs) sourcePath(name string) string {
+	if e.names == nil {
+		return name
+	}
+	return e.names.encryptPath(name)
+}
+
+// plainError returns err with the plain path name of the file, rather than
+// its path in the source, if it is a *os.PathError.
+func (e *Fs) plainError(err error, name string) error {
+	if perr, ok := err.(*os.PathError); ok && e.names != nil {
+		return &os.PathError{Op: perr.Op, Path: name, Err: perr.Err}
+	}
+	return err
+}
+
+// wrap returns the named file of e opened from the source file f.
+func (e *Fs) wrap(name string, f kafero.File, flag int) kafero.File {
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		return &dir{File: f, parent: e, name: name}
+	}
+	return &File{File: f, parent: e, name: name, flag: flag}
+}
+
+func (e *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	f, err := e.Fs.OpenFile(e.sourcePath(name), flag, perm)
+	if err != nil {
+		return nil, e.plainError(err, name)
+	}
+	return e.wrap(name, f, flag), nil
+}
+
+func (e *Fs) Open(name string) (kafero.File, error) {
+	f, err := e.Fs.Open(e.sourcePath(name))
+	if err != nil {
+		return nil, e.plainError(err, name)
+	}
+	return e.wrap(name, f, os.O_RDONLY), nil
+}
+
+func (e *Fs) Create(name string) (kafero.File, error) {
+	f, err := e.Fs.Create(e.sourcePath(name))
+	if err != nil {
+		return nil, e.plainError(err, name)
+	}
+	return &File{File: f, parent: e, name: name, flag: os.O_RDWR | os.O_CREATE | os.O_TRUNC}, nil
+}
+
+func (e *Fs) Mkdir(name string, perm os.FileMode) error {
+	return e.plainError(e.Fs.Mkdir(e.sourcePath(name), perm), name)
+}
+
+func (e *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return e.plainError(e.Fs.MkdirAll(e.sourcePath(path), perm), path)
+}
+
+func (e *Fs) Remove(name string) error {
+	return e.plainError(e.Fs.Remove(e.sourcePath(name)), name)
+}
+
+func (e *Fs) RemoveAll(path string) error {
+	return e.plainError(e.Fs.RemoveAll(e.sourcePath(path)), path)
+}
+
+// Rename renames the file oldname to newname. With the names encrypted,
+// a directory is renamed by creating newname and renaming its entries one
+// by one, which isn't atomic, oldname being left if it holds entries whose
+// names don't decrypt.
+func (e *Fs) Rename(oldname, newname string) error {
+	if e.names == nil {
+		return e.Fs.Rename(oldname, newname)
+	}
+	fi, err := e.Fs.Stat(e.sourcePath(oldname))
+	if err != nil {
+		return e.plainError(err, oldname)
+	}
+	if !fi.IsDir() {
+		err := e.Fs.Rename(e.sourcePath(oldname), e.sourcePath(newname))
+		if lerr, ok := err.(*os.LinkError); ok {
+			return &os.LinkError{Op: lerr.Op, Old: oldname, New: newname, Err: lerr.Err}
+		}
+		return e.plainError(err, oldname)
+	}
+	if err := e.MkdirAll(newname, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	names, err := kafero.ReadDirNames(e, oldname)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := e.Rename(filepath.Join(oldname, name), filepath.Join(newname, name)); err != nil {
+			return err
+		}
+	}
+	return e.Remove(oldname)
+}
+
+func (e *Fs) Chmod(name string, mode os.FileMode) error {
+	return e.plainError(e.Fs.Chmod(e.sourcePath(name), mode), name)
+}
+
+func (e *Fs) Chtimes(name string, atime, mtime time.Time) error {
+	return e.plainError(e.Fs.Chtimes(e.sourcePath(name), atime, mtime), name)
+}
+
+// Stat returns the FileInfo of the named file, with its plain size.
+func (e *Fs) Stat(name string) (os.FileInfo, error) {
+	src := e.sourcePath(name)
+	fi, err := e.Fs.Stat(src)
+	if err != nil {
+		return nil, e.plainError(err, name)
+	}
+	return e.plainInfo(filepath.Base(name), fi), nil
+}
+
+var _ kafero.Lstater = (*Fs)(nil)
+
+func (e *Fs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := e.Fs.(kafero.Lstater); ok {
+		src := e.sourcePath(name)
+		fi, lstat, err := lsf.LstatIfPossible(src)
+		if err != nil {
+			return nil, lstat, e.plainError(err, name)
+		}
+		return e.plainInfo(filepath.Base(name), fi), lstat, nil
+	}
+	fi, err := e.Stat(name)
+	return fi, false, err
+}
+
+// plainInfo returns fi, of a file of the source, with its plain size,
+// computed from its size without reading it, and its plain name if the
+// names are encrypted. The files whose size isn't the one of an encrypted
+// file keep it.
+func (e *Fs) plainInfo(name string, fi os.FileInfo) os.FileInfo {
+	info := &sizedInfo{FileInfo: fi, size: fi.Size()}
+	if e.names != nil {
+		info.name = name
+	}
+	if fi.Mode().IsRegular() && fi.Size() > 0 {
+		if size, err := plainSize(fi.Size(), e.chunkSize); err == nil {
+			info.size = size
+		}
+	}
+	if info.size == fi.Size() && info.name == "" {
+		return fi
+	}
+	return info
+}
+
+type sizedInfo struct {
+	os.FileInfo
+	size int64
+	// The plain name, if the names are encrypted
+	name string
+}
+
+func (fi *sizedInfo) Name() string {
+	if fi.name != "" {
+		return fi.name
+	}
+	return fi.FileInfo.Name()
+}
+
+func (fi *sizedInfo) Size() int64 {
+	return fi.size
+}
+
+// dir is a directory, whose entries are listed with their plain names and
+// sizes.
+type dir struct {
+	kafero.File
+	parent *Fs
+	// The plain name of the directory
+	name string
+}
+
+func (d *dir) Name() string {
+	return d.name
+}
+
+// Readdir lists the entries whose names decrypt, filling count with them
+// if positive.
+func (d *dir) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		fis, err := d.File.Readdir(count)
+		return d.plain(fis), err
+	}
+	var plain []os.FileInfo
+	for len(plain) < count {
+		fis, err := d.File.Readdir(count - len(plain))
+		plain = append(plain, d.plain(fis)...)
+		if err != nil {
+			if len(plain) > 0 {
+				return plain, nil
+			}
+			return nil, err
+		}
+	}
+	return plain, nil
+}
+
+// plain returns the entries fis of the source listed, with their plain
+// names and sizes.
+func (d *dir) plain(fis []os.FileInfo) []os.FileInfo {
+	plain := fis[:0]
+	for _, fi := range fis {
+		name := fi.Name()
+		if names := d.parent.names; names != nil {
+			var ok bool
+			if name, ok = names.decrypt(dirKey(d.name), name); !ok {
+				continue
+			}
+		}
+		plain = append(plain, d.parent.plainInfo(name, fi))
+	}
+	return plain
+}
+
+// Readdirnames lists the names which decrypt, filling n with them if
+// positive.
+func (d *dir) Readdirnames(n int) ([]string, error) {
+	if d.parent.names == nil {
+		return d.File.Readdirnames(n)
+	}
+	if n <= 0 {
+		names, err := d.File.Readdirnames(n)
+		return d.plainNames(names), err
+	}
+	var plain []string
+	for len(plain) < n {
+		names, err := d.File.Readdirnames(n - len(plain))
+		plain = append(plain, d.plainNames(names)...)
+		if err != nil {
+			if len(plain) > 0 {
+				return plain, nil
+			}
+			return nil, err
+		}
+	}
+	return plain, nil
+}
+
+// plainNames returns the names of the source listed which decrypt,
+// decrypted.
+func (d *dir) plainNames(names []string) []string {
+	plain := names[:0]
+	for _, name := range names {
+		if name, ok := d.parent.names.decrypt(dirKey(d.name), name); ok {
+			plain = append(plain, name)
+		}
+	}
+	return plain
+}
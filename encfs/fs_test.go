@@ -0,0 +1,425 @@
+package encfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestEncFs(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	fs := NewFs(base, StaticKey("k1", testKey), ChunkSize(16))
+
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		content := make([]byte, size)
+		for i := range content {
+			content[i] = byte('a' + i%26)
+		}
+		if err := kafero.WriteFile(fs, "file", content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := kafero.ReadFile(fs, "file")
+		if err != nil {
+			t.Fatalf("error reading %d bytes: %v", size, err)
+		}
+		if !bytes.Equal(data, content) {
+			t.Fatalf("was expecting %q, got %q", content, data)
+		}
+		fi, err := fs.Stat("file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Size() != int64(size) {
+			t.Fatalf("was expecting a size of %d, got %d", size, fi.Size())
+		}
+		if size >= 16 {
+			raw, _ := kafero.ReadFile(base, "file")
+			if bytes.Contains(raw, content) {
+				t.Fatalf("content stored in the clear")
+			}
+		}
+	}
+
+	// Random access
+	f, err := fs.Open("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b := make([]byte, 10)
+	if _, err := f.ReadAt(b, 12); err != nil || string(b) != "mnopqrstuv" {
+		t.Fatalf("error reading at 12: %q, %v", b, err)
+	}
+	if _, err := f.Seek(-4, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := ioutil.ReadAll(f)
+	if err != nil || string(rest) != "stuv" {
+		t.Fatalf("error reading the end: %q, %v", rest, err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Fatalf("wrote a file opened read only")
+	}
+
+	// No in place writes
+	f, err = fs.OpenFile("file", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Fatalf("wrote a file in place")
+	}
+	f.Close()
+}
+
+func TestEncFsAppend(t *testing.T) {
+	fs := NewFs(kafero.NewMemMapFs(), StaticKey("k1", testKey), ChunkSize(8))
+	if err := kafero.WriteFile(fs, "log", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.OpenFile("log", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	// Synced, then written further
+	if err := f.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := kafero.ReadFile(fs, "log"); err != nil || string(data) != "0123456789abc" {
+		t.Fatalf("error reading the synced file: %q, %v", data, err)
+	}
+	if _, err := f.Write([]byte("defgh")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := kafero.ReadFile(fs, "log"); err != nil || string(data) != "0123456789abcdefgh" {
+		t.Fatalf("error reading the appended file: %q, %v", data, err)
+	}
+}
+
+func TestEncFsCorrupted(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	fs := NewFs(base, StaticKey("k1", testKey), ChunkSize(8))
+	content := []byte("0123456789abcdefghij")
+	if err := kafero.WriteFile(fs, "file", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := kafero.ReadFile(base, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := readHeader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	full := 8 + overhead
+
+	tampered := append([]byte(nil), raw...)
+	tampered[len(tampered)-1] ^= 1
+	// The last chunk dropped
+	truncated := raw[:h.chunkOffset(2)]
+	// The first two chunks swapped
+	swapped := append([]byte(nil), raw...)
+	copy(swapped[h.chunkOffset(0):], raw[h.chunkOffset(1):h.chunkOffset(1)+int64(full)])
+	copy(swapped[h.chunkOffset(1):], raw[h.chunkOffset(0):h.chunkOffset(0)+int64(full)])
+
+	for name, raw := range map[string][]byte{"tampered": tampered, "truncated": truncated, "swapped": swapped} {
+		if err := kafero.WriteFile(base, "file", raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := kafero.ReadFile(fs, "file"); err != ErrCorrupted {
+			t.Errorf("%s: was expecting ErrCorrupted, got %v", name, err)
+		}
+	}
+
+	// Chunks of 4GB aren't allocated
+	huge := append([]byte(nil), raw...)
+	binary.BigEndian.PutUint32(huge[len(magic)+1:], 1<<32-1)
+	if _, err := readHeader(bytes.NewReader(huge)); err != ErrCorrupted {
+		t.Errorf("was expecting ErrCorrupted, got %v", err)
+	}
+
+	if err := kafero.WriteFile(base, "plain", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kafero.ReadFile(fs, "plain"); err != ErrNotEncrypted {
+		t.Errorf("was expecting ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestEncFsKeyRotation(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	keys := StaticKey("k1", testKey)
+	fs := NewFs(base, keys)
+	if err := kafero.WriteFile(fs, "old", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	keys.Keys["k2"] = []byte("another key")
+	keys.Current = "k2"
+	if err := kafero.WriteFile(fs, "new", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"old", "new"} {
+		if data, err := kafero.ReadFile(fs, name); err != nil || string(data) != name {
+			t.Errorf("error reading %s: %q, %v", name, data, err)
+		}
+	}
+
+	// Under another key with the same identifier
+	other := NewFs(base, StaticKey("k1", []byte("wrong key")))
+	if _, err := kafero.ReadFile(other, "old"); err != ErrCorrupted {
+		t.Errorf("was expecting ErrCorrupted, got %v", err)
+	}
+	delete(keys.Keys, "k1")
+	if _, err := kafero.ReadFile(fs, "old"); err == nil {
+		t.Errorf("read a file of an unknown key")
+	}
+}
+
+// openCountingFs counts the files opened.
+type openCountingFs struct {
+	kafero.Fs
+	opens int
+}
+
+func (c *openCountingFs) Open(name string) (kafero.File, error) {
+	c.opens++
+	return c.Fs.Open(name)
+}
+
+func (c *openCountingFs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	c.opens++
+	return c.Fs.OpenFile(name, flag, perm)
+}
+
+func TestEncFsNames(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	nameKey := []byte("names key")
+	fs := NewFs(base, StaticKey("k1", testKey), EncryptNames(nameKey))
+	for name, content := range map[string]string{
+		"/data/2024/ticks.bin": "0123456789",
+		"/data/other.bin":      "abc",
+		"/x":                   "root x",
+		"/data/x":              "data x",
+	} {
+		if err := fs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := kafero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Neither the names nor the structure leak to the source
+	err := kafero.Walk(base, "/", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		for _, plain := range []string{"data", "2024", "ticks", "other"} {
+			if strings.Contains(path, plain) || info.Name() == "x" {
+				t.Errorf("name %s stored in the clear", path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := fs.sourcePath("/x")
+	if data := fs.sourcePath("/data/x"); filepath.Base(data) == src {
+		t.Fatal("was expecting the same names in different directories to encrypt differently")
+	}
+
+	// Read back by another Fs with the same key
+	fs = NewFs(base, StaticKey("k1", testKey), EncryptNames(nameKey))
+	if data, err := kafero.ReadFile(fs, "/data/2024/ticks.bin"); err != nil || string(data) != "0123456789" {
+		t.Fatalf("error reading the file: %q, %v", data, err)
+	}
+	fi, err := fs.Stat("/data/2024/ticks.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Name() != "ticks.bin" || fi.Size() != 10 {
+		t.Fatalf("was expecting ticks.bin of 10 bytes, got %s of %d", fi.Name(), fi.Size())
+	}
+	f, err := fs.Open("/data/2024/ticks.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "/data/2024/ticks.bin" {
+		t.Fatalf("was expecting the plain name of the file, got %s", f.Name())
+	}
+	f.Close()
+
+	// The entries written to the source directly aren't listed
+	if err := kafero.WriteFile(base, filepath.Join(fs.sourcePath("/data"), "foreign"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err := kafero.ReadDirNames(fs, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "2024,other.bin,x" {
+		t.Fatalf("was expecting 2024,other.bin,x, got %v", names)
+	}
+	infos, err := kafero.ReadDir(fs, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 3 || infos[1].Name() != "other.bin" || infos[1].Size() != 3 {
+		t.Fatalf("was expecting the plain names and sizes, got %v", infos)
+	}
+	d, err := fs.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for {
+		infos, err := d.Readdir(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || len(infos) != 1 {
+			t.Fatalf("was expecting an entry, got %v, %v", infos, err)
+		}
+		listed = append(listed, infos[0].Name())
+	}
+	d.Close()
+	sort.Strings(listed)
+	if strings.Join(listed, ",") != "2024,other.bin,x" {
+		t.Fatalf("was expecting 2024,other.bin,x, got %v", listed)
+	}
+
+	// The sizes are listed without reading the files
+	counting := &openCountingFs{Fs: base}
+	fs = NewFs(counting, StaticKey("k1", testKey), EncryptNames(nameKey))
+	if fi, err := fs.Stat("/data/other.bin"); err != nil || fi.Size() != 3 {
+		t.Fatalf("was expecting other.bin of 3 bytes, got %v, %v", fi, err)
+	}
+	if _, err := kafero.ReadDir(fs, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	if counting.opens != 1 {
+		t.Fatalf("was expecting only the directory opened, got %d opens", counting.opens)
+	}
+
+	// The directories are renamed with their entries
+	if err := base.Remove(filepath.Join(fs.sourcePath("/data"), "foreign")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/data", "/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := kafero.ReadFile(fs, "/archive/2024/ticks.bin"); err != nil || string(data) != "0123456789" {
+		t.Fatalf("error reading the renamed file: %q, %v", data, err)
+	}
+	if _, err := fs.Stat("/data"); !os.IsNotExist(err) {
+		t.Fatalf("was expecting the old directory removed, got %v", err)
+	}
+
+	_, err = fs.Open("missing")
+	if perr, ok := err.(*os.PathError); !ok || perr.Path != "missing" || !os.IsNotExist(err) {
+		t.Fatalf("was expecting a not exist error on the plain path, got %v", err)
+	}
+}
+
+// renameFailingFs fails the renames from the failAt-th one.
+type renameFailingFs struct {
+	kafero.Fs
+	renames, failAt int
+}
+
+func (f *renameFailingFs) Rename(oldname, newname string) error {
+	f.renames++
+	if f.failAt > 0 && f.renames >= f.failAt {
+		return &os.PathError{Op: "rename", Path: oldname, Err: errors.New("interrupted")}
+	}
+	return f.Fs.Rename(oldname, newname)
+}
+
+func TestEncFsRotate(t *testing.T) {
+	base := &renameFailingFs{Fs: kafero.NewMemMapFs()}
+	keys := StaticKey("k1", testKey)
+	fs := NewFs(base, keys, ChunkSize(8), EncryptNames([]byte("names key")))
+	files := map[string]string{
+		"/data/a/1": "0123456789abcdef",
+		"/data/a/2": "2",
+		"/data/b/3": "3",
+		"/data/c":   "",
+		// Named as the copies of the files rotated once were
+		"/data/b/.3.encfs-rotating": "user",
+	}
+	for name, content := range files {
+		if err := fs.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := kafero.WriteFile(fs, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys.Keys["k2"] = []byte("another key")
+	keys.Current = "k2"
+	if err := kafero.WriteFile(fs, "/data/a/new", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files["/data/a/new"] = "new"
+
+	// Interrupted after the first file, whose rotation is saved
+	base.failAt = 2
+	if err := Rotate(fs, "/data", "k1", "k2", RotateCheckpoint(1)); err == nil {
+		t.Fatal("was expecting the rotation interrupted")
+	}
+	progress, err := kafero.ReadFile(fs, "/data/"+ProgressFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(progress) != "k1\nk2\n/data/a/1" {
+		t.Fatalf("was expecting the progress saved after /data/a/1, got %q", progress)
+	}
+	// A copy left by a crash
+	if err := kafero.WriteFile(fs, "/data/"+RotatingDir+"/file", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	base.failAt = 0
+	if err := Rotate(fs, "/data", "k1", "k2"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := kafero.Exists(fs, "/data/"+ProgressFile); exists {
+		t.Fatal("was expecting the progress removed")
+	}
+	if exists, _ := kafero.Exists(fs, "/data/"+RotatingDir); exists {
+		t.Fatal("was expecting the copies of the files rotated removed")
+	}
+
+	// Readable without the old key
+	delete(keys.Keys, "k1")
+	for name, content := range files {
+		if data, err := kafero.ReadFile(fs, name); err != nil || string(data) != content {
+			t.Errorf("error reading %s: %q, %v", name, data, err)
+		}
+	}
+	names, err := kafero.ReadDirNames(fs, "/data/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(names, ",") != "1,2,new" {
+		t.Fatalf("was expecting 1,2,new, got %v", names)
+	}
+}
@@ -0,0 +1,59 @@
+package encfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// A KeyProvider provides the keys encrypting the files, identified so that
+// they can be rotated: the new files are encrypted with the current key,
+// the files written before keep being decrypted with the key they were
+// encrypted with. The keys can be of any length, 32 random bytes are
+// recommended.
+type KeyProvider interface {
+	// CurrentKey returns the key encrypting the new files, with its
+	// identifier, of 255 bytes at most.
+	CurrentKey() (id string, key []byte, err error)
+	// Key returns the key identified by id.
+	Key(id string) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider of a fixed set of keys by identifier.
+type StaticKeys struct {
+	// The identifier of the key encrypting the new files
+	Current string
+	Keys    map[string][]byte
+}
+
+// StaticKey returns a KeyProvider of the single key, identified by id.
+func StaticKey(id string, key []byte) *StaticKeys {
+	return &StaticKeys{Current: id, Keys: map[string][]byte{id: key}}
+}
+
+func (k *StaticKeys) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+func (k *StaticKeys) Key(id string) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", id)
+	}
+	return key, nil
+}
+
+// fileCipher returns the cipher of a file, under the key derived from key
+// and its salt.
+func fileCipher(key, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,107 @@
+package encfs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base32"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// The names of the files and directories, when encrypted, are encrypted
+// deterministically so that a file is opened without listing its
+// directory. As with AES-SIV, the IV of a name is a MAC of the name and of
+// the plain path of its directory, under which the name is encrypted with
+// AES-CTR: the same names in different directories don't encrypt alike,
+// and the names modified don't decrypt. The encrypted names are encoded in
+// unpadded base32, of a single case for the case insensitive filesystems,
+// so that the names of up to 140 bytes fit in the 255 bytes of most
+// filesystems.
+
+var nameEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type nameCipher struct {
+	macKey []byte
+	block  cipher.Block
+}
+
+// newNameCipher returns the cipher of the names under keys derived from
+// key.
+func newNameCipher(key []byte) *nameCipher {
+	// Can't fail, the key derived being of 32 bytes
+	block, _ := aes.NewCipher(deriveKey(key, "name encryption"))
+	return &nameCipher{macKey: deriveKey(key, "name authentication"), block: block}
+}
+
+// deriveKey returns the key for purpose derived from key.
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// siv returns the synthetic IV of name in the directory dir.
+func (c *nameCipher) siv(dir, name string) []byte {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(dir))
+	mac.Write([]byte{0})
+	mac.Write([]byte(name))
+	return mac.Sum(nil)[:aes.BlockSize]
+}
+
+// encrypt returns the encrypted name of name in the directory dir, as
+// returned by dirKey.
+func (c *nameCipher) encrypt(dir, name string) string {
+	iv := c.siv(dir, name)
+	raw := make([]byte, len(iv)+len(name))
+	copy(raw, iv)
+	cipher.NewCTR(c.block, iv).XORKeyStream(raw[len(iv):], []byte(name))
+	return nameEncoding.EncodeToString(raw)
+}
+
+// decrypt returns the plain name of the encrypted name in the directory
+// dir, false if it doesn't decrypt.
+func (c *nameCipher) decrypt(dir, name string) (string, bool) {
+	raw, err := nameEncoding.DecodeString(name)
+	// The names not canonically encoded would list a file twice
+	if err != nil || len(raw) <= aes.BlockSize || nameEncoding.EncodeToString(raw) != name {
+		return "", false
+	}
+	iv := raw[:aes.BlockSize]
+	plain := make([]byte, len(raw)-aes.BlockSize)
+	cipher.NewCTR(c.block, iv).XORKeyStream(plain, raw[aes.BlockSize:])
+	if !hmac.Equal(iv, c.siv(dir, string(plain))) {
+		return "", false
+	}
+	return string(plain), true
+}
+
+// dirKey returns the plain path of the directory dir bound to the names of
+// its entries, the same whether dir is absolute or relative.
+func dirKey(dir string) string {
+	dir = strings.Trim(filepath.ToSlash(filepath.Clean(dir)), "/")
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// encryptPath returns the path in the source of the plain path name.
+func (c *nameCipher) encryptPath(name string) string {
+	vol := filepath.VolumeName(name)
+	elems := strings.Split(filepath.ToSlash(filepath.Clean(name[len(vol):])), "/")
+	dir := ""
+	for i, elem := range elems {
+		if elem == "" || elem == "." {
+			continue
+		}
+		if elem != ".." {
+			elems[i] = c.encrypt(dir, elem)
+		}
+		dir = path.Join(dir, elem)
+	}
+	return vol + filepath.FromSlash(strings.Join(elems, "/"))
+}
@@ -0,0 +1,217 @@
+package encfs
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/melaurent/kafero"
+)
+
+// ProgressFile is the name of the file, in the root of a rotation, holding
+// its progress until it is done.
+const ProgressFile = ".encfs-rotation"
+
+// RotatingDir is the name of the directory, in the root of a rotation,
+// holding the copy of the file being rotated, renamed over it once
+// complete. It is removed when the rotation is done or resumed.
+const RotatingDir = ".encfs-rotating"
+
+// A RotateOption configures a Rotate.
+type RotateOption func(r *rotation)
+
+// RotateCheckpoint sets the number of files rotated between the saves of
+// the progress, 100 by default.
+func RotateCheckpoint(n int) RotateOption {
+	return func(r *rotation) {
+		if n > 0 {
+			r.checkpoint = n
+		}
+	}
+}
+
+// fixedKey is a KeyProvider encrypting the new files under the key id.
+type fixedKey struct {
+	KeyProvider
+	id string
+}
+
+func (k fixedKey) CurrentKey() (string, []byte, error) {
+	key, err := k.Key(k.id)
+	return k.id, key, err
+}
+
+type rotation struct {
+	fs *Fs
+	// fs encrypting under the new key
+	to             *Fs
+	oldKey, newKey string
+	progress       string
+	tmpDir         string
+	checkpoint     int
+	// The last file rotated, and the number of files rotated since the
+	// progress was saved
+	last    string
+	pending int
+}
+
+// Rotate re-encrypts under the key newKey the files of the tree root of fs
+// encrypted under the key oldKey, both provided by the KeyProvider of fs.
+// The content of each file is streamed to a temporary file renamed over
+// it, so that the files stay readable if the rotation is interrupted. Its
+// progress is saved to the file ProgressFile of root, encrypted as well,
+// from which a rotation of the same keys resumes, skipping without reading
+// them the files walked before the last one rotated. The files added
+// there since under oldKey are then left, the new files being encrypted
+// under the current key.
+func Rotate(fs *Fs, root, oldKey, newKey string, opts ...RotateOption) error {
+	if _, err := fs.keys.Key(newKey); err != nil {
+		return err
+	}
+	to := *fs
+	to.keys = fixedKey{KeyProvider: fs.keys, id: newKey}
+	r := &rotation{
+		fs:         fs,
+		to:         &to,
+		oldKey:     oldKey,
+		newKey:     newKey,
+		progress:   filepath.Join(root, ProgressFile),
+		tmpDir:     filepath.Join(root, RotatingDir),
+		checkpoint: 100,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := r.load(); err != nil {
+		return err
+	}
+	// Left by an interrupted rotation
+	if err := fs.RemoveAll(r.tmpDir); err != nil {
+		return err
+	}
+	if err := kafero.Walk(fs, root, r.visit); err != nil {
+		if serr := r.save(); serr != nil {
+			return serr
+		}
+		return err
+	}
+	if err := fs.RemoveAll(r.tmpDir); err != nil {
+		return err
+	}
+	if err := fs.Remove(r.progress); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// load loads the progress of an interrupted rotation of the same keys.
+func (r *rotation) load() error {
+	data, err := kafero.ReadFile(r.fs, r.progress)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitN(string(data), "\n", 3)
+	if len(lines) == 3 && lines[0] == r.oldKey && lines[1] == r.newKey {
+		r.last = lines[2]
+	}
+	return nil
+}
+
+// save saves the progress, if any file was rotated since last saved.
+func (r *rotation) save() error {
+	if r.pending == 0 {
+		return nil
+	}
+	r.pending = 0
+	return kafero.WriteFile(r.fs, r.progress, []byte(r.oldKey+"\n"+r.newKey+"\n"+r.last), 0600)
+}
+
+func (r *rotation) visit(path string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && filepath.Clean(path) == r.tmpDir {
+		return filepath.SkipDir
+	}
+	if !info.Mode().IsRegular() || filepath.Clean(path) == r.progress {
+		return nil
+	}
+	if r.last != "" && !walkedBefore(r.last, path) {
+		return nil
+	}
+	rotated, err := r.rotate(path, info)
+	if err != nil || !rotated {
+		return err
+	}
+	r.last = path
+	r.pending++
+	if r.pending >= r.checkpoint {
+		return r.save()
+	}
+	return nil
+}
+
+// rotate re-encrypts the file path if encrypted under the old key.
+func (r *rotation) rotate(path string, info os.FileInfo) (bool, error) {
+	f, err := r.fs.Fs.Open(r.fs.sourcePath(path))
+	if err != nil {
+		return false, r.fs.plainError(err, path)
+	}
+	h, err := readHeader(f)
+	_ = f.Close()
+	if err == ErrNotEncrypted {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if h.keyID != r.oldKey {
+		return false, nil
+	}
+
+	src, err := r.fs.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+	if err := r.fs.MkdirAll(r.tmpDir, 0700); err != nil {
+		return false, err
+	}
+	tmp := filepath.Join(r.tmpDir, "file")
+	dst, err := r.to.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = r.to.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = r.to.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = r.to.Remove(tmp)
+		return false, err
+	}
+	return true, nil
+}
+
+// walkedBefore reports whether Walk visits the path a before b, walking
+// the entries of the directories in lexical order.
+func walkedBefore(a, b string) bool {
+	ea := strings.Split(filepath.ToSlash(filepath.Clean(a)), "/")
+	eb := strings.Split(filepath.ToSlash(filepath.Clean(b)), "/")
+	for i := 0; i < len(ea) && i < len(eb); i++ {
+		if ea[i] != eb[i] {
+			return ea[i] < eb[i]
+		}
+	}
+	return len(ea) < len(eb)
+}
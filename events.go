@@ -0,0 +1,170 @@
+package kafero
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// An EventType is the kind of change of an Event.
+type EventType string
+
+const (
+	EventCreate EventType = "create"
+	EventUpdate EventType = "update"
+	EventDelete EventType = "delete"
+)
+
+// An Event is a change of a file made through a filesystem wrapped with
+// WithEvents. The renames are a deletion followed by a creation.
+type Event struct {
+	Type EventType
+	Path string
+	// Size is the size of the file created or updated.
+	Size int64
+	// Hash is the hex encoded SHA-256 of the content of the file created
+	// or updated, if the hashes are enabled.
+	Hash string
+	Time time.Time
+}
+
+// An EventSink publishes the events, to a channel, NATS, Kafka, or any
+// other bus.
+type EventSink interface {
+	Publish(e Event) error
+}
+
+// ChanSink is an EventSink sending the events to a channel, blocking until
+// they are received.
+type ChanSink chan<- Event
+
+func (c ChanSink) Publish(e Event) error {
+	c <- e
+	return nil
+}
+
+// EventOptions are the options of WithEvents.
+type EventOptions struct {
+	// Hash enables the hashes of the events, read from the XattrSHA256
+	// attribute if the filesystem has it, or computed from the content.
+	Hash bool
+	// OnError is called with the events the sink failed to publish, which
+	// are dropped otherwise.
+	OnError func(e Event, err error)
+	// Clock tells the time of the events, the system time if nil.
+	Clock Clock
+}
+
+type eventPublisher struct {
+	fs   Fs
+	sink EventSink
+	opts EventOptions
+	mu   sync.Mutex
+	// The files being created, counted by handle
+	creating map[string]int
+}
+
+// WithEvents returns fs wrapped in a HookFs publishing the changes of the
+// files to sink once done, so that other systems can react to the writes
+// made through kafero. The creations of empty directories are not
+// published, and the removals and renames of trees are published for
+// their root only.
+func WithEvents(fs Fs, sink EventSink, opts EventOptions) Fs {
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	p := &eventPublisher{fs: fs, sink: sink, opts: opts, creating: make(map[string]int)}
+	return WithHooks(fs, Hooks{
+		BeforeOpen:  p.beforeOpen,
+		AfterWrite:  p.afterWrite,
+		AfterRemove: p.afterRemove,
+		AfterRename: p.afterRename,
+	})
+}
+
+// beforeOpen remembers the files about to be created.
+func (p *eventPublisher) beforeOpen(name string, flag int) error {
+	if flag&os.O_CREATE == 0 {
+		return nil
+	}
+	if _, err := p.fs.Stat(name); os.IsNotExist(err) {
+		p.mu.Lock()
+		p.creating[name]++
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+func (p *eventPublisher) afterWrite(name string) {
+	typ := EventUpdate
+	p.mu.Lock()
+	if n := p.creating[name]; n > 0 {
+		typ = EventCreate
+		if n == 1 {
+			delete(p.creating, name)
+		} else {
+			p.creating[name] = n - 1
+		}
+	}
+	p.mu.Unlock()
+	p.publishFile(typ, name)
+}
+
+func (p *eventPublisher) afterRemove(name string) {
+	p.publish(Event{Type: EventDelete, Path: name})
+}
+
+func (p *eventPublisher) afterRename(oldname, newname string) {
+	p.publish(Event{Type: EventDelete, Path: oldname})
+	p.publishFile(EventCreate, newname)
+}
+
+// publishFile publishes the change of the file name, with its size and
+// hash unless a directory.
+func (p *eventPublisher) publishFile(typ EventType, name string) {
+	e := Event{Type: typ, Path: name}
+	info, err := p.fs.Stat(name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		p.publish(e)
+		return
+	}
+	e.Size = info.Size()
+	if p.opts.Hash {
+		if e.Hash, err = p.hash(name); err != nil {
+			if p.opts.OnError != nil {
+				p.opts.OnError(e, err)
+			}
+			return
+		}
+	}
+	p.publish(e)
+}
+
+func (p *eventPublisher) hash(name string) (string, error) {
+	if sum, err := Getxattr(p.fs, name, XattrSHA256); err == nil && len(sum) > 0 {
+		return string(sum), nil
+	}
+	f, err := p.fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (p *eventPublisher) publish(e Event) {
+	e.Time = p.opts.Clock.Now()
+	if err := p.sink.Publish(e); err != nil && p.opts.OnError != nil {
+		p.opts.OnError(e, err)
+	}
+}
@@ -0,0 +1,66 @@
+package kafero
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type sliceSink struct {
+	events []Event
+	err    error
+}
+
+func (s *sliceSink) Publish(e Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, e)
+	return nil
+}
+
+func TestWithEvents(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	sink := &sliceSink{}
+	fs := WithEvents(NewMemMapFs(), sink, EventOptions{Hash: true, Clock: clock})
+
+	if err := WriteFile(fs, "/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/a.txt", []byte("aa"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/a.txt", "/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []Event{
+		{Type: EventCreate, Path: "/a.txt", Size: 1, Hash: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb"},
+		{Type: EventUpdate, Path: "/a.txt", Size: 2, Hash: "961b6dd3ede3cb8ecbaacbd68de040cd78eb2ed5889130cceb4c49268ea4d506"},
+		{Type: EventDelete, Path: "/a.txt"},
+		{Type: EventCreate, Path: "/b.txt", Size: 2, Hash: "961b6dd3ede3cb8ecbaacbd68de040cd78eb2ed5889130cceb4c49268ea4d506"},
+		{Type: EventDelete, Path: "/b.txt"},
+	}
+	if len(sink.events) != len(expected) {
+		t.Fatalf("was expecting %d events, got %v", len(expected), sink.events)
+	}
+	for i, e := range expected {
+		e.Time = clock.Now()
+		if sink.events[i] != e {
+			t.Fatalf("was expecting %v, got %v", e, sink.events[i])
+		}
+	}
+
+	// The events the sink fails to publish are reported
+	sink.err = errors.New("unavailable")
+	var failed []Event
+	fs = WithEvents(NewMemMapFs(), sink, EventOptions{OnError: func(e Event, err error) { failed = append(failed, e) }})
+	if err := WriteFile(fs, "/c.txt", []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Path != "/c.txt" {
+		t.Fatalf("was expecting the event of /c.txt to fail, got %v", failed)
+	}
+}
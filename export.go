@@ -0,0 +1,254 @@
+package kafero
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// An ArchiveFormat is the format of the streams of Export and Import.
+type ArchiveFormat int
+
+const (
+	TarFormat ArchiveFormat = iota
+	ZipFormat
+)
+
+func (f ArchiveFormat) String() string {
+	switch f {
+	case TarFormat:
+		return "tar"
+	case ZipFormat:
+		return "zip"
+	}
+	return fmt.Sprintf("ArchiveFormat(%d)", int(f))
+}
+
+// ExportOptions are the options of Export.
+type ExportOptions struct {
+	// Include are the patterns, in the filepath.Match syntax, of the paths
+	// relative to the root to export, all of them if empty. A path is
+	// matched if it, or any of its parent directories, matches a pattern,
+	// so "logs" and "data/*.csv" cover the whole logs tree and the csv
+	// files of data.
+	Include []string
+	// Exclude are the patterns of the paths not to export, matched as
+	// Include.
+	Exclude []string
+}
+
+// matchesAny returns true if rel, or any of its parents, matches any of
+// patterns.
+func matchesAny(patterns []string, rel string) bool {
+	for name := rel; name != "." && name != "/"; name = path.Dir(name) {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Export streams the tree rooted at root in fs to w as a tar or zip
+// archive, without temporary files, with the paths relative to root. The
+// directories are exported if included or holding files included, with the
+// permissions and modification times of the entries, and the symlinks as
+// symlinks when fs can read them. Export doesn't close w.
+func Export(fs Fs, root string, w io.Writer, format ArchiveFormat, opts ExportOptions) error {
+	var aw archiveWriter
+	switch format {
+	case TarFormat:
+		aw = &tarArchiveWriter{tw: tar.NewWriter(w)}
+	case ZipFormat:
+		aw = &zipArchiveWriter{zw: zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("unsupported archive format %v", format)
+	}
+	root = filepath.Clean(root)
+	exported := make(map[string]bool)
+	// exportDir exports the directory rel and its parents, if not yet
+	exportDir := func(rel string) error {
+		var dirs []string
+		for dir := rel; dir != "." && !exported[dir]; dir = path.Dir(dir) {
+			dirs = append(dirs, dir)
+		}
+		for i := len(dirs) - 1; i >= 0; i-- {
+			info, err := fs.Stat(filepath.Join(root, filepath.FromSlash(dirs[i])))
+			if err != nil {
+				return err
+			}
+			if err := aw.dir(dirs[i], info); err != nil {
+				return err
+			}
+			exported[dirs[i]] = true
+		}
+		return nil
+	}
+	err := Walk(fs, root, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if matchesAny(opts.Exclude, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchesAny(opts.Include, rel) {
+			return nil
+		}
+		if info.IsDir() {
+			return exportDir(rel)
+		}
+		if err := exportDir(path.Dir(rel)); err != nil {
+			return err
+		}
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			reader, ok := fs.(LinkReader)
+			if !ok {
+				return nil
+			}
+			target, err := reader.ReadlinkIfPossible(name)
+			if err != nil {
+				return err
+			}
+			return aw.symlink(rel, target, info)
+		case info.Mode().IsRegular():
+			f, err := fs.Open(name)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return aw.file(rel, info, f)
+		}
+		// The other special files are skipped
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error exporting %s: %v", root, err)
+	}
+	return aw.close()
+}
+
+// archiveWriter writes the entries of an archive.
+type archiveWriter interface {
+	dir(rel string, info os.FileInfo) error
+	file(rel string, info os.FileInfo, r io.Reader) error
+	symlink(rel, target string, info os.FileInfo) error
+	close() error
+}
+
+type tarArchiveWriter struct {
+	tw *tar.Writer
+}
+
+func (a *tarArchiveWriter) header(rel, link string, info os.FileInfo) (*tar.Header, error) {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	return hdr, nil
+}
+
+func (a *tarArchiveWriter) dir(rel string, info os.FileInfo) error {
+	hdr, err := a.header(rel, "", info)
+	if err != nil {
+		return err
+	}
+	return a.tw.WriteHeader(hdr)
+}
+
+func (a *tarArchiveWriter) file(rel string, info os.FileInfo, r io.Reader) error {
+	hdr, err := a.header(rel, "", info)
+	if err != nil {
+		return err
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// The file may have changed since stated, the entry keeps its size
+	n, err := io.Copy(a.tw, io.LimitReader(r, hdr.Size))
+	if err != nil {
+		return err
+	}
+	if n < hdr.Size {
+		return fmt.Errorf("%s truncated while exported", rel)
+	}
+	return nil
+}
+
+func (a *tarArchiveWriter) symlink(rel, target string, info os.FileInfo) error {
+	hdr, err := a.header(rel, target, info)
+	if err != nil {
+		return err
+	}
+	return a.tw.WriteHeader(hdr)
+}
+
+func (a *tarArchiveWriter) close() error {
+	return a.tw.Close()
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchiveWriter) create(rel string, info os.FileInfo) (io.Writer, error) {
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Name = rel
+	if info.IsDir() {
+		hdr.Name += "/"
+	} else if info.Mode().IsRegular() {
+		hdr.Method = zip.Deflate
+	}
+	return a.zw.CreateHeader(hdr)
+}
+
+func (a *zipArchiveWriter) dir(rel string, info os.FileInfo) error {
+	_, err := a.create(rel, info)
+	return err
+}
+
+func (a *zipArchiveWriter) file(rel string, info os.FileInfo, r io.Reader) error {
+	w, err := a.create(rel, info)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+func (a *zipArchiveWriter) symlink(rel, target string, info os.FileInfo) error {
+	w, err := a.create(rel, info)
+	if err != nil {
+		return err
+	}
+	// The target of a link is its content
+	_, err = io.WriteString(w, target)
+	return err
+}
+
+func (a *zipArchiveWriter) close() error {
+	return a.zw.Close()
+}
@@ -0,0 +1,65 @@
+package kafero
+
+import (
+	"bytes"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	src := NewMemMapFs()
+	for name, content := range map[string]string{
+		"/root/a.txt":          "a",
+		"/root/data/b.csv":     "b",
+		"/root/data/c.json":    "c",
+		"/root/logs/d.log":     "d",
+		"/root/tmp/e.txt":      "e",
+		"/root/data/sub/f.csv": "f",
+	} {
+		if err := WriteFile(src, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.MkdirAll("/root/empty", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []ArchiveFormat{TarFormat, ZipFormat} {
+		var buf bytes.Buffer
+		opts := ExportOptions{Include: []string{"data/*.csv", "data/sub", "logs", "a.txt", "empty"}, Exclude: []string{"logs"}}
+		if err := Export(src, "/root", &buf, format, opts); err != nil {
+			t.Fatal(err)
+		}
+		dst := NewMemMapFs()
+		var err error
+		if format == TarFormat {
+			err = Untar(&buf, dst, "/out", ExtractOptions{})
+		} else {
+			err = Unzip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dst, "/out", ExtractOptions{})
+		}
+		if err != nil {
+			t.Fatalf("error extracting %v: %v", format, err)
+		}
+		var names []string
+		err = Walk(dst, "/out", func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			names = append(names, path)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(names)
+		expected := "/out,/out/a.txt,/out/data,/out/data/b.csv,/out/data/sub,/out/data/sub/f.csv,/out/empty"
+		if strings.Join(names, ",") != expected {
+			t.Fatalf("was expecting %s in %v, got %v", expected, format, names)
+		}
+		if data, err := ReadFile(dst, "/out/data/sub/f.csv"); err != nil || string(data) != "f" {
+			t.Fatalf("was expecting f, got %s, %v", data, err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+)
+
+// FileIDer is an optional interface in Kafero. It is only implemented by the
+// filesystems able to identify the files independently of their names: the
+// names with the same identifier are the same file, hard linked, or the
+// same version of an object, allowing to detect duplicates portably.
+type FileIDer interface {
+	FileID(name string) (FileID, error)
+}
+
+// A FileID identifies a file on a filesystem, comparable with the
+// identifiers of the same filesystem only. It is the device and inode of the
+// files of the OsFs, the bucket, name and generation of the objects of the
+// GcsFs, and a UUID kept through renames on the MemMapFs.
+type FileID string
+
+// ErrFileIDNotSupported is returned by the filesystems not implementing
+// FileIDer.
+var ErrFileIDNotSupported = errors.New("file identifiers not supported")
+
+// GetFileID returns the identifier of the named file, if the filesystem
+// supports it.
+func GetFileID(fs Fs, name string) (FileID, error) {
+	if ifs, ok := fs.(FileIDer); ok {
+		return ifs.FileID(name)
+	}
+	return "", &os.PathError{Op: "fileid", Path: name, Err: ErrFileIDNotSupported}
+}
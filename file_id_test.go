@@ -0,0 +1,59 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileID(t *testing.T) {
+	dir, err := TempDir(NewOsFs(), "", "kafero-fileid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, fs := range []Fs{NewMemMapFs(), NewBasePathFs(NewOsFs(), dir)} {
+		if err := WriteFile(fs, "/a.txt", []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(fs, "/b.txt", []byte("a"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		a, err := GetFileID(fs, "/a.txt")
+		if errors.Is(err, ErrFileIDNotSupported) {
+			// Not all the platforms have them
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := GetFileID(fs, "/b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a == "" || a == b {
+			t.Fatalf("was expecting distinct identifiers on %s, got %s and %s", fs.Name(), a, b)
+		}
+		// The identifiers are kept through renames
+		if err := fs.Rename("/a.txt", "/c.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := GetFileID(fs, "/c.txt"); err != nil || c != a {
+			t.Fatalf("was expecting %s on %s, got %s, %v", a, fs.Name(), c, err)
+		}
+	}
+
+	// Hard links share their identifier
+	if err := os.Link(filepath.Join(dir, "b.txt"), filepath.Join(dir, "d.txt")); err == nil {
+		b, _ := GetFileID(NewOsFs(), filepath.Join(dir, "b.txt"))
+		if d, err := GetFileID(NewOsFs(), filepath.Join(dir, "d.txt")); err != nil || d != b {
+			t.Fatalf("was expecting %s, got %s, %v", b, d, err)
+		}
+	}
+
+	if _, err := GetFileID(&prefetchFs{Fs: NewMemMapFs()}, "/a.txt"); err == nil {
+		t.Fatal("was expecting an error")
+	}
+}
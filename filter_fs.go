@@ -0,0 +1,323 @@
+package kafero
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	_ Lstater   = (*FilterFs)(nil)
+	_ Xattrer   = (*FilterFs)(nil)
+	_ ReadDirer = (*FilterFs)(nil)
+	_ ContextFs = (*FilterFs)(nil)
+)
+
+// The FilterFs exposes only the files of the source filesystem whose path
+// matches, the other files being hidden from Open, Stat, Readdir and Walk,
+// as if they didn't exist, and can't be created. The directories are all
+// exposed, so that the files matching can be reached.
+//
+// The FilterFs confines its callers to the files exposed, so it doesn't
+// unwrap, and refuses to remove or rename the directories holding hidden
+// files.
+type FilterFs struct {
+	source Fs
+	match  func(name string) bool
+}
+
+// NewFilterFs returns a FilterFs exposing the files of source whose
+// cleaned path is matched by match.
+func NewFilterFs(source Fs, match func(name string) bool) *FilterFs {
+	return &FilterFs{source: source, match: match}
+}
+
+// NewGlobFilterFs returns a FilterFs exposing the files of source matching
+// one of patterns, with the syntax of filepath.Match: the patterns with a
+// separator, such as "/data/*.csv", match the whole path, the others, such
+// as "*.csv", the base name.
+func NewGlobFilterFs(source Fs, patterns ...string) (*FilterFs, error) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+	}
+	return NewFilterFs(source, func(name string) bool {
+		for _, pattern := range patterns {
+			target := name
+			if !strings.ContainsRune(pattern, filepath.Separator) {
+				target = filepath.Base(name)
+			}
+			if ok, _ := filepath.Match(pattern, target); ok {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+// NewRegexpFilterFs returns a FilterFs exposing the files of source whose
+// path matches re, as RegexpFs does.
+func NewRegexpFilterFs(source Fs, re *regexp.Regexp) *FilterFs {
+	return NewFilterFs(source, re.MatchString)
+}
+
+func (r *FilterFs) Name() string {
+	return "FilterFs"
+}
+
+func (r *FilterFs) WithContext(ctx context.Context) Fs {
+	return &FilterFs{source: WithContext(r.source, ctx), match: r.match}
+}
+
+// visible returns whether the file name, of info, is exposed.
+func (r *FilterFs) visible(name string, info os.FileInfo) bool {
+	return info.IsDir() || r.match(filepath.Clean(name))
+}
+
+// check returns a not exist error if name is a file hidden.
+func (r *FilterFs) check(op, name string) error {
+	info, err := r.source.Stat(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return r.checkName(op, name)
+		}
+		return err
+	}
+	if !r.visible(name, info) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// checkName returns a not exist error if name, not a directory, doesn't
+// match.
+func (r *FilterFs) checkName(op, name string) error {
+	if !r.match(filepath.Clean(name)) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+// checkHidden returns an error if the directory dir, of info, holds hidden
+// files, which its removal or renaming would reach.
+func (r *FilterFs) checkHidden(op, dir string, info os.FileInfo) error {
+	if !info.IsDir() {
+		return nil
+	}
+	err := Walk(r.source, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !r.visible(path, info) {
+			return &os.PathError{Op: op, Path: dir, Err: syscall.ENOTEMPTY}
+		}
+		return nil
+	})
+	return err
+}
+
+// filter returns the entries of the directory dir exposed.
+func (r *FilterFs) filter(dir string, infos []os.FileInfo) []os.FileInfo {
+	var visible []os.FileInfo
+	for _, info := range infos {
+		if r.visible(filepath.Join(dir, info.Name()), info) {
+			visible = append(visible, info)
+		}
+	}
+	return visible
+}
+
+func (r *FilterFs) Stat(name string) (os.FileInfo, error) {
+	info, err := r.source.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if !r.visible(name, info) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return info, nil
+}
+
+func (r *FilterFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lsf, ok := r.source.(Lstater)
+	if !ok {
+		info, err := r.Stat(name)
+		return info, false, err
+	}
+	info, lstat, err := lsf.LstatIfPossible(name)
+	if err != nil {
+		return nil, lstat, err
+	}
+	if !r.visible(name, info) {
+		return nil, lstat, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	return info, lstat, nil
+}
+
+func (r *FilterFs) ReadDir(name string) ([]os.FileInfo, error) {
+	infos, err := readDirLstat(r.source, name)
+	if err != nil {
+		return nil, err
+	}
+	return r.filter(name, infos), nil
+}
+
+func (r *FilterFs) Open(name string) (File, error) {
+	if err := r.check("open", name); err != nil {
+		return nil, err
+	}
+	f, err := r.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &filterFile{File: f, fs: r}, nil
+}
+
+func (r *FilterFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := r.check("open", name); err != nil {
+		return nil, err
+	}
+	f, err := r.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &filterFile{File: f, fs: r}, nil
+}
+
+func (r *FilterFs) Create(name string) (File, error) {
+	if err := r.checkName("create", name); err != nil {
+		return nil, err
+	}
+	return r.source.Create(name)
+}
+
+func (r *FilterFs) Mkdir(name string, perm os.FileMode) error {
+	return r.source.Mkdir(name, perm)
+}
+
+func (r *FilterFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.source.MkdirAll(path, perm)
+}
+
+func (r *FilterFs) Remove(name string) error {
+	if err := r.check("remove", name); err != nil {
+		return err
+	}
+	return r.source.Remove(name)
+}
+
+// RemoveAll removes path, failing with ENOTEMPTY if it is a directory
+// holding hidden files.
+func (r *FilterFs) RemoveAll(path string) error {
+	info, err := r.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := r.checkHidden("removeall", path, info); err != nil {
+		return err
+	}
+	return r.source.RemoveAll(path)
+}
+
+// Rename renames oldname, failing with ENOTEMPTY if it is a directory
+// holding hidden files.
+func (r *FilterFs) Rename(oldname, newname string) error {
+	info, err := r.Stat(oldname)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := r.checkHidden("rename", oldname, info); err != nil {
+			return err
+		}
+	} else if err := r.checkName("rename", newname); err != nil {
+		return err
+	}
+	return r.source.Rename(oldname, newname)
+}
+
+func (r *FilterFs) Chmod(name string, mode os.FileMode) error {
+	if err := r.check("chmod", name); err != nil {
+		return err
+	}
+	return r.source.Chmod(name, mode)
+}
+
+func (r *FilterFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := r.check("chtimes", name); err != nil {
+		return err
+	}
+	return r.source.Chtimes(name, atime, mtime)
+}
+
+func (r *FilterFs) Getxattr(name, attr string) ([]byte, error) {
+	if err := r.check("getxattr", name); err != nil {
+		return nil, err
+	}
+	return Getxattr(r.source, name, attr)
+}
+
+func (r *FilterFs) Setxattr(name, attr string, value []byte) error {
+	if err := r.check("setxattr", name); err != nil {
+		return err
+	}
+	return Setxattr(r.source, name, attr, value)
+}
+
+func (r *FilterFs) Listxattr(name string) ([]string, error) {
+	if err := r.check("listxattr", name); err != nil {
+		return nil, err
+	}
+	return Listxattr(r.source, name)
+}
+
+func (r *FilterFs) Removexattr(name, attr string) error {
+	if err := r.check("removexattr", name); err != nil {
+		return err
+	}
+	return Removexattr(r.source, name, attr)
+}
+
+// filterFile lists the entries of a directory exposed by its FilterFs.
+type filterFile struct {
+	File
+	fs *FilterFs
+}
+
+func (f *filterFile) Readdir(count int) ([]os.FileInfo, error) {
+	if count <= 0 {
+		infos, err := f.File.Readdir(count)
+		return f.fs.filter(f.Name(), infos), err
+	}
+	// Fill the count with the entries exposed
+	var visible []os.FileInfo
+	for len(visible) < count {
+		infos, err := f.File.Readdir(count - len(visible))
+		visible = append(visible, f.fs.filter(f.Name(), infos)...)
+		if err != nil {
+			if len(visible) > 0 {
+				return visible, nil
+			}
+			return nil, err
+		}
+	}
+	return visible, nil
+}
+
+func (f *filterFile) Readdirnames(count int) ([]string, error) {
+	infos, err := f.Readdir(count)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
@@ -0,0 +1,129 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"syscall"
+	"testing"
+)
+
+func TestGlobFilterFs(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.MkdirAll("/data/sub", 0777)
+	for _, name := range []string{"/data/a.csv", "/data/b.json", "/data/sub/c.csv", "/data/sub/d.txt"} {
+		if err := WriteFile(mfs, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewGlobFilterFs(mfs, "*.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := fs.Stat("/data/a.csv"); err != nil {
+		t.Errorf("Stat of a matching file failed: %v", err)
+	}
+	if _, err := fs.Stat("/data/b.json"); !os.IsNotExist(err) {
+		t.Errorf("Stat of a hidden file: expected not exist error, got %v", err)
+	}
+	if _, err := fs.Open("/data/sub/d.txt"); !os.IsNotExist(err) {
+		t.Errorf("Open of a hidden file: expected not exist error, got %v", err)
+	}
+	if err := fs.Remove("/data/b.json"); !os.IsNotExist(err) {
+		t.Errorf("Remove of a hidden file: expected not exist error, got %v", err)
+	}
+	if _, err := fs.Create("/data/e.txt"); !os.IsNotExist(err) {
+		t.Errorf("Create of a non matching file: expected not exist error, got %v", err)
+	}
+	if err := fs.Rename("/data/a.csv", "/data/a.txt"); !os.IsNotExist(err) {
+		t.Errorf("Rename to a non matching file: expected not exist error, got %v", err)
+	}
+
+	f, err := fs.Open("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for {
+		infos, err := f.Readdir(1)
+		if err != nil {
+			break
+		}
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+	}
+	f.Close()
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a.csv" || names[1] != "sub" {
+		t.Errorf("Got wrong entries: %v", names)
+	}
+
+	var walked []string
+	err = Walk(fs, "/data", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			walked = append(walked, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(walked) != 2 || walked[0] != filepath.FromSlash("/data/a.csv") || walked[1] != filepath.FromSlash("/data/sub/c.csv") {
+		t.Errorf("Walked wrong files: %v", walked)
+	}
+
+	if Unwrap(fs) != nil {
+		t.Errorf("Expected the FilterFs not to unwrap")
+	}
+	if err := fs.RemoveAll("/data/sub"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("RemoveAll of a directory with hidden files: expected ENOTEMPTY, got %v", err)
+	}
+	if err := fs.Rename("/data/sub", "/data/sub.csv"); !errors.Is(err, syscall.ENOTEMPTY) {
+		t.Errorf("Rename of a directory with hidden files: expected ENOTEMPTY, got %v", err)
+	}
+	if _, err := mfs.Stat("/data/sub/d.txt"); err != nil {
+		t.Errorf("Hidden file removed or renamed: %v", err)
+	}
+	if err := mfs.Remove("/data/sub/d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/data/sub", "/data/moved"); err != nil {
+		t.Errorf("Rename of a directory without hidden files failed: %v", err)
+	}
+	if err := fs.RemoveAll("/data/moved"); err != nil {
+		t.Errorf("RemoveAll of a directory without hidden files failed: %v", err)
+	}
+	if _, err := mfs.Stat("/data/moved"); !os.IsNotExist(err) {
+		t.Errorf("Expected the directory removed, got %v", err)
+	}
+
+	if _, err := NewGlobFilterFs(mfs, "[a-"); err == nil {
+		t.Errorf("Expected an error for a malformed pattern")
+	}
+}
+
+func TestRegexpFilterFs(t *testing.T) {
+	mfs := &MemMapFs{}
+	mfs.MkdirAll("/in", 0777)
+	WriteFile(mfs, "/in/2020.csv", nil, 0644)
+	WriteFile(mfs, "/in/old.csv", nil, 0644)
+	fs := NewRegexpFilterFs(mfs, regexp.MustCompile(`/\d+\.csv$`))
+
+	names, err := ReadDirNames(fs, "/in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "2020.csv" {
+		t.Errorf("Got wrong names: %v", names)
+	}
+	if _, err := fs.Open("/in/old.csv"); !os.IsNotExist(err) {
+		t.Errorf("Open of a hidden file: expected not exist error, got %v", err)
+	}
+}
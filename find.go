@@ -0,0 +1,200 @@
+package kafero
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileType selects the type of the files found by Find.
+type FileType int
+
+const (
+	// AnyFile matches all the files
+	AnyFile FileType = iota
+	// RegularFile matches the regular files
+	RegularFile
+	// DirFile matches the directories
+	DirFile
+	// SymlinkFile matches the symbolic links
+	SymlinkFile
+)
+
+// FindOptions are the predicates of Find. A file is found if it matches all
+// of them, the zero value of each matching any file.
+type FindOptions struct {
+	// Name is a pattern, with the syntax of filepath.Match, that the base
+	// name of the files must match.
+	Name string
+	// MinSize is the minimum size of the files.
+	MinSize int64
+	// ModifiedAfter and ModifiedBefore bound the modification time of the
+	// files, excluded.
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// MaxDepth is the number of levels searched below the root, 0
+	// searching all of them.
+	MaxDepth int
+	// Type is the type of the files.
+	Type FileType
+}
+
+func (o *FindOptions) match(info os.FileInfo) (bool, error) {
+	if o.Name != "" {
+		ok, err := filepath.Match(o.Name, info.Name())
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	switch o.Type {
+	case RegularFile:
+		if !info.Mode().IsRegular() {
+			return false, nil
+		}
+	case DirFile:
+		if !info.IsDir() {
+			return false, nil
+		}
+	case SymlinkFile:
+		if info.Mode()&os.ModeSymlink == 0 {
+			return false, nil
+		}
+	}
+	if info.Size() < o.MinSize {
+		return false, nil
+	}
+	mtime := info.ModTime()
+	if !o.ModifiedAfter.IsZero() && !mtime.After(o.ModifiedAfter) {
+		return false, nil
+	}
+	if !o.ModifiedBefore.IsZero() && !mtime.Before(o.ModifiedBefore) {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (a Afero) Find(root string, opts FindOptions) *FindIterator {
+	return Find(a.Fs, root, opts)
+}
+
+// Find returns an iterator over the files of the tree rooted at root, root
+// included, matching opts, in lexical order. The tree is listed as the
+// iteration goes, one directory at a time, and the symlinks are not
+// followed. For instance, the files older than 30 days larger than 1MB:
+//
+//	it := kafero.Find(fs, root, kafero.FindOptions{
+//		Type:           kafero.RegularFile,
+//		MinSize:        1 << 20,
+//		ModifiedBefore: time.Now().AddDate(0, 0, -30),
+//	})
+//	for it.Next() {
+//		fmt.Println(it.Path())
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+func Find(fs Fs, root string, opts FindOptions) *FindIterator {
+	return &FindIterator{fs: fs, root: root, opts: opts}
+}
+
+// FindIterator iterates over the files found by Find.
+type FindIterator struct {
+	fs      Fs
+	root    string
+	opts    FindOptions
+	started bool
+	// The directories being listed, the innermost last
+	stack []findDir
+	path  string
+	info  os.FileInfo
+	err   error
+}
+
+type findDir struct {
+	path  string
+	infos []os.FileInfo
+	depth int
+}
+
+// Next advances to the next file found, returning false when there are no
+// more files or on error.
+func (it *FindIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		info, err := lstatIfPossible(it.fs, it.root)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if it.visit(it.root, info, 0) {
+			return true
+		}
+	}
+	for len(it.stack) > 0 {
+		dir := &it.stack[len(it.stack)-1]
+		if len(dir.infos) == 0 {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		info := dir.infos[0]
+		dir.infos = dir.infos[1:]
+		if it.visit(filepath.Join(dir.path, info.Name()), info, dir.depth+1) {
+			return true
+		}
+	}
+	return false
+}
+
+// visit lists the directory at path if the search goes below it, and
+// returns whether its file matches. The directories removed since their
+// parent was listed are skipped.
+func (it *FindIterator) visit(path string, info os.FileInfo, depth int) bool {
+	ok, err := it.opts.match(info)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	if info.IsDir() && (it.opts.MaxDepth == 0 || depth < it.opts.MaxDepth) {
+		infos, err := readDirLstat(it.fs, path)
+		if depth > 0 && os.IsNotExist(err) {
+			return false
+		}
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.stack = append(it.stack, findDir{path: path, infos: infos, depth: depth})
+	}
+	if ok {
+		it.path, it.info = path, info
+	}
+	return ok
+}
+
+// Path returns the path of the current file.
+func (it *FindIterator) Path() string {
+	return it.path
+}
+
+// Info returns the FileInfo of the current file, as returned by Lstat when
+// the filesystem supports it.
+func (it *FindIterator) Info() os.FileInfo {
+	return it.info
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *FindIterator) Err() error {
+	return it.err
+}
+
+// All returns the paths of the remaining files found.
+func (it *FindIterator) All() ([]string, error) {
+	var paths []string
+	for it.Next() {
+		paths = append(paths, it.Path())
+	}
+	return paths, it.Err()
+}
@@ -0,0 +1,86 @@
+package kafero_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+func TestFind(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	fs := kafero.NewMemMapFs()
+	big := strings.Repeat("x", 2<<20)
+	fixture := tests.Fixture{
+		"new.tick":         big,
+		"old.tick":         big,
+		"old.txt":          big,
+		"dir/small.tick":   strings.Repeat("x", 10),
+		"dir/sub/old.tick": big,
+	}
+	if err := fixture.Load(fs, "root"); err != nil {
+		t.Fatal(err)
+	}
+	for name, age := range map[string]time.Duration{
+		"root/new.tick":         time.Hour,
+		"root/old.tick":         40 * 24 * time.Hour,
+		"root/old.txt":          40 * 24 * time.Hour,
+		"root/dir/small.tick":   40 * 24 * time.Hour,
+		"root/dir/sub/old.tick": 40 * 24 * time.Hour,
+	} {
+		mtime := now.Add(-age)
+		if err := fs.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(opts kafero.FindOptions) []string {
+		paths, err := kafero.Find(fs, "root", opts).All()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return paths
+	}
+	j := filepath.Join
+
+	paths := find(kafero.FindOptions{
+		Name:           "*.tick",
+		MinSize:        1 << 20,
+		ModifiedBefore: now.AddDate(0, 0, -30),
+	})
+	expected := []string{j("root", "dir", "sub", "old.tick"), j("root", "old.tick")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("was expecting %v, got %v", expected, paths)
+	}
+
+	paths = find(kafero.FindOptions{Name: "*.tick", MaxDepth: 1, ModifiedAfter: now.AddDate(0, 0, -30)})
+	expected = []string{j("root", "new.tick")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("was expecting %v, got %v", expected, paths)
+	}
+
+	paths = find(kafero.FindOptions{Type: kafero.DirFile})
+	expected = []string{"root", j("root", "dir"), j("root", "dir", "sub")}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("was expecting %v, got %v", expected, paths)
+	}
+
+	it := kafero.Find(fs, "root", kafero.FindOptions{Name: "small.tick"})
+	if !it.Next() || it.Info().Size() != 10 {
+		t.Fatal("was expecting small.tick of size 10")
+	}
+	if it.Next() {
+		t.Fatalf("was expecting a single file, got %s", it.Path())
+	}
+
+	if _, err := kafero.Find(fs, "root", kafero.FindOptions{Name: "["}).All(); err == nil {
+		t.Fatal("was expecting an error for a malformed pattern")
+	}
+	if _, err := kafero.Find(fs, "missing", kafero.FindOptions{}).All(); err == nil {
+		t.Fatal("was expecting an error for a missing root")
+	}
+}
@@ -0,0 +1,122 @@
+package kafero
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// GCReport describes the orphaned files found by GCOrphans.
+type GCReport struct {
+	// Orphans are the layer files removed, or to be removed in dry run.
+	Orphans []string
+	// Size is the total size of the orphans.
+	Size int64
+}
+
+type gcOptions struct {
+	dryRun bool
+	maxAge time.Duration
+	skip   map[string]bool
+}
+
+type GCOption func(o *gcOptions)
+
+// GCDryRun only reports the orphans, without removing them.
+func GCDryRun() GCOption {
+	return func(o *gcOptions) {
+		o.dryRun = true
+	}
+}
+
+// GCMaxAge also collects the layer files not modified for maxAge, even if
+// they are still in the base.
+func GCMaxAge(maxAge time.Duration) GCOption {
+	return func(o *gcOptions) {
+		o.maxAge = maxAge
+	}
+}
+
+// GCOrphans removes the files under root present in a cache or buffer
+// layer but not in its base anymore, typically left behind by a crash.
+// The empty directories left are removed as well.
+//
+// It must not run concurrently with a filesystem using the layer. A
+// SizeCacheFS index only referencing removed files is harmless, but its
+// size accounting is only corrected by rebuilding it.
+func GCOrphans(layer, base Fs, root string, opts ...GCOption) (*GCReport, error) {
+	o := &gcOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	var names []string
+	infos := make(map[string]os.FileInfo)
+	err := Walk(layer, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// Internal files of the cache layers
+		if info.IsDir() && isCacheTempDir(path) {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || filepath.Base(path) == ".cacheindex" {
+			return nil
+		}
+		names = append(names, path)
+		infos[path] = info
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking layer: %v", err)
+	}
+
+	exists, err := ExistsMany(base, names)
+	if err != nil {
+		return nil, fmt.Errorf("error checking base files: %v", err)
+	}
+
+	report := &GCReport{}
+	now := time.Now()
+	for _, name := range names {
+		info := infos[name]
+		expired := o.maxAge > 0 && now.Sub(info.ModTime()) > o.maxAge
+		if exists[name] && !expired {
+			continue
+		}
+		report.Orphans = append(report.Orphans, name)
+		report.Size += info.Size()
+	}
+	if o.dryRun {
+		return report, nil
+	}
+
+	dirs := make(map[string]bool)
+	for _, name := range report.Orphans {
+		if err := layer.Remove(name); err != nil && !os.IsNotExist(err) {
+			return report, fmt.Errorf("error removing orphan %s: %v", name, err)
+		}
+		dirs[filepath.Dir(name)] = true
+	}
+	// Deepest directories first, so their parents can become empty
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	root = filepath.Clean(root)
+	for _, dir := range sorted {
+		for dir != root && dir != "." && dir != string(filepath.Separator) {
+			if empty, err := IsEmpty(layer, dir); err != nil || !empty {
+				break
+			}
+			if err := layer.Remove(dir); err != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,54 @@
+package kafero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCOrphans(t *testing.T) {
+	base := NewMemMapFs()
+	layer := NewMemMapFs()
+	for _, name := range []string{"/cache/a.txt", "/cache/sub/b.txt"} {
+		WriteFile(base, name, []byte("base"), 0644)
+		WriteFile(layer, name, []byte("base"), 0644)
+	}
+	WriteFile(layer, "/cache/orphan.txt", []byte("orphan"), 0644)
+	WriteFile(layer, "/cache/old/orphan.txt", []byte("orphan"), 0644)
+	WriteFile(layer, "/cache/.cacheindex", []byte("[]"), 0644)
+
+	report, err := GCOrphans(layer, base, "/cache", GCDryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 2 || report.Size != 12 {
+		t.Fatalf("was expecting 2 orphans of 12 bytes, got %v, %d", report.Orphans, report.Size)
+	}
+	if exists, _ := Exists(layer, "/cache/orphan.txt"); !exists {
+		t.Fatal("was not expecting a dry run to remove files")
+	}
+
+	if _, err := GCOrphans(layer, base, "/cache"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/cache/orphan.txt", "/cache/old"} {
+		if exists, _ := Exists(layer, name); exists {
+			t.Fatalf("was expecting %s to be removed", name)
+		}
+	}
+	for _, name := range []string{"/cache/a.txt", "/cache/sub/b.txt", "/cache/.cacheindex"} {
+		if exists, _ := Exists(layer, name); !exists {
+			t.Fatalf("was expecting %s to be kept", name)
+		}
+	}
+
+	// Files still in the base are collected once too old
+	old := time.Now().Add(-2 * time.Hour)
+	layer.Chtimes("/cache/a.txt", old, old)
+	report, err = GCOrphans(layer, base, "/cache", GCMaxAge(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Orphans) != 1 || report.Orphans[0] != "/cache/a.txt" {
+		t.Fatalf("was expecting /cache/a.txt to be collected, got %v", report.Orphans)
+	}
+}
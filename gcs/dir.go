@@ -0,0 +1,38 @@
+package gcs
+
+import (
+	"context"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// Buckets populated by other tools don't contain the "virtual_folder"
+// marker objects, their directories only exist as the common prefix of the
+// objects they contain.
+
+// PrefixExists returns true if at least one object name starts with prefix.
+func PrefixExists(ctx context.Context, bucket *storage.BucketHandle, prefix string) (bool, error) {
+	it := bucket.Objects(ctx, &storage.Query{Prefix: prefix, Versions: false})
+	it.PageInfo().MaxSize = 1
+	if _, err := it.Next(); err != nil {
+		if err == iterator.Done {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// NewDirInfo returns the FileInfo of a directory without marker object.
+func NewDirInfo(name string, separator string) *FileInfo {
+	return &FileInfo{ObjAtt: &storage.ObjectAttrs{
+		Prefix: strings.TrimSuffix(name, separator) + separator,
+	}}
+}
+
+// isRoot returns true if name designates the root of the bucket.
+func isRoot(name string, separator string) bool {
+	return strings.Trim(name, separator) == ""
+}
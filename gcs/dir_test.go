@@ -0,0 +1,52 @@
+package gcs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestDirInfo(t *testing.T) {
+	fi := NewDirInfo("data/raw", "/")
+	if !fi.IsDir() {
+		t.Fatal("was expecting a directory")
+	}
+	if fi.Name() != "raw" {
+		t.Fatalf("was expecting name raw, got %s", fi.Name())
+	}
+
+	// Common prefixes returned by listings
+	fi = &FileInfo{ObjAtt: &storage.ObjectAttrs{Prefix: "data/raw/"}}
+	if !fi.IsDir() || fi.Name() != "raw" {
+		t.Fatalf("was expecting directory raw, got %s", fi.Name())
+	}
+
+	fi = &FileInfo{ObjAtt: &storage.ObjectAttrs{Name: "data/raw/file.bin"}}
+	if fi.IsDir() {
+		t.Fatal("was not expecting a directory")
+	}
+
+	if !isRoot("/", "/") || !isRoot("", "/") || isRoot("data", "/") {
+		t.Fatal("wrong root detection")
+	}
+}
+
+func TestDirFile(t *testing.T) {
+	dir := &GcsFile{isDir: true, resource: &gcsFileResource{name: "data"}}
+	if _, err := dir.Read(make([]byte, 4)); !errors.Is(err, syscall.EISDIR) {
+		t.Fatalf("was expecting EISDIR reading a directory, got %v", err)
+	}
+	if _, err := dir.ReadAt(make([]byte, 4), 2); !errors.Is(err, syscall.EISDIR) {
+		t.Fatalf("was expecting EISDIR reading a directory, got %v", err)
+	}
+
+	file := &GcsFile{resource: &gcsFileResource{name: "data/file.bin"}}
+	if _, err := file.Readdir(0); !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("was expecting ENOTDIR listing a file, got %v", err)
+	}
+	if _, err := file.Readdirnames(0); !errors.Is(err, syscall.ENOTDIR) {
+		t.Fatalf("was expecting ENOTDIR listing a file, got %v", err)
+	}
+}
@@ -10,4 +10,7 @@ var (
 	ErrOutOfRange   = errors.New("Out of range")
 	ErrTooLarge     = errors.New("Too large")
 	ErrFileNotFound = os.ErrNotExist
+	// ErrArchived is returned when reading an object stored in an archive
+	// storage class would incur retrieval costs.
+	ErrArchived = errors.New("object is in an archive storage class")
 )
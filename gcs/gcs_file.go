@@ -16,14 +16,18 @@ package gcs
 import (
 	"cloud.google.com/go/storage"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"syscall"
 	"time"
 
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -36,10 +40,55 @@ type GcsFile struct {
 	closed    bool
 	ReadDirIt *storage.ObjectIterator
 	isDir     bool
+	seen      map[string]bool
 	fhoffset  int64
 	resource  *gcsFileResource
 }
 
+// ObjectOptions are the attributes applied to the objects written through
+// a GcsFile.
+type ObjectOptions struct {
+	// StorageClass of the written objects, the bucket default if empty.
+	StorageClass string
+	// DisableContentSniffing stops guessing the content type of the
+	// objects from their first bytes when their extension is unknown,
+	// application/octet-stream is used instead.
+	DisableContentSniffing bool
+	// Root is the prefix of the names of the objects, under which the
+	// names of the files are resolved.
+	Root string
+	// Codec encodes the path elements of the files into the ones of the
+	// names of the objects, if not nil.
+	Codec NameCodec
+}
+
+// A NameCodec maps the path elements of the files to the ones of the names
+// of the objects, and back, as kafero.NameCodec does.
+type NameCodec interface {
+	Encode(elem string) string
+	Decode(elem string) (string, error)
+}
+
+// ObjectName returns the name of the object of the file name, a path
+// relative to Root.
+func (o ObjectOptions) ObjectName(name string, separator string) string {
+	name = strings.Trim(name, separator)
+	if o.Codec != nil && name != "" {
+		elems := strings.Split(name, separator)
+		for i, elem := range elems {
+			elems[i] = o.Codec.Encode(elem)
+		}
+		name = strings.Join(elems, separator)
+	}
+	switch {
+	case o.Root == "":
+		return name
+	case name == "":
+		return o.Root
+	}
+	return o.Root + separator + name
+}
+
 func NewGcsFile(
 	ctx context.Context,
 	bucket *storage.BucketHandle,
@@ -47,6 +96,18 @@ func NewGcsFile(
 	separator string,
 	openFlags int,
 	name string,
+) (*GcsFile, error) {
+	return NewGcsFileWithOptions(ctx, bucket, obj, separator, openFlags, name, ObjectOptions{})
+}
+
+func NewGcsFileWithOptions(
+	ctx context.Context,
+	bucket *storage.BucketHandle,
+	obj *storage.ObjectHandle,
+	separator string,
+	openFlags int,
+	name string,
+	opts ObjectOptions,
 ) (*GcsFile, error) {
 	file := &GcsFile{
 		ctx:       ctx,
@@ -60,25 +121,50 @@ func NewGcsFile(
 		resource:  nil,
 	}
 
-	attr, err := obj.Attrs(ctx)
+	var attr *storage.ObjectAttrs
+	var err error
+	if isRoot(name, separator) {
+		file.isDir = true
+	} else {
+		attr, err = obj.Attrs(ctx)
+	}
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
-			if openFlags&os.O_CREATE != 0 {
-				// Create file
-				writer := obj.NewWriter(ctx)
+			if openFlags&os.O_CREATE == 0 {
+				// The object may be a directory without marker
+				exists, perr := PrefixExists(ctx, bucket, opts.ObjectName(name, separator)+separator)
+				if perr != nil {
+					return nil, fmt.Errorf("error listing prefix: %v", perr)
+				}
+				if !exists {
+					return nil, os.ErrNotExist
+				}
+				file.isDir = true
+			} else {
+				// Create file, exclusively with a precondition on the
+				// absence of the object, so that only one of concurrent
+				// creations succeeds
+				cobj := obj
+				if openFlags&os.O_EXCL != 0 {
+					cobj = obj.If(storage.Conditions{DoesNotExist: true})
+				}
+				writer := newWriter(ctx, cobj, opts)
+				setContentType(writer, opts, "", nil)
 				if _, err := writer.Write([]byte("")); err != nil {
 					return nil, fmt.Errorf("error writing to file: %v", err)
 				}
 				if err := writer.Close(); err != nil {
+					var gerr *googleapi.Error
+					if errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed {
+						return nil, os.ErrExist
+					}
 					return nil, fmt.Errorf("error closing writer: %v", err)
 				}
-			} else {
-				return nil, os.ErrNotExist
 			}
 		} else {
 			return nil, fmt.Errorf("error getting file reader: %v", err)
 		}
-	} else {
+	} else if attr != nil {
 		// If create exclusive and file exists, error
 		if openFlags&os.O_CREATE != 0 && openFlags&os.O_EXCL != 0 {
 			return nil, os.ErrExist
@@ -88,10 +174,15 @@ func NewGcsFile(
 		}
 	}
 
+	if file.isDir && openFlags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+
 	file.resource = &gcsFileResource{
 		ctx:  ctx,
 		obj:  obj,
 		name: name,
+		opts: opts,
 
 		currentGcsSize: 0,
 
@@ -137,34 +228,46 @@ func (f *GcsFile) Seek(newOffset int64, whence int) (int64, error) {
 	if err := f.Sync(); err != nil {
 		return 0, fmt.Errorf("error syncing file: %v", err)
 	}
-	stat, err := f.Stat()
-	if err != nil {
-		return 0, nil
-	}
 
+	// Invalid seeks fail as with os.File, and kafero.SeekOffset
 	switch whence {
-	case 0:
-		f.fhoffset = newOffset
-	case 1:
-		f.fhoffset += newOffset
-	case 2:
-		f.fhoffset = stat.Size() + newOffset
+	case io.SeekStart:
+	case io.SeekCurrent:
+		newOffset += f.fhoffset
+	case io.SeekEnd:
+		stat, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		newOffset += stat.Size()
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: syscall.EINVAL}
 	}
+	if newOffset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.Name(), Err: syscall.EINVAL}
+	}
+	f.fhoffset = newOffset
 	return f.fhoffset, nil
 }
 
 func (f *GcsFile) Read(p []byte) (n int, err error) {
-	return f.ReadAt(p, f.fhoffset)
+	n, err = f.ReadAt(p, f.fhoffset)
+	f.fhoffset += int64(n)
+	return n, err
 }
 
+// ReadAt doesn't move the offset of the file, as os.File. The directories
+// fail the reads with EISDIR, as os.File, even those stored as a marker
+// object.
 func (f *GcsFile) ReadAt(p []byte, off int64) (n int, err error) {
 	if f.closed {
 		return 0, ErrFileClosed
 	}
+	if f.isDir {
+		return 0, &os.PathError{Op: "read", Path: f.Name(), Err: syscall.EISDIR}
+	}
 
-	read, err := f.resource.ReadAt(p, off)
-	f.fhoffset += int64(read)
-	return read, err
+	return f.resource.ReadAt(p, off)
 }
 
 func (f *GcsFile) Write(p []byte) (n int, err error) {
@@ -176,8 +279,8 @@ func (f *GcsFile) WriteAt(b []byte, off int64) (n int, err error) {
 		return 0, ErrFileClosed
 	}
 
-	if f.openFlags == os.O_RDONLY {
-		return 0, fmt.Errorf("file is opened as read only")
+	if f.openFlags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return 0, f.readOnlyError("write")
 	}
 
 	written, err := f.resource.WriteAt(b, off)
@@ -194,16 +297,20 @@ func (f *GcsFile) readdir(count int) ([]*FileInfo, error) {
 		return nil, fmt.Errorf("error syncing file")
 	}
 	path := strings.Replace(strings.Replace(f.Name(), "\\", f.separator, -1), "/", f.separator, -1)
+	path = f.resource.opts.ObjectName(path, f.separator)
 	if len(path) > 0 && !strings.HasSuffix(path, f.separator) {
 		path = path + f.separator
 	}
 	if f.ReadDirIt == nil {
 		f.ReadDirIt = f.bucket.Objects(
 			f.ctx, &storage.Query{
-				Delimiter: "/",
+				Delimiter: f.separator,
 				Prefix:    path,
 				Versions:  false})
 	}
+	if f.seen == nil {
+		f.seen = make(map[string]bool)
+	}
 	var res []*FileInfo
 	for {
 		object, err := f.ReadDirIt.Next()
@@ -217,12 +324,20 @@ func (f *GcsFile) readdir(count int) ([]*FileInfo, error) {
 			return res, err
 		}
 
-		tmp := FileInfo{object}
+		tmp := FileInfo{ObjAtt: object, Codec: f.resource.opts.Codec}
 		// Since we create "virtual folders which are empty objects they can sometimes be returned twice
 		// when we do a query (As the query will also return GCS version of "virtual folders" but they only
-		// have a .Prefix, and not .Name)
+		// have a .Prefix, and not .Name). The marker object is listed first, so only keep the prefix of
+		// the folders without marker.
 		if object.Name == "" {
+			if f.seen[strings.TrimSuffix(object.Prefix, f.separator)] {
+				continue
+			}
+		} else if object.Name == path {
+			// Marker of the listed folder itself
 			continue
+		} else {
+			f.seen[object.Name] = true
 		}
 
 		res = append(res, &tmp)
@@ -234,8 +349,11 @@ func (f *GcsFile) readdir(count int) ([]*FileInfo, error) {
 }
 
 func (f *GcsFile) Readdir(count int) ([]os.FileInfo, error) {
+	if f.closed {
+		return nil, ErrFileClosed
+	}
 	if !f.isDir {
-		return nil, fmt.Errorf("not a directory")
+		return nil, &os.PathError{Op: "readdirent", Path: f.Name(), Err: syscall.ENOTDIR}
 	}
 	fi, err := f.readdir(count)
 	if err != nil {
@@ -253,12 +371,9 @@ func (f *GcsFile) Readdir(count int) ([]os.FileInfo, error) {
 }
 
 func (f *GcsFile) Readdirnames(n int) ([]string, error) {
-	if !f.isDir {
-		return nil, fmt.Errorf("not a directory")
-	}
 	fi, err := f.Readdir(n)
 	if err != nil && err != io.EOF {
-		return nil, fmt.Errorf("error reading dir names: %v", err)
+		return nil, err
 	}
 	names := make([]string, len(fi))
 
@@ -272,14 +387,21 @@ func (f *GcsFile) Stat() (os.FileInfo, error) {
 	if err := f.Sync(); err != nil {
 		return nil, fmt.Errorf("error syncing file")
 	}
+	if f.isDir && isRoot(f.Name(), f.separator) {
+		return NewDirInfo("", f.separator), nil
+	}
 	objAttrs, err := f.resource.obj.Attrs(f.ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
+			if f.isDir {
+				// Directory without marker
+				return NewDirInfo(f.Name(), f.separator), nil
+			}
 			return nil, os.ErrNotExist //works with os.IsNotExist check
 		}
 		return nil, fmt.Errorf("error getting resource attributes: %v", err)
 	}
-	return &FileInfo{objAttrs}, nil
+	return &FileInfo{ObjAtt: objAttrs, Codec: f.resource.opts.Codec}, nil
 }
 
 func (f *GcsFile) Sync() error {
@@ -290,12 +412,22 @@ func (f *GcsFile) Truncate(wantedSize int64) error {
 	if f.closed {
 		return ErrFileClosed
 	}
-	if f.openFlags&os.O_RDONLY != 0 {
-		return fmt.Errorf("file is read only")
+	if f.isDir {
+		return &os.PathError{Op: "truncate", Path: f.Name(), Err: syscall.EISDIR}
+	}
+	if f.openFlags&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return f.readOnlyError("truncate")
 	}
 	return f.resource.Truncate(wantedSize)
 }
 
+// readOnlyError returns the error of the operation op on a handle opened
+// read only, wrapping os.ErrPermission as kafero.ErrReadOnlyHandle, which
+// this package can't import.
+func (f *GcsFile) readOnlyError(op string) error {
+	return &os.PathError{Op: op, Path: f.Name(), Err: os.ErrPermission}
+}
+
 func (f *GcsFile) WriteString(s string) (ret int, err error) {
 	return f.Write([]byte(s))
 }
@@ -314,6 +446,8 @@ func (f *GcsFile) Munmap() error {
 
 type FileInfo struct {
 	ObjAtt *storage.ObjectAttrs
+	// Codec decodes the name of the object, if not nil
+	Codec NameCodec
 }
 
 func (fi *FileInfo) name() string {
@@ -321,7 +455,15 @@ func (fi *FileInfo) name() string {
 }
 
 func (fi *FileInfo) Name() string {
-	return filepath.Base(fi.name())
+	name := filepath.Base(fi.name())
+	if fi.Codec != nil {
+		// The objects not written through the codec keep their name, only
+		// the names encoding back to themselves being decoded
+		if decoded, err := fi.Codec.Decode(name); err == nil && fi.Codec.Encode(decoded) == name {
+			return decoded
+		}
+	}
+	return name
 }
 
 func (fi *FileInfo) Size() int64 {
@@ -338,12 +480,18 @@ func (fi *FileInfo) ModTime() time.Time {
 	return fi.ObjAtt.Updated
 }
 
+// IsDir returns true for the "virtual_folder" markers, and for the common
+// prefixes returned by listings.
 func (fi *FileInfo) IsDir() bool {
+	if fi.ObjAtt.Name == "" && fi.ObjAtt.Prefix != "" {
+		return true
+	}
 	return fi.ObjAtt.Metadata["virtual_folder"] == "y"
 }
 
+// Sys returns the *storage.ObjectAttrs of the object.
 func (fi *FileInfo) Sys() interface{} {
-	return nil
+	return fi.ObjAtt
 }
 
 type ByName []*FileInfo
@@ -353,7 +501,7 @@ func (a ByName) Len() int {
 }
 
 func (a ByName) Swap(i, j int) {
-	a[i].ObjAtt, a[j].ObjAtt = a[j].ObjAtt, a[i].ObjAtt
+	a[i], a[j] = a[j], a[i]
 }
 
 func (a ByName) Less(i, j int) bool {
@@ -16,10 +16,15 @@ package gcs
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/http"
+	"path"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // gcsFileResource represents a singleton version of each GCS object;
@@ -33,6 +38,7 @@ type gcsFileResource struct {
 
 	obj  *storage.ObjectHandle
 	name string
+	opts ObjectOptions
 
 	currentGcsSize int64
 	offset         int64
@@ -42,6 +48,33 @@ type gcsFileResource struct {
 	closed bool
 }
 
+// newWriter returns a writer to obj. Its content type is set from the
+// object extension when it is known, else it must be set with
+// setContentType before the first write.
+func newWriter(ctx context.Context, obj *storage.ObjectHandle, opts ObjectOptions) *storage.Writer {
+	w := obj.NewWriter(ctx)
+	if opts.StorageClass != "" {
+		w.StorageClass = opts.StorageClass
+	}
+	w.ContentType = mime.TypeByExtension(path.Ext(obj.ObjectName()))
+	return w
+}
+
+// setContentType sets the content type of w if it is unknown, to the
+// content type of the previous version of the object, or the one sniffed
+// from the first bytes written.
+func setContentType(w *storage.Writer, opts ObjectOptions, previous string, data []byte) {
+	switch {
+	case w.ContentType != "":
+	case previous != "":
+		w.ContentType = previous
+	case opts.DisableContentSniffing || len(data) == 0:
+		w.ContentType = "application/octet-stream"
+	default:
+		w.ContentType = http.DetectContentType(data)
+	}
+}
+
 func (o *gcsFileResource) Close() error {
 	o.closed = true
 	// TODO rawGcsObjectsMap ?
@@ -101,34 +134,40 @@ func (o *gcsFileResource) maybeCloseWriter() error {
 	return nil
 }
 
+// ReadAt reads len(p) bytes at off, fewer only at the end of the object, the
+// read then returning io.EOF with the bytes read, as os.File does.
 func (o *gcsFileResource) ReadAt(p []byte, off int64) (n int, err error) {
-	if cap(p) == 0 {
+	if len(p) == 0 {
 		return 0, nil
 	}
 
 	// Assume that if the reader is open; it is at the correct fhoffset
 	// a good performance assumption that we must ensure holds
-	if off == o.offset && o.reader != nil {
-		read, err := o.reader.Read(p)
-		o.offset += int64(read)
-		return read, err
-	}
-
-	//If any writers have written anything; commit it first so we can read it back.
-	if err := o.maybeCloseIo(); err != nil {
-		return 0, err
-	}
+	if off != o.offset || o.reader == nil {
+		//If any writers have written anything; commit it first so we can read it back.
+		if err := o.maybeCloseIo(); err != nil {
+			return 0, err
+		}
 
-	//Then read at the correct offset.
-	r, err := o.obj.NewRangeReader(o.ctx, off, -1)
-	if err != nil {
-		return 0, err
+		//Then read at the correct offset.
+		r, err := o.obj.NewRangeReader(o.ctx, off, -1)
+		if err != nil {
+			var gerr *googleapi.Error
+			if errors.As(err, &gerr) && gerr.Code == http.StatusRequestedRangeNotSatisfiable {
+				// At or past the end of the object
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		o.reader = r
+		o.offset = off
 	}
-	o.reader = r
-	o.offset = off
 
-	read, err := o.reader.Read(p)
+	read, err := io.ReadFull(o.reader, p)
 	o.offset += int64(read)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
 	return read, err
 }
 
@@ -146,7 +185,7 @@ func (o *gcsFileResource) WriteAt(b []byte, off int64) (n int, err error) {
 		return 0, err
 	}
 
-	w := o.obj.NewWriter(o.ctx)
+	w := newWriter(o.ctx, o.obj, o.opts)
 	// TRIGGER WARNING: This can seem like a hack but it works thanks
 	// to GCS strong consistency. We will open and write to the same file; First when the
 	// writer is closed will the content get committed to GCS.
@@ -167,6 +206,11 @@ func (o *gcsFileResource) WriteAt(b []byte, off int64) (n int, err error) {
 	} else {
 		o.currentGcsSize = int64(objAttrs.Size)
 	}
+	previous := ""
+	if objAttrs != nil && o.currentGcsSize > 0 {
+		previous = objAttrs.ContentType
+	}
+	setContentType(w, o.opts, previous, b)
 
 	if off > o.currentGcsSize {
 		return 0, ErrOutOfRange
@@ -215,7 +259,8 @@ func (o *gcsFileResource) Truncate(wantedSize int64) error {
 		return err
 	}
 
-	w := o.obj.NewWriter(o.ctx)
+	w := newWriter(o.ctx, o.obj, o.opts)
+	setContentType(w, o.opts, r.Attrs.ContentType, nil)
 	written, err := io.Copy(w, r)
 	if err != nil {
 		return err
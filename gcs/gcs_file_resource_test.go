@@ -0,0 +1,85 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestContentType(t *testing.T) {
+	bucket := (&storage.Client{}).Bucket("bucket")
+	ctx := context.Background()
+
+	w := newWriter(ctx, bucket.Object("data/file.json"), ObjectOptions{})
+	setContentType(w, ObjectOptions{}, "", []byte("<html></html>"))
+	if w.ContentType != "application/json" {
+		t.Fatalf("was expecting application/json, got %s", w.ContentType)
+	}
+
+	w = newWriter(ctx, bucket.Object("data/file"), ObjectOptions{})
+	setContentType(w, ObjectOptions{}, "", []byte("<html></html>"))
+	if w.ContentType != "text/html; charset=utf-8" {
+		t.Fatalf("was expecting text/html, got %s", w.ContentType)
+	}
+
+	// Rewrites keep the content type of the object
+	w = newWriter(ctx, bucket.Object("data/file"), ObjectOptions{})
+	setContentType(w, ObjectOptions{}, "image/png", []byte("<html></html>"))
+	if w.ContentType != "image/png" {
+		t.Fatalf("was expecting image/png, got %s", w.ContentType)
+	}
+
+	opts := ObjectOptions{DisableContentSniffing: true}
+	w = newWriter(ctx, bucket.Object("data/file"), opts)
+	setContentType(w, opts, "", []byte("<html></html>"))
+	if w.ContentType != "application/octet-stream" {
+		t.Fatalf("was expecting application/octet-stream, got %s", w.ContentType)
+	}
+}
+
+func TestReadAtEOF(t *testing.T) {
+	content := []byte("0123456789")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+	host := os.Getenv("STORAGE_EMULATOR_HOST")
+	os.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	defer os.Setenv("STORAGE_EMULATOR_HOST", host)
+	ctx := context.Background()
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &gcsFileResource{ctx: ctx, obj: client.Bucket("bucket").Object("file"), name: "file"}
+	defer o.Close()
+
+	tests := []struct {
+		off      int64
+		size     int
+		expected string
+		err      error
+	}{
+		{0, 4, "0123", nil},
+		{4, 4, "4567", nil},
+		{8, 4, "89", io.EOF},
+		{2, 8, "23456789", nil},
+		{10, 4, "", io.EOF},
+		{20, 4, "", io.EOF},
+	}
+	for _, test := range tests {
+		p := make([]byte, test.size)
+		n, err := o.ReadAt(p, test.off)
+		if string(p[:n]) != test.expected || err != test.err {
+			t.Fatalf("was expecting %q, %v at %d, got %q, %v", test.expected, test.err, test.off, p[:n], err)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package gcs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// HoldError is returned when deleting an object protected by a hold or by
+// the retention policy of its bucket. It matches os.ErrPermission.
+type HoldError struct {
+	Name           string
+	TemporaryHold  bool
+	EventBasedHold bool
+	RetainUntil    time.Time
+}
+
+func (e *HoldError) Error() string {
+	var reasons []string
+	if e.TemporaryHold {
+		reasons = append(reasons, "temporary hold")
+	}
+	if e.EventBasedHold {
+		reasons = append(reasons, "event-based hold")
+	}
+	if !e.RetainUntil.IsZero() {
+		reasons = append(reasons, fmt.Sprintf("retained until %s", e.RetainUntil.Format(time.RFC3339)))
+	}
+	return fmt.Sprintf("%s is protected: %s", e.Name, strings.Join(reasons, ", "))
+}
+
+func (e *HoldError) Is(target error) bool {
+	return target == os.ErrPermission
+}
+
+// CheckHold returns a *HoldError if the object can't be deleted at time now
+// because of a hold or a retention period.
+func CheckHold(name string, attrs *storage.ObjectAttrs, now time.Time) error {
+	err := &HoldError{
+		Name:           name,
+		TemporaryHold:  attrs.TemporaryHold,
+		EventBasedHold: attrs.EventBasedHold,
+	}
+	if attrs.RetentionExpirationTime.After(now) {
+		err.RetainUntil = attrs.RetentionExpirationTime
+	}
+	if err.TemporaryHold || err.EventBasedHold || !err.RetainUntil.IsZero() {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package gcs
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+func TestCheckHold(t *testing.T) {
+	now := time.Now()
+	if err := CheckHold("a", &storage.ObjectAttrs{}, now); err != nil {
+		t.Fatalf("was expecting no error, got %v", err)
+	}
+	if err := CheckHold("a", &storage.ObjectAttrs{RetentionExpirationTime: now.Add(-time.Hour)}, now); err != nil {
+		t.Fatalf("was expecting no error for an expired retention, got %v", err)
+	}
+	err := CheckHold("a", &storage.ObjectAttrs{TemporaryHold: true, RetentionExpirationTime: now.Add(time.Hour)}, now)
+	var herr *HoldError
+	if !errors.As(err, &herr) {
+		t.Fatalf("was expecting a HoldError, got %v", err)
+	}
+	if !herr.TemporaryHold || herr.EventBasedHold || herr.RetainUntil.IsZero() {
+		t.Fatalf("unexpected hold error: %+v", herr)
+	}
+	if !errors.Is(err, os.ErrPermission) {
+		t.Fatal("was expecting the hold error to match os.ErrPermission")
+	}
+}
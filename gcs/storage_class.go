@@ -0,0 +1,19 @@
+package gcs
+
+const (
+	StorageClassStandard = "STANDARD"
+	StorageClassNearline = "NEARLINE"
+	StorageClassColdline = "COLDLINE"
+	StorageClassArchive  = "ARCHIVE"
+)
+
+// IsArchiveClass returns true if objects of the storage class incur
+// retrieval costs when read.
+func IsArchiveClass(class string) bool {
+	switch class {
+	case StorageClassNearline, StorageClassColdline, StorageClassArchive:
+		return true
+	default:
+		return false
+	}
+}
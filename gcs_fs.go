@@ -15,37 +15,162 @@ package kafero
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/melaurent/kafero/gcs"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
 // TODO walk returns folder file ???
 
+// Maximum number of concurrent requests issued by StatMany
+const gcsStatConcurrency = 32
+
 // GcsFs is a Fs implementation that uses functions provided by google cloud storage
 type GcsFs struct {
-	ctx       context.Context
-	client    *storage.Client
-	bucket    *storage.BucketHandle
-	separator string
+	ctx           context.Context
+	client        *storage.Client
+	bucket        *storage.BucketHandle
+	bucketName    string
+	separator     string
+	root          string
+	rootErr       error
+	codec         NameCodec
+	storageClass  string
+	noSniffing    bool
+	archivePolicy ArchiveReadPolicy
+	negative      *negativeCache
+	// Readahead of the files opened read only, disabled if 0
+	readaheadBuffers int
+	readaheadSize    int
+	// Write buffer of the files opened for writing, disabled if 0
+	writeBufferSize int
+}
+
+// ArchiveReadPolicy decides what happens when opening for reading an object
+// stored in a NEARLINE, COLDLINE or ARCHIVE storage class.
+type ArchiveReadPolicy int
+
+const (
+	// ArchiveReadAllow reads the object, incurring retrieval costs.
+	ArchiveReadAllow ArchiveReadPolicy = iota
+	// ArchiveReadDeny refuses to open the object, returning gcs.ErrArchived.
+	ArchiveReadDeny
+	// ArchiveReadWarm rewrites the object in the storage class of the
+	// GcsFs (STANDARD by default) before opening it, so only the first read
+	// incurs retrieval costs.
+	ArchiveReadWarm
+)
+
+// ErrOutsideRoot is returned for the paths escaping the root of a GcsFs.
+var ErrOutsideRoot = errors.New("path outside of the root")
+
+type GcsOption func(fs *GcsFs)
+
+// GcsRoot resolves all the paths under the prefix root of the bucket, as in
+// a folder, so that a bucket can host several filesystems. The paths
+// escaping root, through "..", are rejected with ErrOutsideRoot, as are
+// all the operations if root itself escapes the bucket.
+func GcsRoot(root string) GcsOption {
+	return func(fs *GcsFs) {
+		fs.root, fs.rootErr = cleanGcsPath(root, fs.separator)
+		if fs.rootErr != nil {
+			fs.rootErr = &os.PathError{Op: "root", Path: root, Err: fs.rootErr}
+		}
+	}
+}
+
+// GcsStorageClass sets the storage class of the objects written through
+// the GcsFs, instead of the bucket default.
+func GcsStorageClass(class string) GcsOption {
+	return func(fs *GcsFs) {
+		fs.storageClass = class
+	}
+}
+
+// GcsDisableContentSniffing stops guessing the content type of the
+// written objects from their first bytes when their extension is unknown,
+// they get application/octet-stream instead.
+func GcsDisableContentSniffing() GcsOption {
+	return func(fs *GcsFs) {
+		fs.noSniffing = true
+	}
+}
+
+// GcsReadahead wraps the files opened read only in a ReadaheadFile, reading
+// up to buffers chunks of size bytes ahead of the sequential reads.
+func GcsReadahead(buffers int, size int) GcsOption {
+	return func(fs *GcsFs) {
+		fs.readaheadBuffers = buffers
+		fs.readaheadSize = size
+	}
+}
+
+// GcsWriteBuffer wraps the files opened for writing in a
+// BufferedWriterFile, coalescing the small writes into writes of size
+// bytes.
+func GcsWriteBuffer(size int) GcsOption {
+	return func(fs *GcsFs) {
+		fs.writeBufferSize = size
+	}
+}
+
+// GcsArchivePolicy sets the policy applied when reading archived objects.
+func GcsArchivePolicy(policy ArchiveReadPolicy) GcsOption {
+	return func(fs *GcsFs) {
+		fs.archivePolicy = policy
+	}
+}
+
+// GcsNegativeCacheTTL enables the caching of failed lookups: an object
+// found missing is reported missing for ttl without querying GCS again.
+// Objects created through the GcsFs are visible immediately, objects
+// created by other clients may not be until ttl expires.
+func GcsNegativeCacheTTL(ttl time.Duration) GcsOption {
+	return func(fs *GcsFs) {
+		fs.negative = newNegativeCache(ttl, nil)
+	}
 }
 
-func NewGcsFs(ctx context.Context, cl *storage.Client, bucket string, folderSep string) *GcsFs {
-	return &GcsFs{
-		ctx:       ctx,
-		client:    cl,
-		bucket:    cl.Bucket(bucket),
-		separator: folderSep,
+// GcsNameCodec encodes the path elements of the files into the ones of the
+// names of their objects with codec. The objects not written through the
+// codec are listed, walked and removed by RemoveAll with their name, but
+// are not reachable by it when it encodes to another object name.
+func GcsNameCodec(codec NameCodec) GcsOption {
+	return func(fs *GcsFs) {
+		fs.codec = codec
 	}
 }
 
+// NewGcsFs returns a GcsFs over bucket, whose folders are separated by
+// folderSep, "/" if empty.
+func NewGcsFs(ctx context.Context, cl *storage.Client, bucket string, folderSep string, opts ...GcsOption) *GcsFs {
+	if folderSep == "" {
+		folderSep = "/"
+	}
+	fs := &GcsFs{
+		ctx:        ctx,
+		client:     cl,
+		bucket:     cl.Bucket(bucket),
+		bucketName: bucket,
+		separator:  folderSep,
+	}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
 // normSeparators will normalize all "\\" and "/" to the provided separator
 func normSeparators(s string, to string) string {
 	return strings.Replace(strings.Replace(s, "\\", to, -1), "/", to, -1)
@@ -66,8 +191,66 @@ func (fs *GcsFs) trimRoot(s string) string {
 	}
 }
 
-func (fs *GcsFs) getObj(name string) *storage.ObjectHandle {
-	return fs.bucket.Object(normSeparators(name, fs.separator)) //normalize paths for ll oses
+// cleanGcsPath returns the path name with its separators normalized, and
+// its "." and ".." elements resolved, without leading nor trailing
+// separator. It fails with ErrOutsideRoot if name escapes its root.
+func cleanGcsPath(name string, separator string) (string, error) {
+	var elems []string
+	for _, elem := range strings.Split(normSeparators(name, separator), separator) {
+		switch elem {
+		case "", ".":
+		case "..":
+			if len(elems) == 0 {
+				return "", ErrOutsideRoot
+			}
+			elems = elems[:len(elems)-1]
+		default:
+			elems = append(elems, elem)
+		}
+	}
+	return strings.Join(elems, separator), nil
+}
+
+// objName returns the name of the object of the path name, under the root
+// of the GcsFs.
+func (fs *GcsFs) objName(op, name string) (string, error) {
+	if fs.rootErr != nil {
+		return "", fs.rootErr
+	}
+	clean, err := cleanGcsPath(name, fs.separator)
+	if err != nil {
+		return "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return fs.objectOptions().ObjectName(clean, fs.separator), nil
+}
+
+// relName returns the path, relative to the root of the GcsFs, of the
+// object or prefix objName.
+func (fs *GcsFs) relName(objName string) string {
+	if fs.root != "" {
+		objName = strings.TrimPrefix(objName, fs.root+fs.separator)
+	}
+	if fs.codec == nil {
+		return objName
+	}
+	elems := strings.Split(objName, fs.separator)
+	for i, elem := range elems {
+		elems[i] = fs.decode(elem)
+	}
+	return strings.Join(elems, fs.separator)
+}
+
+// decode returns the decoded path element elem, or elem if it was not
+// encoded by the codec: only the elements encoding back to themselves are
+// decoded, so that the names of two objects can't decode to the same one.
+func (fs *GcsFs) decode(elem string) string {
+	if fs.codec == nil {
+		return elem
+	}
+	if name, err := fs.codec.Decode(elem); err == nil && fs.codec.Encode(name) == elem {
+		return name
+	}
+	return elem
 }
 
 func (fs *GcsFs) Name() string { return "GcsFs" }
@@ -83,14 +266,19 @@ func (fs *GcsFs) Mkdir(name string, perm os.FileMode) error {
 	}
 	name = fs.trimRoot(name)
 	name = filepath.Clean(normSeparators(name, fs.separator))
-	obj := fs.getObj(name)
+	objName, err := fs.objName("mkdir", name)
+	if err != nil {
+		return err
+	}
+	obj := fs.bucket.Object(objName)
 	w := obj.NewWriter(fs.ctx)
 	if err := w.Close(); err != nil {
 		return err
 	}
+	fs.negative.invalidate(name)
 	meta := make(map[string]string)
 	meta["virtual_folder"] = "y"
-	_, err := obj.Update(fs.ctx, storage.ObjectAttrsToUpdate{Metadata: meta})
+	_, err = obj.Update(fs.ctx, storage.ObjectAttrsToUpdate{Metadata: meta})
 	//fmt.Printf("Created virtual folder: %v\n", name)
 	return err
 }
@@ -141,81 +329,339 @@ func (fs *GcsFs) OpenFile(name string, flag int, perm os.FileMode) (File, error)
 		}
 	}
 
-	file, err := gcs.NewGcsFile(fs.ctx, fs.bucket, fs.getObj(name), fs.separator, flag, name)
+	if flag&os.O_CREATE == 0 && fs.negative.missing(name) {
+		return nil, os.ErrNotExist
+	}
+
+	objName, err := fs.objName("open", name)
 	if err != nil {
+		return nil, err
+	}
+	obj := fs.bucket.Object(objName)
+	if fs.archivePolicy != ArchiveReadAllow && flag&(os.O_WRONLY|os.O_TRUNC) == 0 {
+		if err := fs.checkArchived(obj, name); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := gcs.NewGcsFileWithOptions(fs.ctx, fs.bucket, obj, fs.separator, flag, name, fs.objectOptions())
+	if err != nil {
+		if err == os.ErrNotExist {
+			fs.negative.add(name)
+		}
 		// Don't decorate error, as implementations depend on knowing
 		// if err is ErrExists or ErrNotExists etc..
 		return nil, err
 	}
+	if flag&os.O_CREATE != 0 {
+		fs.negative.invalidate(name)
+	}
+	if fs.readaheadBuffers > 0 && flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) == 0 {
+		return NewReadaheadFile(file, fs.readaheadBuffers, fs.readaheadSize), nil
+	}
+	if fs.writeBufferSize > 0 && flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 {
+		return NewBufferedWriterFile(file, fs.writeBufferSize), nil
+	}
 
 	return file, nil
 }
 
+func (fs *GcsFs) objectOptions() gcs.ObjectOptions {
+	return gcs.ObjectOptions{
+		StorageClass:           fs.storageClass,
+		DisableContentSniffing: fs.noSniffing,
+		Root:                   fs.root,
+		Codec:                  fs.codec,
+	}
+}
+
+// checkArchived applies the archive read policy to the object.
+func (fs *GcsFs) checkArchived(obj *storage.ObjectHandle, name string) error {
+	attrs, err := obj.Attrs(fs.ctx)
+	if err != nil {
+		// Let the file opening report missing objects
+		return nil
+	}
+	if !gcs.IsArchiveClass(attrs.StorageClass) {
+		return nil
+	}
+	switch fs.archivePolicy {
+	case ArchiveReadDeny:
+		return &os.PathError{Op: "open", Path: name, Err: gcs.ErrArchived}
+	case ArchiveReadWarm:
+		class := fs.storageClass
+		if class == "" || gcs.IsArchiveClass(class) {
+			class = gcs.StorageClassStandard
+		}
+		return fs.setStorageClass(obj, attrs, class)
+	}
+	return nil
+}
+
+// setStorageClass rewrites the object in the given storage class, keeping
+// its other attributes.
+func (fs *GcsFs) setStorageClass(obj *storage.ObjectHandle, attrs *storage.ObjectAttrs, class string) error {
+	copier := obj.CopierFrom(obj)
+	copier.ContentType = attrs.ContentType
+	copier.ContentEncoding = attrs.ContentEncoding
+	copier.CacheControl = attrs.CacheControl
+	copier.Metadata = attrs.Metadata
+	copier.StorageClass = class
+	if _, err := copier.Run(fs.ctx); err != nil {
+		return fmt.Errorf("error rewriting object in storage class %s: %v", class, err)
+	}
+	return nil
+}
+
 func (fs *GcsFs) Remove(name string) error {
-	name = fs.trimRoot(name)
-	obj := fs.getObj(name)
-	if _, err := fs.Stat(name); err != nil {
+	obj, attrs, err := fs.objAttrs("remove", name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return os.ErrNotExist
+		}
+		return err
+	}
+	// Refuse early rather than getting an opaque 403 from GCS
+	if err := gcs.CheckHold(fs.trimRoot(name), attrs, time.Now()); err != nil {
 		return err
 	}
 	return obj.Delete(fs.ctx)
 }
 
+var _ conditionalFs = (*GcsFs)(nil)
+
+// generation returns the object of the file name, with a precondition on
+// the generation of its version stat'ed as fi.
+func (fs *GcsFs) generation(op, name string, fi os.FileInfo) (*storage.ObjectHandle, error) {
+	info, ok := fi.(*gcs.FileInfo)
+	if !ok || info.ObjAtt == nil || info.ObjAtt.Generation == 0 {
+		return nil, &os.PathError{Op: op, Path: name, Err: errLockChanged}
+	}
+	objName, err := fs.objName(op, fs.trimRoot(name))
+	if err != nil {
+		return nil, err
+	}
+	return fs.bucket.Object(objName).If(storage.Conditions{GenerationMatch: info.ObjAtt.Generation}), nil
+}
+
+// conditionError maps the failed preconditions on the generation of the
+// object of name to errLockChanged.
+func conditionError(op, name string, err error) error {
+	var gerr *googleapi.Error
+	if (errors.As(err, &gerr) && gerr.Code == http.StatusPreconditionFailed) || err == storage.ErrObjectNotExist {
+		return &os.PathError{Op: op, Path: name, Err: errLockChanged}
+	}
+	return err
+}
+
+// removeIfUnchanged removes the file name if its object is still the
+// generation stat'ed as fi, for FileLock.
+func (fs *GcsFs) removeIfUnchanged(name string, fi os.FileInfo) error {
+	obj, err := fs.generation("remove", name, fi)
+	if err != nil {
+		return err
+	}
+	return conditionError("remove", name, obj.Delete(fs.ctx))
+}
+
+// writeIfUnchanged rewrites the file name with data if its object is still
+// the generation stat'ed as fi, for FileLock.
+func (fs *GcsFs) writeIfUnchanged(name string, fi os.FileInfo, data []byte) error {
+	obj, err := fs.generation("write", name, fi)
+	if err != nil {
+		return err
+	}
+	w := obj.NewWriter(fs.ctx)
+	_, err = w.Write(data)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return conditionError("write", name, err)
+}
+
+// RemoveAll removes the named file, or virtual folder with its content. As
+// os.RemoveAll, it returns nil if the path doesn't exist.
 func (fs *GcsFs) RemoveAll(path string) error {
-	path = fs.trimRoot(path)
-	path = fs.ensureTrailingSeparator(path)
+	objName, err := fs.objName("removeall", path)
+	if err != nil {
+		return err
+	}
+	if err := fs.removePrefix(fs.ensureTrailingSeparator(objName)); err != nil {
+		return err
+	}
+
+	// The file, or the object of the virtual folder, itself
+	if clean, _ := cleanGcsPath(path, fs.separator); clean != "" {
+		if err := fs.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
 
+// removePrefix removes the objects whose name starts with prefix. The
+// objects are removed by the names listed, rather than by names decoded
+// and encoded again, so that the objects not written through the codec
+// are removed too.
+func (fs *GcsFs) removePrefix(prefix string) error {
 	it := fs.bucket.Objects(fs.ctx, &storage.Query{
 		Delimiter: fs.separator,
-		Prefix:    path,
+		Prefix:    prefix,
 		Versions:  false})
 	for {
 		objAttrs, err := it.Next()
 		if err == iterator.Done {
-			break
+			return nil
 		}
 		if err != nil {
 			return fmt.Errorf("error iterating objects: %v", err)
 		}
 		if objAttrs.Name != "" {
-			if err := fs.Remove(objAttrs.Name); err != nil {
+			if err := gcs.CheckHold(fs.relName(objAttrs.Name), objAttrs, time.Now()); err != nil {
+				return err
+			}
+			err := fs.bucket.Object(objAttrs.Name).Delete(fs.ctx)
+			if err != nil && err != storage.ErrObjectNotExist {
 				return err
 			}
 		} else if objAttrs.Prefix != "" {
-			if err := fs.RemoveAll(objAttrs.Prefix); err != nil {
+			if err := fs.removePrefix(objAttrs.Prefix); err != nil {
 				return err
 			}
 		}
 	}
-
-	// TODO delete the folder file
-	return nil
 }
 
 func (fs *GcsFs) Rename(oldname, newname string) error {
 	oldname = fs.trimRoot(oldname)
 	newname = fs.trimRoot(newname)
+	srcName, err := fs.objName("rename", oldname)
+	if err != nil {
+		return err
+	}
+	dstName, err := fs.objName("rename", newname)
+	if err != nil {
+		return err
+	}
 
-	src := fs.bucket.Object(oldname)
-	dst := fs.bucket.Object(newname)
+	src := fs.bucket.Object(srcName)
+	dst := fs.bucket.Object(dstName)
 
+	// The source object is deleted once copied, don't copy it if it is held
+	if attrs, err := src.Attrs(fs.ctx); err == nil {
+		if err := gcs.CheckHold(oldname, attrs, time.Now()); err != nil {
+			return err
+		}
+	}
 	if _, err := dst.CopierFrom(src).Run(fs.ctx); err != nil {
 		return err
 	}
+	fs.negative.invalidate(newname)
 	return src.Delete(fs.ctx)
 }
 
 func (fs *GcsFs) Stat(name string) (os.FileInfo, error) {
 	name = fs.trimRoot(name)
+	if strings.Trim(name, fs.separator) == "" {
+		return gcs.NewDirInfo("", fs.separator), nil
+	}
 
-	obj := fs.getObj(name)
-	objAttrs, err := obj.Attrs(fs.ctx)
+	if fs.negative.missing(name) {
+		return nil, os.ErrNotExist
+	}
+
+	objName, err := fs.objName("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	objAttrs, err := fs.bucket.Object(objName).Attrs(fs.ctx)
 	if err != nil {
 		if err == storage.ErrObjectNotExist {
+			// Directories created by other tools have no marker object
+			prefix := fs.ensureTrailingSeparator(objName)
+			exists, perr := gcs.PrefixExists(fs.ctx, fs.bucket, prefix)
+			if perr != nil {
+				return nil, perr
+			}
+			if exists {
+				return gcs.NewDirInfo(name, fs.separator), nil
+			}
+			fs.negative.add(name)
 			return nil, os.ErrNotExist //works with os.IsNotExist check
 		}
 		return nil, err
 	}
-	return &gcs.FileInfo{objAttrs}, nil
+	return &gcs.FileInfo{ObjAtt: objAttrs, Codec: fs.codec}, nil
+}
+
+var _ Lstater = (*GcsFs)(nil)
+
+// LstatIfPossible stats the object, as there are no symlinks in a bucket.
+func (fs *GcsFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	fi, err := fs.Stat(name)
+	return fi, false, err
+}
+
+// StatMany issues the Stat requests concurrently, as each of them is a
+// round trip to GCS.
+func (fs *GcsFs) StatMany(names []string) (map[string]os.FileInfo, error) {
+	return statMany(names, gcsStatConcurrency, fs.Stat)
+}
+
+// Prefetch lists the tree rooted at dir in a single flat listing, the
+// directories being synthesized from the object prefixes.
+func (fs *GcsFs) Prefetch(dir string) (map[string]os.FileInfo, error) {
+	res := make(map[string]os.FileInfo)
+	info, err := fs.Stat(dir)
+	if os.IsNotExist(err) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res[filepath.Clean(dir)] = info
+	if !info.IsDir() {
+		return res, nil
+	}
+	prefix, err := fs.objName("prefetch", dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix = fs.ensureTrailingSeparator(prefix)
+	it := fs.bucket.Objects(fs.ctx, &storage.Query{Prefix: prefix, Versions: false})
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		rel := strings.TrimPrefix(attrs.Name, prefix)
+		isDir := strings.HasSuffix(rel, fs.separator)
+		rel = strings.Trim(rel, fs.separator)
+		if rel == "" {
+			// Marker of dir itself
+			continue
+		}
+		parts := strings.Split(rel, fs.separator)
+		for i, part := range parts {
+			parts[i] = fs.decode(part)
+		}
+		for i := range parts[:len(parts)-1] {
+			name := filepath.Join(dir, filepath.Join(parts[:i+1]...))
+			if _, ok := res[name]; !ok {
+				res[name] = gcs.NewDirInfo(strings.Join(parts[:i+1], fs.separator), fs.separator)
+			}
+		}
+		name := filepath.Join(dir, filepath.Join(parts...))
+		if isDir {
+			// Marker objects take precedence over synthesized directories
+			res[name] = gcs.NewDirInfo(strings.Join(parts, fs.separator), fs.separator)
+		} else if fi, ok := res[name]; !ok || !fi.IsDir() {
+			res[name] = &gcs.FileInfo{ObjAtt: attrs, Codec: fs.codec}
+		}
+	}
 }
 
 func (fs *GcsFs) Chmod(name string, mode os.FileMode) error {
@@ -226,35 +672,94 @@ func (fs *GcsFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
 	return fmt.Errorf("chtimes not implemented: Create, Delete, Updated times are read only fields in GCS and set implicitly")
 }
 
+var _ FileIDer = (*GcsFs)(nil)
+
+// FileID returns the bucket, name and generation of the object, which
+// changes each time the object is written.
+func (fs *GcsFs) FileID(name string) (FileID, error) {
+	_, attrs, err := fs.objAttrs("fileid", name)
+	if err != nil {
+		return "", err
+	}
+	return FileID(fmt.Sprintf("%s/%s#%d", attrs.Bucket, attrs.Name, attrs.Generation)), nil
+}
+
+// Walk walks the tree rooted at root like Walk does, listing each
+// directory with a delimiter listing once walkFn visited it, so that the
+// directories skipped with filepath.SkipDir are never listed. The entries
+// are sorted by name, as GCS lists "a.txt" before the prefix "a/".
 func (fs *GcsFs) Walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := fs.Stat(root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+	err = fs.walk(root, info, walkFn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
 
-	ctx := context.Background()
+func (fs *GcsFs) walk(path string, info os.FileInfo, walkFn filepath.WalkFunc) error {
+	if err := walkFn(path, info, nil); err != nil || !info.IsDir() {
+		return err
+	}
+	infos, err := fs.listDir(path)
+	if err != nil {
+		return walkFn(path, info, err)
+	}
+	for _, fi := range infos {
+		err := fs.walk(filepath.Join(path, fi.Name()), fi, walkFn)
+		if err == filepath.SkipDir {
+			if fi.IsDir() {
+				continue
+			}
+			// Skip the remaining files of the directory
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	it := fs.bucket.Objects(ctx, &storage.Query{
-		Prefix: root,
-	})
+// listDir lists the entries of the directory dir, sorted by name.
+func (fs *GcsFs) listDir(dir string) ([]os.FileInfo, error) {
+	prefix, err := fs.objName("walk", dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix = fs.ensureTrailingSeparator(prefix)
+	it := fs.bucket.Objects(fs.ctx, &storage.Query{
+		Delimiter: fs.separator,
+		Prefix:    prefix,
+		Versions:  false})
+	var infos []os.FileInfo
+	seen := make(map[string]int)
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
-		var info *gcs.FileInfo
-		fName := ""
-		if attrs != nil {
-			fName = attrs.Name
-			info = &gcs.FileInfo{
-				ObjAtt: attrs,
-			}
-		} else {
-			fmt.Println("NIL ATTRIBUTE", err)
+		if err != nil {
+			return nil, err
 		}
-
-		if err := walkFn(fName, info, err); err != nil {
-			return err
+		if attrs.Name == prefix {
+			// Marker of dir itself
+			continue
+		}
+		fi := &gcs.FileInfo{ObjAtt: attrs, Codec: fs.codec}
+		if i, ok := seen[fi.Name()]; ok {
+			// Directories take precedence over the objects of the same name
+			if fi.IsDir() {
+				infos[i] = fi
+			}
+			continue
 		}
+		seen[fi.Name()] = len(infos)
+		infos = append(infos, fi)
 	}
-
-	return nil
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
 }
@@ -5,6 +5,7 @@ package kafero
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -35,3 +36,62 @@ func TestGcsFs_Create(t *testing.T) {
 	b, err := ioutil.ReadAll(file2)
 	fmt.Println(string(b))
 }
+
+func TestGcsFs_Root(t *testing.T) {
+	fs := &GcsFs{separator: "/"}
+	GcsRoot("/tenants/a/")(fs)
+	for name, expected := range map[string]string{
+		"":                "tenants/a",
+		"/":               "tenants/a",
+		"data/file.bin":   "tenants/a/data/file.bin",
+		"/data//./x/../y": "tenants/a/data/y",
+		"data\\file.bin":  "tenants/a/data/file.bin",
+	} {
+		objName, err := fs.objName("open", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if objName != expected {
+			t.Fatalf("was expecting %s for %s, got %s", expected, name, objName)
+		}
+	}
+	if rel := fs.relName("tenants/a/data/"); rel != "data/" {
+		t.Fatalf("was expecting data/, got %s", rel)
+	}
+	for _, name := range []string{"..", "../b/file.bin", "data/../../b"} {
+		_, err := fs.objName("open", name)
+		if perr, ok := err.(*os.PathError); !ok || perr.Err != ErrOutsideRoot {
+			t.Fatalf("was expecting ErrOutsideRoot for %s, got %v", name, err)
+		}
+	}
+
+	fs = &GcsFs{separator: "/"}
+	GcsRoot("../other")(fs)
+	if _, err := fs.objName("open", "file.bin"); err == nil {
+		t.Fatal("was expecting an error for a root escaping the bucket")
+	}
+}
+
+func TestGcsFs_NameCodec(t *testing.T) {
+	fs := &GcsFs{separator: "/"}
+	GcsRoot("tenant")(fs)
+	GcsNameCodec(EscapeNames)(fs)
+	objName, err := fs.objName("open", "data dir/a#b.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if objName != "tenant/data%20dir/a%23b.csv" {
+		t.Fatalf("was expecting the elements to be escaped, got %s", objName)
+	}
+	if rel := fs.relName(objName); rel != "data dir/a#b.csv" {
+		t.Fatalf("was expecting data dir/a#b.csv, got %s", rel)
+	}
+	// The objects written by other tools keep their name
+	if rel := fs.relName("tenant/raw%zz"); rel != "raw%zz" {
+		t.Fatalf("was expecting raw%%zz, got %s", rel)
+	}
+	// Nor are the names decoding to the name of another object
+	if rel := fs.relName("tenant/a%41"); rel != "a%41" {
+		t.Fatalf("was expecting a%%41, got %s", rel)
+	}
+}
@@ -0,0 +1,177 @@
+package kafero
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+var (
+	_ Xattrer = (*GcsFs)(nil)
+	_ Metaer  = (*GcsFs)(nil)
+)
+
+// Extended attributes of the objects of a GcsFs. "user." attributes are
+// stored in the object metadata.
+const (
+	GcsXattrStorageClass        = "gcs.storage_class"
+	GcsXattrTemporaryHold       = "gcs.temporary_hold"
+	GcsXattrEventBasedHold      = "gcs.event_based_hold"
+	GcsXattrRetentionExpiration = "gcs.retention_expiration"
+	xattrUserPrefix             = "user."
+)
+
+func (fs *GcsFs) objAttrs(op, name string) (*storage.ObjectHandle, *storage.ObjectAttrs, error) {
+	name = fs.trimRoot(name)
+	objName, err := fs.objName(op, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj := fs.bucket.Object(objName)
+	attrs, err := obj.Attrs(fs.ctx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			return nil, nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		return nil, nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return obj, attrs, nil
+}
+
+func (fs *GcsFs) Getxattr(name, attr string) ([]byte, error) {
+	_, attrs, err := fs.objAttrs("getxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case attr == GcsXattrStorageClass:
+		return []byte(attrs.StorageClass), nil
+	case attr == GcsXattrTemporaryHold:
+		return []byte(strconv.FormatBool(attrs.TemporaryHold)), nil
+	case attr == GcsXattrEventBasedHold:
+		return []byte(strconv.FormatBool(attrs.EventBasedHold)), nil
+	case attr == GcsXattrRetentionExpiration:
+		if attrs.RetentionExpirationTime.IsZero() {
+			return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoAttr}
+		}
+		return []byte(attrs.RetentionExpirationTime.Format(time.RFC3339)), nil
+	case strings.HasPrefix(attr, xattrUserPrefix):
+		v, ok := attrs.Metadata[strings.TrimPrefix(attr, xattrUserPrefix)]
+		if !ok {
+			return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoAttr}
+		}
+		return []byte(v), nil
+	default:
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoAttr}
+	}
+}
+
+func (fs *GcsFs) Setxattr(name, attr string, value []byte) error {
+	obj, attrs, err := fs.objAttrs("setxattr", name)
+	if err != nil {
+		return err
+	}
+	switch {
+	case attr == GcsXattrStorageClass:
+		if err := fs.setStorageClass(obj, attrs, string(value)); err != nil {
+			return &os.PathError{Op: "setxattr", Path: name, Err: err}
+		}
+		return nil
+	case attr == GcsXattrTemporaryHold, attr == GcsXattrEventBasedHold:
+		hold, err := strconv.ParseBool(string(value))
+		if err != nil {
+			return &os.PathError{Op: "setxattr", Path: name, Err: err}
+		}
+		var update storage.ObjectAttrsToUpdate
+		if attr == GcsXattrTemporaryHold {
+			update.TemporaryHold = hold
+		} else {
+			update.EventBasedHold = hold
+		}
+		if _, err := obj.Update(fs.ctx, update); err != nil {
+			return &os.PathError{Op: "setxattr", Path: name, Err: err}
+		}
+		return nil
+	case strings.HasPrefix(attr, xattrUserPrefix):
+		meta := map[string]string{strings.TrimPrefix(attr, xattrUserPrefix): string(value)}
+		if _, err := obj.Update(fs.ctx, storage.ObjectAttrsToUpdate{Metadata: meta}); err != nil {
+			return &os.PathError{Op: "setxattr", Path: name, Err: err}
+		}
+		return nil
+	default:
+		return &os.PathError{Op: "setxattr", Path: name, Err: ErrXattrNotSupported}
+	}
+}
+
+func (fs *GcsFs) Listxattr(name string) ([]string, error) {
+	_, attrs, err := fs.objAttrs("listxattr", name)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for k := range attrs.Metadata {
+		if k == "virtual_folder" {
+			continue
+		}
+		names = append(names, xattrUserPrefix+k)
+	}
+	sort.Strings(names)
+	system := []string{GcsXattrStorageClass, GcsXattrTemporaryHold, GcsXattrEventBasedHold}
+	if !attrs.RetentionExpirationTime.IsZero() {
+		system = append(system, GcsXattrRetentionExpiration)
+	}
+	return append(system, names...), nil
+}
+
+func (fs *GcsFs) Removexattr(name, attr string) error {
+	if !strings.HasPrefix(attr, xattrUserPrefix) {
+		return &os.PathError{Op: "removexattr", Path: name, Err: ErrXattrNotSupported}
+	}
+	obj, attrs, err := fs.objAttrs("removexattr", name)
+	if err != nil {
+		return err
+	}
+	key := strings.TrimPrefix(attr, xattrUserPrefix)
+	if _, ok := attrs.Metadata[key]; !ok {
+		return &os.PathError{Op: "removexattr", Path: name, Err: ErrNoAttr}
+	}
+	// Deleting a metadata key is done by setting it to the empty string
+	meta := map[string]string{key: ""}
+	if _, err := obj.Update(fs.ctx, storage.ObjectAttrsToUpdate{Metadata: meta}); err != nil {
+		return &os.PathError{Op: "removexattr", Path: name, Err: err}
+	}
+	return nil
+}
+
+// GetMeta returns the metadata of the object, as the "user." attributes
+// without their prefix.
+func (fs *GcsFs) GetMeta(name string) (map[string]string, error) {
+	_, attrs, err := fs.objAttrs("getmeta", name)
+	if err != nil {
+		return nil, err
+	}
+	kv := make(map[string]string, len(attrs.Metadata))
+	for k, v := range attrs.Metadata {
+		if k != "virtual_folder" {
+			kv[k] = v
+		}
+	}
+	return kv, nil
+}
+
+// SetMeta updates the metadata of the object in a single request.
+func (fs *GcsFs) SetMeta(name string, kv map[string]string) error {
+	obj, _, err := fs.objAttrs("setmeta", name)
+	if err != nil {
+		return err
+	}
+	// The keys set to the empty string are deleted
+	if _, err := obj.Update(fs.ctx, storage.ObjectAttrsToUpdate{Metadata: kv}); err != nil {
+		return &os.PathError{Op: "setmeta", Path: name, Err: err}
+	}
+	return nil
+}
@@ -3,13 +3,16 @@ module github.com/melaurent/kafero
 require (
 	cloud.google.com/go/storage v1.12.0
 	github.com/aws/aws-sdk-go v1.43.12
+	github.com/golang/groupcache v0.0.0-20200121045136-8c9f03a8e57e
 	github.com/klauspost/compress v1.16.5
 	github.com/kr/fs v0.1.0 // indirect
+	github.com/pierrec/lz4/v4 v4.1.18
 	github.com/pkg/sftp v1.10.0
 	github.com/stretchr/testify v1.4.0
 	github.com/wangjia184/sortedset v0.0.0-20160527075905-f5d03557ba30
 	golang.org/x/text v0.3.7
 	google.golang.org/api v0.36.0
+	gopkg.in/yaml.v2 v2.2.8
 )
 
 go 1.13
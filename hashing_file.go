@@ -0,0 +1,135 @@
+package kafero
+
+import (
+	"encoding/hex"
+	"errors"
+	"hash"
+	"os"
+)
+
+// XattrDigestPrefix is the prefix of the extended attributes holding the
+// hex encoded digests stored by the HashingFile, followed by the name of
+// the digest, XattrSHA256 being the "sha256" one.
+const XattrDigestPrefix = "user.kafero."
+
+// The HashingFile computes the digests of the content written to a file
+// sequentially from its start, as it is written, sparing a second read of
+// the file to build a manifest after a large upload. Writing out of
+// sequence, with WriteAt, Seek or Truncate, stops the hashing.
+//
+// On Close, the digests are stored in the metadata of the file on the Fs
+// given, as the "kafero.<name>" key if the Fs is a Metaer, or else in the
+// XattrDigestPrefix extended attributes if it supports them, the sha256
+// one being checked by an IntegrityFs with VerifyOnRead.
+type HashingFile struct {
+	File
+	fs     Fs
+	hashes map[string]hash.Hash
+	offset int64
+	sums   map[string][]byte
+}
+
+// NewHashingFile returns a HashingFile computing the digests of f with
+// hashes, by name, such as {"sha256": sha256.New()}. f is expected to be
+// empty, as created or truncated. The digests are stored in the metadata
+// of f on fs, unless fs is nil.
+func NewHashingFile(fs Fs, f File, hashes map[string]hash.Hash) *HashingFile {
+	return &HashingFile{File: f, fs: fs, hashes: hashes}
+}
+
+func (f *HashingFile) Write(b []byte) (int, error) {
+	n, err := f.File.Write(b)
+	f.advance(b[:n], f.offset)
+	return n, err
+}
+
+func (f *HashingFile) WriteAt(b []byte, off int64) (int, error) {
+	n, err := f.File.WriteAt(b, off)
+	f.advance(b[:n], off)
+	return n, err
+}
+
+func (f *HashingFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *HashingFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil && pos != f.offset {
+		f.hashes = nil
+	}
+	return pos, err
+}
+
+func (f *HashingFile) Truncate(size int64) error {
+	if size != f.offset {
+		f.hashes = nil
+	}
+	return f.File.Truncate(size)
+}
+
+// advance feeds b, written at off, to the hashes.
+func (f *HashingFile) advance(b []byte, off int64) {
+	if off != f.offset {
+		f.hashes = nil
+	}
+	for _, h := range f.hashes {
+		h.Write(b)
+	}
+	f.offset += int64(len(b))
+}
+
+// Sums returns the digests of the content written, by name, nil if it
+// wasn't written sequentially.
+func (f *HashingFile) Sums() map[string][]byte {
+	if f.sums != nil {
+		return f.sums
+	}
+	if f.hashes == nil {
+		return nil
+	}
+	sums := make(map[string][]byte, len(f.hashes))
+	for name, h := range f.hashes {
+		sums[name] = h.Sum(nil)
+	}
+	return sums
+}
+
+// Close closes the file and stores its digests, which Sums still returns.
+func (f *HashingFile) Close() error {
+	if f.sums == nil {
+		f.sums = f.Sums()
+	}
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if f.fs == nil || f.sums == nil {
+		return nil
+	}
+	if err := storeDigests(f.fs, f.Name(), f.sums); err != nil {
+		return &os.PathError{Op: "close", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+// storeDigests stores sums in the metadata of the named file, if fs
+// supports it.
+func storeDigests(fs Fs, name string, sums map[string][]byte) error {
+	if mfs, ok := fs.(Metaer); ok {
+		kv := make(map[string]string, len(sums))
+		for digest, sum := range sums {
+			kv["kafero."+digest] = hex.EncodeToString(sum)
+		}
+		return mfs.SetMeta(name, kv)
+	}
+	for digest, sum := range sums {
+		err := Setxattr(fs, name, XattrDigestPrefix+digest, []byte(hex.EncodeToString(sum)))
+		if errors.Is(err, ErrXattrNotSupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package kafero
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"testing"
+)
+
+func TestHashingFile(t *testing.T) {
+	fs := newXattrMemFs()
+	f, err := fs.Create("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hf := NewHashingFile(fs, f, map[string]hash.Hash{"sha256": sha256.New(), "md5": md5.New()})
+	content := bytes.Repeat([]byte("content"), 1000)
+	if _, err := hf.Write(content[:100]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hf.WriteString(string(content[100:])); err != nil {
+		t.Fatal(err)
+	}
+	if err := hf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sha, md := sha256.Sum256(content), md5.Sum(content)
+	sums := hf.Sums()
+	if !bytes.Equal(sums["sha256"], sha[:]) || !bytes.Equal(sums["md5"], md[:]) {
+		t.Fatalf("was expecting the digests of the content, got %x", sums)
+	}
+	if value, err := Getxattr(fs, "file.bin", XattrDigestPrefix+"md5"); err != nil || string(value) != hex.EncodeToString(md[:]) {
+		t.Fatalf("was expecting the md5 stored, got %s, %v", value, err)
+	}
+	// The sha256 digest is verified by the IntegrityFs
+	if _, err := ReadFile(NewIntegrityFs(fs, VerifyOnRead()), "file.bin"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHashingFileOutOfSequence(t *testing.T) {
+	fs := newXattrMemFs()
+	f, err := fs.Create("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hf := NewHashingFile(fs, f, map[string]hash.Hash{"sha256": sha256.New()})
+	if _, err := hf.WriteAt([]byte("content"), 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := hf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if sums := hf.Sums(); sums != nil {
+		t.Fatalf("was expecting no digest, got %x", sums)
+	}
+	if _, err := Getxattr(fs, "file.bin", XattrSHA256); !errors.Is(err, ErrNoAttr) {
+		t.Fatalf("was expecting no digest stored, got %v", err)
+	}
+}
+
+func TestHashingFileNoXattr(t *testing.T) {
+	fs := NewMemMapFs()
+	f, err := fs.Create("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hf := NewHashingFile(fs, f, map[string]hash.Hash{"sha256": sha256.New()})
+	if _, err := hf.Write([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hf.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sha := sha256.Sum256([]byte("content"))
+	if !bytes.Equal(hf.Sums()["sha256"], sha[:]) {
+		t.Fatalf("was expecting the digest of the content, got %x", hf.Sums())
+	}
+}
@@ -0,0 +1,177 @@
+package kafero
+
+import (
+	"os"
+	"time"
+)
+
+var _ Lstater = (*HookFs)(nil)
+
+// Hooks are callbacks run around the operations of a HookFs. Any of them
+// may be nil.
+type Hooks struct {
+	// BeforeOpen is called before a file is opened or created, an error
+	// aborts the operation.
+	BeforeOpen func(name string, flag int) error
+	// AfterWrite is called once a file opened for writing is closed
+	// successfully, and after truncating or changing the metadata of a file.
+	AfterWrite func(name string)
+	// AfterMkdir is called once a directory is created.
+	AfterMkdir func(name string)
+	// AfterRemove is called once a file or a tree is removed.
+	AfterRemove func(name string)
+	// AfterRename is called once a file is renamed.
+	AfterRename func(oldname, newname string)
+}
+
+// The HookFs runs Hooks around the operations of the source filesystem,
+// so that applications can implement invalidation, indexing or replication
+// without a full wrapper Fs. HookFs can be nested to chain several Hooks.
+type HookFs struct {
+	source Fs
+	hooks  Hooks
+}
+
+// WithHooks returns fs wrapped in a HookFs running hooks.
+func WithHooks(fs Fs, hooks Hooks) Fs {
+	return &HookFs{source: fs, hooks: hooks}
+}
+
+func (h *HookFs) beforeOpen(name string, flag int) error {
+	if h.hooks.BeforeOpen == nil {
+		return nil
+	}
+	if err := h.hooks.BeforeOpen(name, flag); err != nil {
+		return &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return nil
+}
+
+func (h *HookFs) afterWrite(name string) {
+	if h.hooks.AfterWrite != nil {
+		h.hooks.AfterWrite(name)
+	}
+}
+
+func (h *HookFs) Create(name string) (File, error) {
+	return h.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (h *HookFs) Mkdir(name string, perm os.FileMode) error {
+	if err := h.source.Mkdir(name, perm); err != nil {
+		return err
+	}
+	if h.hooks.AfterMkdir != nil {
+		h.hooks.AfterMkdir(name)
+	}
+	return nil
+}
+
+func (h *HookFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := h.source.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	if h.hooks.AfterMkdir != nil {
+		h.hooks.AfterMkdir(path)
+	}
+	return nil
+}
+
+func (h *HookFs) Open(name string) (File, error) {
+	return h.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (h *HookFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if err := h.beforeOpen(name, flag); err != nil {
+		return nil, err
+	}
+	f, err := h.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+	return &hookFile{File: f, fs: h, name: name}, nil
+}
+
+func (h *HookFs) Remove(name string) error {
+	if err := h.source.Remove(name); err != nil {
+		return err
+	}
+	if h.hooks.AfterRemove != nil {
+		h.hooks.AfterRemove(name)
+	}
+	return nil
+}
+
+func (h *HookFs) RemoveAll(path string) error {
+	if err := h.source.RemoveAll(path); err != nil {
+		return err
+	}
+	if h.hooks.AfterRemove != nil {
+		h.hooks.AfterRemove(path)
+	}
+	return nil
+}
+
+func (h *HookFs) Rename(oldname, newname string) error {
+	if err := h.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	if h.hooks.AfterRename != nil {
+		h.hooks.AfterRename(oldname, newname)
+	}
+	return nil
+}
+
+func (h *HookFs) Stat(name string) (os.FileInfo, error) {
+	return h.source.Stat(name)
+}
+
+func (h *HookFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := h.source.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := h.Stat(name)
+	return fi, false, err
+}
+
+func (h *HookFs) Name() string {
+	return "HookFs"
+}
+
+func (h *HookFs) Unwrap() Fs {
+	return h.source
+}
+
+func (h *HookFs) Chmod(name string, mode os.FileMode) error {
+	if err := h.source.Chmod(name, mode); err != nil {
+		return err
+	}
+	h.afterWrite(name)
+	return nil
+}
+
+func (h *HookFs) Chtimes(name string, atime, mtime time.Time) error {
+	if err := h.source.Chtimes(name, atime, mtime); err != nil {
+		return err
+	}
+	h.afterWrite(name)
+	return nil
+}
+
+// hookFile is a file opened for writing through a HookFs.
+type hookFile struct {
+	File
+	fs   *HookFs
+	name string
+}
+
+func (f *hookFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	f.fs.afterWrite(f.name)
+	return nil
+}
@@ -0,0 +1,60 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestWithHooks(t *testing.T) {
+	var events []string
+	denied := errors.New("denied")
+	fs := WithHooks(NewMemMapFs(), Hooks{
+		BeforeOpen: func(name string, flag int) error {
+			if name == "/secret" {
+				return denied
+			}
+			return nil
+		},
+		AfterWrite:  func(name string) { events = append(events, "write "+name) },
+		AfterMkdir:  func(name string) { events = append(events, "mkdir "+name) },
+		AfterRemove: func(name string) { events = append(events, "remove "+name) },
+		AfterRename: func(oldname, newname string) { events = append(events, "rename "+oldname+" "+newname) },
+	})
+
+	if err := fs.MkdirAll("/dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/dir/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(fs, "/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/dir/a.txt", "/dir/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/missing"); err == nil {
+		t.Fatal("was expecting an error removing a missing file")
+	}
+	if _, err := fs.Create("/secret"); !errors.Is(err, denied) {
+		t.Fatalf("was expecting the BeforeOpen error, got %v", err)
+	}
+	if _, err := fs.Stat("/secret"); !os.IsNotExist(err) {
+		t.Fatal("was not expecting /secret to be created")
+	}
+
+	expected := []string{
+		"mkdir /dir",
+		"write /dir/a.txt",
+		"rename /dir/a.txt /dir/b.txt",
+		"remove /dir",
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Fatalf("was expecting events %v, got %v", expected, events)
+	}
+}
@@ -0,0 +1,75 @@
+package kafero
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// An ImportPolicy tells what Import does with the files of the archive
+// already in the destination.
+type ImportPolicy int
+
+const (
+	// FailOnConflict fails on the first file already in the destination,
+	// with an error satisfying os.IsExist.
+	FailOnConflict ImportPolicy = iota
+	// SkipExisting keeps the files already in the destination.
+	SkipExisting
+	// OverwriteIfNewer replaces the files of the destination modified
+	// before their version in the archive, keeping the others.
+	OverwriteIfNewer
+	// OverwriteExisting replaces the files of the destination.
+	OverwriteExisting
+)
+
+// An ImportReport sums up the files, and symlinks, restored by Import.
+type ImportReport struct {
+	Created     int
+	Overwritten int
+	Skipped     int
+	// Size is the total size of the files written.
+	Size int64
+}
+
+func (r *ImportReport) add(overwritten bool, size int64) {
+	if overwritten {
+		r.Overwritten++
+	} else {
+		r.Created++
+	}
+	r.Size += size
+}
+
+// Import restores the tar or zip archive read from r, as streamed by
+// Export, under the directory root of dst, as Untar does, the files already
+// there being handled according to policy. The report tells what was
+// restored, up to the error if any. The zip archives need random access,
+// and are read in memory unless r is an io.ReaderAt with a Size method, as
+// *os.File is not but *bytes.Reader and *io.SectionReader are.
+func Import(r io.Reader, format ArchiveFormat, dst Fs, root string, policy ImportPolicy) (*ImportReport, error) {
+	x := newExtractor(dst, root, ExtractOptions{})
+	x.policy = policy
+	var err error
+	switch format {
+	case TarFormat:
+		err = x.untar(r)
+	case ZipFormat:
+		ra, ok := r.(interface {
+			io.ReaderAt
+			Size() int64
+		})
+		if !ok {
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return &x.report, fmt.Errorf("error reading archive: %v", err)
+			}
+			ra = bytes.NewReader(data)
+		}
+		err = x.unzip(ra, ra.Size())
+	default:
+		return &x.report, fmt.Errorf("unsupported archive format %v", format)
+	}
+	return &x.report, err
+}
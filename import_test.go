@@ -0,0 +1,85 @@
+package kafero
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := old.Add(time.Hour)
+	src := NewMemMapFs()
+	for name, mtime := range map[string]time.Time{
+		"/root/new.txt":   recent,
+		"/root/newer.txt": recent,
+		"/root/older.txt": old,
+	} {
+		if err := WriteFile(src, name, []byte("archived"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := src.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		policy   ImportPolicy
+		report   ImportReport
+		contents map[string]string
+	}{
+		{SkipExisting, ImportReport{Created: 1, Skipped: 2, Size: 8},
+			map[string]string{"newer.txt": "existing", "older.txt": "existing"}},
+		{OverwriteIfNewer, ImportReport{Created: 1, Overwritten: 1, Skipped: 1, Size: 16},
+			map[string]string{"newer.txt": "archived", "older.txt": "existing"}},
+		{OverwriteExisting, ImportReport{Created: 1, Overwritten: 2, Size: 24},
+			map[string]string{"newer.txt": "archived", "older.txt": "archived"}},
+	}
+	for _, format := range []ArchiveFormat{TarFormat, ZipFormat} {
+		var buf bytes.Buffer
+		if err := Export(src, "/root", &buf, format, ExportOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		for _, test := range tests {
+			dst := NewMemMapFs()
+			for _, name := range []string{"/out/newer.txt", "/out/older.txt"} {
+				if err := WriteFile(dst, name, []byte("existing"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				mtime := old.Add(time.Minute)
+				if err := dst.Chtimes(name, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// Hides the io.ReaderAt of the zip archives
+			r := io.MultiReader(bytes.NewReader(buf.Bytes()))
+			report, err := Import(r, format, dst, "/out", test.policy)
+			if err != nil {
+				t.Fatalf("error importing %v: %v", format, err)
+			}
+			if *report != test.report {
+				t.Fatalf("was expecting %+v for %v, got %+v", test.report, format, *report)
+			}
+			test.contents["new.txt"] = "archived"
+			for name, expected := range test.contents {
+				data, err := ReadFile(dst, "/out/"+name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(data) != expected {
+					t.Fatalf("was expecting %s in %s, got %s", expected, name, data)
+				}
+			}
+		}
+
+		dst := NewMemMapFs()
+		if err := WriteFile(dst, "/out/older.txt", []byte("existing"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Import(bytes.NewReader(buf.Bytes()), format, dst, "/out", FailOnConflict); !os.IsExist(err) {
+			t.Fatalf("was expecting an existing file error for %v, got %v", format, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package kafero
+
+import (
+	"context"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	_ Lstater   = (*InstrumentedFs)(nil)
+	_ Unwrapper = (*InstrumentedFs)(nil)
+	_ ContextFs = (*InstrumentedFs)(nil)
+
+	_ MetricsSink = (*MetricsRecorder)(nil)
+)
+
+// An Observation is an operation done through an InstrumentedFs.
+type Observation struct {
+	// Layer is the label of the InstrumentedFs, telling apart the levels
+	// of a stack instrumented at several of them, such as a cache and its
+	// base.
+	Layer string
+	// Op is the operation: "create", "open", "mkdir", "remove", "rename",
+	// "stat", "chmod" or "chtimes" on the filesystem, "read", "write",
+	// "seek", "readdir", "stat", "sync", "truncate" or "close" on the
+	// files.
+	Op string
+	// Bytes is the number of bytes read or written.
+	Bytes    int64
+	Duration time.Duration
+	// Err is the error of the operation, the io.EOF of the reads being
+	// left out.
+	Err error
+}
+
+// A MetricsSink receives the observations of InstrumentedFs, from any
+// goroutine. It is called inline with the operations, so it should only
+// aggregate them.
+type MetricsSink interface {
+	Observe(o Observation)
+}
+
+// The InstrumentedFs counts and times the operations on the source
+// filesystem and on its files, reporting them to a MetricsSink. Several
+// layers of a stack can be instrumented with the same sink, such as the
+// cache and the base of a SizeCacheFS, to see which one serves the
+// requests.
+type InstrumentedFs struct {
+	source Fs
+	layer  string
+	sink   MetricsSink
+}
+
+// NewInstrumentedFs returns an InstrumentedFs reporting the operations on
+// source to sink, labelled with layer.
+func NewInstrumentedFs(source Fs, layer string, sink MetricsSink) *InstrumentedFs {
+	return &InstrumentedFs{source: source, layer: layer, sink: sink}
+}
+
+// observe reports the operation op started at start.
+func (m *InstrumentedFs) observe(op string, start time.Time, n int64, err error) {
+	if err == io.EOF {
+		err = nil
+	}
+	m.sink.Observe(Observation{Layer: m.layer, Op: op, Bytes: n, Duration: time.Since(start), Err: err})
+}
+
+func (m *InstrumentedFs) Name() string {
+	return "InstrumentedFs"
+}
+
+func (m *InstrumentedFs) Unwrap() Fs {
+	return m.source
+}
+
+func (m *InstrumentedFs) WithContext(ctx context.Context) Fs {
+	return &InstrumentedFs{source: WithContext(m.source, ctx), layer: m.layer, sink: m.sink}
+}
+
+// wrap wraps the file f opened by the operation op.
+func (m *InstrumentedFs) wrap(op string, start time.Time, f File, err error) (File, error) {
+	m.observe(op, start, 0, err)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedFile{File: f, fs: m}, nil
+}
+
+func (m *InstrumentedFs) Create(name string) (File, error) {
+	start := time.Now()
+	f, err := m.source.Create(name)
+	return m.wrap("create", start, f, err)
+}
+
+func (m *InstrumentedFs) Open(name string) (File, error) {
+	start := time.Now()
+	f, err := m.source.Open(name)
+	return m.wrap("open", start, f, err)
+}
+
+func (m *InstrumentedFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	start := time.Now()
+	f, err := m.source.OpenFile(name, flag, perm)
+	return m.wrap("open", start, f, err)
+}
+
+func (m *InstrumentedFs) Mkdir(name string, perm os.FileMode) error {
+	start := time.Now()
+	err := m.source.Mkdir(name, perm)
+	m.observe("mkdir", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) MkdirAll(path string, perm os.FileMode) error {
+	start := time.Now()
+	err := m.source.MkdirAll(path, perm)
+	m.observe("mkdir", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) Remove(name string) error {
+	start := time.Now()
+	err := m.source.Remove(name)
+	m.observe("remove", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) RemoveAll(path string) error {
+	start := time.Now()
+	err := m.source.RemoveAll(path)
+	m.observe("remove", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) Rename(oldname, newname string) error {
+	start := time.Now()
+	err := m.source.Rename(oldname, newname)
+	m.observe("rename", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) Stat(name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := m.source.Stat(name)
+	m.observe("stat", start, 0, err)
+	return info, err
+}
+
+func (m *InstrumentedFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	start := time.Now()
+	var info os.FileInfo
+	var ok bool
+	var err error
+	if lsf, isLstater := m.source.(Lstater); isLstater {
+		info, ok, err = lsf.LstatIfPossible(name)
+	} else {
+		info, err = m.source.Stat(name)
+	}
+	m.observe("stat", start, 0, err)
+	return info, ok, err
+}
+
+func (m *InstrumentedFs) Chmod(name string, mode os.FileMode) error {
+	start := time.Now()
+	err := m.source.Chmod(name, mode)
+	m.observe("chmod", start, 0, err)
+	return err
+}
+
+func (m *InstrumentedFs) Chtimes(name string, atime, mtime time.Time) error {
+	start := time.Now()
+	err := m.source.Chtimes(name, atime, mtime)
+	m.observe("chtimes", start, 0, err)
+	return err
+}
+
+// instrumentedFile is a file opened through an InstrumentedFs.
+type instrumentedFile struct {
+	File
+	fs *InstrumentedFs
+}
+
+func (f *instrumentedFile) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := f.File.Read(p)
+	f.fs.observe("read", start, int64(n), err)
+	return n, err
+}
+
+func (f *instrumentedFile) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := f.File.ReadAt(p, off)
+	f.fs.observe("read", start, int64(n), err)
+	return n, err
+}
+
+func (f *instrumentedFile) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := f.File.Write(p)
+	f.fs.observe("write", start, int64(n), err)
+	return n, err
+}
+
+func (f *instrumentedFile) WriteAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := f.File.WriteAt(p, off)
+	f.fs.observe("write", start, int64(n), err)
+	return n, err
+}
+
+func (f *instrumentedFile) WriteString(s string) (int, error) {
+	start := time.Now()
+	n, err := f.File.WriteString(s)
+	f.fs.observe("write", start, int64(n), err)
+	return n, err
+}
+
+func (f *instrumentedFile) Seek(offset int64, whence int) (int64, error) {
+	start := time.Now()
+	ret, err := f.File.Seek(offset, whence)
+	f.fs.observe("seek", start, 0, err)
+	return ret, err
+}
+
+func (f *instrumentedFile) Readdir(count int) ([]os.FileInfo, error) {
+	start := time.Now()
+	infos, err := f.File.Readdir(count)
+	f.fs.observe("readdir", start, 0, err)
+	return infos, err
+}
+
+func (f *instrumentedFile) Readdirnames(n int) ([]string, error) {
+	start := time.Now()
+	names, err := f.File.Readdirnames(n)
+	f.fs.observe("readdir", start, 0, err)
+	return names, err
+}
+
+func (f *instrumentedFile) Stat() (os.FileInfo, error) {
+	start := time.Now()
+	info, err := f.File.Stat()
+	f.fs.observe("stat", start, 0, err)
+	return info, err
+}
+
+func (f *instrumentedFile) Sync() error {
+	start := time.Now()
+	err := f.File.Sync()
+	f.fs.observe("sync", start, 0, err)
+	return err
+}
+
+func (f *instrumentedFile) Truncate(size int64) error {
+	start := time.Now()
+	err := f.File.Truncate(size)
+	f.fs.observe("truncate", start, 0, err)
+	return err
+}
+
+func (f *instrumentedFile) Close() error {
+	start := time.Now()
+	err := f.File.Close()
+	f.fs.observe("close", start, 0, err)
+	return err
+}
+
+// OpStats are the observations of an operation on a layer, aggregated.
+type OpStats struct {
+	Count int64
+	// Errors is the number of operations which failed, NotExist the
+	// number of them failing with os.ErrNotExist, the misses of the
+	// lookups.
+	Errors, NotExist int64
+	Bytes            int64
+	Duration         time.Duration
+}
+
+// metricsKey identifies an operation on a layer.
+type metricsKey struct {
+	layer, op string
+}
+
+// MetricsRecorder is a MetricsSink aggregating the observations in memory,
+// by layer and operation, to be polled or logged.
+type MetricsRecorder struct {
+	mu    sync.Mutex
+	stats map[metricsKey]*OpStats
+}
+
+func NewMetricsRecorder() *MetricsRecorder {
+	return &MetricsRecorder{stats: make(map[metricsKey]*OpStats)}
+}
+
+func (r *MetricsRecorder) Observe(o Observation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := metricsKey{o.Layer, o.Op}
+	s, ok := r.stats[key]
+	if !ok {
+		s = &OpStats{}
+		r.stats[key] = s
+	}
+	s.Count++
+	if o.Err != nil {
+		s.Errors++
+		if os.IsNotExist(o.Err) {
+			s.NotExist++
+		}
+	}
+	s.Bytes += o.Bytes
+	s.Duration += o.Duration
+}
+
+// Stats returns the stats of the operation op on layer.
+func (r *MetricsRecorder) Stats(layer, op string) OpStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s, ok := r.stats[metricsKey{layer, op}]; ok {
+		return *s
+	}
+	return OpStats{}
+}
+
+// Layers returns the layers observed, sorted.
+func (r *MetricsRecorder) Layers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	seen := make(map[string]bool)
+	var layers []string
+	for key := range r.stats {
+		if !seen[key.layer] {
+			seen[key.layer] = true
+			layers = append(layers, key.layer)
+		}
+	}
+	sort.Strings(layers)
+	return layers
+}
@@ -0,0 +1,97 @@
+package kafero
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInstrumentedFs(t *testing.T) {
+	recorder := NewMetricsRecorder()
+	base := &MemMapFs{}
+	if err := WriteFile(base, "/data.txt", []byte("hello, world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ifs := NewCacheOnReadFs(
+		NewInstrumentedFs(base, "base", recorder),
+		NewInstrumentedFs(&MemMapFs{}, "cache", recorder),
+		time.Hour,
+	)
+
+	for i := 0; i < 3; i++ {
+		data, err := ReadFile(ifs, "/data.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "hello, world" {
+			t.Fatalf("Got %q", data)
+		}
+	}
+	if _, err := ifs.Stat("/missing"); err == nil {
+		t.Fatal("Stat of a missing file succeeded")
+	}
+
+	// The base is only read once, to fill the cache
+	if s := recorder.Stats("base", "read"); s.Bytes != 12 {
+		t.Errorf("Got %d bytes read from the base, want 12", s.Bytes)
+	}
+	if s := recorder.Stats("cache", "read"); s.Bytes != 36 {
+		t.Errorf("Got %d bytes read from the cache, want 36", s.Bytes)
+	}
+	if s := recorder.Stats("cache", "write"); s.Bytes != 12 {
+		t.Errorf("Got %d bytes written to the cache, want 12", s.Bytes)
+	}
+	if s := recorder.Stats("cache", "open"); s.Count < 3 || s.Errors != 0 {
+		t.Errorf("Got %+v opens of the cache", s)
+	}
+	if s := recorder.Stats("base", "stat"); s.NotExist == 0 || s.NotExist != s.Errors {
+		t.Errorf("Got %+v stats of the base, want the miss", s)
+	}
+	if layers := recorder.Layers(); len(layers) != 2 || layers[0] != "base" || layers[1] != "cache" {
+		t.Errorf("Got layers %v", layers)
+	}
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	collector := NewPrometheusCollector(0.5, 1)
+	fs := NewInstrumentedFs(&MemMapFs{}, `gcs "eu"`, collector)
+	if err := WriteFile(fs, "/a", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open("/missing"); err == nil {
+		t.Fatal("Open of a missing file succeeded")
+	}
+	collector.Observe(Observation{Layer: "slow", Op: "read", Duration: 750 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	collector.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Got content type %q", ct)
+	}
+	out := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE kafero_fs_operations_total counter",
+		`kafero_fs_operations_total{layer="gcs \"eu\"",op="open"} 2`,
+		`kafero_fs_errors_total{layer="gcs \"eu\"",op="open",kind="not_exist"} 1`,
+		`kafero_fs_errors_total{layer="gcs \"eu\"",op="open",kind="other"} 0`,
+		`kafero_fs_bytes_total{layer="gcs \"eu\"",op="write"} 5`,
+		"# TYPE kafero_fs_operation_duration_seconds histogram",
+		`kafero_fs_operation_duration_seconds_bucket{layer="slow",op="read",le="0.5"} 0`,
+		`kafero_fs_operation_duration_seconds_bucket{layer="slow",op="read",le="1"} 1`,
+		`kafero_fs_operation_duration_seconds_bucket{layer="slow",op="read",le="+Inf"} 1`,
+		`kafero_fs_operation_duration_seconds_sum{layer="slow",op="read"} 0.75`,
+		`kafero_fs_operation_duration_seconds_count{layer="slow",op="read"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Missing %q in:\n%s", line, out)
+		}
+	}
+
+	var buf bytes.Buffer
+	n, err := collector.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) || buf.String() != out {
+		t.Errorf("WriteTo returned %d, %v, writing %d bytes", n, err, buf.Len())
+	}
+}
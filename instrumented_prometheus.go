@@ -0,0 +1,179 @@
+package kafero
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var _ MetricsSink = (*PrometheusCollector)(nil)
+
+// DefaultDurationBuckets are the upper bounds, in seconds, of the buckets
+// of the histogram of the durations of a PrometheusCollector, from the
+// hits of a local cache to the slow requests of a bucket.
+var DefaultDurationBuckets = []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5, 10}
+
+// The PrometheusCollector is a MetricsSink exposing the observations in
+// the Prometheus text exposition format, so that it can be scraped without
+// kafero depending on a client library. It is an http.Handler, to mount
+// on the metrics endpoint of an application, or next to it if it already
+// serves the metrics of a client library. The metrics, labelled by layer
+// and op, are:
+//
+//	kafero_fs_operations_total                counter
+//	kafero_fs_errors_total                    counter, also labelled with
+//	                                          kind, "not_exist" or "other"
+//	kafero_fs_bytes_total                     counter, of the reads and writes
+//	kafero_fs_operation_duration_seconds      histogram
+type PrometheusCollector struct {
+	buckets []float64
+	mu      sync.Mutex
+	series  map[metricsKey]*promSeries
+}
+
+// promSeries are the series of an operation on a layer.
+type promSeries struct {
+	count, notExist, errors, bytes int64
+	sum                            float64
+	// counts are the numbers of observations in each bucket, not
+	// cumulated
+	counts []int64
+}
+
+// NewPrometheusCollector returns a PrometheusCollector with a histogram of
+// the durations bounded by buckets, in seconds, DefaultDurationBuckets if
+// none.
+func NewPrometheusCollector(buckets ...float64) *PrometheusCollector {
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusCollector{buckets: buckets, series: make(map[metricsKey]*promSeries)}
+}
+
+func (c *PrometheusCollector) Observe(o Observation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := metricsKey{o.Layer, o.Op}
+	s, ok := c.series[key]
+	if !ok {
+		s = &promSeries{counts: make([]int64, len(c.buckets))}
+		c.series[key] = s
+	}
+	s.count++
+	if o.Err != nil {
+		if os.IsNotExist(o.Err) {
+			s.notExist++
+		} else {
+			s.errors++
+		}
+	}
+	s.bytes += o.Bytes
+	d := o.Duration.Seconds()
+	s.sum += d
+	if i := sort.SearchFloat64s(c.buckets, d); i < len(c.buckets) {
+		s.counts[i]++
+	}
+}
+
+// WriteTo writes the metrics to w in the Prometheus text exposition
+// format.
+func (c *PrometheusCollector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	keys := make([]metricsKey, 0, len(c.series))
+	series := make(map[metricsKey]promSeries, len(c.series))
+	for key, s := range c.series {
+		keys = append(keys, key)
+		copied := *s
+		copied.counts = append([]int64(nil), s.counts...)
+		series[key] = copied
+	}
+	c.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].layer != keys[j].layer {
+			return keys[i].layer < keys[j].layer
+		}
+		return keys[i].op < keys[j].op
+	})
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	header := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	header("kafero_fs_operations_total", "counter", "Operations done through the instrumented filesystems.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "kafero_fs_operations_total%s %d\n", promLabels(key), series[key].count)
+	}
+	header("kafero_fs_errors_total", "counter", "Operations which failed, by kind of error.")
+	for _, key := range keys {
+		s := series[key]
+		fmt.Fprintf(bw, "kafero_fs_errors_total%s %d\n", promLabels(key, "kind", "not_exist"), s.notExist)
+		fmt.Fprintf(bw, "kafero_fs_errors_total%s %d\n", promLabels(key, "kind", "other"), s.errors)
+	}
+	header("kafero_fs_bytes_total", "counter", "Bytes read and written.")
+	for _, key := range keys {
+		fmt.Fprintf(bw, "kafero_fs_bytes_total%s %d\n", promLabels(key), series[key].bytes)
+	}
+	header("kafero_fs_operation_duration_seconds", "histogram", "Duration of the operations.")
+	for _, key := range keys {
+		s := series[key]
+		var cumulated int64
+		for i, bound := range c.buckets {
+			cumulated += s.counts[i]
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			fmt.Fprintf(bw, "kafero_fs_operation_duration_seconds_bucket%s %d\n", promLabels(key, "le", le), cumulated)
+		}
+		fmt.Fprintf(bw, "kafero_fs_operation_duration_seconds_bucket%s %d\n", promLabels(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(bw, "kafero_fs_operation_duration_seconds_sum%s %s\n", promLabels(key), strconv.FormatFloat(s.sum, 'g', -1, 64))
+		fmt.Fprintf(bw, "kafero_fs_operation_duration_seconds_count%s %d\n", promLabels(key), s.count)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP serves the metrics to the Prometheus scrapers.
+func (c *PrometheusCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = c.WriteTo(w)
+}
+
+// promLabels formats the labels of key, followed by the extra label pairs.
+func promLabels(key metricsKey, extra ...string) string {
+	pairs := append([]string{"layer", key.layer, "op", key.op}, extra...)
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(pairs[i])
+		b.WriteString(`="`)
+		b.WriteString(promEscaper.Replace(pairs[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// promEscaper escapes the label values.
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,282 @@
+package kafero
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"time"
+)
+
+// XattrSHA256 is the extended attribute holding the hex encoded SHA-256
+// digest of the content of a file, as written by the IntegrityFs.
+const XattrSHA256 = "user.kafero.sha256"
+
+var _ Xattrer = (*IntegrityFs)(nil)
+
+// The IntegrityFs stores the digest of the files written through it in the
+// XattrSHA256 attribute, on the filesystems supporting extended
+// attributes. The attribute is forwarded by the layers wrapping a
+// filesystem, so placing the IntegrityFs on top of a stack covers the
+// content as seen by the application, whatever the layers below do with it.
+//
+// With VerifyOnRead, files read sequentially up to EOF are checked against
+// their digest, the read returning a *VerificationError instead of io.EOF
+// on mismatch. Files without digest, or read at random offsets, are not
+// verified.
+type IntegrityFs struct {
+	source Fs
+	verify bool
+}
+
+type IntegrityOption func(fs *IntegrityFs)
+
+// VerifyOnRead enables the verification of the files opened read only.
+func VerifyOnRead() IntegrityOption {
+	return func(fs *IntegrityFs) {
+		fs.verify = true
+	}
+}
+
+func NewIntegrityFs(source Fs, opts ...IntegrityOption) *IntegrityFs {
+	fs := &IntegrityFs{source: source}
+	for _, opt := range opts {
+		opt(fs)
+	}
+	return fs
+}
+
+func (i *IntegrityFs) Name() string {
+	return "IntegrityFs"
+}
+
+func (i *IntegrityFs) Unwrap() Fs {
+	return i.source
+}
+
+func (i *IntegrityFs) Create(name string) (File, error) {
+	f, err := i.source.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return newIntegrityFile(i, f, name, os.O_RDWR|os.O_CREATE|os.O_TRUNC), nil
+}
+
+func (i *IntegrityFs) Open(name string) (File, error) {
+	return i.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (i *IntegrityFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := i.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 {
+		return newIntegrityFile(i, f, name, flag), nil
+	}
+	if !i.verify {
+		return f, nil
+	}
+	if fi, err := f.Stat(); err != nil || fi.IsDir() {
+		return f, nil
+	}
+	expected, err := i.digest(name)
+	if err != nil {
+		// Nothing to verify against
+		return f, nil
+	}
+	return &IntegrityFile{File: f, fs: i, name: name, flag: flag, hash: sha256.New(), expected: expected}, nil
+}
+
+// digest returns the digest stored in the attributes of name.
+func (i *IntegrityFs) digest(name string) ([]byte, error) {
+	value, err := Getxattr(i.source, name, XattrSHA256)
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(string(value))
+}
+
+// setDigest stores the digest of name, if the source supports it.
+func (i *IntegrityFs) setDigest(name string, sum []byte) error {
+	err := Setxattr(i.source, name, XattrSHA256, []byte(hex.EncodeToString(sum)))
+	if err != nil && errors.Is(err, ErrXattrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// computeDigest reads the whole content of name.
+func (i *IntegrityFs) computeDigest(name string) ([]byte, error) {
+	f, err := i.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+func (i *IntegrityFs) Mkdir(name string, perm os.FileMode) error {
+	return i.source.Mkdir(name, perm)
+}
+
+func (i *IntegrityFs) MkdirAll(path string, perm os.FileMode) error {
+	return i.source.MkdirAll(path, perm)
+}
+
+func (i *IntegrityFs) Remove(name string) error {
+	return i.source.Remove(name)
+}
+
+func (i *IntegrityFs) RemoveAll(path string) error {
+	return i.source.RemoveAll(path)
+}
+
+func (i *IntegrityFs) Rename(oldname, newname string) error {
+	return i.source.Rename(oldname, newname)
+}
+
+func (i *IntegrityFs) Stat(name string) (os.FileInfo, error) {
+	return i.source.Stat(name)
+}
+
+func (i *IntegrityFs) Chmod(name string, mode os.FileMode) error {
+	return i.source.Chmod(name, mode)
+}
+
+func (i *IntegrityFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return i.source.Chtimes(name, atime, mtime)
+}
+
+func (i *IntegrityFs) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(i.source, name, attr)
+}
+
+func (i *IntegrityFs) Setxattr(name, attr string, value []byte) error {
+	return Setxattr(i.source, name, attr, value)
+}
+
+func (i *IntegrityFs) Listxattr(name string) ([]string, error) {
+	return Listxattr(i.source, name)
+}
+
+func (i *IntegrityFs) Removexattr(name, attr string) error {
+	return Removexattr(i.source, name, attr)
+}
+
+// The IntegrityFile hashes the content going through it. The digest of
+// written files is stored on close, computed on the fly if the file was
+// written sequentially from the start, or by reading the file back
+// otherwise.
+type IntegrityFile struct {
+	File
+	fs       *IntegrityFs
+	name     string
+	flag     int
+	hash     hash.Hash
+	offset   int64
+	written  bool
+	expected []byte
+}
+
+func newIntegrityFile(fs *IntegrityFs, f File, name string, flag int) *IntegrityFile {
+	file := &IntegrityFile{File: f, fs: fs, name: name, flag: flag}
+	if flag&os.O_TRUNC != 0 {
+		file.hash = sha256.New()
+	}
+	return file
+}
+
+// advance feeds b, read or written at off, to the hash. Any access out of
+// sequence stops the hashing.
+func (f *IntegrityFile) advance(b []byte, off int64) {
+	if f.hash == nil {
+		return
+	}
+	if off != f.offset {
+		f.hash = nil
+		return
+	}
+	f.hash.Write(b)
+	f.offset += int64(len(b))
+}
+
+func (f *IntegrityFile) Read(b []byte) (int, error) {
+	off := f.offset
+	n, err := f.File.Read(b)
+	f.advance(b[:n], off)
+	if err == io.EOF && f.expected != nil && f.hash != nil {
+		if sum := f.hash.Sum(nil); !bytes.Equal(sum, f.expected) {
+			return n, &VerificationError{Path: f.name, Expected: f.expected, Actual: sum}
+		}
+	}
+	return n, err
+}
+
+func (f *IntegrityFile) ReadAt(b []byte, off int64) (int, error) {
+	f.hash = nil
+	return f.File.ReadAt(b, off)
+}
+
+func (f *IntegrityFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := f.File.Seek(offset, whence)
+	if err == nil && pos != f.offset {
+		f.hash = nil
+	}
+	return pos, err
+}
+
+func (f *IntegrityFile) Write(b []byte) (int, error) {
+	f.written = true
+	n, err := f.File.Write(b)
+	f.advance(b[:n], f.offset)
+	return n, err
+}
+
+func (f *IntegrityFile) WriteAt(b []byte, off int64) (int, error) {
+	f.written = true
+	n, err := f.File.WriteAt(b, off)
+	f.advance(b[:n], off)
+	return n, err
+}
+
+func (f *IntegrityFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *IntegrityFile) Truncate(size int64) error {
+	f.written = true
+	if size != f.offset {
+		f.hash = nil
+	}
+	return f.File.Truncate(size)
+}
+
+func (f *IntegrityFile) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	if f.flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) == 0 {
+		return nil
+	}
+	if !f.written && f.flag&os.O_TRUNC == 0 {
+		return nil
+	}
+	var sum []byte
+	if f.hash != nil {
+		sum = f.hash.Sum(nil)
+	} else {
+		var err error
+		if sum, err = f.fs.computeDigest(f.name); err != nil {
+			return &os.PathError{Op: "close", Path: f.name, Err: err}
+		}
+	}
+	return f.fs.setDigest(f.name, sum)
+}
@@ -0,0 +1,119 @@
+package kafero
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+)
+
+// xattrMemFs is a MemMapFs supporting extended attributes.
+type xattrMemFs struct {
+	Fs
+	mu    sync.Mutex
+	attrs map[string]map[string][]byte
+}
+
+func newXattrMemFs() *xattrMemFs {
+	return &xattrMemFs{Fs: NewMemMapFs(), attrs: make(map[string]map[string][]byte)}
+}
+
+func (x *xattrMemFs) Getxattr(name, attr string) ([]byte, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	v, ok := x.attrs[name][attr]
+	if !ok {
+		return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrNoAttr}
+	}
+	return v, nil
+}
+
+func (x *xattrMemFs) Setxattr(name, attr string, value []byte) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.attrs[name] == nil {
+		x.attrs[name] = make(map[string][]byte)
+	}
+	x.attrs[name][attr] = value
+	return nil
+}
+
+func (x *xattrMemFs) Listxattr(name string) ([]string, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	var names []string
+	for k := range x.attrs[name] {
+		names = append(names, k)
+	}
+	return names, nil
+}
+
+func (x *xattrMemFs) Removexattr(name, attr string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.attrs[name], attr)
+	return nil
+}
+
+func TestIntegrityFs(t *testing.T) {
+	base := newXattrMemFs()
+	fs := NewIntegrityFs(NewBasePathFs(base, "/data"), VerifyOnRead())
+
+	content := []byte("This is a test")
+	sum := sha256.Sum256(content)
+	if err := WriteFile(fs, "/file.txt", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	value, err := Getxattr(base, "/data/file.txt", XattrSHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != hex.EncodeToString(sum[:]) {
+		t.Fatalf("was expecting digest %x, got %s", sum, value)
+	}
+
+	// Non sequential writes get their digest by reading the file back
+	f, err := fs.OpenFile("/file.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("That"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte("That is a test"))
+	if value, _ := Getxattr(base, "/data/file.txt", XattrSHA256); string(value) != hex.EncodeToString(sum[:]) {
+		t.Fatalf("was expecting digest %x, got %s", sum, value)
+	}
+
+	data, err := ReadFile(fs, "/file.txt")
+	if err != nil || string(data) != "That is a test" {
+		t.Fatalf("error reading verified file: %q, %v", data, err)
+	}
+
+	// Tampering below the IntegrityFs is detected
+	if err := WriteFile(base.Fs, "/data/file.txt", []byte("That is a lie!"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.Open("/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.Copy(ioutil.Discard, f)
+	f.Close()
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("was expecting a verification error, got %v", err)
+	}
+
+	// Filesystems without extended attributes are still usable
+	if err := WriteFile(NewIntegrityFs(NewMemMapFs(), VerifyOnRead()), "/file.txt", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,406 @@
+package kafero
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedInventory is returned for the inventories in a format which
+// can't be read, such as Parquet or ORC, only CSV being supported.
+var ErrUnsupportedInventory = errors.New("unsupported inventory format")
+
+// InventoryObject is an object listed in the inventory of a bucket.
+type InventoryObject struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// An Inventory lists the objects of a bucket.
+type Inventory interface {
+	// Next returns the next object, io.EOF after the last one.
+	Next() (*InventoryObject, error)
+}
+
+// inventoryColumns are the indexes of the columns of an inventory, -1 for
+// the columns missing.
+type inventoryColumns struct {
+	key, size, mtime, etag, latest, deleted int
+}
+
+// inventoryColumnNames are the names of the columns in the S3 file schemas
+// and the headers of the GCS inventories, lower cased.
+var inventoryColumnNames = map[string][]string{
+	"key":     {"key", "name"},
+	"size":    {"size"},
+	"mtime":   {"lastmodifieddate", "updated"},
+	"etag":    {"etag"},
+	"latest":  {"islatest"},
+	"deleted": {"isdeletemarker"},
+}
+
+func newInventoryColumns(names []string) (inventoryColumns, error) {
+	index := func(col string) int {
+		for i, name := range names {
+			name = strings.ToLower(strings.TrimSpace(name))
+			for _, alias := range inventoryColumnNames[col] {
+				if name == alias {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	cols := inventoryColumns{
+		key:     index("key"),
+		size:    index("size"),
+		mtime:   index("mtime"),
+		etag:    index("etag"),
+		latest:  index("latest"),
+		deleted: index("deleted"),
+	}
+	if cols.key < 0 || cols.size < 0 {
+		return cols, fmt.Errorf("inventory without key or size: %v", names)
+	}
+	return cols, nil
+}
+
+// InventoryReader reads the objects of a CSV inventory, gzipped or not, as
+// generated by S3 Inventory or GCS Storage Insights. Only the latest
+// versions of the objects are returned.
+type InventoryReader struct {
+	rr   *RecordReader
+	cr   *csv.Reader
+	cols inventoryColumns
+	// The keys of the S3 inventories are URL encoded
+	unescape bool
+}
+
+// NewS3InventoryReader returns an InventoryReader of the S3 inventory file
+// read from r, of the fileSchema of its manifest, such as "Bucket, Key,
+// Size, LastModifiedDate, ETag".
+func NewS3InventoryReader(r io.Reader, fileSchema string) (*InventoryReader, error) {
+	cols, err := newInventoryColumns(strings.Split(fileSchema, ","))
+	if err != nil {
+		return nil, err
+	}
+	rr, err := NewRecordReader(r, RecordOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &InventoryReader{rr: rr, cr: newInventoryCSV(rr), cols: cols, unescape: true}, nil
+}
+
+// NewGcsInventoryReader returns an InventoryReader of the GCS inventory
+// file read from r, whose columns are named by its header.
+func NewGcsInventoryReader(r io.Reader) (*InventoryReader, error) {
+	rr, err := NewRecordReader(r, RecordOptions{})
+	if err != nil {
+		return nil, err
+	}
+	cr := newInventoryCSV(rr)
+	header, err := cr.Read()
+	if err != nil {
+		_ = rr.Close()
+		return nil, fmt.Errorf("error reading inventory header: %v", err)
+	}
+	cols, err := newInventoryColumns(header)
+	if err != nil {
+		_ = rr.Close()
+		return nil, err
+	}
+	return &InventoryReader{rr: rr, cr: cr, cols: cols}, nil
+}
+
+func newInventoryCSV(rr *RecordReader) *csv.Reader {
+	cr := rr.CSV()
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	return cr
+}
+
+// Next returns the next object of the inventory, io.EOF at its end.
+func (ir *InventoryReader) Next() (*InventoryObject, error) {
+	for {
+		record, err := ir.cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(record) {
+				return ""
+			}
+			return record[i]
+		}
+		if field(ir.cols.latest) == "false" || field(ir.cols.deleted) == "true" {
+			continue
+		}
+		obj := &InventoryObject{Key: field(ir.cols.key), ETag: field(ir.cols.etag)}
+		if ir.unescape {
+			if obj.Key, err = url.QueryUnescape(obj.Key); err != nil {
+				return nil, fmt.Errorf("error decoding inventory key %s: %v", field(ir.cols.key), err)
+			}
+		}
+		if obj.Size, err = strconv.ParseInt(field(ir.cols.size), 10, 64); err != nil {
+			return nil, fmt.Errorf("error parsing size of %s: %v", obj.Key, err)
+		}
+		if mtime := field(ir.cols.mtime); mtime != "" {
+			if obj.ModTime, err = time.Parse(time.RFC3339Nano, mtime); err != nil {
+				return nil, fmt.Errorf("error parsing modification time of %s: %v", obj.Key, err)
+			}
+		}
+		return obj, nil
+	}
+}
+
+// Close releases the decompressor of the inventory.
+func (ir *InventoryReader) Close() error {
+	return ir.rr.Close()
+}
+
+// S3InventoryManifest is the manifest.json of an S3 inventory, listing its
+// files.
+type S3InventoryManifest struct {
+	SourceBucket      string `json:"sourceBucket"`
+	DestinationBucket string `json:"destinationBucket"`
+	FileFormat        string `json:"fileFormat"`
+	FileSchema        string `json:"fileSchema"`
+	Files             []struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+// ReadS3InventoryManifest reads the manifest name of fs, failing with
+// ErrUnsupportedInventory if its files are not in CSV.
+func ReadS3InventoryManifest(fs Fs, name string) (*S3InventoryManifest, error) {
+	data, err := ReadFile(fs, name)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &S3InventoryManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("error unmarshalling inventory manifest: %v", err)
+	}
+	if !strings.EqualFold(manifest.FileFormat, "CSV") {
+		return nil, &os.PathError{Op: "inventory", Path: name, Err: ErrUnsupportedInventory}
+	}
+	return manifest, nil
+}
+
+// Open returns the Inventory of the objects of the inventory files of the
+// manifest, which are read from the root directory of fs, the destination
+// bucket of the inventory. It must be closed.
+func (m *S3InventoryManifest) Open(fs Fs, root string) *S3Inventory {
+	return &S3Inventory{manifest: m, fs: fs, root: root}
+}
+
+// S3Inventory reads the inventory files of a manifest in turn.
+type S3Inventory struct {
+	manifest *S3InventoryManifest
+	fs       Fs
+	root     string
+	next     int
+	f        File
+	ir       *InventoryReader
+}
+
+func (inv *S3Inventory) Next() (*InventoryObject, error) {
+	for {
+		if inv.ir != nil {
+			obj, err := inv.ir.Next()
+			if err != io.EOF {
+				return obj, err
+			}
+			if err := inv.Close(); err != nil {
+				return nil, err
+			}
+		}
+		if inv.next >= len(inv.manifest.Files) {
+			return nil, io.EOF
+		}
+		name := filepath.Join(inv.root, inv.manifest.Files[inv.next].Key)
+		inv.next++
+		f, err := inv.fs.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		ir, err := NewS3InventoryReader(f, inv.manifest.FileSchema)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		inv.f, inv.ir = f, ir
+	}
+}
+
+// Close closes the inventory file being read.
+func (inv *S3Inventory) Close() error {
+	if inv.ir == nil {
+		return nil
+	}
+	_ = inv.ir.Close()
+	err := inv.f.Close()
+	inv.f, inv.ir = nil, nil
+	return err
+}
+
+func readInventory(inv Inventory, fn func(*InventoryObject) error) error {
+	for {
+		obj, err := inv.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(obj); err != nil {
+			return err
+		}
+	}
+}
+
+// inventoryFileInfo is the FileInfo of an object, or a directory, of an
+// inventory.
+type inventoryFileInfo struct {
+	name string
+	obj  *InventoryObject
+}
+
+func (fi *inventoryFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *inventoryFileInfo) Size() int64 {
+	if fi.obj == nil {
+		return 0
+	}
+	return fi.obj.Size
+}
+
+func (fi *inventoryFileInfo) Mode() os.FileMode {
+	if fi.obj == nil {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *inventoryFileInfo) ModTime() time.Time {
+	if fi.obj == nil {
+		return time.Time{}
+	}
+	return fi.obj.ModTime
+}
+
+func (fi *inventoryFileInfo) IsDir() bool {
+	return fi.obj == nil
+}
+
+// Sys returns the *InventoryObject of the files, nil for the directories.
+func (fi *inventoryFileInfo) Sys() interface{} {
+	if fi.obj == nil {
+		return nil
+	}
+	return fi.obj
+}
+
+// ImportInventory fills the cache with the listings of the directories of
+// the objects of inv, as if the bucket was listed under root, so that
+// ReadDir, and the walks using it, don't need any LIST call on a large
+// bucket. The listings expire as the others. The keys ending with a slash
+// are the placeholders of directories.
+func (l *ListingCacheFs) ImportInventory(inv Inventory, root string) error {
+	dirs := make(map[string]map[string]os.FileInfo)
+	addDir := func(dir string) map[string]os.FileInfo {
+		entries, ok := dirs[dir]
+		if !ok {
+			entries = make(map[string]os.FileInfo)
+			dirs[dir] = entries
+		}
+		return entries
+	}
+	root = filepath.Clean(root)
+	addDir(root)
+	err := readInventory(inv, func(obj *InventoryObject) error {
+		key := path.Clean("/" + obj.Key)
+		if key == "/" {
+			return nil
+		}
+		name := filepath.Join(root, filepath.FromSlash(key))
+		var info os.FileInfo = &inventoryFileInfo{name: filepath.Base(name), obj: obj}
+		if strings.HasSuffix(obj.Key, "/") {
+			info = &inventoryFileInfo{name: filepath.Base(name)}
+			addDir(name)
+		}
+		// Add the object to its directory, and the directories to theirs
+		// up to the first one already there
+		for name != root {
+			dir := filepath.Dir(name)
+			entries := addDir(dir)
+			if known, ok := entries[info.Name()]; ok && known.IsDir() && info.IsDir() {
+				break
+			}
+			entries[info.Name()] = info
+			name = dir
+			info = &inventoryFileInfo{name: filepath.Base(name)}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n := len(l.dirs) + len(dirs); n > l.maxDirs {
+		l.maxDirs = n
+	}
+	expiry := l.clock.Now().Add(l.ttl)
+	for dir, entries := range dirs {
+		entry := &listing{names: entries, expiry: expiry}
+		for _, info := range entries {
+			entry.infos = append(entry.infos, info)
+		}
+		sort.Sort(byName(entry.infos))
+		l.dirs[dir] = entry
+	}
+	return nil
+}
+
+// NewSizeCacheFSFromInventory returns a SizeCacheFS whose index is built
+// from the inventory of the cache, an object store mounted at root,
+// rather than from the index saved in the cache or by walking it.
+func NewSizeCacheFSFromInventory(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration, inv Inventory, root string) (*SizeCacheFS, error) {
+	var files []*cacheFile
+	err := readInventory(inv, func(obj *InventoryObject) error {
+		if strings.HasSuffix(obj.Key, "/") || path.Base(obj.Key) == ".cacheindex" {
+			return nil
+		}
+		files = append(files, &cacheFile{
+			Path:           filepath.Join(root, filepath.FromSlash(obj.Key)),
+			Size:           obj.Size,
+			LastAccessTime: obj.ModTime.UnixNano() / 1000000,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading cache inventory: %v", err)
+	}
+	return newSizeCacheFS(base, cache, cacheSize, cacheTime, files), nil
+}
+
+var (
+	_ Inventory = (*InventoryReader)(nil)
+	_ Inventory = (*S3Inventory)(nil)
+)
@@ -0,0 +1,98 @@
+package kafero
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3Inventory(t *testing.T) {
+	fs := NewMemMapFs()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = io.WriteString(zw, `"bucket","data/a.txt","true","false","10","2020-01-02T15:04:05.000Z","e1"
+"bucket","data/old.txt","false","false","5","2020-01-01T15:04:05.000Z","e0"
+"bucket","data/sub/b%20c.txt","true","false","20","2020-01-02T15:04:05.000Z","e2"
+"bucket","data/gone.txt","true","true","","",""
+"bucket","empty/","true","false","0","2020-01-02T15:04:05.000Z","e3"
+`)
+	_ = zw.Close()
+	if err := WriteFile(fs, "/inv/data/1.csv.gz", buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `{"sourceBucket":"bucket","fileFormat":"CSV",
+"fileSchema":"Bucket, Key, IsLatest, IsDeleteMarker, Size, LastModifiedDate, ETag",
+"files":[{"key":"data/1.csv.gz","size":100}]}`
+	if err := WriteFile(fs, "/inv/manifest.json", []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := ReadS3InventoryManifest(fs, "/inv/manifest.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := &listCountingFs{Fs: NewMemMapFs()}
+	lfs := NewListingCacheFs(base, time.Hour)
+	inv := m.Open(fs, "/inv")
+	if err := lfs.ImportInventory(inv, "/bucket"); err != nil {
+		t.Fatal(err)
+	}
+	_ = inv.Close()
+
+	infos, err := lfs.ReadDir("/bucket/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if strings.Join(names, ",") != "a.txt,sub" || infos[0].Size() != 10 || !infos[1].IsDir() {
+		t.Fatalf("unexpected listing %v", names)
+	}
+	if infos, err := lfs.ReadDir("/bucket/data/sub"); err != nil || len(infos) != 1 || infos[0].Name() != "b c.txt" {
+		t.Fatalf("was expecting b c.txt, got %v", err)
+	}
+	if infos, err := lfs.ReadDir("/bucket"); err != nil || len(infos) != 2 {
+		t.Fatalf("was expecting data and empty, got %d, %v", len(infos), err)
+	}
+	if infos, err := lfs.ReadDir("/bucket/empty"); err != nil || len(infos) != 0 {
+		t.Fatalf("was expecting an empty directory, got %d, %v", len(infos), err)
+	}
+	if base.lists != 0 {
+		t.Fatalf("was expecting no listing, got %d", base.lists)
+	}
+
+	m.FileFormat = "Parquet"
+	data, _ := ReadFile(fs, "/inv/manifest.json")
+	_ = WriteFile(fs, "/inv/manifest.json", bytes.Replace(data, []byte(`"CSV"`), []byte(`"Parquet"`), 1), 0644)
+	if _, err := ReadS3InventoryManifest(fs, "/inv/manifest.json"); err == nil || !strings.Contains(err.Error(), ErrUnsupportedInventory.Error()) {
+		t.Fatalf("was expecting ErrUnsupportedInventory, got %v", err)
+	}
+}
+
+func TestGcsInventory(t *testing.T) {
+	inventory := `bucket,name,size,updated,etag
+cache,a/1.bin,100,2020-01-02T15:04:05Z,CJ1
+cache,a/2.bin,200,2020-01-02T15:04:06Z,CJ2
+cache,.cacheindex,10,2020-01-02T15:04:06Z,CJ3
+`
+	ir, err := NewGcsInventoryReader(strings.NewReader(inventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ir.Close()
+	fs, err := NewSizeCacheFSFromInventory(NewMemMapFs(), NewMemMapFs(), 1000, 0, ir, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Size() != 300 {
+		t.Fatalf("was expecting a size of 300, got %d", fs.Size())
+	}
+	if f := fs.getCacheFile("/a/2.bin"); f == nil || f.Size != 200 {
+		t.Fatalf("was expecting /a/2.bin to be indexed")
+	}
+}
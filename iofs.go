@@ -0,0 +1,145 @@
+//go:build go1.16
+// +build go1.16
+
+package kafero
+
+import (
+	"io/fs"
+	"path"
+	"sort"
+)
+
+var (
+	_ fs.FS         = IOFS{}
+	_ fs.GlobFS     = IOFS{}
+	_ fs.ReadDirFS  = IOFS{}
+	_ fs.ReadFileFS = IOFS{}
+	_ fs.StatFS     = IOFS{}
+	_ fs.SubFS      = IOFS{}
+)
+
+// IOFS adapts a Fs to the io/fs interfaces, for the consumers of the
+// standard library, such as html/template.ParseFS or http.FS. The names
+// are those of the Fs, the root directory of the io/fs interfaces being
+// the working directory of the Fs, "." or "/" for most of them: wrap the
+// Fs in a BasePathFs to expose a subtree. The files of the filesystems
+// which can't seek, such as those of zstfs, fail their Seek and ReadAt.
+type IOFS struct {
+	Fs
+}
+
+func NewIOFS(fs Fs) IOFS {
+	return IOFS{Fs: fs}
+}
+
+func (iofs IOFS) Open(name string) (fs.File, error) {
+	const op = "open"
+	if !fs.ValidPath(name) {
+		return nil, iofs.wrapError(op, name, fs.ErrInvalid)
+	}
+	file, err := iofs.Fs.Open(name)
+	if err != nil {
+		return nil, iofs.wrapError(op, name, err)
+	}
+	return ioFile{File: file}, nil
+}
+
+func (iofs IOFS) Glob(pattern string) ([]string, error) {
+	const op = "glob"
+	// Reject the malformed patterns, as fs.Glob does
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, iofs.wrapError(op, pattern, err)
+	}
+	matches, err := Glob(iofs.Fs, pattern)
+	if err != nil {
+		return nil, iofs.wrapError(op, pattern, err)
+	}
+	return matches, nil
+}
+
+// ReadDir returns the entries of the directory name, sorted by name.
+func (iofs IOFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	const op = "readdir"
+	if !fs.ValidPath(name) {
+		return nil, iofs.wrapError(op, name, fs.ErrInvalid)
+	}
+	infos, err := ReadDir(iofs.Fs, name)
+	if err != nil {
+		return nil, iofs.wrapError(op, name, err)
+	}
+	return dirEntries(infos), nil
+}
+
+func (iofs IOFS) ReadFile(name string) ([]byte, error) {
+	const op = "readfile"
+	if !fs.ValidPath(name) {
+		return nil, iofs.wrapError(op, name, fs.ErrInvalid)
+	}
+	data, err := ReadFile(iofs.Fs, name)
+	if err != nil {
+		return nil, iofs.wrapError(op, name, err)
+	}
+	return data, nil
+}
+
+func (iofs IOFS) Stat(name string) (fs.FileInfo, error) {
+	const op = "stat"
+	if !fs.ValidPath(name) {
+		return nil, iofs.wrapError(op, name, fs.ErrInvalid)
+	}
+	info, err := iofs.Fs.Stat(name)
+	if err != nil {
+		return nil, iofs.wrapError(op, name, err)
+	}
+	return info, nil
+}
+
+// Sub returns the IOFS of the subtree dir, through a BasePathFs.
+func (iofs IOFS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, iofs.wrapError("sub", dir, fs.ErrInvalid)
+	}
+	if dir == "." {
+		return iofs, nil
+	}
+	return IOFS{Fs: NewBasePathFs(iofs.Fs, dir)}, nil
+}
+
+// wrapError returns err as a *fs.PathError, as the io/fs interfaces do.
+func (iofs IOFS) wrapError(op, name string, err error) error {
+	if _, ok := err.(*fs.PathError); ok {
+		return err
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// ioFile is a File implementing fs.ReadDirFile.
+type ioFile struct {
+	File
+}
+
+func (f ioFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	infos, err := f.Readdir(count)
+	if count <= 0 {
+		sort.Sort(byName(infos))
+	}
+	return dirEntries(infos), err
+}
+
+func dirEntries(infos []fs.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = dirEntry{info}
+	}
+	return entries
+}
+
+// dirEntry is a fs.DirEntry of a FileInfo.
+type dirEntry struct {
+	info fs.FileInfo
+}
+
+func (e dirEntry) Name() string               { return e.info.Name() }
+func (e dirEntry) IsDir() bool                { return e.info.IsDir() }
+func (e dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
@@ -0,0 +1,69 @@
+//go:build go1.16
+// +build go1.16
+
+package kafero_test
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+var ioFixture = tests.Fixture{
+	"a.txt":           "a",
+	"dir/b.txt":       "bb",
+	"dir/sub/c.txt":   "ccc",
+	"dir/sub/d.txt":   "",
+	"empty/":          "",
+	"other/e.tar.zst": "eeeee",
+}
+
+func TestIOFS(t *testing.T) {
+	for _, config := range testConfigs {
+		tests.TestIOFS(t, config.Fs, ioFixture, config.CanSeek)
+	}
+	for _, fs := range []kafero.Fs{
+		kafero.NewCacheOnReadFs(&kafero.MemMapFs{}, &kafero.MemMapFs{}, 0),
+		kafero.NewCopyOnWriteFs(&kafero.MemMapFs{}, &kafero.MemMapFs{}),
+		kafero.NewBufferFs(&kafero.MemMapFs{}, &kafero.MemMapFs{}),
+	} {
+		tests.TestIOFS(t, fs, ioFixture, true)
+	}
+}
+
+func TestIOFSAdapter(t *testing.T) {
+	mem := kafero.NewMemMapFs()
+	for name, content := range ioFixture {
+		if strings.HasSuffix(name, "/") {
+			if err := mem.MkdirAll(name, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := kafero.WriteFile(mem, name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var expected []string
+	for name := range ioFixture {
+		expected = append(expected, strings.TrimSuffix(name, "/"))
+	}
+	if err := fstest.TestFS(kafero.NewIOFS(mem), expected...); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := fs.Sub(kafero.NewIOFS(mem), "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "b.txt", "sub/c.txt", "sub/d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kafero.NewIOFS(mem).Open("/a.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("was expecting an invalid path error, got %v", err)
+	}
+}
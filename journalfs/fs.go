@@ -0,0 +1,288 @@
+package journalfs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// An Op is a kind of mutating operation.
+type Op string
+
+const (
+	// OpWrite is logged once a file opened for writing is closed.
+	OpWrite   Op = "write"
+	OpMkdir   Op = "mkdir"
+	OpRemove  Op = "remove"
+	OpRename  Op = "rename"
+	OpChmod   Op = "chmod"
+	OpChtimes Op = "chtimes"
+)
+
+// An Entry is an operation of the journal.
+type Entry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Op   Op        `json:"op"`
+	Path string    `json:"path"`
+	// NewPath is the destination of OpRename.
+	NewPath string `json:"new_path,omitempty"`
+	// Mode is the mode of OpChmod and OpMkdir.
+	Mode os.FileMode `json:"mode,omitempty"`
+	// ModTime is the modification time of OpChtimes.
+	ModTime *time.Time `json:"mtime,omitempty"`
+}
+
+// Maximum size of an entry of the journal
+const maxEntrySize = 1 << 20
+
+// The Fs appends the mutating operations done through it to a journal, a
+// file of JSON lines on a filesystem of choice, each entry numbered. The
+// entries are synced to the journal before the operations return, so that
+// the consumers replaying it, to maintain an index or track the changes to
+// synchronize, don't miss any. The journal needs a filesystem supporting
+// appends.
+//
+// The operations are logged once done, the failed ones not being logged.
+// RemoveAll is logged as OpRemove.
+type Fs struct {
+	*state
+	source kafero.Fs
+	clock  kafero.Clock
+}
+
+// state is the state of a Fs, shared with its views bound to contexts.
+type state struct {
+	mu  sync.Mutex
+	log kafero.File
+	seq uint64
+}
+
+// NewFs returns an Fs logging the operations on source to the journal name
+// of logFs, continuing its sequence if it exists.
+func NewFs(source kafero.Fs, logFs kafero.Fs, name string) (*Fs, error) {
+	var seq uint64
+	var size int64
+	err := replay(logFs, name, 0, func(e Entry) error {
+		seq = e.Seq
+		return nil
+	}, &size)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	log, err := logFs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// Drop the entry partially written by a crash, if any
+	if info, err := log.Stat(); err == nil && info.Size() > size {
+		if err := log.Truncate(size); err != nil {
+			_ = log.Close()
+			return nil, err
+		}
+		// Not all the filesystems append at the end of the file whatever
+		// the offset
+		if _, err := log.Seek(0, io.SeekEnd); err != nil {
+			_ = log.Close()
+			return nil, err
+		}
+	}
+	return &Fs{state: &state{log: log, seq: seq}, source: source, clock: kafero.SystemClock}, nil
+}
+
+// SetClock sets the clock telling the time of the entries.
+func (j *Fs) SetClock(clock kafero.Clock) {
+	j.clock = clock
+}
+
+// Seq returns the sequence number of the last entry.
+func (j *Fs) Seq() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.seq
+}
+
+// Close closes the journal.
+func (j *Fs) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log.Close()
+}
+
+// append logs e, failing if it can't be synced to the journal.
+func (j *Fs) append(e Entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	e.Seq = j.seq + 1
+	e.Time = j.clock.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := j.log.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+	if err := j.log.Sync(); err != nil {
+		return fmt.Errorf("error syncing journal: %v", err)
+	}
+	j.seq = e.Seq
+	return nil
+}
+
+// Replay calls fn with the entries of the journal name of logFs whose
+// sequence number is above after, in order. The last entry, if partially
+// written by a crash, is ignored.
+func Replay(logFs kafero.Fs, name string, after uint64, fn func(Entry) error) error {
+	var size int64
+	return replay(logFs, name, after, fn, &size)
+}
+
+// replay replays the journal, setting size to the size of its complete
+// entries.
+func replay(logFs kafero.Fs, name string, after uint64, fn func(Entry) error, size *int64) error {
+	f, err := logFs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, maxEntrySize)
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return fmt.Errorf("journal entry too large")
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*size += int64(len(line))
+		if len(line) == 1 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("error unmarshalling journal entry: %v", err)
+		}
+		if e.Seq <= after {
+			continue
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+}
+
+func (j *Fs) Name() string {
+	return "JournalFs"
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (j *Fs) Unwrap() kafero.Fs {
+	return j.source
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (j *Fs) WithContext(ctx context.Context) kafero.Fs {
+	return &Fs{state: j.state, source: kafero.WithContext(j.source, ctx), clock: j.clock}
+}
+
+func (j *Fs) Create(name string) (kafero.File, error) {
+	f, err := j.source.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, fs: j, name: name}, nil
+}
+
+func (j *Fs) Open(name string) (kafero.File, error) {
+	return j.source.Open(name)
+}
+
+func (j *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	f, err := j.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+	return &file{File: f, fs: j, name: name}, nil
+}
+
+func (j *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := j.source.Mkdir(name, perm); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpMkdir, Path: name, Mode: perm})
+}
+
+func (j *Fs) MkdirAll(path string, perm os.FileMode) error {
+	if err := j.source.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpMkdir, Path: path, Mode: perm})
+}
+
+func (j *Fs) Remove(name string) error {
+	if err := j.source.Remove(name); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpRemove, Path: name})
+}
+
+func (j *Fs) RemoveAll(path string) error {
+	if err := j.source.RemoveAll(path); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpRemove, Path: path})
+}
+
+func (j *Fs) Rename(oldname, newname string) error {
+	if err := j.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpRename, Path: oldname, NewPath: newname})
+}
+
+func (j *Fs) Stat(name string) (os.FileInfo, error) {
+	return j.source.Stat(name)
+}
+
+func (j *Fs) Chmod(name string, mode os.FileMode) error {
+	if err := j.source.Chmod(name, mode); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpChmod, Path: name, Mode: mode})
+}
+
+func (j *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := j.source.Chtimes(name, atime, mtime); err != nil {
+		return err
+	}
+	return j.append(Entry{Op: OpChtimes, Path: name, ModTime: &mtime})
+}
+
+// file is a file opened for writing, logged once closed.
+type file struct {
+	kafero.File
+	fs   *Fs
+	name string
+}
+
+func (f *file) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.fs.append(Entry{Op: OpWrite, Path: f.name})
+}
@@ -0,0 +1,75 @@
+package journalfs
+
+import (
+	"os"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestJournal(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	logFs := kafero.NewMemMapFs()
+	fs, err := NewFs(base, logFs, "/journal.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("/data", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(fs, "/data/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/data/a.txt", "/data/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// The failed operations are not logged
+	if err := fs.Remove("/data/missing.txt"); err == nil {
+		t.Fatal("was expecting an error removing a missing file")
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash leaves a partial entry, which is dropped
+	f, err := logFs.OpenFile("/journal.log", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write([]byte(`{"seq":4,"op":"rem`))
+	_ = f.Close()
+
+	fs, err = NewFs(base, logFs, "/journal.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Seq() != 3 {
+		t.Fatalf("was expecting the sequence to continue from 3, got %d", fs.Seq())
+	}
+	if err := fs.Remove("/data/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	_ = fs.Close()
+
+	var entries []Entry
+	err = Replay(logFs, "/journal.log", 1, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Entry{
+		{Seq: 2, Op: OpWrite, Path: "/data/a.txt"},
+		{Seq: 3, Op: OpRename, Path: "/data/a.txt", NewPath: "/data/b.txt"},
+		{Seq: 4, Op: OpRemove, Path: "/data/b.txt"},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("was expecting %d entries, got %v", len(expected), entries)
+	}
+	for i, e := range expected {
+		if entries[i].Seq != e.Seq || entries[i].Op != e.Op || entries[i].Path != e.Path || entries[i].NewPath != e.NewPath {
+			t.Fatalf("was expecting %v, got %v", e, entries[i])
+		}
+	}
+}
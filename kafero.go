@@ -108,10 +108,25 @@ type Fs interface {
 	Chtimes(name string, atime time.Time, mtime time.Time) error
 }
 
+// Walkable is an optional interface in Kafero. It is implemented by the
+// filesystems walking a tree more efficiently than directory by directory,
+// and is used by Walk when available. The walks must be those of Walk: in
+// lexical order, without following the symbolic links, skipping the rest of
+// a directory when walkFn returns filepath.SkipDir, and the wrapping
+// filesystems must only implement it if they walk their source unchanged.
 type Walkable interface {
 	Walk(root string, walkFunc filepath.WalkFunc) error
 }
 
+// ReadDirer is an optional interface in Kafero. It is implemented by the
+// filesystems listing a directory with the same FileInfo as returned by
+// LstatIfPossible for its entries, and is used by Walk when available to
+// avoid a stat per entry.
+type ReadDirer interface {
+	// ReadDir returns the entries of the named directory, sorted by name.
+	ReadDir(dirname string) ([]os.FileInfo, error)
+}
+
 var (
 	ErrFileClosed        = errors.New("file is closed")
 	ErrOutOfRange        = errors.New("out of range")
@@ -119,4 +134,9 @@ var (
 	ErrFileNotFound      = os.ErrNotExist
 	ErrFileExists        = os.ErrExist
 	ErrDestinationExists = os.ErrExist
+	// ErrReadOnlyHandle is wrapped in the *os.PathError returned by the
+	// writes to a file opened read only, whatever the filesystem. The mem
+	// and gcs packages, imported by kafero, can't import it and wrap
+	// os.ErrPermission directly: it must stay os.ErrPermission.
+	ErrReadOnlyHandle = os.ErrPermission
 )
@@ -1,7 +1,13 @@
 package kafero_test
 
 import (
+	"io/ioutil"
+	"os"
+	"runtime"
+
 	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/lz4fs"
+	"github.com/melaurent/kafero/snappyfs"
 	"github.com/melaurent/kafero/tests"
 	"github.com/melaurent/kafero/zstfs"
 	"testing"
@@ -9,6 +15,9 @@ import (
 
 var tmpCacheFs, _ = kafero.NewSizeCacheFS(&kafero.MemMapFs{}, &kafero.MemMapFs{}, 0, 0)
 var zstFs = zstfs.NewFs(&kafero.MemMapFs{}, 0)
+var lz4Fs = lz4fs.NewFs(&kafero.MemMapFs{}, 0)
+var snappyFs = snappyfs.NewFs(&kafero.MemMapFs{})
+var bufferFs = kafero.NewBufferFs(&kafero.MemMapFs{}, &kafero.MemMapFs{})
 var Fss = []kafero.Fs{&kafero.MemMapFs{}, &kafero.OsFs{}, tmpCacheFs, zstFs} //gcsFs}
 
 type TestConfig struct {
@@ -22,6 +31,8 @@ var testConfigs = []TestConfig{
 	{Fs: &kafero.OsFs{}, CanSeek: true, CanTruncate: true},
 	{Fs: tmpCacheFs, CanSeek: true, CanTruncate: true},
 	{Fs: zstFs, CanSeek: false, CanTruncate: false},
+	{Fs: lz4Fs, CanSeek: false, CanTruncate: false},
+	{Fs: snappyFs, CanSeek: false, CanTruncate: false},
 }
 
 func TestRead0(t *testing.T) {
@@ -38,6 +49,15 @@ func TestOpenFile(t *testing.T) {
 	}
 }
 
+func TestOpenFlags(t *testing.T) {
+	for _, config := range testConfigs {
+		tests.TestOpenFlags(t, config.Fs)
+	}
+	// The handles of a BufferFs don't share their content, so it is only
+	// checked for flags
+	tests.TestOpenFlags(t, bufferFs)
+}
+
 func TestCreate(t *testing.T) {
 	for _, config := range testConfigs {
 		tests.TestCreate(t, config.Fs)
@@ -56,6 +76,13 @@ func TestRemove(t *testing.T) {
 	}
 }
 
+func TestRemoveAll(t *testing.T) {
+	for _, config := range testConfigs {
+		tests.TestRemoveAll(t, config.Fs)
+	}
+	tests.TestRemoveAll(t, bufferFs)
+}
+
 func TestTruncate(t *testing.T) {
 	for _, config := range testConfigs {
 		if config.CanTruncate {
@@ -64,12 +91,31 @@ func TestTruncate(t *testing.T) {
 	}
 }
 
+func TestChtimes(t *testing.T) {
+	for _, config := range testConfigs {
+		tests.TestChtimes(t, config.Fs)
+	}
+}
+
+func TestWriteReadOnly(t *testing.T) {
+	for _, config := range testConfigs {
+		tests.TestWriteReadOnly(t, config.Fs)
+	}
+	tests.TestWriteReadOnly(t, bufferFs)
+}
+
 func TestSeek(t *testing.T) {
 	for _, config := range testConfigs {
 		if config.CanSeek {
 			tests.TestSeek(t, config.Fs)
+			// Windows seeks from the start for the unknown whences, and
+			// fails the negative offsets with its own error
+			if _, ok := config.Fs.(*kafero.OsFs); !ok || runtime.GOOS != "windows" {
+				tests.TestSeekInvalid(t, config.Fs)
+			}
 		}
 	}
+	tests.TestSeekInvalid(t, bufferFs)
 }
 
 func TestReadAt(t *testing.T) {
@@ -78,6 +124,7 @@ func TestReadAt(t *testing.T) {
 			tests.TestReadAt(t, config.Fs)
 		}
 	}
+	tests.TestReadAt(t, bufferFs)
 }
 
 func TestWriteAt(t *testing.T) {
@@ -117,3 +164,56 @@ func TestReadDirAll(t *testing.T) {
 		tests.TestReadDirAll(t, config.Fs)
 	}
 }
+
+// osDir returns a filesystem rooted in a new temporary directory of the
+// OsFs, with its own temporary directory.
+func osDir(t *testing.T) (kafero.Fs, string) {
+	dir, err := ioutil.TempDir("", "kafero-equivalence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := kafero.NewBasePathFs(&kafero.OsFs{}, dir)
+	if err := fs.MkdirAll(os.TempDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return fs, dir
+}
+
+func TestEquivalence(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		base, baseDir := osDir(t)
+		layer, layerDir := osDir(t)
+		defer os.RemoveAll(baseDir)
+		defer os.RemoveAll(layerDir)
+
+		tests.TestEquivalence(t, &kafero.OsFs{}, kafero.NewBasePathFs(&kafero.OsFs{}, "/"), seed, 50)
+		sizeCacheFs, _ := kafero.NewSizeCacheFS(base, layer, 1e9, 0)
+		tests.TestEquivalence(t, &kafero.OsFs{}, sizeCacheFs, seed, 50)
+		tests.TestEquivalence(t, &kafero.OsFs{}, kafero.NewCacheOnReadFs(base, layer, 0), seed, 50)
+		tests.TestEquivalence(t, &kafero.OsFs{}, kafero.NewCopyOnWriteFs(base, layer), seed, 50)
+		tests.TestEquivalence(t, &kafero.OsFs{}, kafero.NewBufferFs(base, layer), seed, 50)
+	}
+}
+
+func TestStress(t *testing.T) {
+	sizeCacheFs, _ := kafero.NewSizeCacheFS(&kafero.MemMapFs{}, &kafero.MemMapFs{}, 1e9, 0)
+	for _, fs := range []kafero.Fs{
+		&kafero.MemMapFs{},
+		sizeCacheFs,
+		kafero.NewBufferFs(&kafero.MemMapFs{}, &kafero.MemMapFs{}),
+	} {
+		tests.TestStress(t, fs, 8, 200)
+	}
+}
+
+func TestFixture(t *testing.T) {
+	fixture, err := tests.FixtureFromDir(&kafero.OsFs{}, "tests/testdata/fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range Fss {
+		root := tests.LoadFixture(t, fs, fixture)
+		tests.CheckFixture(t, fs, root, fixture)
+	}
+	tests.RemoveAllTestFiles(t)
+}
@@ -0,0 +1,314 @@
+package kafero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Default maximum number of directories remembered by a ListingCacheFs
+const listingCacheSize = 1 << 12
+
+type listing struct {
+	infos  []os.FileInfo
+	names  map[string]os.FileInfo
+	expiry time.Time
+}
+
+// The ListingCacheFs caches the listings of the directories of the source
+// filesystem for ttl, so that the tools listing the same directories over
+// and over, such as globbing or tree, don't list an object store each
+// time. The listings are invalidated by the writes through the
+// ListingCacheFs, and by the Stat of the files which don't match them:
+// their ETag when known, their size and modification time otherwise. The writes of other clients may not be visible until ttl
+// expires.
+type ListingCacheFs struct {
+	*listings
+	source  Fs
+	ttl     time.Duration
+	clock   Clock
+	maxDirs int
+}
+
+// listings are the listings cached by a ListingCacheFs, shared with its
+// views bound to contexts.
+type listings struct {
+	mu   sync.Mutex
+	dirs map[string]*listing
+}
+
+func NewListingCacheFs(source Fs, ttl time.Duration) *ListingCacheFs {
+	return &ListingCacheFs{listings: &listings{dirs: make(map[string]*listing)}, source: source, ttl: ttl, clock: SystemClock, maxDirs: listingCacheSize}
+}
+
+// SetClock sets the clock telling the expiry of the listings.
+func (l *ListingCacheFs) SetClock(clock Clock) {
+	l.clock = clock
+}
+
+// get returns the cached listing of dir, nil if missing or expired.
+func (l *ListingCacheFs) get(dir string) *listing {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.dirs[dir]
+	if !ok {
+		return nil
+	}
+	if l.clock.Now().After(entry.expiry) {
+		delete(l.dirs, dir)
+		return nil
+	}
+	return entry
+}
+
+func (l *ListingCacheFs) add(dir string, infos []os.FileInfo) *listing {
+	now := l.clock.Now()
+	entry := &listing{infos: infos, names: make(map[string]os.FileInfo, len(infos)), expiry: now.Add(l.ttl)}
+	for _, info := range infos {
+		entry.names[info.Name()] = info
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.dirs) >= l.maxDirs {
+		for k, e := range l.dirs {
+			if now.After(e.expiry) {
+				delete(l.dirs, k)
+			}
+		}
+		if len(l.dirs) >= l.maxDirs {
+			l.dirs = make(map[string]*listing)
+		}
+	}
+	l.dirs[dir] = entry
+	return entry
+}
+
+// Invalidate forgets the listing of dir.
+func (l *ListingCacheFs) Invalidate(dir string) {
+	dir = filepath.Clean(dir)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.dirs, dir)
+}
+
+// invalidateParents forgets the listings of the parent directories of
+// name, as creating a file creates its parents.
+func (l *ListingCacheFs) invalidateParents(name string) {
+	name = filepath.Clean(name)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for {
+		parent := filepath.Dir(name)
+		if parent == name {
+			return
+		}
+		delete(l.dirs, parent)
+		name = parent
+	}
+}
+
+// invalidateTree forgets the listings of the parent of name, of name and
+// of all the directories below it.
+func (l *ListingCacheFs) invalidateTree(name string) {
+	name = filepath.Clean(name)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.dirs, filepath.Dir(name))
+	prefix := name + string(filepath.Separator)
+	for dir := range l.dirs {
+		if dir == name || strings.HasPrefix(dir, prefix) {
+			delete(l.dirs, dir)
+		}
+	}
+}
+
+// ReadDir returns the listing of dirname, from the cache if possible. The
+// callers own the slice returned, which they may sort.
+func (l *ListingCacheFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	dir := filepath.Clean(dirname)
+	entry := l.get(dir)
+	if entry == nil {
+		infos, err := readDirLstat(l.source, dir)
+		if err != nil {
+			return nil, err
+		}
+		entry = l.add(dir, infos)
+	}
+	return append([]os.FileInfo(nil), entry.infos...), nil
+}
+
+// fileETag returns the ETag of a file, if known.
+func fileETag(info os.FileInfo) string {
+	switch sys := info.Sys().(type) {
+	case *storage.ObjectAttrs:
+		return sys.Etag
+	case *InventoryObject:
+		return sys.ETag
+	}
+	return ""
+}
+
+// sameVersion returns true if a and b are the same version of a file: of
+// the same ETag if known, of the same size and modification time
+// otherwise. The size and times of the directories change with their
+// content, so they are not compared.
+func sameVersion(a, b os.FileInfo) bool {
+	if a.IsDir() || b.IsDir() {
+		return a.IsDir() == b.IsDir()
+	}
+	if etagA, etagB := fileETag(a), fileETag(b); etagA != "" && etagB != "" {
+		return etagA == etagB
+	}
+	return a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// Stat stats name in the source, and invalidates the listing of its
+// parent if it doesn't match.
+func (l *ListingCacheFs) Stat(name string) (os.FileInfo, error) {
+	info, err := l.source.Stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		return info, err
+	}
+	name = filepath.Clean(name)
+	parent := filepath.Dir(name)
+	if entry := l.get(parent); entry != nil {
+		cached, listed := entry.names[filepath.Base(name)]
+		switch {
+		case err != nil && listed, err == nil && !listed:
+			l.Invalidate(parent)
+		case err == nil:
+			if !sameVersion(info, cached) {
+				l.Invalidate(parent)
+			}
+		}
+	}
+	return info, err
+}
+
+func (l *ListingCacheFs) Create(name string) (File, error) {
+	return l.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (l *ListingCacheFs) Open(name string) (File, error) {
+	return l.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (l *ListingCacheFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := l.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC|os.O_CREATE) != 0 {
+		l.invalidateParents(name)
+		return &listingWriteFile{File: f, fs: l, name: name}, nil
+	}
+	return &listingReadFile{File: f, fs: l, name: name}, nil
+}
+
+func (l *ListingCacheFs) Mkdir(name string, perm os.FileMode) error {
+	l.invalidateParents(name)
+	return l.source.Mkdir(name, perm)
+}
+
+func (l *ListingCacheFs) MkdirAll(path string, perm os.FileMode) error {
+	l.invalidateParents(path)
+	return l.source.MkdirAll(path, perm)
+}
+
+func (l *ListingCacheFs) Remove(name string) error {
+	l.invalidateTree(name)
+	return l.source.Remove(name)
+}
+
+func (l *ListingCacheFs) RemoveAll(path string) error {
+	l.invalidateTree(path)
+	return l.source.RemoveAll(path)
+}
+
+func (l *ListingCacheFs) Rename(oldname, newname string) error {
+	l.invalidateTree(oldname)
+	l.invalidateTree(newname)
+	l.invalidateParents(newname)
+	return l.source.Rename(oldname, newname)
+}
+
+func (l *ListingCacheFs) Chmod(name string, mode os.FileMode) error {
+	l.invalidateParents(name)
+	return l.source.Chmod(name, mode)
+}
+
+func (l *ListingCacheFs) Chtimes(name string, atime, mtime time.Time) error {
+	l.invalidateParents(name)
+	return l.source.Chtimes(name, atime, mtime)
+}
+
+func (l *ListingCacheFs) Name() string {
+	return "ListingCacheFs"
+}
+
+func (l *ListingCacheFs) Unwrap() Fs {
+	return l.source
+}
+
+// listingWriteFile invalidates the listings of the parents of the file
+// once written.
+type listingWriteFile struct {
+	File
+	fs   *ListingCacheFs
+	name string
+}
+
+func (f *listingWriteFile) Close() error {
+	err := f.File.Close()
+	f.fs.invalidateParents(f.name)
+	return err
+}
+
+// listingReadFile serves the listing of a directory from the cache.
+type listingReadFile struct {
+	File
+	fs     *ListingCacheFs
+	name   string
+	infos  []os.FileInfo
+	listed bool
+}
+
+func (f *listingReadFile) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.listed {
+		infos, err := f.fs.ReadDir(f.name)
+		if err != nil {
+			return nil, err
+		}
+		f.infos, f.listed = infos, true
+	}
+	if count <= 0 {
+		infos := f.infos
+		f.infos = nil
+		return infos, nil
+	}
+	if len(f.infos) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.infos) {
+		count = len(f.infos)
+	}
+	infos := f.infos[:count]
+	f.infos = f.infos[count:]
+	return infos, nil
+}
+
+func (f *listingReadFile) Readdirnames(n int) ([]string, error) {
+	infos, err := f.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
+
+var _ ReadDirer = (*ListingCacheFs)(nil)
@@ -0,0 +1,112 @@
+package kafero
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// listCountingFs counts the listings of its directories.
+type listCountingFs struct {
+	Fs
+	lists int
+}
+
+func (fs *listCountingFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	fs.lists++
+	return readDirLstat(fs.Fs, dirname)
+}
+
+func TestListingCacheFs(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	base := &listCountingFs{Fs: NewMemMapFsWithClock(clock)}
+	if err := WriteFile(base, "/dir/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(base, "/dir/b.txt", []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewListingCacheFs(base, time.Minute)
+	fs.SetClock(clock)
+
+	for i := 0; i < 10; i++ {
+		matches, err := Glob(fs, "/dir/*.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 2 {
+			t.Fatalf("was expecting 2 matches, got %v", matches)
+		}
+	}
+	if base.lists != 1 {
+		t.Fatalf("was expecting 1 listing, got %d", base.lists)
+	}
+
+	// The handles of the directory are served from the cache
+	f, err := fs.Open("/dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := f.Readdirnames(1)
+	if err != nil || len(names) != 1 || names[0] != "a.txt" {
+		t.Fatalf("was expecting a.txt, got %v, %v", names, err)
+	}
+	names, err = f.Readdirnames(-1)
+	if err != nil || len(names) != 1 || names[0] != "b.txt" {
+		t.Fatalf("was expecting b.txt, got %v, %v", names, err)
+	}
+	_ = f.Close()
+	if base.lists != 1 {
+		t.Fatalf("was expecting 1 listing, got %d", base.lists)
+	}
+
+	// The local writes invalidate the listing
+	if err := WriteFile(fs, "/dir/c.txt", []byte("c"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	infos, err := ReadDir(fs, "/dir")
+	if err != nil || len(infos) != 3 {
+		t.Fatalf("was expecting 3 files, got %d, %v", len(infos), err)
+	}
+	if err := fs.Remove("/dir/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = ReadDir(fs, "/dir")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("was expecting 2 files, got %d, %v", len(infos), err)
+	}
+	if base.lists != 3 {
+		t.Fatalf("was expecting 3 listings, got %d", base.lists)
+	}
+
+	// The writes of others are noticed by Stat
+	if err := WriteFile(base, "/dir/d.txt", []byte("d"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadDir(fs, "/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if base.lists != 3 {
+		t.Fatalf("was expecting 3 listings, got %d", base.lists)
+	}
+	if _, err := fs.Stat("/dir/d.txt"); err != nil {
+		t.Fatal(err)
+	}
+	infos, err = ReadDir(fs, "/dir")
+	if err != nil || len(infos) != 3 {
+		t.Fatalf("was expecting 3 files, got %d, %v", len(infos), err)
+	}
+	if base.lists != 4 {
+		t.Fatalf("was expecting 4 listings, got %d", base.lists)
+	}
+
+	// Or once the listing expires
+	if err := base.Remove("/dir/c.txt"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Minute)
+	infos, err = ReadDir(fs, "/dir")
+	if err != nil || len(infos) != 2 {
+		t.Fatalf("was expecting 2 files, got %d, %v", len(infos), err)
+	}
+}
@@ -0,0 +1,198 @@
+package kafero
+
+import (
+	"bytes"
+	crand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrLocked is returned when taking a lock held by another owner.
+var ErrLocked = errors.New("locked")
+
+// ErrLockLost is returned when refreshing or releasing a lock taken over
+// by another owner, after it went stale.
+var ErrLockLost = errors.New("lock lost")
+
+// errLockChanged is returned when a lock file changed before it could be
+// taken over, refreshed or released.
+var errLockChanged = errors.New("lock file changed")
+
+// conditionalFs is implemented by the filesystems changing a file only if
+// it is still the version stat'ed as fi, failing with errLockChanged
+// otherwise, such as GcsFs with a precondition on the generation of the
+// object.
+type conditionalFs interface {
+	removeIfUnchanged(name string, fi os.FileInfo) error
+	writeIfUnchanged(name string, fi os.FileInfo, data []byte) error
+}
+
+// A FileLock is an advisory lock held as a lock file, created exclusively
+// with O_CREATE|O_EXCL, which works on the backends without flock, such as
+// GcsFs with a precondition on the absence of the object. The lock file
+// holds a token of its owner, so that a lock taken over once stale isn't
+// released by its previous owner.
+//
+// The lock file is only changed, to take it over, refresh or release it,
+// if it is still the version seen holding the token expected: on GcsFs
+// with a precondition on the generation of the object, on the other
+// backends while holding a guard file named after the token, created
+// exclusively as well, so that the changes of a version are serialized.
+type FileLock struct {
+	fs    Fs
+	path  string
+	ttl   time.Duration
+	token []byte
+}
+
+// LockFile takes the lock of the lock file path of fs, failing with
+// ErrLocked if it is held. The lock files not modified for ttl are taken
+// for those of crashed owners and taken over, never if ttl is 0: the
+// owners holding a lock longer than ttl must Refresh it. Of the
+// contenders taking over the same stale lock file, only one succeeds.
+func LockFile(fs Fs, path string, ttl time.Duration) (*FileLock, error) {
+	token := make([]byte, 16)
+	if _, err := crand.Read(token); err != nil {
+		return nil, err
+	}
+	l := &FileLock{fs: fs, path: path, ttl: ttl, token: []byte(hex.EncodeToString(token))}
+	err := l.create()
+	if errors.Is(err, os.ErrExist) && ttl > 0 {
+		fi, serr := fs.Stat(path)
+		if serr == nil && time.Since(fi.ModTime()) > ttl {
+			stale, rerr := ReadFile(fs, path)
+			if rerr == nil {
+				rerr = l.change(fi, stale, nil)
+			}
+			if rerr == nil {
+				err = l.create()
+			} else if !errors.Is(rerr, errLockChanged) && !os.IsNotExist(rerr) {
+				return nil, rerr
+			}
+		}
+	}
+	if errors.Is(err, os.ErrExist) {
+		return nil, &os.PathError{Op: "lock", Path: path, Err: ErrLocked}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// create creates the lock file exclusively.
+func (l *FileLock) create() error {
+	f, err := l.fs.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(l.token)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = l.fs.Remove(l.path)
+	}
+	return err
+}
+
+// Path returns the name of the lock file.
+func (l *FileLock) Path() string {
+	return l.path
+}
+
+// change removes the lock file, or rewrites it with data if not nil, if it
+// is still the version fi holding token, failing with errLockChanged
+// otherwise.
+func (l *FileLock) change(fi os.FileInfo, token, data []byte) error {
+	if cfs, ok := l.fs.(conditionalFs); ok {
+		current, err := ReadFile(l.fs, l.path)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, token) {
+			return errLockChanged
+		}
+		if data == nil {
+			return cfs.removeIfUnchanged(l.path, fi)
+		}
+		return cfs.writeIfUnchanged(l.path, fi, data)
+	}
+
+	guard := l.path + ".guard-" + string(token)
+	if err := l.guard(guard); err != nil {
+		return err
+	}
+	defer func() { _ = l.fs.Remove(guard) }()
+	seen, err := l.fs.Stat(l.path)
+	if err != nil {
+		return err
+	}
+	if !seen.ModTime().Equal(fi.ModTime()) || seen.Size() != fi.Size() {
+		return errLockChanged
+	}
+	current, err := ReadFile(l.fs, l.path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, token) {
+		return errLockChanged
+	}
+	if data == nil {
+		return l.fs.Remove(l.path)
+	}
+	return WriteFile(l.fs, l.path, data, 0600)
+}
+
+// guard creates the guard file exclusively, failing with errLockChanged if
+// another change holds it. The guard files not modified for ttl are taken
+// for those of owners which crashed while changing the lock file and
+// removed.
+func (l *FileLock) guard(guard string) error {
+	for retried := false; ; retried = true {
+		f, err := l.fs.OpenFile(guard, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			return f.Close()
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return err
+		}
+		fi, serr := l.fs.Stat(guard)
+		if retried || l.ttl <= 0 || serr != nil || time.Since(fi.ModTime()) <= l.ttl {
+			return errLockChanged
+		}
+		_ = l.fs.Remove(guard)
+	}
+}
+
+// changeOwned removes the lock file, or rewrites it with our token, if it
+// is still ours, failing with an ErrLockLost error otherwise.
+func (l *FileLock) changeOwned(op string, remove bool) error {
+	fi, err := l.fs.Stat(l.path)
+	if err == nil {
+		var data []byte
+		if !remove {
+			data = l.token
+		}
+		err = l.change(fi, l.token, data)
+	}
+	if os.IsNotExist(err) || errors.Is(err, errLockChanged) {
+		return &os.PathError{Op: op, Path: l.path, Err: ErrLockLost}
+	}
+	return err
+}
+
+// Refresh rewrites the lock file, so that it isn't taken for stale. It
+// fails with ErrLockLost if the lock was taken over.
+func (l *FileLock) Refresh() error {
+	return l.changeOwned("refresh", false)
+}
+
+// Unlock releases the lock, removing the lock file. It fails with
+// ErrLockLost if the lock was taken over, leaving the lock file of its new
+// owner.
+func (l *FileLock) Unlock() error {
+	return l.changeOwned("unlock", true)
+}
@@ -0,0 +1,105 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	fs := NewMemMapFs()
+	lock, err := LockFile(fs, "/out/.lock", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LockFile(fs, "/out/.lock", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Fatalf("was expecting ErrLocked, got %v", err)
+	}
+	if err := lock.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stale locks are taken over, their previous owners losing them
+	old := time.Now().Add(-2 * time.Minute)
+	if err := fs.Chtimes("/out/.lock", old, old); err != nil {
+		t.Fatal(err)
+	}
+	taken, err := LockFile(fs, "/out/.lock", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lock.Refresh(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("was expecting ErrLockLost, got %v", err)
+	}
+	if err := lock.Unlock(); !errors.Is(err, ErrLockLost) {
+		t.Fatalf("was expecting ErrLockLost, got %v", err)
+	}
+	if err := taken.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(fs, "/out/.lock"); exists {
+		t.Fatal("was expecting the lock file removed")
+	}
+}
+
+// slowStatFs delays the calls to Stat, widening the races of the
+// contenders of a lock.
+type slowStatFs struct {
+	Fs
+}
+
+func (s slowStatFs) Stat(name string) (os.FileInfo, error) {
+	fi, err := s.Fs.Stat(name)
+	time.Sleep(time.Millisecond)
+	return fi, err
+}
+
+func TestLockFileConcurrentTakeover(t *testing.T) {
+	fs := slowStatFs{NewMemMapFs()}
+	old := time.Now().Add(-2 * time.Minute)
+	for i := 0; i < 20; i++ {
+		stale, err := LockFile(fs, "/out/.lock", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.Chtimes("/out/.lock", old, old); err != nil {
+			t.Fatal(err)
+		}
+
+		// Only one of the contenders takes over the stale lock
+		locks := make(chan *FileLock, 8)
+		var wg sync.WaitGroup
+		for j := 0; j < cap(locks); j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lock, err := LockFile(fs, "/out/.lock", time.Minute)
+				if err == nil {
+					locks <- lock
+				} else if !errors.Is(err, ErrLocked) {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+		close(locks)
+		if len(locks) != 1 {
+			t.Fatalf("was expecting a single owner, got %d", len(locks))
+		}
+		if err := stale.Unlock(); !errors.Is(err, ErrLockLost) {
+			t.Fatalf("was expecting ErrLockLost, got %v", err)
+		}
+		if err := (<-locks).Unlock(); err != nil {
+			t.Fatal(err)
+		}
+		names, err := ReadDir(fs, "/out")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(names) != 0 {
+			t.Fatalf("was expecting no lock or guard file left, got %d", len(names))
+		}
+	}
+}
@@ -47,6 +47,11 @@ func TestLstatIfPossible(t *testing.T) {
 	basePathFsMem := &BasePathFs{source: memFs, path: memWorkDir}
 	roFs := &ReadOnlyFs{source: osFs}
 	roFsMem := &ReadOnlyFs{source: memFs}
+	bufferFs := &BufferFs{base: osFs, layer: NewMemMapFs()}
+	sizeCacheFs, err := NewSizeCacheFS(osFs, NewMemMapFs(), 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	pathFileMem := filepath.Join(memWorkDir, "aferom.txt")
 
@@ -99,4 +104,6 @@ func TestLstatIfPossible(t *testing.T) {
 	testLstat(basePathFsMem, "aferom.txt", "")
 	testLstat(roFs, pathFile, pathSymlink)
 	testLstat(roFsMem, pathFileMem, "")
+	testLstat(bufferFs, pathFile, pathSymlink)
+	testLstat(sizeCacheFs, pathFile, pathSymlink)
 }
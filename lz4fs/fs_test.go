@@ -0,0 +1,62 @@
+package lz4fs
+
+import (
+	"bytes"
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+	"github.com/pierrec/lz4/v4"
+	"os"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	tests.TestWriteFile(t, NewFs(fs, lz4.Level1), "file.txt", 1000)
+}
+
+func TestAppend(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	cfs := NewFs(fs, lz4.Level1)
+	content := bytes.Repeat([]byte("content"), 100)
+	if err := kafero.WriteFile(cfs, "dir/file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := cfs.OpenFile("dir/file.bin", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("dir/file.bin"); err != nil || fi.Size() >= int64(2*len(content)) {
+		t.Fatalf("was expecting the file compressed, got %v, %v", fi, err)
+	}
+
+	if fi, err := cfs.Stat("dir/file.bin"); err != nil || fi.Size() != int64(2*len(content)) {
+		t.Fatalf("was expecting the uncompressed size, got %v, %v", fi, err)
+	}
+	data, err := kafero.ReadFile(cfs, "dir/file.bin")
+	if err != nil || !bytes.Equal(data, append(content, content...)) {
+		t.Fatalf("was expecting the content twice, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestCompressOnly(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	cfs := NewFs(fs, lz4.Fast, CompressOnly("*.bin"), Concurrency(2))
+	for _, name := range []string{"file.bin", "meta.json"} {
+		if err := kafero.WriteFile(cfs, name, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := kafero.ReadFile(cfs, name)
+		if err != nil || string(data) != "content" {
+			t.Fatalf("was expecting content in %s, got %q, %v", name, data, err)
+		}
+	}
+	if data, err := kafero.ReadFile(fs, "meta.json"); err != nil || string(data) != "content" {
+		t.Fatalf("was expecting meta.json uncompressed, got %q, %v", data, err)
+	}
+}
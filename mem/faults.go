@@ -0,0 +1,100 @@
+package mem
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Faults simulates error conditions on the files sharing it: a full
+// filesystem, failing paths and short writes. The zero value simulates
+// nothing, and a nil *Faults is valid and simulates nothing.
+type Faults struct {
+	mu         sync.Mutex
+	limited    bool
+	space      int64
+	paths      map[string]bool
+	shortWrite int
+}
+
+// SetSpace makes the writes fail with ENOSPC once n more bytes have been
+// written, the bytes which fit being written. A negative n removes the
+// limit.
+func (f *Faults) SetSpace(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limited = n >= 0
+	f.space = n
+}
+
+// FailPath makes the reads and writes of the file at path, and its
+// opening, fail with EIO, until HealPath is called.
+func (f *Faults) FailPath(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.paths == nil {
+		f.paths = make(map[string]bool)
+	}
+	f.paths[filepath.Clean(path)] = true
+}
+
+// HealPath stops the failures of the file at path.
+func (f *Faults) HealPath(path string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.paths, filepath.Clean(path))
+}
+
+// SetShortWrites makes the writes write at most n bytes, and return
+// io.ErrShortWrite for the rest. A n of 0 disables the short writes.
+func (f *Faults) SetShortWrites(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shortWrite = n
+}
+
+// Check returns an EIO error if the operations on the file at path fail.
+func (f *Faults) Check(op, path string) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.paths[path] {
+		return &os.PathError{Op: op, Path: path, Err: syscall.EIO}
+	}
+	return nil
+}
+
+// write returns how many of n bytes can be written to the file at path, and
+// the error returned for the others.
+func (f *Faults) write(path string, n int) (int, error) {
+	if f == nil {
+		return n, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.paths[path] {
+		return 0, &os.PathError{Op: "write", Path: path, Err: syscall.EIO}
+	}
+	var err error
+	if f.shortWrite > 0 && n > f.shortWrite {
+		n, err = f.shortWrite, io.ErrShortWrite
+	}
+	if f.limited && int64(n) > f.space {
+		n, err = int(f.space), &os.PathError{Op: "write", Path: path, Err: syscall.ENOSPC}
+	}
+	if f.limited {
+		f.space -= int64(n)
+	}
+	return n, err
+}
+
+// SetFaults makes the file simulate the error conditions of faults.
+func SetFaults(f *FileData, faults *Faults) {
+	f.Lock()
+	f.faults = faults
+	f.Unlock()
+}
@@ -15,7 +15,7 @@
 package mem
 
 import (
-	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"io"
@@ -23,19 +23,26 @@ import (
 	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"syscall"
 )
 
 import "time"
 
 const FilePathSeparator = string(filepath.Separator)
 
+// File is a handle on the FileData of a MemMapFs. Each handle has its own
+// cursor, used by Read, Write and Seek. ReadAt and WriteAt don't use it,
+// and, as all the operations, are safe for concurrent use.
 type File struct {
 	// atomic requires 64-bit alignment for struct field access
 	at           int64
 	readDirCount int64
 	closed       bool
 	readOnly     bool
-	fileData     *FileData
+	// Whether the writes move the cursor to the end of the data first,
+	// as with O_APPEND
+	append   bool
+	fileData *FileData
 }
 
 func NewFileHandle(data *FileData) *File {
@@ -46,6 +53,21 @@ func NewReadOnlyFileHandle(data *FileData) *File {
 	return &File{fileData: data, readOnly: true}
 }
 
+// NewAppendFileHandle returns a handle writing at the end of the data
+// whatever its cursor, as the files opened with O_APPEND.
+func NewAppendFileHandle(data *FileData) *File {
+	return &File{fileData: data, append: true}
+}
+
+// writeOffset returns the offset of the next write of the handle. Must be
+// called with the data locked.
+func (f *File) writeOffset() int64 {
+	if f.append {
+		return f.fileData.content.size
+	}
+	return atomic.LoadInt64(&f.at)
+}
+
 func (f File) Data() *FileData {
 	return f.fileData
 }
@@ -53,11 +75,29 @@ func (f File) Data() *FileData {
 type FileData struct {
 	sync.Mutex
 	name    string
-	data    []byte
+	content pages
 	memDir  Dir
 	dir     bool
 	mode    os.FileMode
 	modtime time.Time
+	clock   Clock
+	faults  *Faults
+	// The identifier of the file, generated when first requested
+	id string
+}
+
+// A Clock tells the modification times of the files.
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the time of the clock of the file, the system time if it
+// has none.
+func (d *FileData) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+	return d.clock.Now()
 }
 
 func (d *FileData) Name() string {
@@ -67,11 +107,27 @@ func (d *FileData) Name() string {
 }
 
 func CreateFile(name string) *FileData {
-	return &FileData{name: name, mode: os.ModeTemporary, modtime: time.Now()}
+	return CreateFileWithClock(name, nil)
+}
+
+// CreateFileWithClock creates a file whose modification times are told by
+// clock.
+func CreateFileWithClock(name string, clock Clock) *FileData {
+	f := &FileData{name: name, mode: os.ModeTemporary, clock: clock}
+	f.modtime = f.now()
+	return f
 }
 
 func CreateDir(name string) *FileData {
-	return &FileData{name: name, memDir: &DirMap{}, dir: true}
+	return CreateDirWithClock(name, nil)
+}
+
+// CreateDirWithClock creates a directory whose modification time is told
+// by clock.
+func CreateDirWithClock(name string, clock Clock) *FileData {
+	d := &FileData{name: name, memDir: &DirMap{}, dir: true, mode: os.ModeDir, clock: clock}
+	d.modtime = d.now()
+	return d
 }
 
 func ChangeFileName(f *FileData, newname string) {
@@ -96,6 +152,31 @@ func setModTime(f *FileData, mtime time.Time) {
 	f.modtime = mtime
 }
 
+// GetFileID returns the identifier of the file, a random UUID kept through
+// renames.
+func GetFileID(f *FileData) string {
+	f.Lock()
+	defer f.Unlock()
+	if f.id == "" {
+		var b [16]byte
+		_, _ = rand.Read(b[:])
+		// Version 4, variant RFC 4122
+		b[6] = b[6]&0x0f | 0x40
+		b[8] = b[8]&0x3f | 0x80
+		f.id = fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+	}
+	return f.id
+}
+
+// SetPageSize sets the size of the pages storing the content of the file,
+// DefaultPageSize by default. The larger pages suit the files read and
+// written in large chunks, the smaller ones the sparse files.
+func SetPageSize(f *FileData, size int) {
+	f.Lock()
+	f.content.setPageSize(size)
+	f.Unlock()
+}
+
 func GetFileInfo(f *FileData) *FileInfo {
 	return &FileInfo{f}
 }
@@ -113,7 +194,7 @@ func (f *File) Close() error {
 	f.fileData.Lock()
 	f.closed = true
 	if !f.readOnly {
-		setModTime(f.fileData, time.Now())
+		setModTime(f.fileData, f.fileData.now())
 	}
 	f.fileData.Unlock()
 	return nil
@@ -177,112 +258,233 @@ func (f *File) Read(b []byte) (n int, err error) {
 	if f.closed == true {
 		return 0, ErrFileClosed
 	}
-	if len(b) > 0 && int(f.at) == len(f.fileData.data) {
+	if err := f.fileData.faults.Check("read", f.fileData.name); err != nil {
+		return 0, err
+	}
+	cur := atomic.LoadInt64(&f.at)
+	if len(b) > 0 && cur == f.fileData.content.size {
 		return 0, io.EOF
 	}
-	if int(f.at) > len(f.fileData.data) {
+	if cur > f.fileData.content.size {
 		return 0, io.ErrUnexpectedEOF
 	}
-	if len(f.fileData.data)-int(f.at) >= len(b) {
-		n = len(b)
-	} else {
-		n = len(f.fileData.data) - int(f.at)
-	}
-	copy(b, f.fileData.data[f.at:f.at+int64(n)])
-	atomic.AddInt64(&f.at, int64(n))
+	n = f.fileData.content.readAt(b, cur)
+	atomic.StoreInt64(&f.at, cur+int64(n))
 	return
 }
 
+// ReadAt doesn't use nor move the cursor of the handle.
 func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
-	atomic.StoreInt64(&f.at, off)
-	return f.Read(b)
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed == true {
+		return 0, ErrFileClosed
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	if err := f.fileData.faults.Check("readat", f.fileData.name); err != nil {
+		return 0, err
+	}
+	if off >= f.fileData.content.size {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n = f.fileData.content.readAt(b, off)
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+// readOnlyError returns the error of the operation op on a handle opened
+// read only, wrapping os.ErrPermission as kafero.ErrReadOnlyHandle, which
+// this package can't import.
+func (f *File) readOnlyError(op string) error {
+	return &os.PathError{Op: op, Path: f.fileData.name, Err: os.ErrPermission}
 }
 
 func (f *File) Truncate(size int64) error {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
 	if f.closed == true {
 		return ErrFileClosed
 	}
 	if f.readOnly {
-		return &os.PathError{Op: "truncate", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+		return f.readOnlyError("truncate")
 	}
 	if size < 0 {
 		return ErrOutOfRange
 	}
-	if size > int64(len(f.fileData.data)) {
-		diff := size - int64(len(f.fileData.data))
-		f.fileData.data = append(f.fileData.data, bytes.Repeat([]byte{00}, int(diff))...)
-	} else {
-		f.fileData.data = f.fileData.data[0:size]
+	if err := f.fileData.faults.Check("truncate", f.fileData.name); err != nil {
+		return err
 	}
-	setModTime(f.fileData, time.Now())
+	f.fileData.content.truncate(size)
+	setModTime(f.fileData, f.fileData.now())
 	return nil
 }
 
 func (f *File) Seek(offset int64, whence int) (int64, error) {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
 	if f.closed == true {
 		return 0, ErrFileClosed
 	}
+	// Invalid seeks fail as with os.File, and kafero.SeekOffset
 	switch whence {
-	case 0:
-		atomic.StoreInt64(&f.at, offset)
-	case 1:
-		atomic.AddInt64(&f.at, int64(offset))
-	case 2:
-		atomic.StoreInt64(&f.at, int64(len(f.fileData.data))+offset)
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += atomic.LoadInt64(&f.at)
+	case io.SeekEnd:
+		offset += f.fileData.content.size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.fileData.name, Err: syscall.EINVAL}
 	}
-	return f.at, nil
+	atomic.StoreInt64(&f.at, offset)
+	return offset, nil
+}
+
+// writeAt writes b at off, the gap after the end of the data being filled
+// with zeros. Must be called with the data locked.
+func (f *File) writeAt(b []byte, off int64) {
+	f.fileData.content.writeAt(b, off)
+	setModTime(f.fileData, f.fileData.now())
 }
 
 func (f *File) Write(b []byte) (n int, err error) {
 	if f.readOnly {
-		return 0, &os.PathError{Op: "write", Path: f.fileData.name, Err: errors.New("file handle is read only")}
+		return 0, f.readOnlyError("write")
 	}
-	n = len(b)
-	cur := atomic.LoadInt64(&f.at)
 	f.fileData.Lock()
 	defer f.fileData.Unlock()
-	diff := cur - int64(len(f.fileData.data))
-	var tail []byte
-	if n+int(cur) < len(f.fileData.data) {
-		tail = f.fileData.data[n+int(cur):]
-	}
-	if diff > 0 {
-		f.fileData.data = append(bytes.Repeat([]byte{00}, int(diff)), b...)
-		f.fileData.data = append(f.fileData.data, tail...)
-	} else {
-		f.fileData.data = append(f.fileData.data[:cur], b...)
-		f.fileData.data = append(f.fileData.data, tail...)
+	n, err = f.fileData.faults.write(f.fileData.name, len(b))
+	cur := f.writeOffset()
+	if n > 0 || err == nil {
+		f.writeAt(b[:n], cur)
 	}
-	setModTime(f.fileData, time.Now())
-
-	atomic.StoreInt64(&f.at, int64(len(f.fileData.data)))
-	return
+	atomic.StoreInt64(&f.at, cur+int64(n))
+	return n, err
 }
 
+// WriteAt doesn't use nor move the cursor of the handle.
 func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
-	atomic.StoreInt64(&f.at, off)
-	return f.Write(b)
+	if f.readOnly {
+		return 0, f.readOnlyError("write")
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	n, err = f.fileData.faults.write(f.fileData.name, len(b))
+	if n > 0 || err == nil {
+		f.writeAt(b[:n], off)
+	}
+	return n, err
 }
 
+// WriteString writes s without converting it to a byte slice first.
 func (f *File) WriteString(s string) (ret int, err error) {
-	return f.Write([]byte(s))
+	if f.readOnly {
+		return 0, f.readOnlyError("write")
+	}
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	n, err := f.fileData.faults.write(f.fileData.name, len(s))
+	cur := f.writeOffset()
+	if n > 0 || err == nil {
+		f.fileData.content.writeStringAt(s[:n], cur)
+		setModTime(f.fileData, f.fileData.now())
+	}
+	atomic.StoreInt64(&f.at, cur+int64(n))
+	return n, err
+}
+
+// Peek returns the n bytes at off, fewer with io.EOF at the end of the file.
+// The bytes lying in a single page of the file are a view of the content,
+// without copy, which must not be written to. The writes to the file don't
+// show through it, so it stays a snapshot of the content, safe to read
+// while the file is written to.
+func (f *File) Peek(off int64, n int) ([]byte, error) {
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed == true {
+		return nil, ErrFileClosed
+	}
+	if off < 0 || n < 0 {
+		return nil, &os.PathError{Op: "peek", Path: f.fileData.name, Err: errors.New("negative offset")}
+	}
+	var err error
+	if rem := f.fileData.content.size - off; int64(n) > rem {
+		n, err = 0, io.EOF
+		if rem > 0 {
+			n = int(rem)
+		}
+	}
+	if b := f.fileData.content.view(off, n); b != nil {
+		return b, err
+	}
+	b := make([]byte, n)
+	f.fileData.content.readAt(b, off)
+	return b, err
+}
+
+// BytesReader returns a reader of the content of the file, independent of
+// the cursor of the handle, writing the pages of the file without copy
+// with WriteTo.
+func (f *File) BytesReader() *Reader {
+	return &Reader{data: f.fileData}
 }
 
 func (f *File) Info() *FileInfo {
 	return &FileInfo{f.fileData}
 }
 
+// CanMmap reports whether the content of the file can be mapped, that is
+// whether it isn't a directory.
 func (f *File) CanMmap() bool {
-	// TODO
-	return false
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	return !f.fileData.dir
 }
 
+// protWrite is syscall.PROT_WRITE, the same on all the unix systems.
+const protWrite = 0x2
+
+// Mmap maps the length bytes at offset read only, failing if prot includes
+// PROT_WRITE, the writes to the mapping not reaching the file. As Peek, it
+// returns a view of the content without copy when it lies in a single
+// page, a copy else, which stays a snapshot of the content whatever is
+// written to the file afterwards.
 func (f *File) Mmap(offset int64, length int, prot int, flags int) ([]byte, error) {
-	return nil, fmt.Errorf("mmap not supported")
+	if prot&protWrite != 0 {
+		return nil, &os.PathError{Op: "mmap", Path: f.fileData.name, Err: os.ErrPermission}
+	}
+	f.fileData.Lock()
+	defer f.fileData.Unlock()
+	if f.closed == true {
+		return nil, ErrFileClosed
+	}
+	if offset < 0 || length <= 0 || offset+int64(length) > f.fileData.content.size {
+		return nil, &os.PathError{Op: "mmap", Path: f.fileData.name, Err: ErrOutOfRange}
+	}
+	if b := f.fileData.content.view(offset, length); b != nil {
+		return b, nil
+	}
+	b := make([]byte, length)
+	f.fileData.content.readAt(b, offset)
+	return b, nil
 }
 
+// Munmap does nothing, the mappings returned by Mmap being garbage
+// collected.
 func (f *File) Munmap() error {
-	return fmt.Errorf("mmap not supported")
+	return nil
 }
 
 type FileInfo struct {
@@ -319,7 +521,7 @@ func (s *FileInfo) Size() int64 {
 	}
 	s.Lock()
 	defer s.Unlock()
-	return int64(len(s.data))
+	return s.content.size
 }
 
 var (
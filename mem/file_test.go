@@ -1,6 +1,10 @@
 package mem
 
 import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 )
@@ -125,9 +129,9 @@ func TestFileDataSizeRace(t *testing.T) {
 	const someOtherDataSize = "Hello World"
 
 	d := FileData{
-		data: []byte(someData),
-		dir:  false,
+		dir: false,
 	}
+	d.content.writeAt([]byte(someData), 0)
 
 	s := FileInfo{
 		FileData: &d,
@@ -139,7 +143,7 @@ func TestFileDataSizeRace(t *testing.T) {
 
 	go func() {
 		s.Lock()
-		d.data = []byte(someOtherDataSize)
+		d.content.writeAt([]byte(someOtherDataSize), 0)
 		s.Unlock()
 	}()
 
@@ -152,3 +156,124 @@ func TestFileDataSizeRace(t *testing.T) {
 		t.Errorf("Failed to read correct value for dir, was %v", s.Size())
 	}
 }
+
+func TestPeek(t *testing.T) {
+	d := CreateFile("/file")
+	SetPageSize(d, 8)
+	f := NewFileHandle(d)
+	if _, err := f.WriteString("0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := f.Peek(2, 4)
+	if err != nil || string(b) != "2345" {
+		t.Fatalf("was expecting 2345, got %q, %v", b, err)
+	}
+	// The view is a snapshot, the write replacing its page
+	if _, err := f.WriteAt([]byte("x"), 2); err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "2345" {
+		t.Fatalf("was expecting the view unchanged, got %q", b)
+	}
+	if b, err := f.Peek(2, 4); err != nil || string(b) != "x345" {
+		t.Fatalf("was expecting x345, got %q, %v", b, err)
+	}
+	if b, err := f.Peek(6, 4); err != nil || string(b) != "6789" {
+		t.Fatalf("was expecting 6789 across pages, got %q, %v", b, err)
+	}
+	if b, err := f.Peek(14, 4); err != io.EOF || string(b) != "ef" {
+		t.Fatalf("was expecting ef and EOF, got %q, %v", b, err)
+	}
+}
+
+func TestPeekConcurrentWrites(t *testing.T) {
+	d := CreateFile("/file")
+	f := NewFileHandle(d)
+	if _, err := f.WriteString("0123456789"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			if _, err := f.WriteAt([]byte{byte(i)}, 4); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		b, err := f.Peek(0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The view doesn't change while read
+		if s := string(b); s != string(b) || s[:4] != "0123" {
+			t.Fatalf("was expecting a snapshot of 0123, got %q", s)
+		}
+	}
+	<-done
+}
+
+func TestMmap(t *testing.T) {
+	d := CreateFile("/file")
+	SetPageSize(d, 8)
+	f := NewFileHandle(d)
+	if _, err := f.WriteString("0123456789abcdef"); err != nil {
+		t.Fatal(err)
+	}
+	if !f.CanMmap() {
+		t.Fatal("was expecting a file across pages to be mappable")
+	}
+	all, err := f.Mmap(0, 16, 0, 0)
+	if err != nil || string(all) != "0123456789abcdef" {
+		t.Fatalf("was expecting the mapped content, got %q, %v", all, err)
+	}
+	page, err := f.Mmap(0, 8, 0, 0)
+	if err != nil || string(page) != "01234567" {
+		t.Fatalf("was expecting the mapped page, got %q, %v", page, err)
+	}
+	if _, err := f.WriteAt([]byte("xy"), 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(4); err != nil {
+		t.Fatal(err)
+	}
+	if string(all) != "0123456789abcdef" || string(page) != "01234567" {
+		t.Fatalf("was expecting the mappings unchanged, got %q and %q", all, page)
+	}
+	if _, err := f.Mmap(0, 4, protWrite, 0); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error mapping for writing, got %v", err)
+	}
+	if _, err := f.Mmap(2, 8, 0, 0); err == nil {
+		t.Fatal("was expecting an error mapping past the end of the file")
+	}
+}
+
+func TestBytesReader(t *testing.T) {
+	d := CreateFile("/file")
+	SetPageSize(d, 4)
+	f := NewFileHandle(d)
+	if _, err := f.WriteAt([]byte("0123456"), 0); err != nil {
+		t.Fatal(err)
+	}
+	// A hole across pages
+	if _, err := f.WriteAt([]byte("end"), 13); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	r := f.BytesReader()
+	if _, err := r.Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.WriteTo(&buf); err != nil || n != 14 {
+		t.Fatalf("was expecting 14 bytes written, got %d, %v", n, err)
+	}
+	if buf.String() != "23456\x00\x00\x00\x00\x00\x00end" {
+		t.Fatalf("was expecting the content with zeros, got %q", buf.String())
+	}
+	data, err := ioutil.ReadAll(f.BytesReader())
+	if err != nil || string(data) != "0123456\x00\x00\x00\x00\x00\x00end" {
+		t.Fatalf("was expecting the content read, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,184 @@
+package mem
+
+// DefaultPageSize is the size of the pages storing the content of the
+// files, unless set otherwise with SetPageSize.
+const DefaultPageSize = 64 << 10
+
+// pages is the content of a file, stored in pages of pageSize bytes so
+// that growing, truncating or writing to a large file only touches the
+// pages concerned, instead of reallocating the whole content.
+//
+// The bytes of the file past the end of their page slice, up to the size
+// of the file, are zeros: the holes left by truncations and writes past
+// the end of the file aren't allocated, and the last page is only as
+// large as needed, small files staying small.
+//
+// The pages viewed without copy are shared: they are never modified
+// again, the writes to them replacing them by modified copies, so that
+// the views stay valid snapshots of the content.
+type pages struct {
+	pageSize int
+	size     int64
+	pages    [][]byte
+	shared   []bool
+}
+
+func (p *pages) psize() int64 {
+	if p.pageSize <= 0 {
+		return DefaultPageSize
+	}
+	return int64(p.pageSize)
+}
+
+// readAt copies the content at off into b, returning the number of bytes
+// copied, fewer than len(b) only at the end of the file.
+func (p *pages) readAt(b []byte, off int64) int {
+	if off >= p.size {
+		return 0
+	}
+	if rem := p.size - off; int64(len(b)) > rem {
+		b = b[:rem]
+	}
+	ps := p.psize()
+	n := 0
+	for n < len(b) {
+		i, o := (off+int64(n))/ps, (off+int64(n))%ps
+		m := len(b) - n
+		if int64(m) > ps-o {
+			m = int(ps - o)
+		}
+		dst := b[n : n+m]
+		var page []byte
+		if i < int64(len(p.pages)) {
+			page = p.pages[i]
+		}
+		c := 0
+		if o < int64(len(page)) {
+			c = copy(dst, page[o:])
+		}
+		for j := c; j < m; j++ {
+			dst[j] = 0
+		}
+		n += m
+	}
+	return n
+}
+
+// writeAt writes b at off, the file growing as needed.
+func (p *pages) writeAt(b []byte, off int64) {
+	p.write(off, len(b), func(dst []byte, n int) {
+		copy(dst, b[n:])
+	})
+}
+
+// writeStringAt writes s at off, without converting it to a byte slice.
+func (p *pages) writeStringAt(s string, off int64) {
+	p.write(off, len(s), func(dst []byte, n int) {
+		copy(dst, s[n:])
+	})
+}
+
+// write writes size bytes at off, fill copying into each page the bytes
+// from the nth on.
+func (p *pages) write(off int64, size int, fill func(dst []byte, n int)) {
+	ps := p.psize()
+	n := 0
+	for n < size {
+		i, o := (off+int64(n))/ps, (off+int64(n))%ps
+		m := size - n
+		if int64(m) > ps-o {
+			m = int(ps - o)
+		}
+		for int64(len(p.pages)) <= i {
+			p.pages = append(p.pages, nil)
+			p.shared = append(p.shared, false)
+		}
+		page := p.pages[i]
+		if p.shared[i] {
+			page = append(make([]byte, 0, len(page)), page...)
+			p.shared[i] = false
+		}
+		page = p.grow(page, int(o)+m)
+		fill(page[o:int(o)+m], n)
+		p.pages[i] = page
+		n += m
+	}
+	if end := off + int64(size); end > p.size {
+		p.size = end
+	}
+}
+
+// view returns the content of the n bytes at off without copy if they lie
+// in an allocated page, else nil. The page is shared from then on.
+func (p *pages) view(off int64, n int) []byte {
+	ps := p.psize()
+	i, o := off/ps, off%ps
+	if n == 0 || o+int64(n) > ps || i >= int64(len(p.pages)) || o+int64(n) > int64(len(p.pages[i])) {
+		return nil
+	}
+	p.shared[i] = true
+	return p.pages[i][o : int(o)+n : int(o)+n]
+}
+
+// grow returns page extended to at least size bytes, the bytes added being
+// zeros.
+func (p *pages) grow(page []byte, size int) []byte {
+	l := len(page)
+	if size <= l {
+		return page
+	}
+	if size <= cap(page) {
+		page = page[:size]
+		for j := l; j < size; j++ {
+			page[j] = 0
+		}
+		return page
+	}
+	// Doubled up to the page size, for the small files written in small
+	// chunks not to be copied at each write
+	c := 2 * cap(page)
+	if c < size {
+		c = size
+	}
+	if int64(c) > p.psize() {
+		c = int(p.psize())
+	}
+	grown := make([]byte, size, c)
+	copy(grown, page)
+	return grown
+}
+
+// truncate changes the size of the file, the pages past the end being
+// released.
+func (p *pages) truncate(size int64) {
+	if size < p.size {
+		ps := p.psize()
+		last := (size + ps - 1) / ps
+		if last < int64(len(p.pages)) {
+			for i := last; i < int64(len(p.pages)); i++ {
+				p.pages[i] = nil
+			}
+			p.pages = p.pages[:last]
+			p.shared = p.shared[:last]
+		}
+		// The bytes past the new end are zeros when the file grows again
+		if i, o := size/ps, size%ps; o > 0 && i < int64(len(p.pages)) && o < int64(len(p.pages[i])) {
+			p.pages[i] = p.pages[i][:o]
+		}
+	}
+	p.size = size
+}
+
+// setPageSize stores the content in pages of size bytes.
+func (p *pages) setPageSize(size int) {
+	if p.size == 0 {
+		p.pageSize = size
+		p.pages = nil
+		p.shared = nil
+		return
+	}
+	b := make([]byte, p.size)
+	p.readAt(b, 0)
+	*p = pages{pageSize: size}
+	p.writeAt(b, 0)
+}
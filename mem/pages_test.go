@@ -0,0 +1,110 @@
+package mem
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestPages(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	p := pages{pageSize: 7}
+	var model []byte
+	for i := 0; i < 2000; i++ {
+		switch rng.Intn(3) {
+		case 0:
+			b := make([]byte, rng.Intn(20))
+			rng.Read(b)
+			off := int64(rng.Intn(60))
+			p.writeAt(b, off)
+			if end := int(off) + len(b); end > len(model) {
+				model = append(model, make([]byte, end-len(model))...)
+			}
+			copy(model[off:], b)
+		case 1:
+			size := int64(rng.Intn(60))
+			p.truncate(size)
+			if int(size) > len(model) {
+				model = append(model, make([]byte, int(size)-len(model))...)
+			} else {
+				model = model[:size]
+			}
+		case 2:
+			if i%50 == 0 {
+				p.setPageSize(1 + rng.Intn(10))
+			}
+		}
+		if p.size != int64(len(model)) {
+			t.Fatalf("was expecting size %d, got %d", len(model), p.size)
+		}
+		b := make([]byte, len(model)+5)
+		if n := p.readAt(b, 0); n != len(model) || !bytes.Equal(b[:n], model) {
+			t.Fatalf("was expecting %v, got %v", model, b[:n])
+		}
+		off := rng.Intn(len(model) + 1)
+		if n := p.readAt(b[:3], int64(off)); !bytes.Equal(b[:n], model[off:off+n]) {
+			t.Fatalf("was expecting %v at %d, got %v", model[off:off+n], off, b[:n])
+		}
+	}
+}
+
+func TestPagesSparse(t *testing.T) {
+	p := pages{}
+	p.truncate(1 << 34)
+	p.writeAt([]byte("end"), 1<<34-3)
+	if len(p.pages[len(p.pages)-1]) == 0 {
+		t.Fatal("was expecting the last page to be allocated")
+	}
+	allocated := 0
+	for _, page := range p.pages {
+		if page != nil {
+			allocated++
+		}
+	}
+	if allocated != 1 {
+		t.Fatalf("was expecting a single page allocated, got %d", allocated)
+	}
+	b := make([]byte, 8)
+	if n := p.readAt(b, 1<<34-8); n != 8 || string(b) != "\x00\x00\x00\x00\x00end" {
+		t.Fatalf("was expecting the end of the file, got %q", b[:n])
+	}
+}
+
+func BenchmarkWriteAtLargeFile(b *testing.B) {
+	for _, bc := range []struct {
+		name     string
+		pageSize int
+	}{{"4KiB", 4 << 10}, {"64KiB", 64 << 10}, {"1MiB", 1 << 20}} {
+		b.Run(bc.name, func(b *testing.B) {
+			d := CreateFile("/file")
+			SetPageSize(d, bc.pageSize)
+			f := NewFileHandle(d)
+			chunk := make([]byte, 32<<10)
+			b.SetBytes(int64(len(chunk)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := f.WriteAt(chunk, int64(i%(1<<15))*int64(len(chunk))); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkTruncateLargeFile(b *testing.B) {
+	d := CreateFile("/file")
+	f := NewFileHandle(d)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		// Grows to 4GiB and back, a page at the end being written
+		if err := f.Truncate(4 << 30); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte("end"), 4<<30-3); err != nil {
+			b.Fatal(err)
+		}
+		if err := f.Truncate(1 << 20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
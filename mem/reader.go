@@ -0,0 +1,109 @@
+package mem
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// A Reader reads the content of a file from its own offset, as returned by
+// File.BytesReader.
+type Reader struct {
+	data *FileData
+	off  int64
+}
+
+func (r *Reader) Read(b []byte) (int, error) {
+	n, err := r.ReadAt(b, r.off)
+	r.off += int64(n)
+	return n, err
+}
+
+func (r *Reader) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: r.data.Name(), Err: errors.New("negative offset")}
+	}
+	r.data.Lock()
+	defer r.data.Unlock()
+	if off >= r.data.content.size {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	n := r.data.content.readAt(b, off)
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.Size()
+	default:
+		return 0, errors.New("mem.Reader.Seek: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("mem.Reader.Seek: negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// Size returns the size of the file.
+func (r *Reader) Size() int64 {
+	r.data.Lock()
+	defer r.data.Unlock()
+	return r.data.content.size
+}
+
+// WriteTo writes the rest of the content to w, the pages being written
+// without copy, shared as the views of Peek so that the file can be
+// written to meanwhile.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	var zeros []byte
+	for {
+		r.data.Lock()
+		p := &r.data.content
+		if r.off >= p.size {
+			r.data.Unlock()
+			return written, nil
+		}
+		ps := p.psize()
+		i, o := r.off/ps, r.off%ps
+		end := ps
+		if rem := p.size - i*ps; rem < end {
+			end = rem
+		}
+		var b []byte
+		if i < int64(len(p.pages)) && o < int64(len(p.pages[i])) {
+			b = p.pages[i][o:]
+			if int64(len(b)) > end-o {
+				b = b[:end-o]
+			}
+			p.shared[i] = true
+		} else {
+			// A hole, up to the end of the page or of the file
+			if zeros == nil {
+				zeros = make([]byte, ps)
+			}
+			b = zeros[:end-o]
+		}
+		r.data.Unlock()
+		n, err := w.Write(b)
+		written += int64(n)
+		r.off += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if n < len(b) {
+			return written, io.ErrShortWrite
+		}
+	}
+}
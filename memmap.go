@@ -19,39 +19,93 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/melaurent/kafero/mem"
 )
 
+var (
+	_ ReadDirer = (*MemMapFs)(nil)
+	_ FileIDer  = (*MemMapFs)(nil)
+)
+
+// The MemMapFs is a filesystem held in memory. As on POSIX systems, the
+// handles of a file removed or renamed keep working on its content: the
+// writes through the handles of a removed file are lost once closed, and
+// the handles of a renamed file write to it under its new name.
 type MemMapFs struct {
-	mu   sync.RWMutex
-	data map[string]*mem.FileData
-	init sync.Once
+	mu     sync.RWMutex
+	data   map[string]*mem.FileData
+	init   sync.Once
+	clock  Clock
+	faults *mem.Faults
+	// Size of the pages of the files created, mem.DefaultPageSize if 0
+	pageSize int
 }
 
 func NewMemMapFs() Fs {
 	return &MemMapFs{}
 }
 
+// NewMemMapFsWithClock returns a MemMapFs whose modification times are told
+// by clock.
+func NewMemMapFsWithClock(clock Clock) Fs {
+	return &MemMapFs{clock: clock}
+}
+
 func (m *MemMapFs) getData() map[string]*mem.FileData {
 	m.init.Do(func() {
 		m.data = make(map[string]*mem.FileData)
 		// Root should always exist, right?
 		// TODO: what about windows?
-		m.data[FilePathSeparator] = mem.CreateDir(FilePathSeparator)
+		m.data[FilePathSeparator] = mem.CreateDirWithClock(FilePathSeparator, m.clock)
+		m.faults = &mem.Faults{}
 	})
 	return m.data
 }
 
+// Faults returns the error conditions simulated by the files of the
+// MemMapFs, such as a full filesystem, to test the error handling of the
+// code using it.
+func (m *MemMapFs) Faults() *mem.Faults {
+	m.getData()
+	return m.faults
+}
+
+// SetPageSize sets the size of the pages storing the content of the files
+// created afterwards, mem.DefaultPageSize by default. The files are grown,
+// truncated and written to a page at a time, so that the operations on the
+// huge files only cost the pages touched.
+func (m *MemMapFs) SetPageSize(size int) {
+	m.mu.Lock()
+	m.pageSize = size
+	m.mu.Unlock()
+}
+
 func (*MemMapFs) Name() string { return "MemMapFS" }
 
+func (m *MemMapFs) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
 func (m *MemMapFs) Create(name string) (File, error) {
 	name = NormalizePath(name)
+	if err := m.Faults().Check("open", name); err != nil {
+		return nil, err
+	}
 	m.mu.Lock()
-	file := mem.CreateFile(name)
+	file := mem.CreateFileWithClock(name, m.clock)
+	mem.SetFaults(file, m.faults)
+	if m.pageSize > 0 {
+		mem.SetPageSize(file, m.pageSize)
+	}
 	m.getData()[name] = file
 	m.registerWithParent(file)
 	m.mu.Unlock()
@@ -119,7 +173,8 @@ func (m *MemMapFs) lockfreeMkdir(name string, perm os.FileMode) error {
 			return ErrFileExists
 		}
 	} else {
-		item := mem.CreateDir(name)
+		item := mem.CreateDirWithClock(name, m.clock)
+		mem.SetMode(item, perm|os.ModeDir)
 		m.getData()[name] = item
 		m.registerWithParent(item)
 	}
@@ -137,12 +192,12 @@ func (m *MemMapFs) Mkdir(name string, perm os.FileMode) error {
 	}
 
 	m.mu.Lock()
-	item := mem.CreateDir(name)
+	item := mem.CreateDirWithClock(name, m.clock)
 	m.getData()[name] = item
 	m.registerWithParent(item)
 	m.mu.Unlock()
 
-	m.Chmod(name, perm|os.ModeDir)
+	m.setFileMode(name, perm|os.ModeDir)
 
 	return nil
 }
@@ -151,6 +206,9 @@ func (m *MemMapFs) MkdirAll(path string, perm os.FileMode) error {
 	err := m.Mkdir(path, perm)
 	if err != nil {
 		if err.(*os.PathError).Err == ErrFileExists {
+			if info, err := m.Stat(path); err == nil && !info.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: path, Err: syscall.ENOTDIR}
+			}
 			return nil
 		}
 		return err
@@ -197,6 +255,9 @@ func (m *MemMapFs) open(name string) (*mem.FileData, error) {
 	if !ok {
 		return nil, &os.PathError{Op: "open", Path: name, Err: ErrFileNotFound}
 	}
+	if err := m.faults.Check("open", name); err != nil {
+		return nil, err
+	}
 	return f, nil
 }
 
@@ -225,29 +286,36 @@ func (m *MemMapFs) OpenFile(name string, flag int, perm os.FileMode) (File, erro
 		// Error
 		return nil, err
 	} else if (flag&os.O_CREATE != 0) && (flag&os.O_EXCL != 0) {
-		// Exists but exclusive create so error
-		file.Close()
-		return nil, os.ErrExist
+		// Exists but exclusive create so error, the handle dropped without
+		// closing it, which would touch the modification time
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
 	}
-	if flag == os.O_RDONLY {
+	if flag&(os.O_RDWR|os.O_WRONLY) == 0 {
 		file = mem.NewReadOnlyFileHandle(file.(*mem.File).Data())
+	} else if info, _ := file.Stat(); info.IsDir() {
+		file.Close()
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
 	}
-	if flag&os.O_APPEND > 0 {
-		_, err = file.Seek(0, io.SeekEnd)
+	// Truncate before seeking the end for O_APPEND
+	if flag&os.O_TRUNC > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 {
+		err = file.Truncate(0)
 		if err != nil {
 			file.Close()
 			return nil, err
 		}
 	}
-	if flag&os.O_TRUNC > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 {
-		err = file.Truncate(0)
+	if flag&os.O_APPEND > 0 && flag&(os.O_RDWR|os.O_WRONLY) > 0 {
+		file = mem.NewAppendFileHandle(file.(*mem.File).Data())
+	}
+	if flag&os.O_APPEND > 0 {
+		_, err = file.Seek(0, io.SeekEnd)
 		if err != nil {
 			file.Close()
 			return nil, err
 		}
 	}
 	if chmod {
-		m.Chmod(name, perm)
+		m.setFileMode(name, perm)
 	}
 	return file, nil
 }
@@ -258,7 +326,10 @@ func (m *MemMapFs) Remove(name string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if _, ok := m.getData()[name]; ok {
+	if f, ok := m.getData()[name]; ok {
+		if mem.GetFileInfo(f).IsDir() && len(m.children(name)) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
 		err := m.unRegisterWithParent(name)
 		if err != nil {
 			return &os.PathError{Op: "remove", Path: name, Err: err}
@@ -280,7 +351,7 @@ func (m *MemMapFs) RemoveAll(path string) error {
 	defer m.mu.RUnlock()
 
 	for p, _ := range m.getData() {
-		if strings.HasPrefix(p, path) {
+		if p == path || strings.HasPrefix(p, path+FilePathSeparator) {
 			m.mu.RUnlock()
 			m.mu.Lock()
 			delete(m.getData(), p)
@@ -295,29 +366,79 @@ func (m *MemMapFs) Rename(oldname, newname string) error {
 	oldname = NormalizePath(oldname)
 	newname = NormalizePath(newname)
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fileData, ok := m.getData()[oldname]
+	if !ok {
+		return &os.PathError{Op: "rename", Path: oldname, Err: ErrFileNotFound}
+	}
 	if oldname == newname {
 		return nil
 	}
+	isDir := mem.GetFileInfo(fileData).IsDir()
+	if isDir && strings.HasPrefix(newname, oldname+FilePathSeparator) {
+		return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EINVAL}
+	}
+	// As os.Rename, only replace a file by a file or an empty directory by
+	// a directory
+	if dst, ok := m.getData()[newname]; ok {
+		dstInfo := mem.GetFileInfo(dst)
+		switch {
+		case dstInfo.IsDir() && !isDir:
+			return &os.PathError{Op: "rename", Path: oldname, Err: syscall.EISDIR}
+		case !dstInfo.IsDir() && isDir:
+			return &os.PathError{Op: "rename", Path: oldname, Err: syscall.ENOTDIR}
+		case dstInfo.IsDir() && len(m.children(newname)) > 0:
+			return &os.PathError{Op: "rename", Path: oldname, Err: syscall.ENOTEMPTY}
+		}
+		m.unRegisterWithParent(newname)
+		delete(m.getData(), newname)
+	}
 
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-	if _, ok := m.getData()[oldname]; ok {
-		m.mu.RUnlock()
-		m.mu.Lock()
-		m.unRegisterWithParent(oldname)
-		fileData := m.getData()[oldname]
-		delete(m.getData(), oldname)
-		mem.ChangeFileName(fileData, newname)
-		m.getData()[newname] = fileData
-		m.registerWithParent(fileData)
-		m.mu.Unlock()
-		m.mu.RLock()
-	} else {
-		return &os.PathError{Op: "rename", Path: oldname, Err: ErrFileNotFound}
+	// The children of a directory move with it, parents first
+	var children []*mem.FileData
+	if isDir {
+		children = m.children(oldname)
+		sort.Slice(children, func(i, j int) bool {
+			return len(children[i].Name()) < len(children[j].Name())
+		})
+	}
+	for i := len(children) - 1; i >= 0; i-- {
+		m.unRegisterWithParent(children[i].Name())
+	}
+	m.unRegisterWithParent(oldname)
+	for _, f := range append([]*mem.FileData{fileData}, children...) {
+		name := f.Name()
+		delete(m.getData(), name)
+		name = newname + strings.TrimPrefix(name, oldname)
+		mem.ChangeFileName(f, name)
+		m.getData()[name] = f
+		m.registerWithParent(f)
 	}
 	return nil
 }
 
+// children returns all the files under the named directory.
+func (m *MemMapFs) children(name string) []*mem.FileData {
+	var children []*mem.FileData
+	prefix := name + FilePathSeparator
+	if name == FilePathSeparator {
+		prefix = name
+	}
+	for path, f := range m.getData() {
+		if path != name && strings.HasPrefix(path, prefix) {
+			children = append(children, f)
+		}
+	}
+	return children
+}
+
+// ReadDir lists the directory with the FileInfo of the entries, which Stat
+// also returns.
+func (m *MemMapFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ReadDir(m, dirname)
+}
+
 func (m *MemMapFs) Stat(name string) (os.FileInfo, error) {
 	f, err := m.Open(name)
 	if err != nil {
@@ -337,6 +458,27 @@ func (m *MemMapFs) Chmod(name string, mode os.FileMode) error {
 		return &os.PathError{Op: "chmod", Path: name, Err: ErrFileNotFound}
 	}
 
+	// Only the permissions change, the type of the file is kept, as with
+	// os.Chmod
+	const chmodBits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	m.mu.Lock()
+	mem.SetMode(f, mem.GetFileInfo(f).Mode()&os.ModeType|mode&chmodBits)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// setFileMode sets the whole mode of the file created, type included.
+func (m *MemMapFs) setFileMode(name string, mode os.FileMode) error {
+	name = NormalizePath(name)
+
+	m.mu.RLock()
+	f, ok := m.getData()[name]
+	m.mu.RUnlock()
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: ErrFileNotFound}
+	}
+
 	m.mu.Lock()
 	mem.SetMode(f, mode)
 	m.mu.Unlock()
@@ -354,6 +496,11 @@ func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error
 		return &os.PathError{Op: "chtimes", Path: name, Err: ErrFileNotFound}
 	}
 
+	// As os.Chtimes, a zero time leaves the time unchanged, the access
+	// time not being kept
+	if mtime.IsZero() {
+		return nil
+	}
 	m.mu.Lock()
 	mem.SetModTime(f, mtime)
 	m.mu.Unlock()
@@ -361,6 +508,18 @@ func (m *MemMapFs) Chtimes(name string, atime time.Time, mtime time.Time) error
 	return nil
 }
 
+func (m *MemMapFs) FileID(name string) (FileID, error) {
+	name = NormalizePath(name)
+
+	m.mu.RLock()
+	f, ok := m.getData()[name]
+	m.mu.RUnlock()
+	if !ok {
+		return "", &os.PathError{Op: "fileid", Path: name, Err: ErrFileNotFound}
+	}
+	return FileID(mem.GetFileID(f)), nil
+}
+
 func (m *MemMapFs) List() {
 	for _, x := range m.data {
 		y := mem.FileInfo{FileData: x}
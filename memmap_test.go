@@ -1,6 +1,7 @@
 package kafero_test
 
 import (
+	"errors"
 	"fmt"
 	"github.com/melaurent/kafero"
 	"github.com/melaurent/kafero/tests"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -457,3 +459,178 @@ func TestMemFsUnexpectedEOF(t *testing.T) {
 		t.Fatal("Expected ErrUnexpectedEOF")
 	}
 }
+
+func TestMemFsIndependentHandles(t *testing.T) {
+	t.Parallel()
+
+	fs := kafero.NewMemMapFs()
+	if err := kafero.WriteFile(fs, "file.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f1, err := fs.OpenFile("file.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+	f2, err := fs.Open("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+
+	b := make([]byte, 3)
+	if _, err := f1.Read(b); err != nil || string(b) != "012" {
+		t.Fatalf("error reading f1: %q, %v", b, err)
+	}
+	if _, err := f2.Seek(5, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	// ReadAt and WriteAt don't move the cursors
+	if _, err := f1.WriteAt([]byte("ab"), 8); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f2.ReadAt(b, 0); err != nil || string(b) != "012" {
+		t.Fatalf("error reading f2 at 0: %q, %v", b, err)
+	}
+	if _, err := f1.Read(b); err != nil || string(b) != "345" {
+		t.Fatalf("error reading f1: %q, %v", b, err)
+	}
+	if _, err := f2.Read(b); err != nil || string(b) != "567" {
+		t.Fatalf("error reading f2: %q, %v", b, err)
+	}
+	if n, err := f2.ReadAt(b, 8); n != 2 || err != io.EOF || string(b[:n]) != "ab" {
+		t.Fatalf("was expecting a short read at the end, got %d, %v", n, err)
+	}
+
+	// Concurrent ReadAt and WriteAt on distinct ranges
+	done := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			chunk := []byte(fmt.Sprintf("%02d", i))
+			if _, err := f1.WriteAt(chunk, int64(i*2)); err != nil {
+				done <- err
+				return
+			}
+			b := make([]byte, 2)
+			_, err := f2.ReadAt(b, int64(i*2))
+			if err == nil && string(b) != string(chunk) {
+				err = fmt.Errorf("was expecting %s, got %s", chunk, b)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemFsStaleHandles(t *testing.T) {
+	t.Parallel()
+
+	fs := kafero.NewMemMapFs()
+	if err := kafero.WriteFile(fs, "removed.txt", []byte("removed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(fs, "renamed.txt", []byte("renamed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := fs.OpenFile("removed.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := fs.OpenFile("renamed.txt", os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Remove("removed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("renamed.txt", "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handle of the removed file works on its content
+	b := make([]byte, 7)
+	if _, err := removed.ReadAt(b, 0); err != nil || string(b) != "removed" {
+		t.Fatalf("error reading the removed file: %q, %v", b, err)
+	}
+	if _, err := removed.Write([]byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := removed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("removed.txt"); !os.IsNotExist(err) {
+		t.Errorf("removed file re-appeared on close: %v", err)
+	}
+
+	// The handle of the renamed file writes to it under its new name
+	if _, err := renamed.Write([]byte(" then written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := renamed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat("renamed.txt"); !os.IsNotExist(err) {
+		t.Errorf("renamed file re-appeared on close: %v", err)
+	}
+	data, err := kafero.ReadFile(fs, "moved.txt")
+	if err != nil || string(data) != "renamed then written" {
+		t.Errorf("was expecting the writes in the renamed file, got %q, %v", data, err)
+	}
+}
+
+func TestMemFsFaults(t *testing.T) {
+	fs := &kafero.MemMapFs{}
+
+	// Full filesystem
+	fs.Faults().SetSpace(5)
+	f, err := fs.Create("/full")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("0123456789")); n != 5 || !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("was expecting 5 bytes written and ENOSPC, got %d, %v", n, err)
+	}
+	f.Close()
+	fs.Faults().SetSpace(-1)
+	if data, _ := kafero.ReadFile(fs, "/full"); string(data) != "01234" {
+		t.Fatalf("was expecting the bytes which fit, got %q", data)
+	}
+
+	// Short writes
+	fs.Faults().SetShortWrites(3)
+	f, err = fs.Create("/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("0123456789")); n != 3 || err != io.ErrShortWrite {
+		t.Fatalf("was expecting a short write of 3 bytes, got %d, %v", n, err)
+	}
+	f.Close()
+	fs.Faults().SetShortWrites(0)
+
+	// Failing path
+	if err := kafero.WriteFile(fs, "/eio", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = fs.Open("/eio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.Faults().FailPath("/eio")
+	if _, err := f.Read(make([]byte, 4)); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("was expecting EIO reading, got %v", err)
+	}
+	if _, err := fs.Open("/eio"); !errors.Is(err, syscall.EIO) {
+		t.Fatalf("was expecting EIO opening, got %v", err)
+	}
+	fs.Faults().HealPath("/eio")
+	if _, err := f.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
@@ -0,0 +1,161 @@
+package kafero
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Metaer is an optional interface in Kafero. It is only implemented by the
+// filesystems storing user metadata, key value pairs, along with the files,
+// as the object metadata of the GcsFs.
+type Metaer interface {
+	// GetMeta returns the metadata of the named file, empty if none.
+	GetMeta(name string) (map[string]string, error)
+	// SetMeta sets the keys of kv in the metadata of the named file, the
+	// keys with an empty value being removed.
+	SetMeta(name string, kv map[string]string) error
+}
+
+// MetaSidecarSuffix is the suffix of the sidecar files storing the metadata
+// of the files on the filesystems without metadata nor extended attributes,
+// named after the file they describe with a leading dot, as
+// .name.kafero-meta.json.
+const MetaSidecarSuffix = ".kafero-meta.json"
+
+// GetMeta returns the metadata of the named file: those of the filesystem
+// if it implements Metaer, else its "user." extended attributes, without
+// the prefix, or else those of its sidecar.
+func GetMeta(fs Fs, name string) (map[string]string, error) {
+	if mfs, ok := fs.(Metaer); ok {
+		return mfs.GetMeta(name)
+	}
+	if attrs, err := Listxattr(fs, name); !errors.Is(err, ErrXattrNotSupported) {
+		if err != nil {
+			return nil, err
+		}
+		kv := make(map[string]string)
+		for _, attr := range attrs {
+			if !strings.HasPrefix(attr, xattrUserPrefix) {
+				continue
+			}
+			value, err := Getxattr(fs, name, attr)
+			if err != nil {
+				return nil, err
+			}
+			kv[strings.TrimPrefix(attr, xattrUserPrefix)] = string(value)
+		}
+		return kv, nil
+	}
+	if _, err := fs.Stat(name); err != nil {
+		return nil, err
+	}
+	return readMetaSidecar(fs, name)
+}
+
+// SetMeta sets the keys of kv in the metadata of the named file, the keys
+// with an empty value being removed, where GetMeta reads them. The
+// sidecars are neither renamed nor removed with their files.
+func SetMeta(fs Fs, name string, kv map[string]string) error {
+	if mfs, ok := fs.(Metaer); ok {
+		return mfs.SetMeta(name, kv)
+	}
+	if _, err := Listxattr(fs, name); !errors.Is(err, ErrXattrNotSupported) {
+		if err != nil {
+			return err
+		}
+		// Sorted for the updates to be reproducible
+		keys := make([]string, 0, len(kv))
+		for k := range kv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if kv[k] == "" {
+				err = Removexattr(fs, name, xattrUserPrefix+k)
+				if errors.Is(err, ErrNoAttr) {
+					err = nil
+				}
+			} else {
+				err = Setxattr(fs, name, xattrUserPrefix+k, []byte(kv[k]))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, err := fs.Stat(name); err != nil {
+		return err
+	}
+	meta, err := readMetaSidecar(fs, name)
+	if err != nil {
+		return err
+	}
+	for k, v := range kv {
+		if v == "" {
+			delete(meta, k)
+		} else {
+			meta[k] = v
+		}
+	}
+	sidecar := metaSidecarName(name)
+	if len(meta) == 0 {
+		if err := fs.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := WriteFile(fs, sidecar, data, 0644); err != nil {
+		return fmt.Errorf("error writing metadata: %v", err)
+	}
+	return nil
+}
+
+func metaSidecarName(name string) string {
+	dir, file := filepath.Split(name)
+	return filepath.Join(dir, "."+file+MetaSidecarSuffix)
+}
+
+// readMetaSidecar returns the metadata of the sidecar of name, empty if
+// there is none.
+func readMetaSidecar(fs Fs, name string) (map[string]string, error) {
+	meta := make(map[string]string)
+	sidecar := metaSidecarName(name)
+	// Most files have none, stated rather than opened
+	if _, err := fs.Stat(sidecar); os.IsNotExist(err) {
+		return meta, nil
+	}
+	data, err := ReadFile(fs, sidecar)
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata: %v", err)
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("error unmarshalling metadata: %v", err)
+	}
+	return meta, nil
+}
+
+// copyMeta copies the metadata of srcName in src, if any, to dstName in
+// dst, so that they follow the files through the caches and copies.
+func copyMeta(src Fs, srcName string, dst Fs, dstName string) error {
+	meta, err := GetMeta(src, srcName)
+	if err != nil || len(meta) == 0 {
+		return err
+	}
+	if err := SetMeta(dst, dstName, meta); err != nil {
+		return fmt.Errorf("error copying metadata: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMeta(t *testing.T) {
+	dir, err := TempDir(NewOsFs(), "", "kafero-meta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, fs := range []Fs{NewMemMapFs(), newXattrMemFs(), NewBasePathFs(NewOsFs(), dir)} {
+		if err := WriteFile(fs, "/file.txt", []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := SetMeta(fs, "/file.txt", map[string]string{"origin": "test", "job": "1"})
+		if errors.Is(err, ErrXattrNotSupported) {
+			// The temporary directory may not support them
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SetMeta(fs, "/file.txt", map[string]string{"job": "", "owner": "me"}); err != nil {
+			t.Fatal(err)
+		}
+		meta, err := GetMeta(fs, "/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[string]string{"origin": "test", "owner": "me"}
+		if !reflect.DeepEqual(meta, expected) {
+			t.Fatalf("was expecting %v on %T, got %v", expected, fs, meta)
+		}
+	}
+	if _, err := GetMeta(NewMemMapFs(), "/missing.txt"); !os.IsNotExist(err) {
+		t.Fatalf("was expecting a not exist error, got %v", err)
+	}
+
+	// The metadata follow the files through the copies and the layers
+	src := NewMemMapFs()
+	WriteFile(src, "/src/file.txt", []byte("content"), 0644)
+	if err := SetMeta(src, "/src/file.txt", map[string]string{"origin": "test"}); err != nil {
+		t.Fatal(err)
+	}
+	dst := newXattrMemFs()
+	if err := CopyDir(src, "/src", dst, "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if meta, err := GetMeta(dst, "/dst/file.txt"); err != nil || meta["origin"] != "test" {
+		t.Fatalf("was expecting the metadata to be copied, got %v, %v", meta, err)
+	}
+	layer := NewMemMapFs()
+	ufs := NewCopyOnWriteFs(dst, layer)
+	f, err := ufs.OpenFile("/dst/file.txt", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if meta, err := GetMeta(layer, "/dst/file.txt"); err != nil || meta["origin"] != "test" {
+		t.Fatalf("was expecting the metadata to be copied to the layer, got %v, %v", meta, err)
+	}
+}
@@ -0,0 +1,118 @@
+package kafero
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// The files written through the layers have the modification time of the
+// base file once closed.
+func TestModTimeOnClose(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	layers := map[string]func(base Fs) (Fs, Fs){
+		"BufferFs": func(base Fs) (Fs, Fs) {
+			return NewBufferFs(base, NewMemMapFs()), nil
+		},
+		"SizeCacheFS": func(base Fs) (Fs, Fs) {
+			cache := NewMemMapFs()
+			fs, err := NewSizeCacheFS(base, cache, 1<<20, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fs, cache
+		},
+		"CacheOnReadFs": func(base Fs) (Fs, Fs) {
+			layer := NewMemMapFs()
+			return NewCacheOnReadFs(base, layer, time.Hour), layer
+		},
+		"ReadaheadFs": func(base Fs) (Fs, Fs) {
+			return NewReadaheadFs(base, 2, 16), nil
+		},
+		"IntegrityFs": func(base Fs) (Fs, Fs) {
+			return NewIntegrityFs(base), nil
+		},
+	}
+	for name, layer := range layers {
+		clock := NewFakeClock(start)
+		base := NewMemMapFsWithClock(clock)
+		fs, cache := layer(base)
+		if err := WriteFile(fs, "/file.txt", []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+		f, err := fs.OpenFile("/file.txt", os.O_RDWR, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("updated")); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		binfo, err := base.Stat("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := fs.Stat("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(binfo.ModTime()) {
+			t.Fatalf("was expecting %v on %s, got %v", binfo.ModTime(), name, info.ModTime())
+		}
+		// The cached files must not look stale, nor fresher than the base
+		if cache != nil {
+			if cinfo, err := cache.Stat("/file.txt"); err == nil && !cinfo.ModTime().Equal(binfo.ModTime()) {
+				t.Fatalf("was expecting %v in the cache of %s, got %v", binfo.ModTime(), name, cinfo.ModTime())
+			}
+		}
+		data, err := ReadFile(fs, "/file.txt")
+		if err != nil || string(data) != "updated" {
+			t.Fatalf("was expecting updated on %s, got %s, %v", name, data, err)
+		}
+	}
+}
+
+func TestPreserveTimes(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	base := NewMemMapFsWithClock(clock)
+	if err := WriteFile(base, "/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	buffer := NewBufferFs(base, NewMemMapFs()).(*BufferFs)
+	buffer.SetPreserveTimes(true)
+	sizeCache, err := NewSizeCacheFS(base, NewMemMapFs(), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizeCache.SetPreserveTimes(true)
+
+	for _, fs := range []Fs{buffer, sizeCache} {
+		clock.Advance(time.Minute)
+		f, err := fs.OpenFile("/file.txt", os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(fs.Name())); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		info, err := fs.Stat("/file.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.ModTime().Equal(start) {
+			t.Fatalf("was expecting %v on %s, got %v", start, fs.Name(), info.ModTime())
+		}
+		data, err := ReadFile(fs, "/file.txt")
+		if err != nil || string(data) != fs.Name() {
+			t.Fatalf("was expecting %s, got %s, %v", fs.Name(), data, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package kafero
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+)
+
+// A NameCodec maps the path elements of the files of the object store
+// backends to the elements of their object keys, and back, to keep
+// characters out of the keys or spread them over prefixes. It works
+// element by element so that the directories can still be listed by
+// prefix.
+type NameCodec interface {
+	Encode(elem string) string
+	Decode(elem string) (string, error)
+}
+
+// ErrInvalidName is returned when decoding an element which was not
+// encoded by the codec.
+var ErrInvalidName = errors.New("invalid encoded name")
+
+type escapeNames struct{}
+
+func (escapeNames) Encode(elem string) string {
+	return url.PathEscape(elem)
+}
+
+func (escapeNames) Decode(elem string) (string, error) {
+	name, err := url.PathUnescape(elem)
+	if err != nil {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// EscapeNames URL-escapes the characters of the names which are not safe
+// in object keys, such as control characters, "#" or "?".
+var EscapeNames NameCodec = escapeNames{}
+
+type hashPrefixNames struct {
+	n int
+}
+
+func (c hashPrefixNames) Encode(elem string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(elem))
+	return fmt.Sprintf("%08x", h.Sum32())[:c.n] + "-" + elem
+}
+
+func (c hashPrefixNames) Decode(elem string) (string, error) {
+	if len(elem) <= c.n || elem[c.n] != '-' {
+		return "", ErrInvalidName
+	}
+	name := elem[c.n+1:]
+	if c.Encode(name) != elem {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// HashPrefixNames prefixes the names with n hexadecimal digits, up to 8,
+// of their hash, so that the keys of a directory are spread over many
+// prefixes instead of sharing a hot one.
+func HashPrefixNames(n int) NameCodec {
+	if n < 1 {
+		n = 1
+	}
+	if n > 8 {
+		n = 8
+	}
+	return hashPrefixNames{n: n}
+}
+
+type chainNames []NameCodec
+
+func (c chainNames) Encode(elem string) string {
+	for _, codec := range c {
+		elem = codec.Encode(elem)
+	}
+	return elem
+}
+
+func (c chainNames) Decode(elem string) (string, error) {
+	for i := len(c) - 1; i >= 0; i-- {
+		var err error
+		if elem, err = c[i].Decode(elem); err != nil {
+			return "", err
+		}
+	}
+	return elem, nil
+}
+
+// ChainNames encodes the names with each of codecs in turn, and decodes
+// them in the reverse order.
+func ChainNames(codecs ...NameCodec) NameCodec {
+	return chainNames(codecs)
+}
@@ -0,0 +1,42 @@
+package kafero
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNameCodecs(t *testing.T) {
+	for _, codec := range []NameCodec{
+		EscapeNames,
+		HashPrefixNames(2),
+		ChainNames(EscapeNames, HashPrefixNames(4)),
+	} {
+		for _, name := range []string{"file.bin", "with space#1?.csv", "ünïcödé", "a\nb"} {
+			elem := codec.Encode(name)
+			if strings.ContainsAny(elem, "/") {
+				t.Fatalf("was not expecting a separator in %q", elem)
+			}
+			decoded, err := codec.Decode(elem)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decoded != name {
+				t.Fatalf("was expecting %q, got %q", name, decoded)
+			}
+		}
+	}
+
+	if elem := EscapeNames.Encode("a#b?c"); strings.ContainsAny(elem, "#?") {
+		t.Fatalf("was expecting # and ? to be escaped, got %s", elem)
+	}
+	codec := HashPrefixNames(2)
+	if elem := codec.Encode("file.bin"); len(elem) != len("file.bin")+3 || elem[2] != '-' {
+		t.Fatalf("was expecting a 2 digits prefix, got %s", elem)
+	}
+	if _, err := codec.Decode("file.bin"); err != ErrInvalidName {
+		t.Fatalf("was expecting ErrInvalidName, got %v", err)
+	}
+	if _, err := codec.Decode("00-file.bin"); err != ErrInvalidName {
+		t.Fatalf("was expecting ErrInvalidName for a wrong hash, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package kafero
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Maximum number of paths remembered by a negativeCache
+const negativeCacheSize = 1 << 16
+
+// negativeCache remembers the paths known not to exist for a limited time,
+// so that repeated probes for missing files don't all reach a slow backend.
+// A nil *negativeCache is valid and remembers nothing.
+type negativeCache struct {
+	ttl     time.Duration
+	clock   Clock
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func newNegativeCache(ttl time.Duration, clock Clock) *negativeCache {
+	if ttl <= 0 {
+		return nil
+	}
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &negativeCache{ttl: ttl, clock: clock, entries: make(map[string]time.Time)}
+}
+
+// missing returns true if name is known not to exist.
+func (c *negativeCache) missing(name string) bool {
+	if c == nil {
+		return false
+	}
+	name = filepath.Clean(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiry, ok := c.entries[name]
+	if !ok {
+		return false
+	}
+	if c.clock.Now().After(expiry) {
+		delete(c.entries, name)
+		return false
+	}
+	return true
+}
+
+// add records that name doesn't exist.
+func (c *negativeCache) add(name string) {
+	if c == nil {
+		return
+	}
+	name = filepath.Clean(name)
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= negativeCacheSize {
+		for k, expiry := range c.entries {
+			if now.After(expiry) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= negativeCacheSize {
+			c.entries = make(map[string]time.Time)
+		}
+	}
+	c.entries[name] = now.Add(c.ttl)
+}
+
+// invalidate forgets name and its parent directories, as creating a file
+// also creates its parents.
+func (c *negativeCache) invalidate(name string) {
+	if c == nil {
+		return
+	}
+	name = filepath.Clean(name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		delete(c.entries, name)
+		parent := filepath.Dir(name)
+		if parent == name {
+			return
+		}
+		name = parent
+	}
+}
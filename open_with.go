@@ -0,0 +1,175 @@
+package kafero
+
+import (
+	"context"
+	"os"
+)
+
+// openOptions are the options of OpenWith.
+type openOptions struct {
+	flag             int
+	perm             os.FileMode
+	bufferSize       int
+	readaheadBuffers int
+	readaheadSize    int
+	ctx              context.Context
+	verify           bool
+}
+
+// An OpenOption is an option of OpenWith.
+type OpenOption func(o *openOptions)
+
+// ForWrite opens the file read-write instead of read only.
+func ForWrite() OpenOption {
+	return func(o *openOptions) {
+		o.flag |= os.O_RDWR
+	}
+}
+
+// Create creates the file if it doesn't exist, with the permissions of Perm.
+func Create() OpenOption {
+	return func(o *openOptions) {
+		o.flag |= os.O_RDWR | os.O_CREATE
+	}
+}
+
+// Exclusive creates the file, failing if it exists.
+func Exclusive() OpenOption {
+	return func(o *openOptions) {
+		o.flag |= os.O_RDWR | os.O_CREATE | os.O_EXCL
+	}
+}
+
+// Truncate truncates the file when opened.
+func Truncate() OpenOption {
+	return func(o *openOptions) {
+		o.flag |= os.O_RDWR | os.O_TRUNC
+	}
+}
+
+// Append appends the writes to the end of the file.
+func Append() OpenOption {
+	return func(o *openOptions) {
+		o.flag |= os.O_RDWR | os.O_APPEND
+	}
+}
+
+// Perm sets the permissions of the file created, 0666 by default.
+func Perm(perm os.FileMode) OpenOption {
+	return func(o *openOptions) {
+		o.perm = perm
+	}
+}
+
+// BufferSize coalesces the writes to the file in writes of up to size
+// bytes, as a BufferedWriterFile does.
+func BufferSize(size int) OpenOption {
+	return func(o *openOptions) {
+		o.bufferSize = size
+	}
+}
+
+// Readahead reads the file opened read only ahead of its reads, up to
+// buffers chunks of size bytes, as a ReadaheadFile does.
+func Readahead(buffers int, size int) OpenOption {
+	return func(o *openOptions) {
+		o.readaheadBuffers = buffers
+		o.readaheadSize = size
+	}
+}
+
+// OpenContext binds the file to ctx: the file isn't opened if ctx is done,
+// and its reads and writes fail with the error of ctx once it is. The file
+// is opened through fs bound to ctx, as WithContext.
+func OpenContext(ctx context.Context) OpenOption {
+	return func(o *openOptions) {
+		o.ctx = ctx
+	}
+}
+
+// VerifyChecksum verifies the file opened read only against its
+// XattrSHA256 digest, and stores the digest of the file written, as an
+// IntegrityFs with VerifyOnRead does.
+func VerifyChecksum() OpenOption {
+	return func(o *openOptions) {
+		o.verify = true
+	}
+}
+
+// OpenWith opens the named file of fs with the options opts, read only if
+// none asks for writing. The options map onto the flags of OpenFile, and
+// onto the layers wrapping the file for the behaviors the flags can't
+// carry.
+func OpenWith(fs Fs, name string, opts ...OpenOption) (File, error) {
+	o := &openOptions{perm: 0666}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.ctx != nil {
+		if err := o.ctx.Err(); err != nil {
+			return nil, &os.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	if o.ctx != nil {
+		fs = WithContext(fs, o.ctx)
+	}
+	if o.verify {
+		fs = NewIntegrityFs(fs, VerifyOnRead())
+	}
+	f, err := fs.OpenFile(name, o.flag, o.perm)
+	if err != nil {
+		return nil, err
+	}
+	if o.flag == os.O_RDONLY {
+		if o.readaheadBuffers > 0 && o.readaheadSize > 0 {
+			f = NewReadaheadFile(f, o.readaheadBuffers, o.readaheadSize)
+		}
+	} else if o.bufferSize > 0 {
+		f = NewBufferedWriterFile(f, o.bufferSize)
+	}
+	if o.ctx != nil {
+		f = &contextFile{File: f, ctx: o.ctx}
+	}
+	return f, nil
+}
+
+// contextFile fails the reads and writes once its context is done.
+type contextFile struct {
+	File
+	ctx context.Context
+}
+
+func (f *contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.Read(p)
+}
+
+func (f *contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.ReadAt(p, off)
+}
+
+func (f *contextFile) Write(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.Write(p)
+}
+
+func (f *contextFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteAt(p, off)
+}
+
+func (f *contextFile) WriteString(s string) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.File.WriteString(s)
+}
@@ -0,0 +1,71 @@
+package kafero
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOpenWith(t *testing.T) {
+	fs := newXattrMemFs()
+	f, err := OpenWith(fs, "/file.txt", Exclusive(), Perm(0600), BufferSize(1024), VerifyChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fs.Stat("/file.txt"); err != nil || info.Size() != 0 {
+		t.Fatalf("was expecting the write to be buffered, got %v, %v", info, err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fs.Stat("/file.txt"); err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("was expecting 0600, got %v, %v", info, err)
+	}
+	if _, err := OpenWith(fs, "/file.txt", Exclusive()); !os.IsExist(err) {
+		t.Fatalf("was expecting an existing file error, got %v", err)
+	}
+
+	f, err = OpenWith(fs, "/file.txt", Readahead(2, 4), VerifyChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "content" {
+		t.Fatalf("was expecting content, got %s, %v", data, err)
+	}
+
+	// The digest was stored, the changes are detected
+	if err := WriteFile(fs, "/file.txt", []byte("altered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err = OpenWith(fs, "/file.txt", VerifyChecksum())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(f)
+	f.Close()
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("was expecting a verification error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err = OpenWith(fs, "/file.txt", OpenContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := f.Read(make([]byte, 4)); err != context.Canceled {
+		t.Fatalf("was expecting context.Canceled, got %v", err)
+	}
+	f.Close()
+	if _, err := OpenWith(fs, "/file.txt", OpenContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Fatalf("was expecting context.Canceled, got %v", err)
+	}
+}
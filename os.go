@@ -21,7 +21,10 @@ import (
 	"time"
 )
 
-var _ Lstater = (*OsFs)(nil)
+var (
+	_ Symlinker = (*OsFs)(nil)
+	_ ReadDirer = (*OsFs)(nil)
+)
 
 // OsFs is a Fs implementation that uses functions provided by the os package.
 //
@@ -42,7 +45,7 @@ func (OsFs) Create(name string) (File, error) {
 		// a nil value of type *os.File or nil won't be nil
 		return nil, e
 	}
-	return &OsFile{f: f}, e
+	return &OsFile{f: f, flag: os.O_RDWR}, e
 }
 
 func (OsFs) Mkdir(name string, perm os.FileMode) error {
@@ -60,7 +63,7 @@ func (OsFs) Open(name string) (File, error) {
 		// a nil value of type *os.File or nil won't be nil
 		return nil, e
 	}
-	return &OsFile{f: f}, e
+	return &OsFile{f: f, flag: os.O_RDONLY}, e
 }
 
 func (OsFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
@@ -70,7 +73,7 @@ func (OsFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
 		// a nil value of type *os.File or nil won't be nil
 		return nil, e
 	}
-	return &OsFile{f: f}, e
+	return &OsFile{f: f, flag: flag}, e
 }
 
 func (OsFs) Remove(name string) error {
@@ -102,15 +105,49 @@ func (OsFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 	return fi, true, err
 }
 
-func (OsFs) Walk(root string, walkFn filepath.WalkFunc) error {
-	return filepath.Walk(root, walkFn)
+func (OsFs) SymlinkIfPossible(oldname, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OsFs) ReadlinkIfPossible(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+// Walk walks the tree rooted at root as filepath.Walk does, listing the
+// directories with ReadDir.
+func (fs OsFs) Walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		return walkFn(root, nil, err)
+	}
+	err = walk(fs, root, info, walkFn)
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// ReadDir lists the directory with the FileInfo of os.Lstat.
+func (fs OsFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return ReadDir(fs, dirname)
 }
 
 type OsFile struct {
 	f    *os.File
+	flag int
 	mmap []byte
 }
 
+// readOnly returns the error of the operation op if the file is not opened
+// for writing. The os package leaves it to the system, which fails with
+// EBADF, or EINVAL for truncate, on unix.
+func (f *OsFile) readOnly(op string) error {
+	if f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &os.PathError{Op: op, Path: f.f.Name(), Err: ErrReadOnlyHandle}
+	}
+	return nil
+}
+
 func (f *OsFile) Close() error {
 	if f.mmap != nil {
 		if err := f.Munmap(); err != nil {
@@ -133,10 +170,16 @@ func (f *OsFile) Seek(o int64, w int) (int64, error) {
 }
 
 func (f *OsFile) Write(s []byte) (int, error) {
+	if err := f.readOnly("write"); err != nil {
+		return 0, err
+	}
 	return f.f.Write(s)
 }
 
 func (f *OsFile) WriteAt(s []byte, o int64) (int, error) {
+	if err := f.readOnly("writeat"); err != nil {
+		return 0, err
+	}
 	return f.f.WriteAt(s, o)
 }
 
@@ -161,40 +204,42 @@ func (f *OsFile) Sync() error {
 }
 
 func (f *OsFile) Truncate(size int64) error {
+	if err := f.readOnly("truncate"); err != nil {
+		return err
+	}
 	return f.f.Truncate(size)
 }
 
 func (f *OsFile) WriteString(s string) (ret int, err error) {
+	if err := f.readOnly("write"); err != nil {
+		return 0, err
+	}
 	return f.f.WriteString(s)
 }
 
 func (f *OsFile) CanMmap() bool {
-	return true
+	return mmapSupported
 }
 
 func (f *OsFile) Mmap(offset int64, length int, prot int, flags int) ([]byte, error) {
-	return nil, fmt.Errorf("memap not supported")
-	/*
-		fd := f.f.Fd()
-		b, err := syscall.Mmap(int(fd), offset, length, prot, flags)
-		if err != nil {
-			return nil, fmt.Errorf("error mmaping: %v", err)
-		}
-		f.mmap = b
-		return b, nil
-	*/
+	if f.mmap != nil {
+		return nil, fmt.Errorf("file already mmapped")
+	}
+	b, err := mmap(f.f, offset, length, prot, flags)
+	if err != nil {
+		return nil, fmt.Errorf("error mmaping: %v", err)
+	}
+	f.mmap = b
+	return b, nil
 }
 
 func (f *OsFile) Munmap() error {
-	return fmt.Errorf("memap not supported")
-	/*
-		if f.mmap == nil {
-			return fmt.Errorf("file not mmapped")
-		}
-		if err := syscall.Munmap(f.mmap); err != nil {
-			return fmt.Errorf("error unmapping file: %v", err)
-		}
-		f.mmap = nil
-		return nil
-	*/
+	if f.mmap == nil {
+		return fmt.Errorf("file not mmapped")
+	}
+	if err := munmap(f.mmap); err != nil {
+		return fmt.Errorf("error unmapping file: %v", err)
+	}
+	f.mmap = nil
+	return nil
 }
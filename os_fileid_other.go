@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux
+// +build !darwin,!dragonfly,!freebsd,!linux
+
+package kafero
+
+import "os"
+
+var _ FileIDer = (*OsFs)(nil)
+
+func (OsFs) FileID(name string) (FileID, error) {
+	return "", &os.PathError{Op: "fileid", Path: name, Err: ErrFileIDNotSupported}
+}
@@ -0,0 +1,20 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package kafero
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+var _ FileIDer = (*OsFs)(nil)
+
+func (OsFs) FileID(name string) (FileID, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(name, &st); err != nil {
+		return "", &os.PathError{Op: "fileid", Path: name, Err: err}
+	}
+	return FileID(fmt.Sprintf("%d:%d", uint64(st.Dev), uint64(st.Ino))), nil
+}
@@ -0,0 +1,25 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package kafero
+
+import (
+	"errors"
+	"os"
+)
+
+const (
+	mmapSupported = false
+	mmapProtRead  = 0
+	mmapShared    = 0
+)
+
+var errMmapNotSupported = errors.New("mmap not supported")
+
+func mmap(f *os.File, offset int64, length int, prot int, flags int) ([]byte, error) {
+	return nil, errMmapNotSupported
+}
+
+func munmap(b []byte) error {
+	return errMmapNotSupported
+}
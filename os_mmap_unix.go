@@ -0,0 +1,23 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package kafero
+
+import (
+	"os"
+	"syscall"
+)
+
+const (
+	mmapSupported = true
+	mmapProtRead  = syscall.PROT_READ
+	mmapShared    = syscall.MAP_SHARED
+)
+
+func mmap(f *os.File, offset int64, length int, prot int, flags int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), offset, length, prot, flags)
+}
+
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
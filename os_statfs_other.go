@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux
+// +build !darwin,!dragonfly,!freebsd,!linux
+
+package kafero
+
+import "os"
+
+var _ Statfser = (*OsFs)(nil)
+
+func (OsFs) Statfs(name string) (*FsUsage, error) {
+	return nil, &os.PathError{Op: "statfs", Path: name, Err: ErrStatfsNotSupported}
+}
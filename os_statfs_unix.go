@@ -0,0 +1,24 @@
+//go:build darwin || dragonfly || freebsd || linux
+// +build darwin dragonfly freebsd linux
+
+package kafero
+
+import (
+	"os"
+	"syscall"
+)
+
+var _ Statfser = (*OsFs)(nil)
+
+func (OsFs) Statfs(name string) (*FsUsage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(name, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: name, Err: err}
+	}
+	bsize := uint64(st.Bsize)
+	return &FsUsage{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+	}, nil
+}
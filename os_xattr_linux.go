@@ -0,0 +1,76 @@
+package kafero
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+var _ Xattrer = (*OsFs)(nil)
+
+// xattrErr returns the error of the operation op on the extended
+// attributes of name, mapping the errors of the system.
+func xattrErr(op, name string, err error) error {
+	switch err {
+	case syscall.ENODATA:
+		err = ErrNoAttr
+	case syscall.ENOTSUP:
+		err = ErrXattrNotSupported
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+func (OsFs) Getxattr(name, attr string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(name, attr, nil)
+		if err != nil {
+			return nil, xattrErr("getxattr", name, err)
+		}
+		value := make([]byte, size)
+		n, err := syscall.Getxattr(name, attr, value)
+		// The attribute may have grown in between
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, xattrErr("getxattr", name, err)
+		}
+		return value[:n], nil
+	}
+}
+
+func (OsFs) Setxattr(name, attr string, value []byte) error {
+	if err := syscall.Setxattr(name, attr, value, 0); err != nil {
+		return xattrErr("setxattr", name, err)
+	}
+	return nil
+}
+
+func (OsFs) Listxattr(name string) ([]string, error) {
+	for {
+		size, err := syscall.Listxattr(name, nil)
+		if err != nil {
+			return nil, xattrErr("listxattr", name, err)
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size)
+		n, err := syscall.Listxattr(name, buf)
+		if err == syscall.ERANGE {
+			continue
+		}
+		if err != nil {
+			return nil, xattrErr("listxattr", name, err)
+		}
+		// The names are NUL terminated
+		return strings.Split(strings.TrimSuffix(string(buf[:n]), "\x00"), "\x00"), nil
+	}
+}
+
+func (OsFs) Removexattr(name, attr string) error {
+	if err := syscall.Removexattr(name, attr); err != nil {
+		return xattrErr("removexattr", name, err)
+	}
+	return nil
+}
@@ -16,6 +16,7 @@
 package kafero
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -45,6 +46,31 @@ func ReadDirNames(fs Fs, dirname string) ([]string, error) {
 	return readDirNames(fs, dirname)
 }
 
+// readDirLstat returns the entries of the directory named by dirname,
+// sorted by name, with the FileInfo of lstatIfPossible. The entries removed
+// while listing the directory are skipped.
+func readDirLstat(fs Fs, dirname string) ([]os.FileInfo, error) {
+	if rfs, ok := fs.(ReadDirer); ok {
+		return rfs.ReadDir(dirname)
+	}
+	names, err := readDirNames(fs, dirname)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(names))
+	for _, name := range names {
+		info, err := lstatIfPossible(fs, filepath.Join(dirname, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
 // walk recursively descends path, calling walkFn
 // adapted from https://golang.org/src/path/filepath/path.go
 func walk(fs Fs, path string, info os.FileInfo, walkFn filepath.WalkFunc) error {
@@ -60,6 +86,23 @@ func walk(fs Fs, path string, info os.FileInfo, walkFn filepath.WalkFunc) error
 		return nil
 	}
 
+	// The backends listing the entries with their info save a stat per entry
+	if rfs, ok := fs.(ReadDirer); ok {
+		infos, err := rfs.ReadDir(path)
+		if err != nil {
+			return walkFn(path, info, err)
+		}
+		for _, fileInfo := range infos {
+			err = walk(fs, filepath.Join(path, fileInfo.Name()), fileInfo, walkFn)
+			if err != nil {
+				if !fileInfo.IsDir() || err != filepath.SkipDir {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
 	names, err := readDirNames(fs, path)
 	if err != nil {
 		return walkFn(path, info, err)
@@ -106,9 +149,26 @@ func (a Afero) Walk(root string, walkFn filepath.WalkFunc) error {
 
 // TODO should walk without separator suffix work ?
 func Walk(fs Fs, root string, walkFn filepath.WalkFunc) error {
+	// Backends able to list a whole tree at once walk it themselves, the
+	// same way, see Walkable
+	if wfs, ok := fs.(Walkable); ok {
+		return wfs.Walk(root, walkFn)
+	}
 	info, err := lstatIfPossible(fs, root)
 	if err != nil {
 		return walkFn(root, nil, err)
 	}
 	return walk(fs, root, info, walkFn)
 }
+
+// WalkContext walks the file tree rooted at root as Walk does, through fs
+// bound to ctx as WithContext, and stops once ctx is done, returning its
+// error, whether or not the backend cancels its requests.
+func WalkContext(ctx context.Context, fs Fs, root string, walkFn filepath.WalkFunc) error {
+	return Walk(WithContext(fs, ctx), root, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return walkFn(path, info, err)
+	})
+}
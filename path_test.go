@@ -15,11 +15,21 @@
 package kafero_test
 
 import (
+	"context"
 	"fmt"
 	"github.com/melaurent/kafero"
 	"github.com/melaurent/kafero/tests"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/option"
 )
 
 func TestWalk(t *testing.T) {
@@ -79,3 +89,274 @@ func TestWalk(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// statCountingFs counts the calls to Stat.
+type statCountingFs struct {
+	kafero.Fs
+	stats int
+}
+
+func (c *statCountingFs) Stat(name string) (os.FileInfo, error) {
+	c.stats++
+	return c.Fs.Stat(name)
+}
+
+// readDirCountingFs is a statCountingFs listing the directories of its
+// MemMapFs with their info.
+type readDirCountingFs struct {
+	*statCountingFs
+}
+
+func (c readDirCountingFs) ReadDir(dirname string) ([]os.FileInfo, error) {
+	return c.Fs.(kafero.ReadDirer).ReadDir(dirname)
+}
+
+// walkTree creates dirs directories of files files in a MemMapFs.
+func walkTree(dirs, files int) kafero.Fs {
+	fs := &kafero.MemMapFs{}
+	for i := 0; i < dirs; i++ {
+		for j := 0; j < files; j++ {
+			f, _ := fs.Create(fmt.Sprintf("/root/%d/%d", i, j))
+			f.Close()
+		}
+	}
+	return fs
+}
+
+func TestWalkReadDirer(t *testing.T) {
+	mem := walkTree(3, 4)
+	counting := &statCountingFs{Fs: mem}
+	var outputs []string
+	for _, fs := range []kafero.Fs{
+		&statCountingFs{Fs: mem},
+		readDirCountingFs{counting},
+	} {
+		output := ""
+		err := kafero.Walk(fs, "/root", func(path string, info os.FileInfo, err error) error {
+			output += fmt.Sprintln(path, info.Name(), info.Size(), info.IsDir(), err)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, output)
+	}
+	if outputs[0] != outputs[1] {
+		t.Fatalf("Walk outputs not equal:\n%s\n%s", outputs[0], outputs[1])
+	}
+	// Only the root is stat
+	if counting.stats != 1 {
+		t.Fatalf("was expecting a single stat, got %d", counting.stats)
+	}
+}
+
+// walkSkipping walks root of fs, skipping the directories named skip and
+// the files of a directory following one named stop, and returns the
+// entries walked, relative to root.
+func walkSkipping(t *testing.T, fs kafero.Fs, root string) string {
+	output := ""
+	err := kafero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		output += fmt.Sprintln(strings.TrimPrefix(path, root), info.IsDir())
+		if info.Name() == "skip" || info.Name() == "stop" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return output
+}
+
+// The Walkable filesystems walk the trees as Walk does directory by
+// directory
+func TestWalkWalkable(t *testing.T) {
+	files := []string{"b/z", "c", "skip/y", "b/stop", "a/x", "b/a", "b/b"}
+	expected := fmt.Sprintln("", true) +
+		fmt.Sprintln("/a", true) + fmt.Sprintln("/a/x", false) +
+		fmt.Sprintln("/b", true) + fmt.Sprintln("/b/a", false) +
+		fmt.Sprintln("/b/b", false) + fmt.Sprintln("/b/stop", false) +
+		fmt.Sprintln("/c", false) + fmt.Sprintln("/skip", true)
+
+	check := func(t *testing.T, fs kafero.Fs, root string) {
+		if _, ok := fs.(kafero.Walkable); !ok {
+			t.Fatalf("was expecting %s to be Walkable", fs.Name())
+		}
+		for _, name := range files {
+			if err := fs.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := kafero.WriteFile(fs, filepath.Join(root, name), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if output := walkSkipping(t, fs, root); output != expected {
+			t.Fatalf("was expecting the walk\n%s\ngot\n%s", expected, output)
+		}
+		if output := walkSkipping(t, dirByDirFs{fs}, root); output != expected {
+			t.Fatalf("was expecting the walk directory by directory\n%s\ngot\n%s", expected, output)
+		}
+	}
+	t.Run("OsFs", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "kafero-walk")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		check(t, kafero.NewOsFs(), dir)
+	})
+	t.Run("GcsFs", func(t *testing.T) {
+		fs, _, _ := emulatorGcsFs(t, "kafero-test-walk")
+		if err := fs.RemoveAll("walk"); err != nil {
+			t.Fatal(err)
+		}
+		check(t, fs, "walk")
+	})
+}
+
+func TestWalkContext(t *testing.T) {
+	mem := walkTree(3, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	visited := 0
+	err := kafero.WalkContext(ctx, mem, "/root", func(path string, info os.FileInfo, err error) error {
+		visited++
+		if visited == 3 {
+			cancel()
+		}
+		return err
+	})
+	if err != context.Canceled {
+		t.Fatalf("was expecting the walk canceled, got %v", err)
+	}
+	if visited != 3 {
+		t.Fatalf("was expecting the walk to stop after 3 entries, got %d", visited)
+	}
+}
+
+func BenchmarkWalk(b *testing.B) {
+	mem := walkTree(100, 1000)
+	for _, bc := range []struct {
+		name    string
+		readDir bool
+	}{{"Stat", false}, {"ReadDir", true}} {
+		b.Run(bc.name, func(b *testing.B) {
+			counting := &statCountingFs{Fs: mem}
+			var fs kafero.Fs = counting
+			if bc.readDir {
+				fs = readDirCountingFs{counting}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := kafero.Walk(fs, "/root", func(path string, info os.FileInfo, err error) error {
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(counting.stats)/float64(b.N), "stats/op")
+		})
+	}
+}
+
+// countingTransport counts the requests sent to the GCS emulator.
+type countingTransport struct {
+	requests int64
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&c.requests, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// emulatorGcsFs returns a GcsFs on bucket of the GCS emulator listening on
+// STORAGE_EMULATOR_HOST, such as fake-gcs-server, skipping tb if it isn't
+// set, with the transport counting its requests.
+func emulatorGcsFs(tb testing.TB, bucket string) (*kafero.GcsFs, *storage.Client, *countingTransport) {
+	host := os.Getenv("STORAGE_EMULATOR_HOST")
+	if host == "" {
+		tb.Skip("STORAGE_EMULATOR_HOST not set")
+	}
+	ctx := context.Background()
+	transport := &countingTransport{}
+	client, err := storage.NewClient(ctx,
+		option.WithEndpoint("http://"+host+"/storage/v1/"),
+		option.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	// The bucket may exist from a previous run
+	_ = client.Bucket(bucket).Create(ctx, "kafero", nil)
+	return kafero.NewGcsFs(ctx, client, bucket, "/"), client, transport
+}
+
+// gcsWalkTree creates dirs directories of files files in bucket, unless
+// the last one exists from a previous run.
+func gcsWalkTree(tb testing.TB, client *storage.Client, bucket string, dirs, files int) {
+	ctx := context.Background()
+	b := client.Bucket(bucket)
+	if _, err := b.Object(fmt.Sprintf("root/%d/%d", dirs-1, files-1)).Attrs(ctx); err == nil {
+		return
+	}
+	names := make(chan string)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				if err := b.Object(name).NewWriter(ctx).Close(); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	for i := 0; i < dirs; i++ {
+		for j := 0; j < files; j++ {
+			names <- fmt.Sprintf("root/%d/%d", i, j)
+		}
+	}
+	close(names)
+	wg.Wait()
+	select {
+	case err := <-errs:
+		tb.Fatal(err)
+	default:
+	}
+}
+
+// dirByDirFs hides the optional interfaces of its Fs, walked directory by
+// directory with a stat per entry.
+type dirByDirFs struct {
+	kafero.Fs
+}
+
+func BenchmarkWalkGcsEmulator(b *testing.B) {
+	fs, client, transport := emulatorGcsFs(b, "kafero-bench-walk")
+	gcsWalkTree(b, client, "kafero-bench-walk", 100, 1000)
+	for _, bc := range []struct {
+		name string
+		fs   kafero.Fs
+	}{{"DelimiterListing", fs}, {"DirByDir", dirByDirFs{fs}}} {
+		b.Run(bc.name, func(b *testing.B) {
+			atomic.StoreInt64(&transport.requests, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				err := kafero.Walk(bc.fs, "root", func(path string, info os.FileInfo, err error) error {
+					return err
+				})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&transport.requests))/float64(b.N), "requests/op")
+		})
+	}
+}
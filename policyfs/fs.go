@@ -0,0 +1,179 @@
+package policyfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/stack"
+)
+
+// A Rule applies layers to all the paths matching Pattern.
+//
+// Pattern uses the filepath.Match syntax. A path matches the rule if the
+// path itself, or any of its parent directories, matches the pattern, so
+// "raw" and "tmp/*" cover the whole raw and tmp trees.
+type Rule struct {
+	Pattern string
+	Layers  []stack.Layer
+}
+
+// ReadOnly is a shortcut for a rule rejecting writes under pattern.
+func ReadOnly(pattern string) Rule {
+	return Rule{Pattern: pattern, Layers: []stack.Layer{stack.ReadOnly()}}
+}
+
+type route struct {
+	pattern string
+	fs      kafero.Fs
+}
+
+// The Fs routes every operation to a view of the base Fs depending on the
+// path: the first rule matching the path decides which layers are applied.
+// Paths matching no rule go to the base directly.
+//
+// Renaming between paths governed by different rules is not allowed, as
+// the content would not be transformed, and returns EXDEV.
+type Fs struct {
+	base   kafero.Fs
+	routes []route
+}
+
+func NewFs(base kafero.Fs, rules ...Rule) (*Fs, error) {
+	fs := &Fs{base: base}
+	for _, r := range rules {
+		if _, err := filepath.Match(r.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %v", r.Pattern, err)
+		}
+		b := stack.New(base)
+		for _, l := range r.Layers {
+			b.With(l)
+		}
+		rfs, err := b.Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building rule %q: %v", r.Pattern, err)
+		}
+		fs.routes = append(fs.routes, route{pattern: r.Pattern, fs: rfs})
+	}
+	return fs, nil
+}
+
+func matches(pattern, name string) bool {
+	name = strings.TrimPrefix(filepath.Clean(name), string(filepath.Separator))
+	for name != "" && name != "." {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		name = filepath.Dir(name)
+	}
+	return false
+}
+
+// route returns the index of the rule governing name, -1 for the base.
+func (p *Fs) route(name string) int {
+	for i, r := range p.routes {
+		if matches(r.pattern, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Resolve returns the Fs an operation on name is delegated to.
+func (p *Fs) Resolve(name string) kafero.Fs {
+	if i := p.route(name); i >= 0 {
+		return p.routes[i].fs
+	}
+	return p.base
+}
+
+func (p *Fs) Name() string {
+	return "PolicyFs"
+}
+
+// Unwrap returns the base filesystem, holding the views of the rules.
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (p *Fs) Unwrap() kafero.Fs {
+	return p.base
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+// WithContext returns a view of the Fs bound to ctx, through its base and
+// the layers of its rules.
+func (p *Fs) WithContext(ctx context.Context) kafero.Fs {
+	v := &Fs{base: kafero.WithContext(p.base, ctx)}
+	for _, r := range p.routes {
+		v.routes = append(v.routes, route{pattern: r.pattern, fs: kafero.WithContext(r.fs, ctx)})
+	}
+	return v
+}
+
+func (p *Fs) Create(name string) (kafero.File, error) {
+	return p.Resolve(name).Create(name)
+}
+
+func (p *Fs) Mkdir(name string, perm os.FileMode) error {
+	return p.Resolve(name).Mkdir(name, perm)
+}
+
+func (p *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return p.Resolve(path).MkdirAll(path, perm)
+}
+
+func (p *Fs) Open(name string) (kafero.File, error) {
+	return p.Resolve(name).Open(name)
+}
+
+func (p *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	return p.Resolve(name).OpenFile(name, flag, perm)
+}
+
+func (p *Fs) Remove(name string) error {
+	return p.Resolve(name).Remove(name)
+}
+
+func (p *Fs) RemoveAll(path string) error {
+	return p.Resolve(path).RemoveAll(path)
+}
+
+func (p *Fs) Rename(oldname, newname string) error {
+	if p.route(oldname) != p.route(newname) {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EXDEV}
+	}
+	return p.Resolve(oldname).Rename(oldname, newname)
+}
+
+func (p *Fs) Stat(name string) (os.FileInfo, error) {
+	return p.Resolve(name).Stat(name)
+}
+
+func (p *Fs) Chmod(name string, mode os.FileMode) error {
+	return p.Resolve(name).Chmod(name, mode)
+}
+
+func (p *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return p.Resolve(name).Chtimes(name, atime, mtime)
+}
+
+func (p *Fs) Getxattr(name, attr string) ([]byte, error) {
+	return kafero.Getxattr(p.Resolve(name), name, attr)
+}
+
+func (p *Fs) Setxattr(name, attr string, value []byte) error {
+	return kafero.Setxattr(p.Resolve(name), name, attr, value)
+}
+
+func (p *Fs) Listxattr(name string) ([]string, error) {
+	return kafero.Listxattr(p.Resolve(name), name)
+}
+
+func (p *Fs) Removexattr(name, attr string) error {
+	return kafero.Removexattr(p.Resolve(name), name, attr)
+}
@@ -0,0 +1,55 @@
+package policyfs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/stack"
+	"github.com/melaurent/kafero/tests"
+)
+
+func TestRules(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	fs, err := NewFs(base,
+		Rule{Pattern: "raw", Layers: []stack.Layer{stack.Zstd(zstd.SpeedFastest)}},
+		ReadOnly("results"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests.TestWriteFile(t, fs, "raw/data.bin", 1000)
+	tests.TestWriteFile(t, fs, "tmp/data.bin", 1000)
+
+	fi, err := base.Stat("raw/data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() == 1000 {
+		t.Fatal("was expecting raw/data.bin to be compressed in the base")
+	}
+	fi, err = base.Stat("tmp/data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != 1000 {
+		t.Fatalf("was expecting tmp/data.bin to be stored as is, got size %d", fi.Size())
+	}
+
+	if _, err := fs.Create("results/out.txt"); err == nil {
+		t.Fatal("was expecting an error creating a file under results")
+	}
+
+	if err := fs.Rename("tmp/data.bin", "raw/moved.bin"); !errors.Is(err, syscall.EXDEV) {
+		t.Fatalf("was expecting EXDEV renaming across rules, got %v", err)
+	}
+}
+
+func TestInvalidPattern(t *testing.T) {
+	if _, err := NewFs(kafero.NewMemMapFs(), ReadOnly("[")); err == nil {
+		t.Fatal("was expecting an error for an invalid pattern")
+	}
+}
@@ -6,7 +6,14 @@ import (
 	"time"
 )
 
-var _ Lstater = (*ReadOnlyFs)(nil)
+var (
+	_ Lstater   = (*ReadOnlyFs)(nil)
+	_ Symlinker = (*ReadOnlyFs)(nil)
+	_ Xattrer   = (*ReadOnlyFs)(nil)
+	_ Statfser  = (*ReadOnlyFs)(nil)
+	_ FileIDer  = (*ReadOnlyFs)(nil)
+	_ ReadDirer = (*ReadOnlyFs)(nil)
+)
 
 type ReadOnlyFs struct {
 	source Fs
@@ -17,7 +24,7 @@ func NewReadOnlyFs(source Fs) Fs {
 }
 
 func (r *ReadOnlyFs) ReadDir(name string) ([]os.FileInfo, error) {
-	return ReadDir(r.source, name)
+	return readDirLstat(r.source, name)
 }
 
 func (r *ReadOnlyFs) Chtimes(n string, a, m time.Time) error {
@@ -32,6 +39,10 @@ func (r *ReadOnlyFs) Name() string {
 	return "ReadOnlyFilter"
 }
 
+func (r *ReadOnlyFs) Unwrap() Fs {
+	return r.source
+}
+
 func (r *ReadOnlyFs) Stat(name string) (os.FileInfo, error) {
 	return r.source.Stat(name)
 }
@@ -44,6 +55,17 @@ func (r *ReadOnlyFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
 	return fi, false, err
 }
 
+func (r *ReadOnlyFs) SymlinkIfPossible(oldname, newname string) error {
+	return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (r *ReadOnlyFs) ReadlinkIfPossible(name string) (string, error) {
+	if srdr, ok := r.source.(LinkReader); ok {
+		return srdr.ReadlinkIfPossible(name)
+	}
+	return "", &os.PathError{Op: "readlink", Path: name, Err: ErrNoReadlink}
+}
+
 func (r *ReadOnlyFs) Rename(o, n string) error {
 	return syscall.EPERM
 }
@@ -77,4 +99,28 @@ func (r *ReadOnlyFs) MkdirAll(n string, p os.FileMode) error {
 
 func (r *ReadOnlyFs) Create(n string) (File, error) {
 	return nil, syscall.EPERM
-}
\ No newline at end of file
+}
+
+func (r *ReadOnlyFs) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(r.source, name, attr)
+}
+
+func (r *ReadOnlyFs) Setxattr(name, attr string, value []byte) error {
+	return syscall.EPERM
+}
+
+func (r *ReadOnlyFs) Listxattr(name string) ([]string, error) {
+	return Listxattr(r.source, name)
+}
+
+func (r *ReadOnlyFs) Removexattr(name, attr string) error {
+	return syscall.EPERM
+}
+
+func (r *ReadOnlyFs) Statfs(name string) (*FsUsage, error) {
+	return Statfs(r.source, name)
+}
+
+func (r *ReadOnlyFs) FileID(name string) (FileID, error) {
+	return GetFileID(r.source, name)
+}
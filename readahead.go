@@ -0,0 +1,249 @@
+package kafero
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+type readaheadChunk struct {
+	data []byte
+	err  error
+}
+
+// ReadaheadFile reads a file ahead of its sequential reads, in the
+// background, to hide the latency of network backends from readers
+// consuming small chunks. Up to buffers chunks of size bytes are fetched
+// ahead. Any other operation than Read stops the readahead, which resumes
+// on the next Read.
+// The background reads use the cursor of the wrapped file, which must not
+// be used directly anymore.
+type ReadaheadFile struct {
+	File
+	buffers int
+	size    int
+	pos     int64
+	// Whether the cursor of the file is at pos, when not reading ahead
+	synced  bool
+	chunks  chan readaheadChunk
+	stop    chan struct{}
+	current []byte
+	err     error
+}
+
+func NewReadaheadFile(f File, buffers int, size int) *ReadaheadFile {
+	if buffers < 1 {
+		buffers = 1
+	}
+	if size < 1 {
+		size = 1
+	}
+	return &ReadaheadFile{File: f, buffers: buffers, size: size, synced: true}
+}
+
+// sync moves the cursor of the file to pos.
+func (f *ReadaheadFile) sync() error {
+	if f.synced {
+		return nil
+	}
+	if _, err := f.File.Seek(f.pos, io.SeekStart); err != nil {
+		return err
+	}
+	f.synced = true
+	return nil
+}
+
+func (f *ReadaheadFile) start() error {
+	if err := f.sync(); err != nil {
+		return err
+	}
+	chunks := make(chan readaheadChunk, f.buffers)
+	stop := make(chan struct{})
+	go func() {
+		defer close(chunks)
+		for {
+			buf := make([]byte, f.size)
+			n, err := io.ReadFull(f.File, buf)
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			select {
+			case chunks <- readaheadChunk{data: buf[:n], err: err}:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	f.chunks = chunks
+	f.stop = stop
+	return nil
+}
+
+// halt stops the readahead, the cursor of the file is then unknown.
+func (f *ReadaheadFile) halt() {
+	if f.chunks == nil {
+		return
+	}
+	close(f.stop)
+	for range f.chunks {
+	}
+	f.chunks = nil
+	f.current = nil
+	f.err = nil
+	f.synced = false
+}
+
+func (f *ReadaheadFile) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.chunks == nil {
+		if err := f.start(); err != nil {
+			return 0, err
+		}
+	}
+	for len(f.current) == 0 {
+		if f.err != nil {
+			return 0, f.err
+		}
+		chunk, ok := <-f.chunks
+		if !ok {
+			return 0, io.EOF
+		}
+		f.current, f.err = chunk.data, chunk.err
+	}
+	n := copy(p, f.current)
+	f.current = f.current[n:]
+	f.pos += int64(n)
+	return n, nil
+}
+
+func (f *ReadaheadFile) ReadAt(p []byte, off int64) (int, error) {
+	f.halt()
+	return f.File.ReadAt(p, off)
+}
+
+func (f *ReadaheadFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		if offset == f.pos {
+			return f.pos, nil
+		}
+	case io.SeekCurrent:
+		if offset == 0 {
+			return f.pos, nil
+		}
+		offset, whence = f.pos+offset, io.SeekStart
+	}
+	f.halt()
+	pos, err := f.File.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	f.pos = pos
+	f.synced = true
+	return pos, nil
+}
+
+func (f *ReadaheadFile) Write(p []byte) (int, error) {
+	f.halt()
+	if err := f.sync(); err != nil {
+		return 0, err
+	}
+	n, err := f.File.Write(p)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *ReadaheadFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *ReadaheadFile) WriteAt(p []byte, off int64) (int, error) {
+	f.halt()
+	return f.File.WriteAt(p, off)
+}
+
+func (f *ReadaheadFile) Truncate(size int64) error {
+	f.halt()
+	return f.File.Truncate(size)
+}
+
+func (f *ReadaheadFile) Close() error {
+	f.halt()
+	return f.File.Close()
+}
+
+// The ReadaheadFs wraps the files opened read only from the source
+// filesystem in a ReadaheadFile.
+type ReadaheadFs struct {
+	source  Fs
+	buffers int
+	size    int
+}
+
+func NewReadaheadFs(source Fs, buffers int, size int) Fs {
+	return &ReadaheadFs{source: source, buffers: buffers, size: size}
+}
+
+func (r *ReadaheadFs) Create(name string) (File, error) {
+	return r.source.Create(name)
+}
+
+func (r *ReadaheadFs) Mkdir(name string, perm os.FileMode) error {
+	return r.source.Mkdir(name, perm)
+}
+
+func (r *ReadaheadFs) MkdirAll(path string, perm os.FileMode) error {
+	return r.source.MkdirAll(path, perm)
+}
+
+func (r *ReadaheadFs) Open(name string) (File, error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (r *ReadaheadFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := r.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 {
+		return f, nil
+	}
+	return NewReadaheadFile(f, r.buffers, r.size), nil
+}
+
+func (r *ReadaheadFs) Remove(name string) error {
+	return r.source.Remove(name)
+}
+
+func (r *ReadaheadFs) RemoveAll(path string) error {
+	return r.source.RemoveAll(path)
+}
+
+func (r *ReadaheadFs) Rename(oldname, newname string) error {
+	return r.source.Rename(oldname, newname)
+}
+
+func (r *ReadaheadFs) Stat(name string) (os.FileInfo, error) {
+	return r.source.Stat(name)
+}
+
+func (r *ReadaheadFs) Name() string {
+	return "ReadaheadFs"
+}
+
+func (r *ReadaheadFs) Unwrap() Fs {
+	return r.source
+}
+
+func (r *ReadaheadFs) Chmod(name string, mode os.FileMode) error {
+	return r.source.Chmod(name, mode)
+}
+
+func (r *ReadaheadFs) Chtimes(name string, atime, mtime time.Time) error {
+	return r.source.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,55 @@
+package kafero
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestReadaheadFile(t *testing.T) {
+	fs := NewMemMapFs()
+	content := make([]byte, 10000)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	if err := WriteFile(fs, "/file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	rfs := NewReadaheadFs(fs, 4, 1000)
+
+	data, err := ReadFile(rfs, "/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("was expecting the same content")
+	}
+
+	f, err := rfs.Open("/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	buf := make([]byte, 10)
+	if _, err := io.ReadFull(f, buf); err != nil || !bytes.Equal(buf, content[:10]) {
+		t.Fatalf("error reading start: %v", err)
+	}
+	// ReadAt doesn't move the cursor
+	if _, err := f.ReadAt(buf, 5000); err != nil || !bytes.Equal(buf, content[5000:5010]) {
+		t.Fatalf("error reading at 5000: %v", err)
+	}
+	if _, err := io.ReadFull(f, buf); err != nil || !bytes.Equal(buf, content[10:20]) {
+		t.Fatalf("error resuming reads: %v", err)
+	}
+	if pos, err := f.Seek(-100, io.SeekEnd); err != nil || pos != 9900 {
+		t.Fatalf("error seeking: %d, %v", pos, err)
+	}
+	rest, err := ioutil.ReadAll(f)
+	if err != nil || !bytes.Equal(rest, content[9900:]) {
+		t.Fatalf("error reading end: %v", err)
+	}
+	if pos, err := f.Seek(0, io.SeekCurrent); err != nil || pos != 10000 {
+		t.Fatalf("was expecting position 10000, got %d, %v", pos, err)
+	}
+}
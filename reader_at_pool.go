@@ -0,0 +1,203 @@
+package kafero
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Default number of handles of a ReaderAtPool
+const defaultReaderAtHandles = 4
+
+// A ReaderAtPool reads a file with ReadAt concurrently, for the columnar
+// readers, such as those of Parquet and Arrow, which issue many small
+// reads at random offsets, pathological against the files reading a
+// stream from their offset, such as those of GcsFs. The reads go through
+// a BlockCache, the blocks missing being read from a pool of handles of
+// the file, each read spanning several blocks reading them concurrently.
+// It implements io.ReaderAt, safe for concurrent use, and the Size the
+// columnar readers take with it.
+type ReaderAtPool struct {
+	fs      Fs
+	name    string
+	cache   *BlockCache
+	key     blockKey
+	handles chan File
+	// The handles open, at most cap(handles)
+	mu   sync.Mutex
+	open []File
+}
+
+// A ReaderAtPoolOption configures a ReaderAtPool.
+type ReaderAtPoolOption func(p *ReaderAtPool)
+
+// ReaderAtHandles sets the maximum number of handles of the file open at
+// once, 4 by default.
+func ReaderAtHandles(n int) ReaderAtPoolOption {
+	return func(p *ReaderAtPool) {
+		if n < 1 {
+			n = 1
+		}
+		p.handles = make(chan File, n)
+	}
+}
+
+// ReaderAtCache sets the cache of the blocks read, DefaultBlockCache by
+// default.
+func ReaderAtCache(cache *BlockCache) ReaderAtPoolOption {
+	return func(p *ReaderAtPool) {
+		p.cache = cache
+	}
+}
+
+// NewReaderAtPool returns a ReaderAtPool reading the named file of fs.
+func NewReaderAtPool(fs Fs, name string, opts ...ReaderAtPoolOption) (*ReaderAtPool, error) {
+	name = filepath.Clean(name)
+	p := &ReaderAtPool{
+		fs:      fs,
+		name:    name,
+		cache:   DefaultBlockCache,
+		handles: make(chan File, defaultReaderAtHandles),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	p.key = blockKey{fs: fs, path: name, size: info.Size(), mtime: info.ModTime().UnixNano()}
+	p.open = append(p.open, f)
+	p.handles <- f
+	return p, nil
+}
+
+// Size returns the size of the file.
+func (p *ReaderAtPool) Size() int64 {
+	return p.key.size
+}
+
+// acquire returns a handle of the file, opening one if none is free and
+// fewer than the maximum are open.
+func (p *ReaderAtPool) acquire() (File, error) {
+	select {
+	case f := <-p.handles:
+		return f, nil
+	default:
+	}
+	p.mu.Lock()
+	if len(p.open) < cap(p.handles) {
+		f, err := p.fs.Open(p.name)
+		if err == nil {
+			p.open = append(p.open, f)
+		}
+		p.mu.Unlock()
+		return f, err
+	}
+	p.mu.Unlock()
+	return <-p.handles, nil
+}
+
+func (p *ReaderAtPool) release(f File) {
+	p.handles <- f
+}
+
+// readBlock reads the block idx of the file with a handle of the pool.
+func (p *ReaderAtPool) readBlock(idx int64) ([]byte, error) {
+	bs := p.cache.blockSize
+	size := bs
+	if rest := p.key.size - idx*bs; rest < size {
+		size = rest
+	}
+	f, err := p.acquire()
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(f)
+	data := make([]byte, size)
+	n, err := f.ReadAt(data, idx*bs)
+	if err == io.EOF && int64(n) == size {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// block returns the block idx, from the cache.
+func (p *ReaderAtPool) block(idx int64) ([]byte, error) {
+	key := p.key
+	key.idx = idx
+	return p.cache.get(key, func() ([]byte, error) {
+		return p.readBlock(idx)
+	})
+}
+
+func (p *ReaderAtPool) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: p.name, Err: os.ErrInvalid}
+	}
+	if off >= p.key.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(b))
+	var err error
+	if end > p.key.size {
+		end, err = p.key.size, io.EOF
+	}
+	bs := p.cache.blockSize
+	first, last := off/bs, (end-1)/bs
+	if first == last {
+		data, err := p.block(first)
+		if err != nil {
+			return 0, err
+		}
+		n := copy(b[:end-off], data[off-first*bs:])
+		if n < len(b) {
+			return n, io.EOF
+		}
+		return n, nil
+	}
+	// The blocks are read concurrently, at most one per handle
+	blocks := make([][]byte, last-first+1)
+	errs := make([]error, len(blocks))
+	var wg sync.WaitGroup
+	for i := range blocks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			blocks[i], errs[i] = p.block(first + int64(i))
+		}(i)
+	}
+	wg.Wait()
+	n := 0
+	for i, data := range blocks {
+		if errs[i] != nil {
+			return n, errs[i]
+		}
+		pos := off + int64(n)
+		n += copy(b[n:end-off], data[pos-(first+int64(i))*bs:])
+	}
+	return n, err
+}
+
+// Close closes the handles of the file.
+func (p *ReaderAtPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var first error
+	for _, f := range p.open {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	p.open = nil
+	return first
+}
@@ -0,0 +1,61 @@
+package kafero
+
+import (
+	"bytes"
+	"io"
+	mrand "math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestReaderAtPool(t *testing.T) {
+	content := make([]byte, 1000)
+	mrand.New(mrand.NewSource(0)).Read(content)
+	base := &countingOpenFs{Fs: NewMemMapFs()}
+	if err := WriteFile(base, "a.parquet", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewReaderAtPool(base, "a.parquet", ReaderAtHandles(2), ReaderAtCache(NewBlockCache(16, 1<<20)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Size() != 1000 {
+		t.Fatalf("was expecting a size of 1000, got %d", p.Size())
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := mrand.New(mrand.NewSource(seed))
+			for j := 0; j < 100; j++ {
+				off := rng.Int63n(1000)
+				b := make([]byte, rng.Intn(100)+1)
+				n, err := p.ReadAt(b, off)
+				expected := content[off:]
+				if len(expected) > len(b) {
+					expected = expected[:len(b)]
+				}
+				if n < len(b) && err != io.EOF || n == len(b) && err != nil {
+					t.Errorf("unexpected error reading %d bytes at %d: %d, %v", len(b), off, n, err)
+					return
+				}
+				if !bytes.Equal(b[:n], expected) {
+					t.Errorf("unexpected content at %d", off)
+					return
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	if opens := atomic.LoadInt32(&base.opens); opens > 2 {
+		t.Fatalf("was expecting at most 2 handles, got %d opens", opens)
+	}
+	if _, err := p.ReadAt(make([]byte, 1), 1000); err != io.EOF {
+		t.Fatalf("was expecting io.EOF, got %v", err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
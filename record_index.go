@@ -0,0 +1,191 @@
+package kafero
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// RecordIndexSuffix is the suffix of the sidecar files storing the record
+// indexes of the files, named after the file they index with a leading
+// dot, as .name.kafero-index.
+const RecordIndexSuffix = ".kafero-index"
+
+// DefaultRecordIndexInterval is the number of records between the offsets
+// of a record index by default.
+const DefaultRecordIndexInterval = 1024
+
+// ErrStaleIndex is returned when loading the record index of a file
+// modified since indexed.
+var ErrStaleIndex = errors.New("stale record index")
+
+var recordIndexMagic = []byte("KIDX\x01")
+
+// A RecordIndex holds the offsets of the records, the lines, of a file,
+// one every Interval records, so that reading from a record only skips
+// the records since the previous offset instead of all the records
+// before. The offsets are those of the content read from the filesystem:
+// the files compressed with zstd are indexed and read through a zstfs.
+type RecordIndex struct {
+	// Interval is the number of records between two offsets
+	Interval int64
+	// Records is the number of records of the file
+	Records int64
+	// Offsets are the offsets of the records 0, Interval, 2*Interval...
+	Offsets []int64
+	// The size and modification time of the file indexed
+	Size    int64
+	ModTime int64
+}
+
+func recordIndexName(name string) string {
+	dir, file := filepath.Split(name)
+	return filepath.Join(dir, "."+file+RecordIndexSuffix)
+}
+
+// BuildRecordIndex indexes the records of the named file of fs, an offset
+// every interval records, DefaultRecordIndexInterval if 0, and stores the
+// index in its sidecar.
+func BuildRecordIndex(fs Fs, name string, interval int64) (*RecordIndex, error) {
+	if interval <= 0 {
+		interval = DefaultRecordIndexInterval
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	idx := &RecordIndex{Interval: interval, Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	r := bufio.NewReaderSize(f, defaultRecordBufferSize)
+	var offset int64
+	for {
+		n, err := skipRecord(r)
+		if n > 0 {
+			if idx.Records%interval == 0 {
+				idx.Offsets = append(idx.Offsets, offset)
+			}
+			idx.Records++
+			offset += n
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := WriteFile(fs, recordIndexName(name), idx.marshal(), 0644); err != nil {
+		return nil, fmt.Errorf("error writing record index: %v", err)
+	}
+	return idx, nil
+}
+
+// skipRecord reads a record of r, whatever its length, and returns its
+// length, end of line included.
+func skipRecord(r *bufio.Reader) (int64, error) {
+	var n int64
+	for {
+		line, err := r.ReadSlice('\n')
+		n += int64(len(line))
+		if err != bufio.ErrBufferFull {
+			return n, err
+		}
+	}
+}
+
+// LoadRecordIndex returns the record index of the named file of fs, from
+// its sidecar, ErrStaleIndex if the file was modified since indexed.
+func LoadRecordIndex(fs Fs, name string) (*RecordIndex, error) {
+	data, err := ReadFile(fs, recordIndexName(name))
+	if err != nil {
+		return nil, err
+	}
+	idx, err := unmarshalRecordIndex(data)
+	if err != nil {
+		return nil, fmt.Errorf("error reading record index of %s: %v", name, err)
+	}
+	info, err := fs.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() != idx.Size || info.ModTime().UnixNano() != idx.ModTime {
+		return nil, ErrStaleIndex
+	}
+	return idx, nil
+}
+
+func (idx *RecordIndex) marshal() []byte {
+	buf := bytes.NewBuffer(append([]byte{}, recordIndexMagic...))
+	for _, v := range []int64{idx.Interval, idx.Records, idx.Size, idx.ModTime, int64(len(idx.Offsets))} {
+		_ = binary.Write(buf, binary.LittleEndian, v)
+	}
+	_ = binary.Write(buf, binary.LittleEndian, idx.Offsets)
+	return buf.Bytes()
+}
+
+func unmarshalRecordIndex(data []byte) (*RecordIndex, error) {
+	if !bytes.HasPrefix(data, recordIndexMagic) {
+		return nil, errors.New("not a record index")
+	}
+	r := bytes.NewReader(data[len(recordIndexMagic):])
+	idx := &RecordIndex{}
+	var n int64
+	for _, v := range []*int64{&idx.Interval, &idx.Records, &idx.Size, &idx.ModTime, &n} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	if idx.Interval <= 0 || n < 0 || n*8 != int64(r.Len()) {
+		return nil, errors.New("malformed record index")
+	}
+	idx.Offsets = make([]int64, n)
+	if err := binary.Read(r, binary.LittleEndian, idx.Offsets); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// OpenRecordsAt opens the named file of fs for reading its records from
+// the record number record, 0 being the first, using idx to skip to it.
+// The file is seeked to the offset preceding the record, or read up to it
+// when it can't seek. The content isn't decompressed, as if opts were Raw.
+// It returns io.EOF if the file has no such record.
+func OpenRecordsAt(fs Fs, name string, idx *RecordIndex, record int64, opts RecordOptions) (*RecordReader, error) {
+	if record < 0 || record >= idx.Records {
+		return nil, io.EOF
+	}
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	offset := idx.Offsets[record/idx.Interval]
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		if _, err := io.CopyN(ioutil.Discard, f, offset); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	opts.Raw = true
+	rr, err := NewRecordReader(f, opts)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	rr.f = f
+	for i := record % idx.Interval; i > 0; i-- {
+		if _, err := skipRecord(rr.r); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return rr, nil
+}
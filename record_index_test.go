@@ -0,0 +1,57 @@
+package kafero
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestRecordIndex(t *testing.T) {
+	fs := NewMemMapFs()
+	var buf bytes.Buffer
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&buf, "record %d\n", i)
+	}
+	// The last record may miss its end of line
+	buf.WriteString("last")
+	if err := WriteFile(fs, "/ticks.csv", buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildRecordIndex(fs, "/ticks.csv", 100); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := LoadRecordIndex(fs, "/ticks.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.Records != 10001 || len(idx.Offsets) != 101 {
+		t.Fatalf("was expecting 10001 records and 101 offsets, got %d and %d", idx.Records, len(idx.Offsets))
+	}
+	// The files which can't seek are read up to the offset
+	for _, fs := range []Fs{fs, &streamFs{Fs: fs}} {
+		for record, expected := range map[int64]string{0: "record 0", 5432: "record 5432", 9999: "record 9999", 10000: "last"} {
+			rr, err := OpenRecordsAt(fs, "/ticks.csv", idx, record, RecordOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := rr.Lines()
+			if !lines.Scan() || lines.Text() != expected {
+				t.Fatalf("was expecting %q, got %q, %v", expected, lines.Text(), lines.Err())
+			}
+			if err := rr.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if _, err := OpenRecordsAt(fs, "/ticks.csv", idx, 10001, RecordOptions{}); err != io.EOF {
+		t.Fatalf("was expecting io.EOF, got %v", err)
+	}
+
+	if err := WriteFile(fs, "/ticks.csv", []byte("record 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadRecordIndex(fs, "/ticks.csv"); err != ErrStaleIndex {
+		t.Fatalf("was expecting ErrStaleIndex, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package kafero
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	// Default initial size of the buffer of the record readers
+	defaultRecordBufferSize = 64 * 1024
+	// Default maximum size of the lines read by the record readers
+	defaultMaxRecordSize = 64 * 1024 * 1024
+)
+
+var (
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	gzipMagic = []byte{0x1f, 0x8b}
+)
+
+// RecordOptions are the options of the record readers.
+type RecordOptions struct {
+	// BufferSize is the initial size of the read buffer, 64KB if 0.
+	BufferSize int
+	// MaxRecordSize is the maximum size of a line, 64MB if 0. The buffer
+	// grows up to it, where bufio.Scanner stops at 64KB by default.
+	MaxRecordSize int
+	// Raw disables the decompression of the content compressed with zstd,
+	// as written by zstfs, or gzip, which is detected from its first bytes.
+	// The files read through a zstfs.Fs are already decompressed.
+	Raw bool
+}
+
+// RecordReader streams the records of a file, or any reader: lines, JSON
+// values or CSV records.
+type RecordReader struct {
+	r    *bufio.Reader
+	opts RecordOptions
+	zr   *zstd.Decoder
+	gr   *gzip.Reader
+	f    File
+}
+
+func (a Afero) OpenRecords(name string, opts RecordOptions) (*RecordReader, error) {
+	return OpenRecords(a.Fs, name, opts)
+}
+
+// OpenRecords opens the file name of fs for reading its records. Closing
+// the RecordReader closes the file.
+func OpenRecords(fs Fs, name string, opts RecordOptions) (*RecordReader, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	rr, err := NewRecordReader(f, opts)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	rr.f = f
+	return rr, nil
+}
+
+// NewRecordReader returns a RecordReader reading the records of r,
+// decompressing them unless opts is Raw.
+func NewRecordReader(r io.Reader, opts RecordOptions) (*RecordReader, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultRecordBufferSize
+	}
+	if opts.MaxRecordSize <= 0 {
+		opts.MaxRecordSize = defaultMaxRecordSize
+	}
+	if opts.MaxRecordSize < opts.BufferSize {
+		opts.MaxRecordSize = opts.BufferSize
+	}
+	rr := &RecordReader{r: bufio.NewReaderSize(r, opts.BufferSize), opts: opts}
+	if opts.Raw {
+		return rr, nil
+	}
+	magic, err := rr.r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		rr.zr, err = zstd.NewReader(rr.r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		rr.r = bufio.NewReaderSize(rr.zr, opts.BufferSize)
+	case bytes.HasPrefix(magic, gzipMagic):
+		rr.gr, err = gzip.NewReader(rr.r)
+		if err != nil {
+			return nil, err
+		}
+		rr.r = bufio.NewReaderSize(rr.gr, opts.BufferSize)
+	}
+	return rr, nil
+}
+
+// Read reads the decompressed content.
+func (rr *RecordReader) Read(p []byte) (int, error) {
+	return rr.r.Read(p)
+}
+
+// Lines returns a scanner of the lines, without their end of line, which
+// fails with bufio.ErrTooLong on the lines longer than MaxRecordSize.
+func (rr *RecordReader) Lines() *bufio.Scanner {
+	s := bufio.NewScanner(rr.r)
+	s.Buffer(make([]byte, 0, rr.opts.BufferSize), rr.opts.MaxRecordSize)
+	return s
+}
+
+// JSON returns a decoder of the stream of JSON values, such as NDJSON.
+func (rr *RecordReader) JSON() *json.Decoder {
+	return json.NewDecoder(rr.r)
+}
+
+// CSV returns a reader of the CSV records.
+func (rr *RecordReader) CSV() *csv.Reader {
+	return csv.NewReader(rr.r)
+}
+
+// Close releases the decompressor, and closes the file opened by
+// OpenRecords.
+func (rr *RecordReader) Close() error {
+	if rr.zr != nil {
+		rr.zr.Close()
+	}
+	if rr.gr != nil {
+		_ = rr.gr.Close()
+	}
+	if rr.f != nil {
+		return rr.f.Close()
+	}
+	return nil
+}
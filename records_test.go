@@ -0,0 +1,123 @@
+package kafero
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRecordReader(t *testing.T) {
+	fs := NewMemMapFs()
+	long := strings.Repeat("a", 100*1024)
+	if err := WriteFile(fs, "lines.txt", []byte("first\n"+long+"\nlast"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rr, err := OpenRecords(fs, "lines.txt", RecordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	s := rr.Lines()
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 3 || lines[1] != long || lines[2] != "last" {
+		t.Fatalf("was expecting 3 lines, got %d", len(lines))
+	}
+	if err := rr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rr, err = OpenRecords(fs, "lines.txt", RecordOptions{BufferSize: 1024, MaxRecordSize: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = rr.Lines()
+	for s.Scan() {
+	}
+	if s.Err() != bufio.ErrTooLong {
+		t.Fatalf("was expecting bufio.ErrTooLong, got %v", s.Err())
+	}
+	_ = rr.Close()
+}
+
+func TestRecordReaderDecompress(t *testing.T) {
+	fs := NewMemMapFs()
+
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write([]byte("{\"a\":1}\n{\"a\":2}\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "data.ndjson.zst", buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rr, err := OpenRecords(fs, "data.ndjson.zst", RecordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec := rr.JSON()
+	sum := 0
+	for dec.More() {
+		var v struct{ A int }
+		if err := dec.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		sum += v.A
+	}
+	if sum != 3 {
+		t.Fatalf("was expecting a sum of 3, got %d", sum)
+	}
+	_ = rr.Close()
+
+	buf.Reset()
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte("a,b\n1,2\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	rr, err = NewRecordReader(bytes.NewReader(buf.Bytes()), RecordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := rr.CSV().ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[1][1] != "2" {
+		t.Fatalf("was expecting 2 records, got %v", records)
+	}
+	_ = rr.Close()
+
+	rr, err = NewRecordReader(bytes.NewReader(buf.Bytes()), RecordOptions{Raw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 2)
+	if _, err := rr.Read(b); err != nil || !bytes.Equal(b, gzipMagic) {
+		t.Fatalf("was expecting the raw gzip content, got %v, %v", b, err)
+	}
+
+	rr, err = NewRecordReader(strings.NewReader(""), RecordOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr.Lines().Scan() {
+		t.Fatal("was expecting no lines in an empty reader")
+	}
+}
@@ -11,6 +11,8 @@ import (
 // files matching the given regexp will be allowed, all others get a ENOENT error (
 // "No such file or directory").
 //
+// Deprecated: use NewRegexpFilterFs, whose FilterFs also filters the
+// listings of ReadDir and Walk and confines its callers.
 type RegexpFs struct {
 	re     *regexp.Regexp
 	source Fs
@@ -64,6 +66,10 @@ func (r *RegexpFs) Name() string {
 	return "RegexpFs"
 }
 
+func (r *RegexpFs) Unwrap() Fs {
+	return r.source
+}
+
 func (r *RegexpFs) Stat(name string) (os.FileInfo, error) {
 	if err := r.dirOrMatches(name); err != nil {
 		return nil, err
@@ -91,6 +97,9 @@ func (r *RegexpFs) Rename(oldname, newname string) error {
 func (r *RegexpFs) RemoveAll(p string) error {
 	dir, err := IsDir(r.source, p)
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return err
 	}
 	if !dir {
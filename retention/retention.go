@@ -0,0 +1,121 @@
+// Package retention deletes the files of an Fs which are past their
+// retention period.
+package retention
+
+import (
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// A Policy selects the regular files older than MaxAge whose base name
+// matches Pattern, with the filepath.Match syntax, an empty Pattern
+// matching all of them.
+type Policy struct {
+	Pattern string
+	MaxAge  time.Duration
+}
+
+// Options are the options of Run.
+type Options struct {
+	// DryRun reports the files to delete without deleting them.
+	DryRun bool
+	// Rate is the maximum number of files deleted per second, 0 not
+	// limiting it.
+	Rate float64
+	// Workers is the number of files deleted concurrently, 1 if 0.
+	Workers int
+	// Clock tells the time the age of the files is computed from,
+	// kafero.SystemClock if nil.
+	Clock kafero.Clock
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	// Files are the paths of the files matching the policies, sorted,
+	// which are deleted unless in Errors or on a dry run.
+	Files []string
+	// Size is the total size of Files.
+	Size int64
+	// Errors are the errors deleting files, by path. The files already
+	// removed are not errors.
+	Errors map[string]error
+}
+
+// Run deletes the regular files of the tree rooted at root matching any of
+// the policies. The symlinks are not followed. It only returns an error if
+// the tree can't be searched, the errors deleting files being in the
+// report, along with the files deleted before the search failed.
+func Run(fs kafero.Fs, root string, policies []Policy, opts Options) (*Report, error) {
+	clock := opts.Clock
+	if clock == nil {
+		clock = kafero.SystemClock
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	now := clock.Now()
+	report := &Report{Errors: make(map[string]error)}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range queue {
+				err := fs.Remove(path)
+				mu.Lock()
+				if err != nil && !os.IsNotExist(err) {
+					report.Errors[path] = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	var tick <-chan time.Time
+	if opts.Rate > 0 && !opts.DryRun {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	seen := make(map[string]bool)
+	var err error
+	for _, policy := range policies {
+		it := kafero.Find(fs, root, kafero.FindOptions{
+			Name:           policy.Pattern,
+			Type:           kafero.RegularFile,
+			ModifiedBefore: now.Add(-policy.MaxAge),
+		})
+		for it.Next() {
+			path := it.Path()
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			report.Files = append(report.Files, path)
+			report.Size += it.Info().Size()
+			if opts.DryRun {
+				continue
+			}
+			if tick != nil {
+				<-tick
+			}
+			queue <- path
+		}
+		if err = it.Err(); err != nil {
+			break
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	sort.Strings(report.Files)
+	return report, err
+}
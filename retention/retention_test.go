@@ -0,0 +1,86 @@
+package retention
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+func setup(t *testing.T, now time.Time) kafero.Fs {
+	fs := kafero.NewMemMapFs()
+	ages := map[string]time.Duration{
+		"new.tick":         time.Hour,
+		"old.tick":         40 * 24 * time.Hour,
+		"old.log":          10 * 24 * time.Hour,
+		"new.log":          time.Hour,
+		"dir/old.tick":     40 * 24 * time.Hour,
+		"dir/sub/keep.csv": 400 * 24 * time.Hour,
+	}
+	fixture := make(tests.Fixture)
+	for name := range ages {
+		fixture[name] = "data"
+	}
+	if err := fixture.Load(fs, "root"); err != nil {
+		t.Fatal(err)
+	}
+	for name, age := range ages {
+		mtime := now.Add(-age)
+		if err := fs.Chtimes(filepath.Join("root", filepath.FromSlash(name)), mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return fs
+}
+
+func TestRun(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)
+	policies := []Policy{
+		{Pattern: "*.tick", MaxAge: 30 * 24 * time.Hour},
+		{Pattern: "*.log", MaxAge: 7 * 24 * time.Hour},
+	}
+	expected := []string{
+		filepath.Join("root", "dir", "old.tick"),
+		filepath.Join("root", "old.log"),
+		filepath.Join("root", "old.tick"),
+	}
+
+	fs := setup(t, now)
+	report, err := Run(fs, "root", policies, Options{DryRun: true, Clock: kafero.NewFakeClock(now)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Files, expected) || report.Size != 12 {
+		t.Fatalf("was expecting %v of size 12, got %v of size %d", expected, report.Files, report.Size)
+	}
+	for _, name := range expected {
+		if ok, _ := kafero.Exists(fs, name); !ok {
+			t.Fatalf("was expecting %s to be kept on a dry run", name)
+		}
+	}
+
+	report, err = Run(fs, "root", policies, Options{Workers: 4, Rate: 1000, Clock: kafero.NewFakeClock(now)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Files, expected) || len(report.Errors) != 0 {
+		t.Fatalf("was expecting %v deleted without errors, got %v and %v", expected, report.Files, report.Errors)
+	}
+	for _, name := range expected {
+		if ok, _ := kafero.Exists(fs, name); ok {
+			t.Fatalf("was expecting %s to be deleted", name)
+		}
+	}
+	for _, name := range []string{"root/new.tick", "root/new.log", "root/dir/sub/keep.csv"} {
+		if ok, _ := kafero.Exists(fs, name); !ok {
+			t.Fatalf("was expecting %s to be kept", name)
+		}
+	}
+
+	if _, err := Run(fs, "missing", policies, Options{}); err == nil {
+		t.Fatal("was expecting an error for a missing root")
+	}
+}
@@ -0,0 +1,243 @@
+package kafero
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A RotateHook processes a segment of a RotatingWriter once rotated, such
+// as GzipSegment.
+type RotateHook func(fs Fs, name string) error
+
+// The RotatingWriter writes to sequential segment files of a filesystem,
+// such as rolling logs, starting a new segment once the current one is
+// maxSize bytes or maxAge old. The segments are named after pattern, a
+// format with the sequence number of the segment, such as
+// "logs/app-%06d.log", the sequence continuing after the segments
+// existing. The writes aren't split over segments, so that the segments
+// hold whole records, the segments exceeding maxSize only when a single
+// write does.
+type RotatingWriter struct {
+	fs      Fs
+	pattern string
+	maxSize int64
+	maxAge  time.Duration
+	hook    RotateHook
+	clock   Clock
+
+	mu     sync.Mutex
+	seq    int
+	f      File
+	size   int64
+	opened time.Time
+	// The hooks running, and the first of their errors
+	hooks   sync.WaitGroup
+	hookErr error
+	errL    sync.Mutex
+}
+
+// NewRotatingWriter returns a RotatingWriter writing segments named after
+// pattern to fs, rotated once maxSize bytes or maxAge old, the sizes or
+// ages of 0 being unlimited.
+func NewRotatingWriter(fs Fs, pattern string, maxSize int64, maxAge time.Duration) *RotatingWriter {
+	return &RotatingWriter{fs: fs, pattern: pattern, maxSize: maxSize, maxAge: maxAge, clock: SystemClock, seq: -1}
+}
+
+// SetRotateHook makes the RotatingWriter run hook on the segments once
+// rotated, in the background. It must be called before the first write.
+func (w *RotatingWriter) SetRotateHook(hook RotateHook) {
+	w.hook = hook
+}
+
+// SetClock sets the clock telling the age of the segments.
+func (w *RotatingWriter) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// Segment returns the name of the segment written, empty if none is open.
+func (w *RotatingWriter) Segment() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return ""
+	}
+	return w.segmentName(w.seq)
+}
+
+func (w *RotatingWriter) segmentName(seq int) string {
+	return fmt.Sprintf(w.pattern, seq)
+}
+
+// lastSeq returns the sequence number of the last segment existing, those
+// processed by the hooks included, -1 if none.
+func (w *RotatingWriter) lastSeq() (int, error) {
+	dir := filepath.Dir(w.pattern)
+	names, err := ReadDirNames(w.fs, dir)
+	if err != nil && !os.IsNotExist(err) {
+		return -1, err
+	}
+	last := -1
+	for _, name := range names {
+		var seq int
+		path := filepath.Join(dir, name)
+		if _, err := fmt.Sscanf(path, w.pattern, &seq); err != nil {
+			continue
+		}
+		if strings.HasPrefix(path, w.segmentName(seq)) && seq > last {
+			last = seq
+		}
+	}
+	return last, nil
+}
+
+// open opens the next segment.
+func (w *RotatingWriter) open() error {
+	if w.seq < 0 {
+		last, err := w.lastSeq()
+		if err != nil {
+			return err
+		}
+		w.seq = last
+		if err := w.fs.MkdirAll(filepath.Dir(w.pattern), 0755); err != nil {
+			return err
+		}
+	}
+	w.seq++
+	f, err := w.fs.OpenFile(w.segmentName(w.seq), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	w.f, w.size, w.opened = f, 0, w.clock.Now()
+	return nil
+}
+
+// rotate closes the current segment, running the hook on it.
+func (w *RotatingWriter) rotate() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	if err != nil {
+		return err
+	}
+	if w.hook != nil {
+		name := w.segmentName(w.seq)
+		w.hooks.Add(1)
+		go func() {
+			defer w.hooks.Done()
+			if err := w.hook(w.fs, name); err != nil {
+				w.errL.Lock()
+				if w.hookErr == nil {
+					w.hookErr = fmt.Errorf("error processing segment %s: %v", name, err)
+				}
+				w.errL.Unlock()
+			}
+		}()
+	}
+	return nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f != nil {
+		full := w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize
+		old := w.maxAge > 0 && w.clock.Now().Sub(w.opened) >= w.maxAge
+		if full || old {
+			if err := w.rotate(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Rotate closes the current segment, the next write starting a new one.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+// Sync commits the current segment to the filesystem.
+func (w *RotatingWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	return w.f.Sync()
+}
+
+// Close rotates the current segment and waits for the hooks running. It
+// returns the first error of the hooks, if any.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	err := w.rotate()
+	w.mu.Unlock()
+	w.hooks.Wait()
+	if err != nil {
+		return err
+	}
+	w.errL.Lock()
+	defer w.errL.Unlock()
+	return w.hookErr
+}
+
+// GzipSegment is a RotateHook compressing the segment name with gzip, to
+// name.gz, removing the segment once compressed.
+func GzipSegment(fs Fs, name string) error {
+	return compressSegment(fs, name, name+".gz", func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	})
+}
+
+// ZstdSegment is a RotateHook compressing the segment name with zstd, to
+// name.zst, removing the segment once compressed.
+func ZstdSegment(fs Fs, name string) error {
+	return compressSegment(fs, name, name+".zst", func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	})
+}
+
+func compressSegment(fs Fs, name, dst string, newWriter func(w io.Writer) (io.WriteCloser, error)) error {
+	src, err := fs.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	f, err := fs.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw, err := newWriter(f)
+	if err == nil {
+		if _, err = io.Copy(zw, src); err == nil {
+			err = zw.Close()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = fs.Remove(dst)
+		return err
+	}
+	return fs.Remove(name)
+}
@@ -0,0 +1,81 @@
+package kafero
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	fs := NewMemMapFs()
+	clock := NewFakeClock(time.Unix(0, 0))
+	w := NewRotatingWriter(fs, "/logs/app-%03d.log", 10, time.Hour)
+	w.SetClock(clock)
+	for _, line := range []string{"aaaa\n", "bbbb\n", "cccc\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Rotated by age
+	clock.Advance(time.Hour)
+	if _, err := w.Write([]byte("dd\n")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Segment() != "/logs/app-002.log" {
+		t.Fatalf("was expecting the third segment, got %s", w.Segment())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"/logs/app-000.log": "aaaa\nbbbb\n",
+		"/logs/app-001.log": "cccc\n",
+		"/logs/app-002.log": "dd\n",
+	} {
+		if data, err := ReadFile(fs, name); err != nil || string(data) != content {
+			t.Fatalf("was expecting %q in %s, got %q, %v", content, name, data, err)
+		}
+	}
+
+	// The sequence continues after the segments existing, compressed or not
+	w = NewRotatingWriter(fs, "/logs/app-%03d.log", 10, 0)
+	w.SetRotateHook(GzipSegment)
+	for _, line := range []string{"eeeeee\n", "ffffff\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(fs, "/logs/app-003.log"); exists {
+		t.Fatal("was expecting the rotated segment removed")
+	}
+	f, err := fs.Open("/logs/app-003.log.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadAll(gr); err != nil || string(data) != "eeeeee\n" {
+		t.Fatalf("was expecting the compressed segment, got %q, %v", data, err)
+	}
+	if exists, _ := Exists(fs, "/logs/app-004.log.gz"); !exists {
+		t.Fatal("was expecting the last segment compressed once closed")
+	}
+
+	w = NewRotatingWriter(fs, "/logs/app-%03d.log", 0, 0)
+	if _, err := w.Write([]byte("g")); err != nil {
+		t.Fatal(err)
+	}
+	if w.Segment() != "/logs/app-005.log" {
+		t.Fatalf("was expecting the sequence continued, got %s", w.Segment())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
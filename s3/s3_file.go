@@ -2,11 +2,13 @@
 package s3
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"github.com/melaurent/kafero"
 	"io"
 	"mime"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -68,7 +70,7 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	}
 	// ListObjects treats leading slashes as part of the directory name
 	// It also needs a trailing slash to list contents of a directory.
-	name := strings.TrimPrefix(f.Name(), "/") // + "/"
+	name := strings.TrimPrefix(f.fs.key(f.Name()), "/") // + "/"
 
 	// For the root of the bucket, we need to remove any prefix
 	if name != "" && !strings.HasSuffix(name, "/") {
@@ -91,7 +93,7 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 	}
 	var fis = make([]os.FileInfo, 0, len(output.CommonPrefixes)+len(output.Contents))
 	for _, subfolder := range output.CommonPrefixes {
-		fis = append(fis, NewFileInfo(path.Base("/"+*subfolder.Prefix), true, 0, time.Unix(0, 0)))
+		fis = append(fis, NewFileInfo(f.fs.decode(path.Base("/"+*subfolder.Prefix)), true, 0, time.Unix(0, 0)))
 	}
 	for _, fileObject := range output.Contents {
 		if strings.HasSuffix(*fileObject.Key, "/") {
@@ -99,7 +101,7 @@ func (f *File) Readdir(n int) ([]os.FileInfo, error) {
 			continue
 		}
 
-		fis = append(fis, NewFileInfo(path.Base("/"+*fileObject.Key), false, *fileObject.Size, *fileObject.LastModified))
+		fis = append(fis, NewFileInfo(f.fs.decode(path.Base("/"+*fileObject.Key)), false, *fileObject.Size, *fileObject.LastModified))
 	}
 
 	return fis, nil
@@ -256,15 +258,13 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 }
 
 func (f *File) seekRead(offset int64, whence int) (int64, error) {
-	startByte := int64(0)
-
-	switch whence {
-	case io.SeekStart:
-		startByte = offset
-	case io.SeekCurrent:
-		startByte = f.streamReadOffset + offset
-	case io.SeekEnd:
-		startByte = f.cachedInfo.Size() - offset
+	// The offsets relative to the end are counted backwards
+	if whence == io.SeekEnd {
+		offset = -offset
+	}
+	startByte, err := kafero.SeekOffset(f.name, f.streamReadOffset, f.cachedInfo.Size(), offset, whence)
+	if err != nil {
+		return 0, err
 	}
 
 	if err := f.streamRead.Close(); err != nil {
@@ -272,10 +272,6 @@ func (f *File) seekRead(offset int64, whence int) (int64, error) {
 	}
 	f.streamRead = nil
 
-	if startByte < 0 {
-		return startByte, ErrInvalidSeek
-	}
-
 	return startByte, f.openReadStream(startByte)
 }
 
@@ -310,7 +306,7 @@ func (f *File) openWriteStream() error {
 	go func() {
 		input := &s3manager.UploadInput{
 			Bucket: aws.String(f.fs.bucket),
-			Key:    aws.String(f.name),
+			Key:    aws.String(f.fs.key(f.name)),
 			Body:   reader,
 		}
 
@@ -322,6 +318,13 @@ func (f *File) openWriteStream() error {
 		if input.ContentType == nil {
 			input.ContentType = aws.String(mime.TypeByExtension(filepath.Ext(f.name)))
 		}
+		if *input.ContentType == "" && (f.fs.FileProps == nil || !f.fs.FileProps.DisableContentSniffing) {
+			// Wait for the first bytes of the stream to sniff them
+			body := bufio.NewReaderSize(reader, 512)
+			head, _ := body.Peek(512)
+			input.ContentType = aws.String(http.DetectContentType(head))
+			input.Body = body
+		}
 
 		_, err := uploader.Upload(input)
 
@@ -350,7 +353,7 @@ func (f *File) openReadStream(startAt int64) error {
 
 	resp, err := f.fs.s3API.GetObject(&s3.GetObjectInput{
 		Bucket: aws.String(f.fs.bucket),
-		Key:    aws.String(f.name),
+		Key:    aws.String(f.fs.key(f.name)),
 		Range:  streamRange,
 	})
 	if err != nil {
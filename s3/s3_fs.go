@@ -23,7 +23,11 @@ import (
 // Fs is an FS object backed by S3.
 type Fs struct {
 	FileProps *UploadedFileProperties // FileProps define the file properties we want to set for all new files
-	session   *session.Session        // Session config
+	// NameCodec encodes the path elements of the files into the ones of
+	// the keys of their objects, if not nil. The objects not written
+	// through the codec are listed with their name.
+	NameCodec kafero.NameCodec
+	session   *session.Session // Session config
 	s3API     *s3.S3
 	bucket    string // Bucket name
 }
@@ -33,6 +37,9 @@ type UploadedFileProperties struct {
 	ACL          *string // ACL defines the right to apply
 	CacheControl *string // CacheControl defines the Cache-Control header
 	ContentType  *string // ContentType define the Content-Type header
+	// DisableContentSniffing stops guessing the Content-Type from the first
+	// bytes written when the file extension is unknown
+	DisableContentSniffing bool
 }
 
 // NewFs creates a new Fs object writing files to a given S3 bucket.
@@ -45,6 +52,33 @@ func NewFs(bucket string, session *session.Session) *Fs {
 	}
 }
 
+// key returns the key of the object of the file name.
+func (fs Fs) key(name string) string {
+	if fs.NameCodec == nil {
+		return name
+	}
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if elem != "" {
+			elems[i] = fs.NameCodec.Encode(elem)
+		}
+	}
+	return strings.Join(elems, "/")
+}
+
+// decode returns the decoded path element elem of a key, or elem if it was
+// not encoded by the codec: only the elements encoding back to themselves
+// are decoded.
+func (fs Fs) decode(elem string) string {
+	if fs.NameCodec == nil {
+		return elem
+	}
+	if name, err := fs.NameCodec.Decode(elem); err == nil && fs.NameCodec.Encode(name) == elem {
+		return name
+	}
+	return elem
+}
+
 // ErrNotImplemented is returned when this operation is not (yet) implemented
 var ErrNotImplemented = errors.New("not implemented")
 
@@ -54,7 +88,10 @@ var ErrNotSupported = errors.New("s3 doesn't support this operation")
 // ErrAlreadyOpened is returned when the file is already opened
 var ErrAlreadyOpened = errors.New("already opened")
 
-// ErrInvalidSeek is returned when the seek operation is not doable
+// ErrInvalidSeek was returned when the seek operation is not doable.
+//
+// Deprecated: the invalid seeks fail with a *os.PathError wrapping
+// syscall.EINVAL, as with os.File.
 var ErrInvalidSeek = errors.New("invalid seek offset")
 
 // Name returns the type of FS object this is: Fs.
@@ -65,7 +102,7 @@ func (fs Fs) Create(name string) (kafero.File, error) {
 	{ // It's faster to trigger an explicit empty put object than opening a file for write, closing it and re-opening it
 		req := &s3.PutObjectInput{
 			Bucket: aws.String(fs.bucket),
-			Key:    aws.String(name),
+			Key:    aws.String(fs.key(name)),
 			Body:   bytes.NewReader([]byte{}),
 		}
 
@@ -94,7 +131,7 @@ func (fs Fs) Create(name string) (kafero.File, error) {
 	// wait until S3 reports the object exists.
 	return file, fs.s3API.WaitUntilObjectExists(&s3.HeadObjectInput{
 		Bucket: aws.String(fs.bucket),
-		Key:    aws.String(name),
+		Key:    aws.String(fs.key(name)),
 	})
 }
 
@@ -174,12 +211,12 @@ func (fs Fs) forceRemove(name string) error {
 	}
 	_, err := fs.s3API.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(fs.bucket),
-		Key:    aws.String(name),
+		Key:    aws.String(fs.key(name)),
 	})
 	return err
 }
 
-// RemoveAll removes a path.
+// RemoveAll removes a path, and returns nil if it doesn't exist.
 func (fs *Fs) RemoveAll(name string) error {
 	s3dir := NewFile(fs, name)
 	fis, err := s3dir.Readdir(0)
@@ -202,7 +239,11 @@ func (fs *Fs) RemoveAll(name string) error {
 	if err := fs.forceRemove(s3dir.Name() + "/"); err != nil {
 		return err
 	}
-	return nil
+	// or the file itself, deleting a missing object succeeding
+	if strings.Trim(s3dir.Name(), "/") == "" {
+		return nil
+	}
+	return fs.forceRemove(s3dir.Name())
 }
 
 // Rename a file.
@@ -215,15 +256,15 @@ func (fs Fs) Rename(oldname, newname string) error {
 	}
 	_, err := fs.s3API.CopyObject(&s3.CopyObjectInput{
 		Bucket:     aws.String(fs.bucket),
-		CopySource: aws.String(fs.bucket + oldname),
-		Key:        aws.String(newname),
+		CopySource: aws.String(fs.bucket + fs.key(oldname)),
+		Key:        aws.String(fs.key(newname)),
 	})
 	if err != nil {
 		return err
 	}
 	_, err = fs.s3API.DeleteObject(&s3.DeleteObjectInput{
 		Bucket: aws.String(fs.bucket),
-		Key:    aws.String(oldname),
+		Key:    aws.String(fs.key(oldname)),
 	})
 	return err
 }
@@ -233,7 +274,7 @@ func (fs Fs) Rename(oldname, newname string) error {
 func (fs Fs) Stat(name string) (os.FileInfo, error) {
 	out, err := fs.s3API.HeadObject(&s3.HeadObjectInput{
 		Bucket: aws.String(fs.bucket),
-		Key:    aws.String(name),
+		Key:    aws.String(fs.key(name)),
 	})
 	if err != nil {
 		var errRequestFailure awserr.RequestFailure
@@ -266,7 +307,7 @@ func (fs Fs) statDirectory(name string) (os.FileInfo, error) {
 	nameClean := path.Clean(name)
 	out, err := fs.s3API.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket:  aws.String(fs.bucket),
-		Prefix:  aws.String(strings.TrimPrefix(nameClean, "/")),
+		Prefix:  aws.String(strings.TrimPrefix(fs.key(nameClean), "/")),
 		MaxKeys: aws.Int64(1),
 	})
 	if err != nil {
@@ -304,7 +345,7 @@ func (fs Fs) Chmod(name string, mode os.FileMode) error {
 
 	_, err := fs.s3API.PutObjectAcl(&s3.PutObjectAclInput{
 		Bucket: aws.String(fs.bucket),
-		Key:    aws.String(name),
+		Key:    aws.String(fs.key(name)),
 		ACL:    aws.String(acl),
 	})
 	return err
@@ -0,0 +1,225 @@
+package kafero
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Scanner inspects the content written to a file, e.g. with an antivirus
+// or a magic bytes allowlist. Scan reads the content from r and returns an
+// error to reject it. It may return before reaching the end of r.
+type Scanner interface {
+	Scan(name string, r io.Reader) error
+}
+
+// ScannerFunc is a function used as a Scanner.
+type ScannerFunc func(name string, r io.Reader) error
+
+func (s ScannerFunc) Scan(name string, r io.Reader) error {
+	return s(name, r)
+}
+
+// ScanError is returned by the Close of a file whose content was rejected
+// by the Scanner of a ScannerFs.
+type ScanError struct {
+	Path string
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("%s: content rejected: %v", e.Path, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+var errRescan = errors.New("non sequential write")
+
+// The ScannerFs streams the content written to its files through a
+// Scanner while it is written. A rejected file is removed, and the Close
+// of the file returns a *ScanError.
+// Files written sequentially from the start are scanned as they are
+// written, the others are read back and scanned on Close.
+type ScannerFs struct {
+	source  Fs
+	scanner Scanner
+}
+
+func NewScannerFs(source Fs, scanner Scanner) *ScannerFs {
+	return &ScannerFs{source: source, scanner: scanner}
+}
+
+// scan reads back the named file and scans it.
+func (s *ScannerFs) scan(name string) error {
+	f, err := s.source.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return s.scanner.Scan(name, f)
+}
+
+func (s *ScannerFs) Create(name string) (File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (s *ScannerFs) Mkdir(name string, perm os.FileMode) error {
+	return s.source.Mkdir(name, perm)
+}
+
+func (s *ScannerFs) MkdirAll(path string, perm os.FileMode) error {
+	return s.source.MkdirAll(path, perm)
+}
+
+func (s *ScannerFs) Open(name string) (File, error) {
+	return s.source.Open(name)
+}
+
+func (s *ScannerFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := s.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+	sf := &scanFile{File: f, fs: s, name: name}
+	if flag&os.O_TRUNC == 0 {
+		// Existing content must be scanned as well
+		if info, err := f.Stat(); err != nil || info.Size() > 0 {
+			sf.rescan = true
+		}
+	}
+	if !sf.rescan {
+		pr, pw := io.Pipe()
+		sf.pw = pw
+		sf.done = make(chan error, 1)
+		go func() {
+			err := s.scanner.Scan(name, pr)
+			// Unblock the writes if the scanner returned early
+			pr.Close()
+			sf.done <- err
+		}()
+	}
+	return sf, nil
+}
+
+func (s *ScannerFs) Remove(name string) error {
+	return s.source.Remove(name)
+}
+
+func (s *ScannerFs) RemoveAll(path string) error {
+	return s.source.RemoveAll(path)
+}
+
+func (s *ScannerFs) Rename(oldname, newname string) error {
+	return s.source.Rename(oldname, newname)
+}
+
+func (s *ScannerFs) Stat(name string) (os.FileInfo, error) {
+	return s.source.Stat(name)
+}
+
+func (s *ScannerFs) Name() string {
+	return "ScannerFs"
+}
+
+func (s *ScannerFs) Unwrap() Fs {
+	return s.source
+}
+
+func (s *ScannerFs) Chmod(name string, mode os.FileMode) error {
+	return s.source.Chmod(name, mode)
+}
+
+func (s *ScannerFs) Chtimes(name string, atime, mtime time.Time) error {
+	return s.source.Chtimes(name, atime, mtime)
+}
+
+// scanFile is a file opened for writing through a ScannerFs.
+type scanFile struct {
+	File
+	fs     *ScannerFs
+	name   string
+	pw     *io.PipeWriter
+	done   chan error
+	rescan bool
+}
+
+// stream sends written bytes to the scanner.
+func (f *scanFile) stream(p []byte) {
+	if f.pw == nil {
+		return
+	}
+	if _, err := f.pw.Write(p); err != nil {
+		// The scanner is done, its result is read on Close
+		f.pw = nil
+	}
+}
+
+// abortStream stops the streaming, the file will be scanned on Close.
+func (f *scanFile) abortStream() {
+	if f.rescan {
+		return
+	}
+	f.rescan = true
+	if f.pw != nil {
+		f.pw.CloseWithError(errRescan)
+		f.pw = nil
+	}
+	<-f.done
+}
+
+func (f *scanFile) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.stream(p[:n])
+	return n, err
+}
+
+func (f *scanFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *scanFile) WriteAt(p []byte, off int64) (int, error) {
+	f.abortStream()
+	return f.File.WriteAt(p, off)
+}
+
+func (f *scanFile) Seek(offset int64, whence int) (int64, error) {
+	f.abortStream()
+	return f.File.Seek(offset, whence)
+}
+
+func (f *scanFile) Truncate(size int64) error {
+	f.abortStream()
+	return f.File.Truncate(size)
+}
+
+func (f *scanFile) Close() error {
+	cerr := f.File.Close()
+	var err error
+	if f.rescan {
+		if cerr == nil {
+			err = f.fs.scan(f.name)
+		}
+	} else {
+		if f.pw != nil {
+			f.pw.Close()
+		}
+		err = <-f.done
+	}
+	if cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		if rerr := f.fs.source.Remove(f.name); rerr != nil && !os.IsNotExist(rerr) {
+			return fmt.Errorf("error removing rejected file: %v", rerr)
+		}
+		return &ScanError{Path: f.name, Err: err}
+	}
+	return nil
+}
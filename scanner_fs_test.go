@@ -0,0 +1,74 @@
+package kafero
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestScannerFs(t *testing.T) {
+	infected := errors.New("infected")
+	fs := NewScannerFs(NewMemMapFs(), ScannerFunc(func(name string, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(data, []byte("EICAR")) {
+			return infected
+		}
+		return nil
+	}))
+
+	if err := WriteFile(fs, "/clean.txt", []byte("clean"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Create("/infected.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("X5O!P%@AP EICAR"); err != nil {
+		t.Fatal(err)
+	}
+	err = f.Close()
+	var serr *ScanError
+	if !errors.As(err, &serr) || !errors.Is(err, infected) {
+		t.Fatalf("was expecting a scan error, got %v", err)
+	}
+	if _, err := fs.Stat("/infected.txt"); !os.IsNotExist(err) {
+		t.Fatal("was expecting the rejected file to be removed")
+	}
+
+	// Non sequential writes are scanned on close
+	f, err = fs.OpenFile("/clean.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("EICAR"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); !errors.Is(err, infected) {
+		t.Fatalf("was expecting a scan error, got %v", err)
+	}
+
+	// Scanners may only read the start of the content
+	magic := NewScannerFs(NewMemMapFs(), ScannerFunc(func(name string, r io.Reader) error {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		if string(header) != "\x89PNG" {
+			return errors.New("not a png")
+		}
+		return nil
+	}))
+	content := append([]byte("\x89PNG"), make([]byte, 1<<20)...)
+	if err := WriteFile(magic, "/image.png", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(magic, "/image.gif", []byte("GIF89a"), 0644); err == nil {
+		t.Fatal("was expecting a scan error")
+	}
+}
@@ -0,0 +1,158 @@
+package kafero
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// ErrFileTooLarge is returned by the writes beyond the limit of a
+// LimitFile.
+var ErrFileTooLarge = errors.New("file too large")
+
+// CopyN copies n bytes, or until an error, from src at offset off to dst,
+// as io.CopyN does, and returns the number of bytes copied. src is read
+// with ReadAt, so its cursor doesn't move. It returns io.EOF if src ends
+// before n bytes.
+func CopyN(dst io.Writer, src File, off, n int64) (int64, error) {
+	written, err := io.Copy(dst, io.NewSectionReader(src, off, n))
+	if err == nil && written < n {
+		err = io.EOF
+	}
+	return written, err
+}
+
+// SectionFile is a read only view of the n bytes of a file starting at
+// offset off, with its own cursor, as io.SectionReader is, so that the
+// bounded views of a large file can be handed out without copying it.
+// The file is read with ReadAt, and closing the view doesn't close it.
+type SectionFile struct {
+	*io.SectionReader
+	f File
+}
+
+func NewSectionFile(f File, off int64, n int64) *SectionFile {
+	return &SectionFile{SectionReader: io.NewSectionReader(f, off, n), f: f}
+}
+
+func (s *SectionFile) readOnly(op string) error {
+	return &os.PathError{Op: op, Path: s.f.Name(), Err: ErrReadOnlyHandle}
+}
+
+func (s *SectionFile) Name() string {
+	return s.f.Name()
+}
+
+// Stat returns the FileInfo of the file, with the size of the section.
+func (s *SectionFile) Stat() (os.FileInfo, error) {
+	info, err := s.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sizedFileInfo{FileInfo: info, size: s.Size()}, nil
+}
+
+func (s *SectionFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, &os.PathError{Op: "readdir", Path: s.f.Name(), Err: syscall.ENOTDIR}
+}
+
+func (s *SectionFile) Readdirnames(n int) ([]string, error) {
+	return nil, &os.PathError{Op: "readdir", Path: s.f.Name(), Err: syscall.ENOTDIR}
+}
+
+func (s *SectionFile) Write(p []byte) (int, error) {
+	return 0, s.readOnly("write")
+}
+
+func (s *SectionFile) WriteAt(p []byte, off int64) (int, error) {
+	return 0, s.readOnly("writeat")
+}
+
+func (s *SectionFile) WriteString(str string) (int, error) {
+	return 0, s.readOnly("write")
+}
+
+func (s *SectionFile) Truncate(size int64) error {
+	return s.readOnly("truncate")
+}
+
+func (s *SectionFile) Sync() error {
+	return nil
+}
+
+func (s *SectionFile) Close() error {
+	return nil
+}
+
+func (s *SectionFile) CanMmap() bool {
+	return false
+}
+
+func (s *SectionFile) Mmap(offset int64, length int, prot int, flags int) ([]byte, error) {
+	return nil, s.readOnly("mmap")
+}
+
+func (s *SectionFile) Munmap() error {
+	return s.readOnly("munmap")
+}
+
+// LimitFile limits the size of a file to n bytes: the writes beyond are
+// cut at the limit, and fail with ErrFileTooLarge, as do the truncations
+// beyond it. It bounds what writers streaming into a file, such as the
+// handlers of uploads, can store.
+type LimitFile struct {
+	File
+	n int64
+}
+
+func NewLimitFile(f File, n int64) *LimitFile {
+	return &LimitFile{File: f, n: n}
+}
+
+func (f *LimitFile) tooLarge(op string) error {
+	return &os.PathError{Op: op, Path: f.Name(), Err: ErrFileTooLarge}
+}
+
+func (f *LimitFile) Write(p []byte) (int, error) {
+	off, err := f.File.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if off+int64(len(p)) <= f.n {
+		return f.File.Write(p)
+	}
+	if off >= f.n {
+		return 0, f.tooLarge("write")
+	}
+	n, err := f.File.Write(p[:f.n-off])
+	if err == nil {
+		err = f.tooLarge("write")
+	}
+	return n, err
+}
+
+func (f *LimitFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *LimitFile) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) <= f.n {
+		return f.File.WriteAt(p, off)
+	}
+	if off >= f.n {
+		return 0, f.tooLarge("writeat")
+	}
+	n, err := f.File.WriteAt(p[:f.n-off], off)
+	if err == nil {
+		err = f.tooLarge("writeat")
+	}
+	return n, err
+}
+
+func (f *LimitFile) Truncate(size int64) error {
+	if size > f.n {
+		return f.tooLarge("truncate")
+	}
+	return f.File.Truncate(size)
+}
@@ -0,0 +1,86 @@
+package kafero
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSectionFile(t *testing.T) {
+	fs := NewMemMapFs()
+	if err := WriteFile(fs, "data.bin", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := fs.Open("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	n, err := CopyN(&buf, f, 2, 3)
+	if err != nil || n != 3 || buf.String() != "234" {
+		t.Fatalf("was expecting 234, got %s, %v", buf.String(), err)
+	}
+	if _, err := CopyN(ioutil.Discard, f, 8, 3); err != io.EOF {
+		t.Fatalf("was expecting io.EOF, got %v", err)
+	}
+
+	s := NewSectionFile(f, 3, 4)
+	b, err := ioutil.ReadAll(s)
+	if err != nil || string(b) != "3456" {
+		t.Fatalf("was expecting 3456, got %s, %v", b, err)
+	}
+	if _, err := s.Seek(1, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err = ioutil.ReadAll(s)
+	if err != nil || string(b) != "456" {
+		t.Fatalf("was expecting 456, got %s, %v", b, err)
+	}
+	fi, err := s.Stat()
+	if err != nil || fi.Size() != 4 {
+		t.Fatalf("was expecting a size of 4, got %v", err)
+	}
+	if _, err := s.Write([]byte("a")); err == nil {
+		t.Fatal("was expecting an error writing to a section")
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// The file stays open
+	if _, err := f.ReadAt(make([]byte, 1), 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimitFile(t *testing.T) {
+	fs := NewMemMapFs()
+	f, err := fs.Create("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewLimitFile(f, 5)
+	if n, err := l.Write([]byte("0123")); n != 4 || err != nil {
+		t.Fatalf("was expecting 4 bytes written, got %d, %v", n, err)
+	}
+	n, err := l.Write([]byte("456"))
+	if perr, ok := err.(*os.PathError); !ok || perr.Err != ErrFileTooLarge || n != 1 {
+		t.Fatalf("was expecting 1 byte written and ErrFileTooLarge, got %d, %v", n, err)
+	}
+	if _, err := l.WriteAt([]byte("a"), 5); err == nil {
+		t.Fatal("was expecting an error writing beyond the limit")
+	}
+	if err := l.Truncate(6); err == nil {
+		t.Fatal("was expecting an error truncating beyond the limit")
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadFile(fs, "data.bin")
+	if err != nil || string(b) != "01234" {
+		t.Fatalf("was expecting 01234, got %s, %v", b, err)
+	}
+}
@@ -0,0 +1,29 @@
+package kafero
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// SeekOffset returns the offset resulting from a seek to offset relative to
+// whence in the named file, at pos and of the given size. As os.File does,
+// it fails with a *os.PathError wrapping syscall.EINVAL for an invalid
+// whence or a negative resulting offset, so that the files of the
+// filesystems which can't rely on the operating system report the invalid
+// seeks alike.
+func SeekOffset(name string, pos, size, offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += pos
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, &os.PathError{Op: "seek", Path: name, Err: syscall.EINVAL}
+	}
+	if offset < 0 {
+		return 0, &os.PathError{Op: "seek", Path: name, Err: syscall.EINVAL}
+	}
+	return offset, nil
+}
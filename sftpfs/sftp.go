@@ -102,10 +102,29 @@ func (s Fs) Remove(name string) error {
 	return s.client.Remove(name)
 }
 
+// RemoveAll removes path and its content, without following the symbolic
+// links. As os.RemoveAll, it returns nil if path doesn't exist.
 func (s Fs) RemoveAll(path string) error {
-	// TODO have a look at os.RemoveAll
-	// https://github.com/golang/go/blob/master/src/os/path.go#L66
-	return nil
+	fi, err := s.client.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !fi.IsDir() {
+		return s.client.Remove(path)
+	}
+	fis, err := s.client.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		if err := s.RemoveAll(s.client.Join(path, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return s.client.RemoveDirectory(path)
 }
 
 func (s Fs) Rename(oldname, newname string) error {
@@ -0,0 +1,94 @@
+package kafero
+
+import (
+	"context"
+	"reflect"
+)
+
+// Shutdowner is an optional interface in Kafero. It is implemented by the
+// filesystems holding background state, such as the index of their cache
+// or the refreshes running, to save and release it once the filesystem is
+// not used anymore.
+type Shutdowner interface {
+	// Shutdown waits for the background work of the filesystem, until ctx
+	// is done, and saves its state. The filesystem must not be used
+	// afterwards.
+	Shutdown(ctx context.Context) error
+}
+
+var (
+	_ Shutdowner = (*SizeCacheFS)(nil)
+	_ Shutdowner = (*CacheOnReadFs)(nil)
+)
+
+// CloseAll shuts down the layers of the stack fs, from the top, so that
+// the state flushed by a layer reaches those below before they are closed.
+// The layers implementing Shutdowner are shut down with ctx, those with a
+// Close method, such as the filesystems of journalfs, are closed. The
+// layers are found through Describer and Unwrapper, each being closed
+// once. It returns the first error, after closing all the layers.
+func CloseAll(ctx context.Context, fs Fs) error {
+	var first error
+	closed := make(map[Fs]bool)
+	var closeAll func(fs Fs)
+	closeAll = func(fs Fs) {
+		if fs == nil {
+			return
+		}
+		if reflect.TypeOf(fs).Comparable() {
+			if closed[fs] {
+				return
+			}
+			closed[fs] = true
+		}
+		var err error
+		switch c := fs.(type) {
+		case Shutdowner:
+			err = c.Shutdown(ctx)
+		case interface{ Close() error }:
+			err = c.Close()
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+		for _, w := range wrapped(fs) {
+			closeAll(w)
+		}
+	}
+	closeAll(fs)
+	return first
+}
+
+// wrapped returns the filesystems wrapped by fs.
+func wrapped(fs Fs) []Fs {
+	if d, ok := fs.(Describer); ok {
+		var fss []Fs
+		for _, w := range d.Describe().Wrapped {
+			fss = append(fss, w.Fs)
+		}
+		return fss
+	}
+	if u := Unwrap(fs); u != nil {
+		return []Fs{u}
+	}
+	return nil
+}
+
+// Shutdown waits for the refreshes running, until ctx is done, and saves
+// the index of the cache, as Close.
+func (u *SizeCacheFS) Shutdown(ctx context.Context) error {
+	if u.refresher != nil {
+		if err := u.refresher.stop(ctx); err != nil {
+			return err
+		}
+	}
+	return u.Close()
+}
+
+// Shutdown waits for the refreshes running, until ctx is done.
+func (u *CacheOnReadFs) Shutdown(ctx context.Context) error {
+	if u.refresher != nil {
+		return u.refresher.stop(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package kafero
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// closingFs counts its closes.
+type closingFs struct {
+	Fs
+	closes int
+}
+
+func (c *closingFs) Close() error {
+	c.closes++
+	return nil
+}
+
+func TestCloseAll(t *testing.T) {
+	base := &closingFs{Fs: NewMemMapFs()}
+	cache := NewMemMapFs()
+	sfs, err := NewSizeCacheFS(NewReadOnlyFs(base), cache, 1000, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sfs.SetStaleWhileRevalidate(1)
+	fs := NewBufferFs(sfs, base)
+	if err := CloseAll(context.Background(), fs); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(cache, ".cacheindex"); !exists {
+		t.Fatal("was expecting the cache index saved")
+	}
+	if base.closes != 1 {
+		t.Fatalf("was expecting the base closed once, got %d", base.closes)
+	}
+	if sfs.refresher.refresh("a.txt", func() {}) {
+		t.Fatal("was expecting the refreshes stopped")
+	}
+}
@@ -4,29 +4,77 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 	"time"
 )
 
 type SizeCacheFile struct {
-	Base  File
-	Cache File
-	Flag  int
-	fs    *SizeCacheFS
-	info  *cacheFile
+	Base     File
+	Cache    File
+	Flag     int
+	fs       *SizeCacheFS
+	info     *cacheFile
+	path     string
+	mmapOnce sync.Once
+	mmap     *mmapRegion
+	endWrite func()
+	// The modification time to restore on close, if any
+	mtime time.Time
 }
 
 func NewSizeCacheFile(base File, cache File, flag int, fs *SizeCacheFS, info *cacheFile) File {
-	return &SizeCacheFile{
+	var path string
+	if info != nil {
+		path = info.Path
+	}
+	return newSizeCacheFile(path, base, cache, flag, fs, info)
+}
+
+func newSizeCacheFile(path string, base File, cache File, flag int, fs *SizeCacheFS, info *cacheFile) *SizeCacheFile {
+	f := &SizeCacheFile{
 		Base:  base,
 		Cache: cache,
 		Flag:  flag,
 		fs:    fs,
 		info:  info,
+		path:  path,
 	}
+	if fs != nil {
+		fs.openHandle(f)
+	}
+	return f
+}
+
+// unlinked returns whether the file was removed or renamed since opened.
+func (f *SizeCacheFile) unlinked() bool {
+	return f.fs != nil && f.fs.isUnlinked(f)
 }
 
+// Close syncs the file to the base and puts it back in the cache. The
+// file removed or renamed since opened is neither synced to the base nor
+// put back in the cache, its path now naming another file or none: as on
+// POSIX systems, its content goes away with the last handle.
 func (f *SizeCacheFile) Close() error {
+	if f.endWrite != nil {
+		defer f.endWrite()
+	}
+	unlinked := f.fs != nil && f.fs.closeHandle(f)
+	if f.mmap != nil {
+		if err := f.fs.releaseMmap(f.mmap); err != nil {
+			return fmt.Errorf("error releasing cache file mapping: %v", err)
+		}
+		f.mmap = nil
+	}
+	if unlinked {
+		_ = f.Base.Close()
+		return f.Cache.Close()
+	}
 	if err := f.Sync(); err != nil {
+		// The cache file holds content which is not in the base file, it
+		// must not be served
+		_ = f.Base.Close()
+		_ = f.Cache.Close()
+		_ = f.fs.cache.Remove(f.Name())
 		return fmt.Errorf("error syncing to base file: %v", err)
 	}
 	fstat, err := f.Base.Stat()
@@ -39,11 +87,26 @@ func (f *SizeCacheFile) Close() error {
 	if err := f.Cache.Close(); err != nil {
 		return fmt.Errorf("error closing buffer file: %v", err)
 	}
-	err = f.fs.cache.Chtimes(f.Name(), fstat.ModTime(), fstat.ModTime())
+	if !f.mtime.IsZero() {
+		// Not all the filesystems can set the times
+		if err := f.fs.base.Chtimes(f.path, f.mtime, f.mtime); err == nil {
+			if info, err := f.fs.base.Stat(f.path); err == nil {
+				fstat = info
+			}
+		}
+	}
+	// Only a written cache file holds the current content of the base file,
+	// a stale one must not look fresh after being read
+	written := f.Flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+	if written {
+		_ = f.fs.cache.Chtimes(f.Name(), fstat.ModTime(), fstat.ModTime())
+	}
 	if f.info != nil {
 		// Update size in FS
-		f.info.Size = fstat.Size()
-		f.info.LastAccessTime = time.Now().UnixNano() / 1000
+		if written {
+			f.info.Size = fstat.Size()
+		}
+		f.info.LastAccessTime = f.fs.now().UnixNano() / 1000
 
 		return f.fs.addToCache(f.info)
 	} else {
@@ -52,11 +115,39 @@ func (f *SizeCacheFile) Close() error {
 }
 
 func (f *SizeCacheFile) Read(b []byte) (int, error) {
-	return f.Cache.Read(b)
+	n, err := f.Cache.Read(b)
+	f.bandwidth().addFromCache(int64(n))
+	return n, err
+}
+
+func (f *SizeCacheFile) ReadAt(b []byte, o int64) (n int, err error) {
+	if r := f.region(); r != nil {
+		n, err = r.ReadAt(b, o)
+	} else {
+		n, err = f.Cache.ReadAt(b, o)
+	}
+	f.bandwidth().addFromCache(int64(n))
+	return n, err
+}
+
+// bandwidth returns the counters of the filesystem of the file, if any.
+func (f *SizeCacheFile) bandwidth() *bandwidth {
+	if f.fs == nil {
+		return nil
+	}
+	return f.fs.bandwidth
 }
 
-func (f *SizeCacheFile) ReadAt(b []byte, o int64) (int, error) {
-	return f.Cache.ReadAt(b, o)
+// region returns the shared mapping of the cache file, only used by the
+// read only files.
+func (f *SizeCacheFile) region() *mmapRegion {
+	if f.Flag != os.O_RDONLY || f.fs == nil || f.path == "" {
+		return nil
+	}
+	f.mmapOnce.Do(func() {
+		f.mmap = f.fs.acquireMmap(f.path)
+	})
+	return f.mmap
 }
 
 func (f *SizeCacheFile) Seek(o int64, w int) (int64, error) {
@@ -84,11 +175,23 @@ func (f *SizeCacheFile) Readdirnames(c int) ([]string, error) {
 }
 
 func (f *SizeCacheFile) Stat() (os.FileInfo, error) {
-	return f.Cache.Stat()
+	if f.Cache == nil {
+		return f.Base.Stat()
+	}
+	fi, err := f.Cache.Stat()
+	// The directories of the cache only hold the cached files, the ones of
+	// the base are the actual directories
+	if err == nil && fi.IsDir() && f.Base != nil {
+		return f.Base.Stat()
+	}
+	return fi, err
 }
 
+// Sync copies the content of the cache file to the base file, unless the
+// file was removed or renamed since opened, which would bring its old path
+// back.
 func (f *SizeCacheFile) Sync() error {
-	if f.Flag == os.O_RDONLY {
+	if f.Flag == os.O_RDONLY || f.unlinked() {
 		return nil
 	}
 	if err := f.Base.Truncate(0); err != nil {
@@ -104,7 +207,9 @@ func (f *SizeCacheFile) Sync() error {
 	if _, err := f.Cache.Seek(0, 0); err != nil {
 		return fmt.Errorf("error seeking buffer file to start: %v", err)
 	}
-	if _, err := io.Copy(f.Base, f.Cache); err != nil {
+	n, err := io.Copy(f.Base, f.Cache)
+	f.bandwidth().addToBase(n)
+	if err != nil {
 		return fmt.Errorf("error copying buffer to base file: %v", err)
 	}
 	if _, err := f.Cache.Seek(idx, 0); err != nil {
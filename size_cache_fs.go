@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/golang/groupcache/singleflight"
 	"github.com/wangjia184/sortedset"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -28,16 +30,55 @@ type cacheFile struct {
 }
 
 type SizeCacheFS struct {
+	*sizeCacheState
 	base      Fs
 	cache     Fs
 	cacheSize int64
 	cacheTime time.Duration
-	currSize  int64
-	files     *sortedset.SortedSet
-	cacheL    sync.Mutex
+	negative  *negativeCache
+	disk      *diskBudget
+	clock     Clock
+	bandwidth *bandwidth
+	refresher *refresher
+	lock      DistributedLock
+	// Whether the cache is attached read only, see AttachSizeCacheFS
+	attached bool
+	// Whether the files written keep their modification time
+	preserveTimes bool
+}
+
+// sizeCacheState is the state of a SizeCacheFS, shared with its views
+// bound to contexts.
+type sizeCacheState struct {
+	currSize int64
+	files    *sortedset.SortedSet
+	cacheL   sync.Mutex
+	mmapL    sync.Mutex
+	mmaps    map[string]*mmapRegion
+	writers  map[string]int
+	fill     singleflight.Group
+	// The open handles, with whether their file was removed or renamed
+	// since opened
+	handles map[*SizeCacheFile]bool
+}
+
+// diskBudget derives the cache size from the free space of the cache
+// filesystem.
+type diskBudget struct {
+	minFree  float64
+	interval time.Duration
+	checked  time.Time
+	size     int64
 }
 
 func NewSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration) (*SizeCacheFS, error) {
+	return openSizeCacheFS(base, cache, cacheSize, cacheTime, false)
+}
+
+// openSizeCacheFS loads or rebuilds the index of cache. The temporary
+// files left by a crash are removed when rebuilding it, unless attached,
+// the owner of the cache possibly still writing them.
+func openSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration, attached bool) (*SizeCacheFS, error) {
 	if cacheSize < 0 {
 		cacheSize = 0
 	}
@@ -51,6 +92,13 @@ func NewSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration)
 			if err != nil {
 				return err
 			}
+			if info.IsDir() && isCacheTempDir(path) {
+				if !attached {
+					// Left by a crash
+					_ = cache.RemoveAll(path)
+				}
+				return filepath.SkipDir
+			}
 			if !info.IsDir() {
 				file := &cacheFile{
 					Path:           path,
@@ -75,6 +123,43 @@ func NewSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration)
 		}
 	}
 
+	fs := newSizeCacheFS(base, cache, cacheSize, cacheTime, files)
+	fs.attached = attached
+	return fs, nil
+}
+
+// cacheTempDir is the directory of the cache layers, reserved as
+// .cacheindex is, holding the temporary copies of the cache files being
+// detached or refreshed, renamed over them once complete. It is left out
+// of the index.
+const cacheTempDir = ".cachetmp"
+
+// cacheTempPath returns the name of the temporary copy of the cache file
+// of name, with the suffix of the operation writing it.
+func cacheTempPath(name, suffix string) string {
+	return filepath.Join(cacheTempDir, strings.TrimPrefix(filepath.Clean(name), string(filepath.Separator))+suffix)
+}
+
+// isCacheTempDir reports whether path is the directory cacheTempDir.
+func isCacheTempDir(path string) bool {
+	return strings.Trim(filepath.ToSlash(filepath.Clean(path)), "/") == cacheTempDir
+}
+
+// AttachSizeCacheFS returns a SizeCacheFS reading the cache directory and
+// index of another SizeCacheFS, such as the one of the main process of an
+// application for the tools running aside, without modifying them: the
+// fresh cached files are read from the cache and the others from the base,
+// the cache being neither filled nor evicted, and the index not saved on
+// Close. The attached SizeCacheFS is read only, its write operations
+// failing with EPERM.
+func AttachSizeCacheFS(base Fs, cache Fs, cacheTime time.Duration) (*SizeCacheFS, error) {
+	return openSizeCacheFS(base, cache, 0, cacheTime, true)
+}
+
+func newSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration, files []*cacheFile) *SizeCacheFS {
+	if cacheSize < 0 {
+		cacheSize = 0
+	}
 	var currSize int64 = 0
 	set := sortedset.New()
 	for _, f := range files {
@@ -83,15 +168,146 @@ func NewSizeCacheFS(base Fs, cache Fs, cacheSize int64, cacheTime time.Duration)
 	}
 
 	fs := &SizeCacheFS{
-		base:      base,
-		cache:     cache,
-		cacheSize: cacheSize,
-		cacheTime: cacheTime,
-		currSize:  currSize,
-		files:     set,
+		sizeCacheState: &sizeCacheState{currSize: currSize, files: set},
+		base:           base,
+		cache:          cache,
+		cacheSize:      cacheSize,
+		cacheTime:      cacheTime,
+		bandwidth:      &bandwidth{},
 	}
 
-	return fs, nil
+	return fs
+}
+
+// SetNegativeCacheTTL enables the caching of failed lookups: a path missing
+// from the base is reported missing for ttl without asking the base again.
+// Files created through the SizeCacheFS are visible immediately, files
+// created directly in the base may not be until ttl expires. A ttl of 0
+// disables the negative cache.
+func (u *SizeCacheFS) SetNegativeCacheTTL(ttl time.Duration) {
+	u.negative = newNegativeCache(ttl, u.clock)
+}
+
+// SetStaleWhileRevalidate makes the SizeCacheFS serve the stale cached
+// files immediately, refreshing them from the base in the background, at
+// most concurrency at a time, instead of refreshing them before opening
+// them for reading. The files are served stale until refreshed, the
+// refreshes beyond concurrency being retried on the next opens. A
+// concurrency of 0 restores the refresh before opening. It must be called
+// before the SizeCacheFS is used.
+func (u *SizeCacheFS) SetStaleWhileRevalidate(concurrency int) {
+	u.refresher = newRefresher(concurrency)
+}
+
+// SetDistributedLock makes the SizeCacheFS take the lock of the files it
+// fills and evicts, and of its index when saving it, for several processes
+// to share the cache directory without filling or evicting the same files
+// at the same time. With LockFiles, the lock files belong on another
+// filesystem than the cache, not to be taken for cached files. It must be
+// called before the SizeCacheFS is used.
+func (u *SizeCacheFS) SetDistributedLock(lock DistributedLock) {
+	u.lock = lock
+}
+
+// lockEntry takes the distributed lock of key, if any.
+func (u *SizeCacheFS) lockEntry(key string) (func(), error) {
+	if u.lock == nil {
+		return func() {}, nil
+	}
+	unlock, err := u.lock.Lock(key)
+	if err != nil {
+		return nil, fmt.Errorf("error locking %s: %v", key, err)
+	}
+	return unlock, nil
+}
+
+// SetClock makes the SizeCacheFS tell the access times and the staleness of
+// the cached files, and the expiry of the negative cache, with clock rather
+// than the system time. It must be called before the SizeCacheFS is used,
+// and before SetNegativeCacheTTL.
+func (u *SizeCacheFS) SetClock(clock Clock) {
+	u.clock = clock
+}
+
+// SetPreserveTimes makes the files written through the SizeCacheFS keep the
+// modification time they had before being opened, when the base can set
+// it, as when rewriting files in place without changing their content.
+// Otherwise the files get the modification time the base gives them, which
+// the cached files copy so that they are fresh.
+func (u *SizeCacheFS) SetPreserveTimes(preserve bool) {
+	u.preserveTimes = preserve
+}
+
+// modTime returns the modification time to restore on close of the file
+// name about to be written, zero if none.
+func (u *SizeCacheFS) modTime(name string) time.Time {
+	if !u.preserveTimes {
+		return time.Time{}
+	}
+	info, err := u.base.Stat(name)
+	if err != nil || info.IsDir() {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (u *SizeCacheFS) now() time.Time {
+	if u.clock == nil {
+		return time.Now()
+	}
+	return u.clock.Now()
+}
+
+// SetMinFreeRatio makes the cache size follow the free space of the cache
+// filesystem, so that at least minFree (e.g. 0.1) of the disk stays free
+// as other processes write to it. The size given to NewSizeCacheFS remains
+// an upper bound. The free space is re-evaluated at most every interval,
+// through the Statfser interface of the cache filesystem.
+func (u *SizeCacheFS) SetMinFreeRatio(minFree float64, interval time.Duration) error {
+	u.cacheL.Lock()
+	defer u.cacheL.Unlock()
+	if minFree <= 0 {
+		u.disk = nil
+		return nil
+	}
+	disk := &diskBudget{minFree: minFree, interval: interval}
+	if err := u.updateBudget(disk); err != nil {
+		return err
+	}
+	u.disk = disk
+	return nil
+}
+
+// updateBudget computes the cache size from the disk usage. Must be called
+// with cacheL held.
+func (u *SizeCacheFS) updateBudget(disk *diskBudget) error {
+	usage, err := Statfs(u.cache, ".")
+	if err != nil {
+		return fmt.Errorf("error getting cache filesystem usage: %v", err)
+	}
+	// The space used by the cache is available to the cache
+	size := u.currSize + int64(usage.Available) - int64(float64(usage.Total)*disk.minFree)
+	if size < 0 {
+		size = 0
+	}
+	if size > u.cacheSize {
+		size = u.cacheSize
+	}
+	disk.size = size
+	disk.checked = u.now()
+	return nil
+}
+
+// budget returns the current cache size. Must be called with cacheL held.
+func (u *SizeCacheFS) budget() int64 {
+	if u.disk == nil {
+		return u.cacheSize
+	}
+	if u.now().Sub(u.disk.checked) >= u.disk.interval {
+		// Keep the previous size if the usage is unavailable
+		_ = u.updateBudget(u.disk)
+	}
+	return u.disk.size
 }
 
 func (u *SizeCacheFS) getCacheFile(name string) (info *cacheFile) {
@@ -116,15 +332,23 @@ func (u *SizeCacheFS) addToCache(info *cacheFile) error {
 		u.currSize -= file.Size
 	}
 	// while we can pop files and the cache is full..
-	for u.currSize > 0 && u.currSize+info.Size > u.cacheSize {
+	budget := u.budget()
+	for u.currSize > 0 && u.currSize+info.Size > budget {
 		node := u.files.PopMin()
 		// node CAN'T be nil as currSize > 0
 		file := node.Value.(*cacheFile)
-		if err := u.cache.Remove(file.Path); err != nil {
+		unlock, err := u.lockEntry(file.Path)
+		if err != nil {
+			return err
+		}
+		err = u.cache.Remove(file.Path)
+		unlock()
+		if err != nil {
 			if !errors.Is(err, os.ErrNotExist) {
 				return fmt.Errorf("error removing cache file: %v", err)
 			}
 		}
+		u.retireMmap(file.Path)
 		u.currSize -= file.Size
 		path := filepath.Dir(file.Path)
 		for path != "" && path != "." && path != "/" {
@@ -166,15 +390,58 @@ func (u *SizeCacheFS) removeFromCache(name string) {
 
 	node := u.files.GetByKey(name)
 	if node != nil {
-		// If we remove file that is open, the file will re-add itself in
-		// the cache on close. This is expected behavior as a removed open file
-		// will re-appear on close ?
+		// The open files are not in the cache, see unlinkHandles
 		u.files.Remove(name)
 		info := node.Value.(*cacheFile)
 		u.currSize -= info.Size
 	}
 }
 
+// openHandle tracks f, until closeHandle.
+func (u *SizeCacheFS) openHandle(f *SizeCacheFile) {
+	u.cacheL.Lock()
+	defer u.cacheL.Unlock()
+	if u.handles == nil {
+		u.handles = make(map[*SizeCacheFile]bool)
+	}
+	u.handles[f] = false
+}
+
+// closeHandle stops tracking f, returning whether its file was removed or
+// renamed since opened.
+func (u *SizeCacheFS) closeHandle(f *SizeCacheFile) bool {
+	u.cacheL.Lock()
+	defer u.cacheL.Unlock()
+	unlinked := u.handles[f]
+	delete(u.handles, f)
+	return unlinked
+}
+
+// isUnlinked returns whether the file of f was removed or renamed since
+// opened.
+func (u *SizeCacheFS) isUnlinked(f *SizeCacheFile) bool {
+	u.cacheL.Lock()
+	defer u.cacheL.Unlock()
+	return u.handles[f]
+}
+
+// unlinkHandles marks the open handles of name, and of the files under
+// it, as unlinked: as on POSIX systems, they keep working on the content
+// they opened, which is neither synced to the base nor put back in the
+// cache.
+func (u *SizeCacheFS) unlinkHandles(name string) {
+	u.cacheL.Lock()
+	defer u.cacheL.Unlock()
+	name = filepath.Clean(name)
+	prefix := name + string(filepath.Separator)
+	for f := range u.handles {
+		path := filepath.Clean(f.path)
+		if path == name || strings.HasPrefix(path, prefix) {
+			u.handles[f] = true
+		}
+	}
+}
+
 /*
 
 func (u *CacheOnReadFs) cacheStatus(name string) (state cacheState, fi os.FileInfo, err error) {
@@ -213,7 +480,7 @@ func (u *SizeCacheFS) cacheStatus(name string) (state cacheState, fi os.FileInfo
 			return cacheHit, lfi, nil
 		}
 		// TODO checking even if shouldnt ?
-		if lfi.ModTime().Add(u.cacheTime).Before(time.Now()) {
+		if lfi.ModTime().Add(u.cacheTime).Before(u.now()) {
 			bfi, err = u.base.Stat(name)
 			if err != nil {
 				return cacheLocal, lfi, nil
@@ -236,6 +503,29 @@ func (u *SizeCacheFS) copyToCache(name string) (*cacheFile, error) {
 	// and replace it with current file
 	// TODO
 
+	unlock, err := u.lockEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if u.lock != nil {
+		// Filled by another process while waiting for the lock
+		if st, fi, err := u.cacheStatus(name); err == nil && st == cacheHit && !fi.IsDir() {
+			return &cacheFile{
+				Path:           name,
+				Size:           fi.Size(),
+				LastAccessTime: u.now().UnixNano() / 1000,
+			}, nil
+		}
+	}
+
+	// The cache file is rewritten, detach it from the readers mapping it
+	end, err := u.beginWrite(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+
 	// Get size, if size over our limit, evict one file
 	bfh, err := u.base.Open(name)
 	if err != nil {
@@ -264,6 +554,7 @@ func (u *SizeCacheFS) copyToCache(name string) (*cacheFile, error) {
 		return nil, err
 	}
 	n, err := io.Copy(lfh, bfh)
+	u.bandwidth.addFromBase(n)
 	if err != nil {
 		// If anything fails, clean up the file
 		_ = u.cache.Remove(name)
@@ -292,6 +583,9 @@ func (u *SizeCacheFS) copyToCache(name string) (*cacheFile, error) {
 	if err := u.cache.Chtimes(name, bfi.ModTime(), bfi.ModTime()); err != nil {
 		return nil, err
 	}
+	if err := u.cache.Chmod(name, bfi.Mode()); err != nil {
+		return nil, err
+	}
 
 	// if cache is stale and file already inside sorted set, we are just going to update it
 	// Create info
@@ -299,7 +593,7 @@ func (u *SizeCacheFS) copyToCache(name string) (*cacheFile, error) {
 		info := &cacheFile{
 			Path:           name,
 			Size:           bfi.Size(),
-			LastAccessTime: time.Now().UnixNano() / 1000,
+			LastAccessTime: u.now().UnixNano() / 1000,
 		}
 
 		return info, nil
@@ -308,7 +602,58 @@ func (u *SizeCacheFS) copyToCache(name string) (*cacheFile, error) {
 	}
 }
 
+// refreshCache copies name again from the base to the cache, where info,
+// if any, describes the stale copy, and puts it back in the cache.
+func (u *SizeCacheFS) refreshCache(name string, info *cacheFile) {
+	if info == nil {
+		info = &cacheFile{Path: name}
+	}
+	unlock, err := u.lockEntry(name)
+	if err != nil {
+		// Still stale, retried on the next open
+		_ = u.addToCache(info)
+		return
+	}
+	defer unlock()
+	tmp := refreshPath(name)
+	err = copyToLayerAs(u.base, u.cache, name, tmp)
+	if err == nil {
+		// The cache file is replaced, detach it from the readers mapping it
+		var end func()
+		if end, err = u.beginWrite(name, false); err == nil {
+			err = u.cache.Rename(tmp, name)
+			end()
+		}
+	}
+	if err != nil {
+		// Still stale, retried on the next open
+		_ = u.cache.Remove(tmp)
+	} else if fi, err := u.cache.Stat(name); err == nil {
+		u.bandwidth.addFromBase(fi.Size())
+		info.Size = fi.Size()
+	}
+	info.LastAccessTime = u.now().UnixNano() / 1000
+	_ = u.addToCache(info)
+}
+
+// fillCache copies name from the base once, however many goroutines are
+// opening it concurrently.
+func (u *SizeCacheFS) fillCache(name string) (*cacheFile, error) {
+	info, err := u.fill.Do(name, func() (interface{}, error) {
+		return u.copyToCache(name)
+	})
+	if err != nil || info.(*cacheFile) == nil {
+		return nil, err
+	}
+	// Each file updates its own info on close
+	c := *info.(*cacheFile)
+	return &c, nil
+}
+
 func (u *SizeCacheFS) Chtimes(name string, atime, mtime time.Time) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	exists, err := Exists(u.cache, name)
 	if err != nil {
 		return err
@@ -321,6 +666,9 @@ func (u *SizeCacheFS) Chtimes(name string, atime, mtime time.Time) error {
 }
 
 func (u *SizeCacheFS) Chmod(name string, mode os.FileMode) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	exists, err := Exists(u.cache, name)
 	if err != nil {
 		return err
@@ -333,30 +681,106 @@ func (u *SizeCacheFS) Chmod(name string, mode os.FileMode) error {
 }
 
 func (u *SizeCacheFS) Stat(name string) (os.FileInfo, error) {
-	return u.base.Stat(name)
+	if u.negative.missing(name) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	fi, err := u.base.Stat(name)
+	if err != nil && os.IsNotExist(err) {
+		u.negative.add(name)
+	}
+	return fi, err
+}
+
+var _ Lstater = (*SizeCacheFS)(nil)
+
+func (u *SizeCacheFS) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	lsf, ok := u.base.(Lstater)
+	if !ok {
+		info, err := u.Stat(name)
+		return info, false, err
+	}
+	if u.negative.missing(name) {
+		return nil, false, &os.PathError{Op: "lstat", Path: name, Err: os.ErrNotExist}
+	}
+	fi, lstat, err := lsf.LstatIfPossible(name)
+	if err != nil && os.IsNotExist(err) {
+		u.negative.add(name)
+	}
+	return fi, lstat, err
 }
 
 func (u *SizeCacheFS) Rename(oldname, newname string) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	exists, err := Exists(u.cache, oldname)
 	if err != nil {
 		return err
 	}
+	if exists {
+		end, err := u.beginWrite(oldname, true)
+		if err != nil {
+			return err
+		}
+		defer end()
+	}
+	if err := u.base.Rename(oldname, newname); err != nil {
+		return err
+	}
+	u.negative.invalidate(newname)
+	if oldname == newname {
+		return nil
+	}
+	u.unlinkHandles(oldname)
+	u.unlinkHandles(newname)
+	// The replaced file must not be served from the cache anymore
+	if err := u.uncacheTree(newname); err != nil {
+		return err
+	}
 	// If cache file exists, update to ensure consistency
 	if exists {
 		info := u.getCacheFile(oldname)
+		if info == nil {
+			// Directories are not tracked, drop their content
+			return u.uncacheTree(oldname)
+		}
 		u.removeFromCache(oldname)
 		info.Path = newname
 		if err := u.addToCache(info); err != nil {
 			return err
 		}
+		if err := u.cache.MkdirAll(filepath.Dir(newname), 0777); err != nil {
+			return err
+		}
 		if err := u.cache.Rename(oldname, newname); err != nil {
 			return err
 		}
 	}
-	return u.base.Rename(oldname, newname)
+	return nil
+}
+
+// uncacheTree removes the named file or directory from the cache.
+func (u *SizeCacheFS) uncacheTree(name string) error {
+	err := Walk(u.cache, name, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			u.retireMmap(path)
+			u.removeFromCache(path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return u.cache.RemoveAll(name)
 }
 
 func (u *SizeCacheFS) Remove(name string) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	exists, err := Exists(u.cache, name)
 	if err != nil {
 		return fmt.Errorf("error determining if file exists: %v", err)
@@ -366,12 +790,20 @@ func (u *SizeCacheFS) Remove(name string) error {
 		if err := u.cache.Remove(name); err != nil {
 			return fmt.Errorf("error removing cache file: %v", err)
 		}
+		u.retireMmap(name)
 		u.removeFromCache(name)
 	}
-	return u.base.Remove(name)
+	if err := u.base.Remove(name); err != nil {
+		return err
+	}
+	u.unlinkHandles(name)
+	return nil
 }
 
 func (u *SizeCacheFS) RemoveAll(name string) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	exists, err := Exists(u.cache, name)
 	if err != nil {
 		return err
@@ -395,18 +827,38 @@ func (u *SizeCacheFS) RemoveAll(name string) error {
 		_ = u.cache.RemoveAll(name)
 	}
 
-	return u.base.RemoveAll(name)
+	if err := u.base.RemoveAll(name); err != nil {
+		return err
+	}
+	u.unlinkHandles(name)
+	return nil
 }
 
 func (u *SizeCacheFS) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	if u.attached {
+		if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, syscall.EPERM
+		}
+		return u.openAttached(name)
+	}
 	// Very important, remove from cache to prevent eviction while opening
 	info := u.getCacheFile(name)
 	if info != nil {
 		u.removeFromCache(name)
 	}
 
+	endWrite := func() {}
+	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		end, err := u.beginWrite(name, flag&os.O_TRUNC == 0)
+		if err != nil {
+			return nil, err
+		}
+		endWrite = end
+	}
+
 	st, _, err := u.cacheStatus(name)
 	if err != nil {
+		endWrite()
 		return nil, err
 	}
 
@@ -416,12 +868,14 @@ func (u *SizeCacheFS) OpenFile(name string, flag int, perm os.FileMode) (File, e
 	default:
 		exists, err := Exists(u.base, name)
 		if err != nil {
+			endWrite()
 			return nil, fmt.Errorf("error determining if base file exists: %v", err)
 		}
 		if exists {
 			var err error
-			info, err = u.copyToCache(name)
+			info, err = u.fillCache(name)
 			if err != nil {
+				endWrite()
 				return nil, err
 			}
 		} else {
@@ -429,34 +883,58 @@ func (u *SizeCacheFS) OpenFile(name string, flag int, perm os.FileMode) (File, e
 			info = &cacheFile{
 				Path:           name,
 				Size:           0,
-				LastAccessTime: time.Now().UnixNano() / 1000,
+				LastAccessTime: u.now().UnixNano() / 1000,
 			}
 		}
 	}
 
 	var cacheFlag = flag
+	var mtime time.Time
 
 	if flag&(os.O_WRONLY|syscall.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
 		// Force read write mode
 		cacheFlag = (flag & (^os.O_WRONLY)) | os.O_RDWR
+		mtime = u.modTime(name)
 	}
 
 	bfi, err := u.base.OpenFile(name, flag, perm)
 	if err != nil {
+		endWrite()
+		if os.IsNotExist(err) {
+			u.negative.add(name)
+		}
+		return nil, err
+	}
+	if flag&os.O_CREATE != 0 {
+		u.negative.invalidate(name)
+	}
+	// The parent directory may only exist in the base
+	if err := u.cache.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		bfi.Close()
+		endWrite()
 		return nil, err
 	}
 	lfi, err := u.cache.OpenFile(name, cacheFlag, perm)
 	if err != nil {
 		bfi.Close() // oops, what if O_TRUNC was set and file opening in the layer failed...?
+		endWrite()
 		return nil, err
 	}
 
-	uf := NewSizeCacheFile(bfi, lfi, flag, u, info)
+	uf := newSizeCacheFile(name, bfi, lfi, flag, u, info)
+	uf.endWrite = endWrite
+	uf.mtime = mtime
 
 	return uf, nil
 }
 
 func (u *SizeCacheFS) Open(name string) (File, error) {
+	if u.negative.missing(name) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if u.attached {
+		return u.openAttached(name)
+	}
 	// Very important, remove from cache to prevent eviction while opening
 	info := u.getCacheFile(name)
 	if info != nil {
@@ -474,10 +952,13 @@ func (u *SizeCacheFS) Open(name string) (File, error) {
 	case cacheMiss:
 		bfi, err := u.base.Stat(name)
 		if err != nil {
+			if os.IsNotExist(err) {
+				u.negative.add(name)
+			}
 			return nil, err
 		}
 		if !bfi.IsDir() {
-			info, err = u.copyToCache(name)
+			info, err = u.fillCache(name)
 			if err != nil {
 				return nil, err
 			}
@@ -486,13 +967,20 @@ func (u *SizeCacheFS) Open(name string) (File, error) {
 		}
 
 	case cacheStale:
-		if !fi.IsDir() {
-			info, err = u.copyToCache(name)
+		if fi.IsDir() {
+			return u.base.Open(name)
+		}
+		if u.refresher == nil {
+			info, err = u.fillCache(name)
 			if err != nil {
 				return nil, err
 			}
-		} else {
-			return u.base.Open(name)
+			break
+		}
+		stale := info
+		if u.refresher.refresh(name, func() { u.refreshCache(name, stale) }) {
+			// Put back in the cache by the refresh
+			info = nil
 		}
 	}
 
@@ -508,33 +996,94 @@ func (u *SizeCacheFS) Open(name string) (File, error) {
 		return nil, err
 	}
 
-	uf := NewSizeCacheFile(bfile, lfile, os.O_RDONLY, u, info)
+	uf := newSizeCacheFile(name, bfile, lfile, os.O_RDONLY, u, info)
 	return uf, nil
 }
 
+// openAttached opens name from the cache if it holds it fresh, else from
+// the base, without modifying the cache.
+func (u *SizeCacheFS) openAttached(name string) (File, error) {
+	st, fi, err := u.cacheStatus(name)
+	if err != nil {
+		return nil, err
+	}
+	bfile, err := u.base.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			u.negative.add(name)
+		}
+		return nil, err
+	}
+	if (st != cacheHit && st != cacheLocal) || fi.IsDir() {
+		return bfile, nil
+	}
+	lfile, err := u.cache.Open(name)
+	if err != nil {
+		// Evicted meanwhile
+		return bfile, nil
+	}
+	// Not put back in the cache on close
+	return newSizeCacheFile(name, bfile, lfile, os.O_RDONLY, u, nil), nil
+}
+
 func (u *SizeCacheFS) Mkdir(name string, perm os.FileMode) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	err := u.base.Mkdir(name, perm)
 	if err != nil {
 		return err
 	}
+	u.negative.invalidate(name)
 	return u.cache.MkdirAll(name, perm) // yes, MkdirAll... we cannot assume it exists in the cache
 }
 
+// Bandwidth returns the bytes read from the cache, fetched from the base
+// to fill the cache, and written back to the base.
+func (u *SizeCacheFS) Bandwidth() Bandwidth {
+	return u.bandwidth.get()
+}
+
 func (u *SizeCacheFS) Name() string {
 	return "SizeCacheFS"
 }
 
+// Unwrap returns the base filesystem, the cache holding only copies of
+// its files.
+func (u *SizeCacheFS) Unwrap() Fs {
+	return u.base
+}
+
 func (u *SizeCacheFS) MkdirAll(name string, perm os.FileMode) error {
+	if u.attached {
+		return syscall.EPERM
+	}
 	err := u.base.MkdirAll(name, perm)
 	if err != nil {
 		return err
 	}
+	u.negative.invalidate(name)
 	return u.cache.MkdirAll(name, perm)
 }
 
 func (u *SizeCacheFS) Create(name string) (File, error) {
+	if u.attached {
+		return nil, syscall.EPERM
+	}
+	endWrite, err := u.beginWrite(name, false)
+	if err != nil {
+		return nil, err
+	}
+	mtime := u.modTime(name)
 	bfile, err := u.base.Create(name)
 	if err != nil {
+		endWrite()
+		return nil, err
+	}
+	u.negative.invalidate(name)
+	if err := u.cache.MkdirAll(filepath.Dir(name), 0777); err != nil {
+		_ = bfile.Close()
+		endWrite()
 		return nil, err
 	}
 	lfile, err := u.cache.Create(name)
@@ -542,17 +1091,20 @@ func (u *SizeCacheFS) Create(name string) (File, error) {
 		// oops, see comment about OS_TRUNC above, should we remove? then we have to
 		// remember if the file did not exist before
 		_ = bfile.Close()
+		endWrite()
 		return nil, err
 	}
 
 	info := &cacheFile{
 		Path:           name,
 		Size:           0,
-		LastAccessTime: time.Now().UnixNano() / 1000,
+		LastAccessTime: u.now().UnixNano() / 1000,
 	}
 	// Ensure file is out
 	u.removeFromCache(name)
-	uf := NewSizeCacheFile(bfile, lfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, u, info)
+	uf := newSizeCacheFile(name, bfile, lfile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, u, info)
+	uf.endWrite = endWrite
+	uf.mtime = mtime
 	return uf, nil
 }
 
@@ -561,6 +1113,9 @@ func (u *SizeCacheFS) Size() int64 {
 }
 
 func (u *SizeCacheFS) Close() error {
+	if u.attached {
+		return nil
+	}
 	// TODO close all open files
 	// Save index
 	var files []*cacheFile
@@ -573,8 +1128,37 @@ func (u *SizeCacheFS) Close() error {
 	if err != nil {
 		return fmt.Errorf("error marshalling files: %v", err)
 	}
+	unlock, err := u.lockEntry(".cacheindex")
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	if err := WriteFile(u.cache, ".cacheindex", data, 0644); err != nil {
 		return fmt.Errorf("error writing cache index: %v", err)
 	}
 	return nil
 }
+
+// The extended attributes are those of the base file.
+
+func (u *SizeCacheFS) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(u.base, name, attr)
+}
+
+func (u *SizeCacheFS) Setxattr(name, attr string, value []byte) error {
+	if u.attached {
+		return syscall.EPERM
+	}
+	return Setxattr(u.base, name, attr, value)
+}
+
+func (u *SizeCacheFS) Listxattr(name string) ([]string, error) {
+	return Listxattr(u.base, name)
+}
+
+func (u *SizeCacheFS) Removexattr(name, attr string) error {
+	if u.attached {
+		return syscall.EPERM
+	}
+	return Removexattr(u.base, name, attr)
+}
@@ -2,9 +2,15 @@ package kafero
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestSizeCacheFS_Size(t *testing.T) {
@@ -125,6 +131,137 @@ func TestSizeCacheFS_EvictOpen(t *testing.T) {
 	}
 }
 
+func TestSizeCacheFS_StaleHandles(t *testing.T) {
+	base := &MemMapFs{}
+	cacheFs, _ := NewSizeCacheFS(base, &MemMapFs{}, 1e+9, 0)
+	for _, name := range []string{"removed.txt", "renamed.txt"} {
+		if err := WriteFile(cacheFs, name, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := cacheFs.OpenFile("removed.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := cacheFs.OpenFile("renamed.txt", os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheFs.Remove("removed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheFs.Rename("renamed.txt", "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	// A new file under the name of the removed one
+	if err := WriteFile(cacheFs, "removed.txt", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 10)
+	if _, err := removed.ReadAt(b, 0); err != nil || string(b) != "0123456789" {
+		t.Fatalf("error reading the removed file: %q, %v", b, err)
+	}
+	if _, err := removed.Write([]byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := removed.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := renamed.Write([]byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := renamed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The handles are not put back in the cache under their old names
+	if cacheFs.currSize != 3 {
+		t.Fatalf("was expecting a cache of size 3, got %d", cacheFs.currSize)
+	}
+	if _, err := cacheFs.Stat("renamed.txt"); !os.IsNotExist(err) {
+		t.Errorf("renamed file re-appeared on close: %v", err)
+	}
+	if data, err := ReadFile(cacheFs, "removed.txt"); err != nil || string(data) != "new" {
+		t.Errorf("was expecting the new file, got %q, %v", data, err)
+	}
+	// Nor synced to the base
+	if data, err := ReadFile(base, "moved.txt"); err != nil || string(data) != "0123456789" {
+		t.Errorf("was expecting the renamed file unchanged, got %q, %v", data, err)
+	}
+}
+
+// uploadingFs is a base whose files are written to their path on sync, as
+// the objects of a bucket are uploaded, rather than to the file opened.
+type uploadingFs struct {
+	Fs
+}
+
+func (u uploadingFs) Create(name string) (File, error) {
+	return u.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (u uploadingFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := u.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &uploadingFile{File: f, fs: u.Fs}, nil
+}
+
+type uploadingFile struct {
+	File
+	fs Fs
+}
+
+func (f *uploadingFile) Sync() error {
+	g, err := f.fs.OpenFile(f.Name(), os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return g.Close()
+}
+
+func TestSizeCacheFS_UnlinkedHandlesNotSynced(t *testing.T) {
+	base := &MemMapFs{}
+	cacheFs, _ := NewSizeCacheFS(uploadingFs{base}, &MemMapFs{}, 1e+9, 0)
+	for _, name := range []string{"removed.txt", "renamed.txt"} {
+		if err := WriteFile(cacheFs, name, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removed, err := cacheFs.OpenFile("removed.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := cacheFs.OpenFile("renamed.txt", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheFs.Remove("removed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheFs.Rename("renamed.txt", "moved.txt"); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []File{removed, renamed} {
+		if _, err := f.Write([]byte("written")); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Sync(); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"removed.txt", "renamed.txt"} {
+		if _, err := base.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s brought back to the base: %v", name, err)
+		}
+	}
+}
+
 func TestSizeCacheFS_Update(t *testing.T) {
 	var cacheFs, _ = NewSizeCacheFS(&MemMapFs{}, &MemMapFs{}, 100, 0)
 
@@ -201,6 +338,132 @@ func TestSizeCacheFS_Index(t *testing.T) {
 	}
 }
 
+// The temporary files left by a crash in the cache aren't indexed
+func TestSizeCacheFS_IndexTempFiles(t *testing.T) {
+	cache := &MemMapFs{}
+	temps := []string{detachPath("dir/a.txt"), refreshPath("dir/a.txt")}
+	// Cached files named as the temporary files were once
+	files := []string{"dir/a.txt", "dir/.a.txt.detach", "dir/.a.txt.refresh"}
+	for _, name := range append(files, temps...) {
+		if err := cache.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteFile(cache, name, []byte("0123456789"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Attached, the temporary files may be written by the owner
+	attached, err := AttachSizeCacheFS(&MemMapFs{}, cache, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attached.currSize != 30 {
+		t.Fatalf("was expecting cache size of 30, got %d", attached.currSize)
+	}
+	for _, name := range append(files, temps...) {
+		if exists, _ := Exists(cache, name); !exists {
+			t.Fatalf("was expecting %s kept", name)
+		}
+	}
+
+	cacheFs, err := NewSizeCacheFS(&MemMapFs{}, cache, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cacheFs.currSize != 30 {
+		t.Fatalf("was expecting cache size of 30, got %d", cacheFs.currSize)
+	}
+	for _, name := range temps {
+		if exists, _ := Exists(cache, name); exists {
+			t.Fatalf("was expecting %s removed", name)
+		}
+	}
+	for _, name := range files {
+		if exists, _ := Exists(cache, name); !exists {
+			t.Fatalf("was expecting %s kept", name)
+		}
+	}
+}
+
+// blockingReadFs blocks the reads of its files until release is closed.
+type blockingReadFs struct {
+	Fs
+	reading chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingReadFs) Open(name string) (File, error) {
+	f, err := b.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &blockingReadFile{File: f, fs: b}, nil
+}
+
+type blockingReadFile struct {
+	File
+	fs *blockingReadFs
+}
+
+func (f *blockingReadFile) Read(p []byte) (int, error) {
+	select {
+	case f.fs.reading <- struct{}{}:
+	default:
+	}
+	<-f.fs.release
+	return f.File.Read(p)
+}
+
+func TestSizeCacheFS_AttachDuringRefresh(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	mem := NewMemMapFs()
+	if err := WriteFile(mem, "dir/file.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Chtimes("dir/file.txt", start, start); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewMemMapFs()
+	fs, err := NewSizeCacheFS(mem, cache, 1<<20, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SetClock(clock)
+	fs.SetStaleWhileRevalidate(1)
+	if _, err := ReadFile(fs, "dir/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour)
+	if err := WriteFile(mem, "dir/file.txt", []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := mem.Chtimes("dir/file.txt", clock.Now(), clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	base := &blockingReadFs{Fs: mem, reading: make(chan struct{}, 1), release: make(chan struct{})}
+	fs.base = base
+	if _, err := fs.Open("dir/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	<-base.reading
+
+	// Attaching mid refresh leaves its temporary file alone
+	if _, err := AttachSizeCacheFS(mem, cache, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(cache, refreshPath("dir/file.txt")); !exists {
+		t.Fatal("was expecting the refresh file kept")
+	}
+	close(base.release)
+	fs.refresher.wait()
+	if data, err := ReadFile(cache, "dir/file.txt"); err != nil || string(data) != "new" {
+		t.Fatalf("was expecting the refreshed content, got %q, %v", data, err)
+	}
+}
+
 func TestSizeCacheFS_RemoveAll(t *testing.T) {
 	base := &MemMapFs{}
 	cache := &MemMapFs{}
@@ -322,3 +585,379 @@ func TestSizeCacheFSProfile(t *testing.T) {
 	}
 	_ = cacheFs.Close()
 }
+
+func TestSizeCacheFS_Mmap(t *testing.T) {
+	if !mmapSupported {
+		t.Skip("mmap not supported")
+	}
+	dir, err := ioutil.TempDir("", "kafero-mmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testSizeCacheFSMmap(t, NewBasePathFs(NewOsFs(), dir))
+}
+
+// The files of a MemMapFs lying in a single page are mapped as well
+func TestSizeCacheFS_MemMmap(t *testing.T) {
+	testSizeCacheFSMmap(t, &MemMapFs{})
+}
+
+func testSizeCacheFSMmap(t *testing.T, cache Fs) {
+	base := &MemMapFs{}
+	if err := WriteFile(base, "a.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cacheFs, err := NewSizeCacheFS(base, cache, 1e+9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f1, err := cacheFs.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := cacheFs.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 4)
+	if _, err := f1.ReadAt(b, 2); err != nil || string(b) != "2345" {
+		t.Fatalf("was expecting 2345, got %s, %v", b, err)
+	}
+	if _, err := f2.ReadAt(b, 6); err != nil || string(b) != "6789" {
+		t.Fatalf("was expecting 6789, got %s, %v", b, err)
+	}
+	r1, r2 := f1.(*SizeCacheFile).mmap, f2.(*SizeCacheFile).mmap
+	if r1 == nil || r1 != r2 || r1.refs != 2 {
+		t.Fatal("was expecting the readers to share the mapping")
+	}
+	if n, err := f1.ReadAt(b, 8); n != 2 || err != io.EOF {
+		t.Fatalf("was expecting 2 bytes and EOF, got %d, %v", n, err)
+	}
+
+	// Rewriting the file must not affect the mapped readers
+	if err := WriteFile(cacheFs, "a.txt", []byte("abc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f1.ReadAt(b, 0); err != nil || string(b) != "0123" {
+		t.Fatalf("was expecting 0123, got %s, %v", b, err)
+	}
+	if err := f1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if r1.refs != 0 {
+		t.Fatalf("was expecting the mapping to be released, got %d refs", r1.refs)
+	}
+
+	data, err := ReadFile(cacheFs, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abc" {
+		t.Fatalf("was expecting abc, got %s", data)
+	}
+}
+
+// countingOpenFs counts the calls to Open, which are slowed down to let
+// concurrent callers overlap.
+type countingOpenFs struct {
+	Fs
+	opens int32
+}
+
+func (c *countingOpenFs) Open(name string) (File, error) {
+	atomic.AddInt32(&c.opens, 1)
+	time.Sleep(20 * time.Millisecond)
+	return c.Fs.Open(name)
+}
+
+func TestSizeCacheFS_ConcurrentFill(t *testing.T) {
+	base := &countingOpenFs{Fs: &MemMapFs{}}
+	if err := WriteFile(base, "a.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cacheFs, err := NewSizeCacheFS(base, &MemMapFs{}, 1e+9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			data, err := ReadFile(cacheFs, "a.txt")
+			if err == nil && string(data) != "0123456789" {
+				err = fmt.Errorf("wrong content %s", data)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Every open also opens the base file, only one of them fills the cache
+	if opens := atomic.LoadInt32(&base.opens); opens != n+1 {
+		t.Fatalf("was expecting %d base opens, got %d", n+1, opens)
+	}
+}
+
+// countingStatFs counts the calls to Stat.
+type countingStatFs struct {
+	Fs
+	stats int32
+}
+
+func (c *countingStatFs) Stat(name string) (os.FileInfo, error) {
+	atomic.AddInt32(&c.stats, 1)
+	return c.Fs.Stat(name)
+}
+
+func TestSizeCacheFS_NegativeCache(t *testing.T) {
+	base := &countingStatFs{Fs: &MemMapFs{}}
+	cacheFs, err := NewSizeCacheFS(base, &MemMapFs{}, 1e+9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFs.SetNegativeCacheTTL(50 * time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		if exists, err := Exists(cacheFs, "dir/a.txt"); err != nil || exists {
+			t.Fatalf("was expecting dir/a.txt to be missing, got %v, %v", exists, err)
+		}
+	}
+	if _, err := cacheFs.Open("dir/a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("was expecting a not exist error, got %v", err)
+	}
+	if stats := atomic.LoadInt32(&base.stats); stats != 1 {
+		t.Fatalf("was expecting a single base stat, got %d", stats)
+	}
+
+	// Files created through the cache are visible immediately
+	if err := cacheFs.MkdirAll("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(cacheFs, "dir/a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exists, err := Exists(cacheFs, "dir/a.txt"); err != nil || !exists {
+		t.Fatalf("was expecting dir/a.txt to exist, got %v, %v", exists, err)
+	}
+
+	// Files created in the base are visible once the entry expired
+	if exists, _ := Exists(cacheFs, "b.txt"); exists {
+		t.Fatal("was expecting b.txt to be missing")
+	}
+	if err := WriteFile(base, "b.txt", []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(cacheFs, "b.txt"); exists {
+		t.Fatal("was expecting b.txt to be cached as missing")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if exists, _ := Exists(cacheFs, "b.txt"); !exists {
+		t.Fatal("was expecting b.txt to exist")
+	}
+}
+
+func TestSizeCacheFS_Clock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	base := NewMemMapFsWithClock(clock)
+	cacheFs, err := NewSizeCacheFS(base, NewMemMapFsWithClock(clock), 1e+9, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFs.SetClock(clock)
+	cacheFs.SetNegativeCacheTTL(time.Minute)
+
+	if err := WriteFile(cacheFs, "a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if info := cacheFs.getCacheFile("a.txt"); info == nil || info.LastAccessTime != clock.Now().UnixNano()/1000 {
+		t.Fatalf("was expecting the access time of the clock, got %v", info)
+	}
+	if exists, _ := Exists(cacheFs, "b.txt"); exists {
+		t.Fatal("was expecting b.txt to be missing")
+	}
+
+	// Changes in the base are not seen until the cached file is stale
+	clock.Advance(time.Second)
+	if err := WriteFile(base, "a.txt", []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(base, "b.txt", []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(cacheFs, "a.txt"); err != nil || string(data) != "a" {
+		t.Fatalf("was expecting the cached content, got %q, %v", data, err)
+	}
+	if exists, _ := Exists(cacheFs, "b.txt"); exists {
+		t.Fatal("was expecting b.txt to be cached as missing")
+	}
+
+	clock.Advance(time.Minute)
+	if data, err := ReadFile(cacheFs, "a.txt"); err != nil || string(data) != "b" {
+		t.Fatalf("was expecting the base content, got %q, %v", data, err)
+	}
+	if exists, _ := Exists(cacheFs, "b.txt"); !exists {
+		t.Fatal("was expecting b.txt to exist")
+	}
+}
+
+func TestSizeCacheFS_CacheFull(t *testing.T) {
+	base := &MemMapFs{}
+	cache := &MemMapFs{}
+	cacheFs, err := NewSizeCacheFS(base, cache, 1e+9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(base, "a.txt", make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file which doesn't fit is not left partially copied in the cache
+	cache.Faults().SetSpace(10)
+	if _, err := cacheFs.Open("a.txt"); err == nil {
+		t.Fatal("was expecting an error filling the cache")
+	}
+	if exists, _ := Exists(cache, "a.txt"); exists {
+		t.Fatal("was expecting the partial cache file to be removed")
+	}
+	if cacheFs.currSize != 0 {
+		t.Fatalf("was expecting an empty cache, got a size of %d", cacheFs.currSize)
+	}
+
+	cache.Faults().SetSpace(-1)
+	if data, err := ReadFile(cacheFs, "a.txt"); err != nil || len(data) != 100 {
+		t.Fatalf("error reading the file once the cache has space: %d bytes, %v", len(data), err)
+	}
+
+	// A file which doesn't fit in the base is not served from the cache
+	base.Faults().SetSpace(10)
+	f, err := cacheFs.Create("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err == nil {
+		t.Fatal("was expecting an error writing the base file")
+	}
+	base.Faults().SetSpace(-1)
+	if exists, _ := Exists(cache, "b.txt"); exists {
+		t.Fatal("was expecting the cache file to be removed")
+	}
+	if data, err := ReadFile(cacheFs, "b.txt"); err != nil || len(data) != 10 {
+		t.Fatalf("was expecting the content of the base file, got %d bytes, %v", len(data), err)
+	}
+}
+
+// statfsMemFs is a MemMapFs reporting a settable disk usage.
+type statfsMemFs struct {
+	Fs
+	usage FsUsage
+}
+
+func (s *statfsMemFs) Statfs(name string) (*FsUsage, error) {
+	usage := s.usage
+	return &usage, nil
+}
+
+func TestSizeCacheFS_MinFreeRatio(t *testing.T) {
+	cache := &statfsMemFs{Fs: &MemMapFs{}, usage: FsUsage{Total: 1000, Free: 500, Available: 500}}
+	cacheFs, err := NewSizeCacheFS(&MemMapFs{}, cache, 1e+9, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheFs.SetMinFreeRatio(0.1, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 500 bytes available, 100 to keep free
+	for i := 0; i < 5; i++ {
+		if err := WriteFile(cacheFs, fmt.Sprintf("%d.txt", i), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cache.usage.Available -= 100
+	}
+	if size := cacheFs.Size(); size != 400 {
+		t.Fatalf("was expecting a cache of size 400, got %d", size)
+	}
+
+	// Another process fills the disk
+	cache.usage.Available = 0
+	if err := WriteFile(cacheFs, "5.txt", make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if size := cacheFs.Size(); size != 300 {
+		t.Fatalf("was expecting a cache of size 300, got %d", size)
+	}
+
+	// The cache filesystem must report its usage
+	nostat, _ := NewSizeCacheFS(&MemMapFs{}, &MemMapFs{}, 100, 0)
+	if err := nostat.SetMinFreeRatio(0.1, time.Minute); err == nil {
+		t.Fatal("was expecting an error without Statfs support")
+	}
+}
+
+func TestSizeCacheFS_Attach(t *testing.T) {
+	base, cache := NewMemMapFs(), NewMemMapFs()
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := WriteFile(base, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	main, err := NewSizeCacheFS(base, cache, 1<<20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadFile(main, "a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := main.Close(); err != nil {
+		t.Fatal(err)
+	}
+	index, err := ReadFile(cache, ".cacheindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := AttachSizeCacheFS(base, cache, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if data, err := ReadFile(fs, name); err != nil || string(data) != name {
+			t.Fatalf("was expecting %s, got %q, %v", name, data, err)
+		}
+	}
+	if b := fs.Bandwidth(); b.FromCache != int64(len("a.txt")) || b.FromBase != 0 {
+		t.Fatalf("was expecting a.txt read from the cache only, got %+v", b)
+	}
+	if exists, _ := Exists(cache, "b.txt"); exists {
+		t.Fatal("was expecting b.txt not to be cached")
+	}
+	if _, err := fs.Create("c.txt"); err != syscall.EPERM {
+		t.Fatalf("was expecting EPERM, got %v", err)
+	}
+	if err := fs.Remove("a.txt"); err != syscall.EPERM {
+		t.Fatalf("was expecting EPERM, got %v", err)
+	}
+	if err := fs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(cache, ".cacheindex"); err != nil || string(data) != string(index) {
+		t.Fatalf("was expecting the index unchanged, got %s, %v", data, err)
+	}
+}
@@ -0,0 +1,176 @@
+package kafero
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// When the cache layer supports it, the read only SizeCacheFiles serve
+// ReadAt from a mapping of the cache file shared by all the readers of a
+// path. A mapped file must never be truncated in place, so the writers
+// first detach the path from the mapping, giving it a new cache file, and
+// no mapping is created while a path is being written.
+
+type mmapRegion struct {
+	name string
+	file File
+	data []byte
+	refs int
+}
+
+func (r *mmapRegion) ReadAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, &os.PathError{Op: "readat", Path: r.name, Err: errors.New("negative offset")}
+	}
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, r.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// acquireMmap returns the mapping of the cache file of name, nil if the
+// file can't be mapped.
+func (u *SizeCacheFS) acquireMmap(name string) *mmapRegion {
+	u.mmapL.Lock()
+	defer u.mmapL.Unlock()
+	if r, ok := u.mmaps[name]; ok {
+		r.refs++
+		return r
+	}
+	if u.writers[name] > 0 {
+		return nil
+	}
+	f, err := u.cache.Open(name)
+	if err != nil {
+		return nil
+	}
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() || fi.Size() == 0 || int64(int(fi.Size())) != fi.Size() || !f.CanMmap() {
+		_ = f.Close()
+		return nil
+	}
+	data, err := f.Mmap(0, int(fi.Size()), mmapProtRead, mmapShared)
+	if err != nil {
+		_ = f.Close()
+		return nil
+	}
+	r := &mmapRegion{name: name, file: f, data: data, refs: 1}
+	if u.mmaps == nil {
+		u.mmaps = make(map[string]*mmapRegion)
+	}
+	u.mmaps[name] = r
+	return r
+}
+
+func (u *SizeCacheFS) releaseMmap(r *mmapRegion) error {
+	u.mmapL.Lock()
+	defer u.mmapL.Unlock()
+	r.refs--
+	if r.refs > 0 {
+		return nil
+	}
+	if u.mmaps[r.name] == r {
+		delete(u.mmaps, r.name)
+	}
+	if err := r.file.Munmap(); err != nil {
+		_ = r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// retireMmap prevents new readers from using the current mapping of name,
+// returns true if there was one.
+func (u *SizeCacheFS) retireMmap(name string) bool {
+	u.mmapL.Lock()
+	defer u.mmapL.Unlock()
+	if _, ok := u.mmaps[name]; !ok {
+		return false
+	}
+	delete(u.mmaps, name)
+	return true
+}
+
+// beginWrite registers a writer of name and detaches the path from its
+// mapping. If keepContent is false the cache file is about to be truncated
+// and is simply removed. The returned function ends the write.
+func (u *SizeCacheFS) beginWrite(name string, keepContent bool) (func(), error) {
+	u.mmapL.Lock()
+	if u.writers == nil {
+		u.writers = make(map[string]int)
+	}
+	u.writers[name]++
+	u.mmapL.Unlock()
+
+	end := func() {
+		u.mmapL.Lock()
+		defer u.mmapL.Unlock()
+		u.writers[name]--
+		if u.writers[name] <= 0 {
+			delete(u.writers, name)
+		}
+	}
+	if !u.retireMmap(name) {
+		return end, nil
+	}
+	if !keepContent {
+		if err := u.cache.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			end()
+			return nil, fmt.Errorf("error detaching mapped cache file: %v", err)
+		}
+		return end, nil
+	}
+	if err := u.detachCacheFile(name); err != nil {
+		end()
+		return nil, err
+	}
+	return end, nil
+}
+
+// detachPath returns the name of the temporary copy of the cache file of
+// name being detached.
+func detachPath(name string) string {
+	return cacheTempPath(name, ".detach")
+}
+
+// detachCacheFile replaces the cache file of name by a copy.
+func (u *SizeCacheFS) detachCacheFile(name string) error {
+	tmp := detachPath(name)
+	src, err := u.cache.Open(name)
+	if err != nil {
+		return fmt.Errorf("error opening mapped cache file: %v", err)
+	}
+	defer src.Close()
+	if err := u.cache.MkdirAll(filepath.Dir(tmp), 0777); err != nil {
+		return fmt.Errorf("error creating cache file copy: %v", err)
+	}
+	dst, err := u.cache.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("error creating cache file copy: %v", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		_ = u.cache.Remove(tmp)
+		return fmt.Errorf("error copying mapped cache file: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		_ = u.cache.Remove(tmp)
+		return fmt.Errorf("error closing cache file copy: %v", err)
+	}
+	fi, err := src.Stat()
+	if err == nil {
+		_ = u.cache.Chtimes(tmp, fi.ModTime(), fi.ModTime())
+	}
+	if err := u.cache.Rename(tmp, name); err != nil {
+		_ = u.cache.Remove(tmp)
+		return fmt.Errorf("error replacing mapped cache file: %v", err)
+	}
+	return nil
+}
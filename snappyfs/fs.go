@@ -0,0 +1,91 @@
+// Package snappyfs compresses the files of a Fs with Snappy, faster but
+// compressing less than zstfs, for when the CPU rather than the storage is
+// the bottleneck. The files are in the Snappy framing format.
+package snappyfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/klauspost/compress/s2"
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/compressfs"
+	"io"
+	"io/ioutil"
+)
+
+// The Fs compress its files using the Snappy framing format.
+// It doesn't allow seeking.
+type Fs = compressfs.Fs
+
+// File is a compressed file of a Fs.
+type File = compressfs.File
+
+// codec compresses with snappy.
+type codec struct {
+	opts  []s2.WriterOption
+	layer []compressfs.Option
+}
+
+// An Option configures a Fs.
+type Option func(c *codec)
+
+// CompressOnly compresses only the files whose base name matches one of
+// patterns, as compressfs.CompressOnly.
+func CompressOnly(patterns ...string) Option {
+	return func(c *codec) {
+		c.layer = append(c.layer, compressfs.CompressOnly(patterns...))
+	}
+}
+
+// AutoDetect detects the format of the files read, as
+// compressfs.AutoDetect.
+func AutoDetect() Option {
+	return func(c *codec) {
+		c.layer = append(c.layer, compressfs.AutoDetect())
+	}
+}
+
+// Concurrency sets the number of goroutines compressing each file
+// written, as s2.WriterConcurrency.
+func Concurrency(n int) Option {
+	return func(c *codec) {
+		c.opts = append(c.opts, s2.WriterConcurrency(n))
+	}
+}
+
+func NewFs(source kafero.Fs, opts ...Option) kafero.Fs {
+	c := &codec{opts: []s2.WriterOption{s2.WriterSnappyCompat()}}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return compressfs.NewFs(source, "SnappyFs", c, c.layer...)
+}
+
+func (c *codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return s2.NewWriter(w, c.opts...), nil
+}
+
+func (c *codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(s2.NewReader(r)), nil
+}
+
+// Skippable returns a skippable chunk of the Snappy framing format, after
+// a stream identifier for the chunk to be valid on its own, as the footer
+// of an empty file.
+func (c *codec) Skippable(payload []byte) []byte {
+	chunk := make([]byte, len(streamIdentifier)+4, len(streamIdentifier)+4+len(payload))
+	copy(chunk, streamIdentifier)
+	binary.LittleEndian.PutUint32(chunk[len(streamIdentifier):], uint32(len(payload))<<8|0x8f)
+	return append(chunk, payload...)
+}
+
+// Detect returns whether head starts with the identifier of the Snappy
+// streams.
+func (c *codec) Detect(head []byte) bool {
+	return bytes.HasPrefix(head, []byte(streamIdentifier))
+}
+
+// streamIdentifier is the chunk starting the Snappy streams.
+const streamIdentifier = "\xff\x06\x00\x00sNaPpY"
+
+// vim: ts=4 sw=4 noexpandtab nolist syn=go
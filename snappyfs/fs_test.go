@@ -0,0 +1,100 @@
+package snappyfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+	"os"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	tests.TestWriteFile(t, NewFs(fs), "file.txt", 1000)
+}
+
+func TestAppend(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	cfs := NewFs(fs)
+	content := bytes.Repeat([]byte("content"), 100)
+	if err := kafero.WriteFile(cfs, "dir/file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := cfs.OpenFile("dir/file.bin", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("dir/file.bin"); err != nil || fi.Size() >= int64(2*len(content)) {
+		t.Fatalf("was expecting the file compressed, got %v, %v", fi, err)
+	}
+
+	if fi, err := cfs.Stat("dir/file.bin"); err != nil || fi.Size() != int64(2*len(content)) {
+		t.Fatalf("was expecting the uncompressed size, got %v, %v", fi, err)
+	}
+	data, err := kafero.ReadFile(cfs, "dir/file.bin")
+	if err != nil || !bytes.Equal(data, append(content, content...)) {
+		t.Fatalf("was expecting the content twice, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestCompressOnly(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	cfs := NewFs(fs, CompressOnly("*.bin"), Concurrency(2))
+	for _, name := range []string{"file.bin", "meta.json"} {
+		if err := kafero.WriteFile(cfs, name, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := kafero.ReadFile(cfs, name)
+		if err != nil || string(data) != "content" {
+			t.Fatalf("was expecting content in %s, got %q, %v", name, data, err)
+		}
+	}
+	if data, err := kafero.ReadFile(fs, "meta.json"); err != nil || string(data) != "content" {
+		t.Fatalf("was expecting meta.json uncompressed, got %q, %v", data, err)
+	}
+}
+
+func TestAutoDetect(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	content := bytes.Repeat([]byte("content"), 100)
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(content)
+	w.Close()
+	enc, _ := zstd.NewWriter(nil)
+	files := map[string][]byte{
+		"raw.bin":  content,
+		"file.gz":  gz.Bytes(),
+		"file.zst": enc.EncodeAll(content, nil),
+		"empty":    nil,
+	}
+	for name, data := range files {
+		if err := kafero.WriteFile(fs, name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfs := NewFs(fs, AutoDetect())
+	if err := kafero.WriteFile(cfs, "file.sz", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"raw.bin", "file.gz", "file.zst", "file.sz"} {
+		if data, err := kafero.ReadFile(cfs, name); err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("was expecting the content of %s, got %d bytes, %v", name, len(data), err)
+		}
+	}
+	if data, err := kafero.ReadFile(cfs, "empty"); err != nil || len(data) != 0 {
+		t.Fatalf("was expecting empty to be empty, got %d bytes, %v", len(data), err)
+	}
+	// Without detection, the raw files aren't valid snappy streams
+	if _, err := kafero.ReadFile(NewFs(fs), "raw.bin"); err == nil {
+		t.Fatal("was expecting an error reading raw.bin")
+	}
+}
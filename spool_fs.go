@@ -0,0 +1,246 @@
+package kafero
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+var (
+	_ Lstater   = (*SpoolFs)(nil)
+	_ Xattrer   = (*SpoolFs)(nil)
+	_ Unwrapper = (*SpoolFs)(nil)
+	_ Describer = (*SpoolFs)(nil)
+	_ ContextFs = (*SpoolFs)(nil)
+)
+
+// The SpoolFs makes the files opened read only from the source filesystem
+// seekable, whatever the source: when the source file can't Seek or
+// ReadAt, such as the files of zstfs, it is spooled to a temporary file of
+// the temp filesystem, which the reads then continue from. A file is
+// spooled once, at the cost of reading it whole again, and only when
+// needed: the files read sequentially are streamed. The files opened for
+// writing are those of the source.
+type SpoolFs struct {
+	source Fs
+	temp   Fs
+}
+
+// NewSpoolFs returns a SpoolFs spooling the files of source to temp.
+func NewSpoolFs(source Fs, temp Fs) *SpoolFs {
+	return &SpoolFs{source: source, temp: temp}
+}
+
+func (s *SpoolFs) Name() string {
+	return "SpoolFs"
+}
+
+func (s *SpoolFs) Unwrap() Fs {
+	return s.source
+}
+
+func (s *SpoolFs) Describe() Description {
+	return Description{Name: s.Name(), Wrapped: []WrappedFs{{"source", s.source}, {"temp", s.temp}}}
+}
+
+func (s *SpoolFs) WithContext(ctx context.Context) Fs {
+	return &SpoolFs{source: WithContext(s.source, ctx), temp: WithContext(s.temp, ctx)}
+}
+
+func (s *SpoolFs) Open(name string) (File, error) {
+	f, err := s.source.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &SpoolFile{File: f, fs: s, name: name}, nil
+}
+
+func (s *SpoolFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	f, err := s.source.OpenFile(name, flag, perm)
+	if err != nil || flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_TRUNC) != 0 {
+		return f, err
+	}
+	return &SpoolFile{File: f, fs: s, name: name}, nil
+}
+
+func (s *SpoolFs) Create(name string) (File, error) {
+	return s.source.Create(name)
+}
+
+func (s *SpoolFs) Mkdir(name string, perm os.FileMode) error {
+	return s.source.Mkdir(name, perm)
+}
+
+func (s *SpoolFs) MkdirAll(path string, perm os.FileMode) error {
+	return s.source.MkdirAll(path, perm)
+}
+
+func (s *SpoolFs) Remove(name string) error {
+	return s.source.Remove(name)
+}
+
+func (s *SpoolFs) RemoveAll(path string) error {
+	return s.source.RemoveAll(path)
+}
+
+func (s *SpoolFs) Rename(oldname, newname string) error {
+	return s.source.Rename(oldname, newname)
+}
+
+func (s *SpoolFs) Stat(name string) (os.FileInfo, error) {
+	return s.source.Stat(name)
+}
+
+func (s *SpoolFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	if lsf, ok := s.source.(Lstater); ok {
+		return lsf.LstatIfPossible(name)
+	}
+	fi, err := s.Stat(name)
+	return fi, false, err
+}
+
+func (s *SpoolFs) Chmod(name string, mode os.FileMode) error {
+	return s.source.Chmod(name, mode)
+}
+
+func (s *SpoolFs) Chtimes(name string, atime, mtime time.Time) error {
+	return s.source.Chtimes(name, atime, mtime)
+}
+
+func (s *SpoolFs) Getxattr(name, attr string) ([]byte, error) {
+	return Getxattr(s.source, name, attr)
+}
+
+func (s *SpoolFs) Setxattr(name, attr string, value []byte) error {
+	return Setxattr(s.source, name, attr, value)
+}
+
+func (s *SpoolFs) Listxattr(name string) ([]string, error) {
+	return Listxattr(s.source, name)
+}
+
+func (s *SpoolFs) Removexattr(name, attr string) error {
+	return Removexattr(s.source, name, attr)
+}
+
+// A SpoolFile is a file of a SpoolFs, read from the source file until it
+// is spooled.
+type SpoolFile struct {
+	File
+	fs   *SpoolFs
+	name string
+	// The offset of the reads from the source file
+	offset int64
+	// The temporary file holding the content, once spooled
+	spool File
+}
+
+// unseekable returns whether err tells that a file can't seek.
+func unseekable(err error) bool {
+	return errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.ESPIPE) ||
+		errors.Is(err, syscall.ENOTSUP)
+}
+
+// spooled returns the spooled file, spooling the source file if needed,
+// positioned at the offset of the reads.
+func (f *SpoolFile) spooled() (File, error) {
+	if f.spool != nil {
+		return f.spool, nil
+	}
+	// The content read is gone, the file is read again from the start
+	src, err := f.fs.source.Open(f.name)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	spool, err := TempFile(f.fs.temp, "", "spool")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(spool, src); err != nil {
+		f.removeSpool(spool)
+		return nil, err
+	}
+	if _, err := spool.Seek(f.offset, io.SeekStart); err != nil {
+		f.removeSpool(spool)
+		return nil, err
+	}
+	f.spool = spool
+	return spool, nil
+}
+
+func (f *SpoolFile) removeSpool(spool File) {
+	_ = spool.Close()
+	_ = f.fs.temp.Remove(spool.Name())
+}
+
+// Spooled returns whether the file was spooled.
+func (f *SpoolFile) Spooled() bool {
+	return f.spool != nil
+}
+
+func (f *SpoolFile) Read(p []byte) (int, error) {
+	if f.spool != nil {
+		return f.spool.Read(p)
+	}
+	n, err := f.File.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *SpoolFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.spool == nil {
+		n, err := f.File.ReadAt(p, off)
+		if err == nil || !unseekable(err) {
+			return n, err
+		}
+	}
+	spool, err := f.spooled()
+	if err != nil {
+		return 0, err
+	}
+	return spool.ReadAt(p, off)
+}
+
+func (f *SpoolFile) Seek(offset int64, whence int) (int64, error) {
+	if f.spool == nil {
+		ret, err := f.File.Seek(offset, whence)
+		if err == nil {
+			f.offset = ret
+			return ret, nil
+		}
+		if !unseekable(err) {
+			return 0, err
+		}
+	}
+	spool, err := f.spooled()
+	if err != nil {
+		return 0, err
+	}
+	return spool.Seek(offset, whence)
+}
+
+// Stat returns the FileInfo of the source file, with the size of the
+// content once spooled.
+func (f *SpoolFile) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil || f.spool == nil {
+		return info, err
+	}
+	sinfo, err := f.spool.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return sizedFileInfo{FileInfo: info, size: sinfo.Size()}, nil
+}
+
+func (f *SpoolFile) Close() error {
+	if f.spool != nil {
+		f.removeSpool(f.spool)
+		f.spool = nil
+	}
+	return f.File.Close()
+}
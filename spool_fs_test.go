@@ -0,0 +1,89 @@
+package kafero
+
+import (
+	"io"
+	"io/ioutil"
+	"syscall"
+	"testing"
+)
+
+// streamFs opens its files as streams, which can't Seek nor ReadAt.
+type streamFs struct {
+	Fs
+}
+
+type streamFile struct {
+	File
+}
+
+func (s *streamFs) Open(name string) (File, error) {
+	f, err := s.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &streamFile{f}, nil
+}
+
+func (f *streamFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, syscall.EPERM
+}
+
+func (f *streamFile) ReadAt(p []byte, off int64) (int, error) {
+	return 0, syscall.EPERM
+}
+
+func TestSpoolFs(t *testing.T) {
+	source := &streamFs{Fs: NewMemMapFs()}
+	if err := WriteFile(source, "a.txt", []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	temp := NewMemMapFs()
+	fs := NewSpoolFs(source, temp)
+
+	// The files read sequentially are streamed
+	if data, err := ReadFile(fs, "a.txt"); err != nil || string(data) != "0123456789" {
+		t.Fatalf("was expecting the content, got %q, %v", data, err)
+	}
+
+	f, err := fs.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sf := f.(*SpoolFile)
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "0123" {
+		t.Fatalf("was expecting 0123, got %q, %v", buf, err)
+	}
+	if sf.Spooled() {
+		t.Fatal("was expecting the file streamed")
+	}
+	// Seeking back spools the file, the reads continuing from it
+	if off, err := f.Seek(-2, io.SeekCurrent); err != nil || off != 2 {
+		t.Fatalf("was expecting offset 2, got %d, %v", off, err)
+	}
+	if !sf.Spooled() {
+		t.Fatal("was expecting the file spooled")
+	}
+	if _, err := io.ReadFull(f, buf); err != nil || string(buf) != "2345" {
+		t.Fatalf("was expecting 2345, got %q, %v", buf, err)
+	}
+	if off, err := f.Seek(-2, io.SeekEnd); err != nil || off != 8 {
+		t.Fatalf("was expecting offset 8, got %d, %v", off, err)
+	}
+	if rest, err := ioutil.ReadAll(f); err != nil || string(rest) != "89" {
+		t.Fatalf("was expecting 89, got %q, %v", rest, err)
+	}
+	if _, err := f.ReadAt(buf, 1); err != nil || string(buf) != "1234" {
+		t.Fatalf("was expecting 1234, got %q, %v", buf, err)
+	}
+	if info, err := f.Stat(); err != nil || info.Size() != 10 {
+		t.Fatalf("was expecting a size of 10, got %v", err)
+	}
+	spool := sf.spool.Name()
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists(temp, spool); exists {
+		t.Fatal("was expecting the spooled file removed")
+	}
+}
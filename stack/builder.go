@@ -0,0 +1,106 @@
+package stack
+
+import (
+	"fmt"
+
+	"github.com/melaurent/kafero"
+)
+
+// Seek describes how a layer affects the ability to seek in the files it
+// returns.
+type Seek int
+
+const (
+	// SeekInherit means files are as seekable as the files of the wrapped Fs.
+	SeekInherit Seek = iota
+	// SeekProvide means files are always seekable, e.g. because they are
+	// served from a local cache layer.
+	SeekProvide
+	// SeekRemove means files can never be seeked, e.g. compressed streams.
+	SeekRemove
+)
+
+// A Layer is one level of a filesystem stack. It wraps the Fs below it.
+type Layer struct {
+	// Kind is a short description of the layer, used in error messages.
+	Kind string
+	// NeedsSeek is set when the layer seeks or truncates the files of the
+	// Fs it wraps, like SizeCacheFS or BufferFs do when syncing.
+	NeedsSeek bool
+	// Seek tells how the layer changes the seekability of files.
+	Seek Seek
+	// Wrap builds the layer on top of the given Fs.
+	Wrap func(fs kafero.Fs) (kafero.Fs, error)
+}
+
+// The Builder constructs a layered Fs, from the base backend up, validating
+// that every layer is compatible with the layers below it.
+type Builder struct {
+	base     kafero.Fs
+	seekable bool
+	layers   []Layer
+	err      error
+}
+
+// New starts a stack on top of the given base backend. The base is assumed
+// to return seekable files.
+func New(base kafero.Fs) *Builder {
+	return &Builder{base: base, seekable: true}
+}
+
+// Seekable declares whether the files of the base backend can be seeked.
+func (b *Builder) Seekable(seekable bool) *Builder {
+	b.seekable = seekable
+	return b
+}
+
+// With pushes a layer on top of the stack. Layers are applied in the order
+// they are pushed, the first one wrapping the base directly.
+func (b *Builder) With(l Layer) *Builder {
+	b.layers = append(b.layers, l)
+	return b
+}
+
+// Validate checks the compatibility of the layers without building them.
+func (b *Builder) Validate() error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.base == nil {
+		return fmt.Errorf("stack has no base filesystem")
+	}
+	seekable := b.seekable
+	below := "base"
+	for _, l := range b.layers {
+		if l.Wrap == nil {
+			return fmt.Errorf("layer %s has no constructor", l.Kind)
+		}
+		if l.NeedsSeek && !seekable {
+			return fmt.Errorf("layer %s requires seekable files but %s does not support seeking", l.Kind, below)
+		}
+		switch l.Seek {
+		case SeekProvide:
+			seekable = true
+		case SeekRemove:
+			seekable = false
+		}
+		below = l.Kind
+	}
+	return nil
+}
+
+// Build validates the stack and returns the top most Fs.
+func (b *Builder) Build() (kafero.Fs, error) {
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	fs := b.base
+	for _, l := range b.layers {
+		var err error
+		fs, err = l.Wrap(fs)
+		if err != nil {
+			return nil, fmt.Errorf("error building layer %s: %v", l.Kind, err)
+		}
+	}
+	return fs, nil
+}
@@ -0,0 +1,317 @@
+package stack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/melaurent/kafero"
+	"github.com/pierrec/lz4/v4"
+	"gopkg.in/yaml.v2"
+)
+
+// Config describes a filesystem stack: a base backend and the layers
+// applied on top of it, from the bottom up.
+//
+// In YAML:
+//
+//	base:
+//	  type: named
+//	  name: gcs
+//	layers:
+//	  - type: sizecache
+//	    size: 1073741824
+//	    cache_time: 1h
+//	    cache:
+//	      base: {type: os}
+//	      layers: [{type: basepath, path: /var/cache/kafero}]
+//	  - type: zstd
+//	    level: better
+type Config struct {
+	Base   BackendConfig `json:"base" yaml:"base"`
+	Layers []LayerConfig `json:"layers" yaml:"layers"`
+}
+
+// BackendConfig describes the base of a stack.
+type BackendConfig struct {
+	// Type is one of "mem", "os" or "named".
+	Type string `json:"type" yaml:"type"`
+	// Name is the key of a "named" backend in the backends given to
+	// FromConfig, used for backends that need a client like GcsFs or s3.Fs.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Seekable overrides whether the backend files support seeking.
+	Seekable *bool `json:"seekable,omitempty" yaml:"seekable,omitempty"`
+}
+
+// LayerConfig describes one layer of a stack. Which fields are used depends
+// on the layer type.
+type LayerConfig struct {
+	Type string `json:"type" yaml:"type"`
+	// Path of a basepath layer.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+	// Level of a zstd layer: fastest, default, better or best, or of a lz4
+	// layer: fast or level1 to level9.
+	Level string `json:"level,omitempty" yaml:"level,omitempty"`
+	// Size in bytes of a sizecache layer.
+	Size int64 `json:"size,omitempty" yaml:"size,omitempty"`
+	// CacheTime of the cache layers, parsed with time.ParseDuration.
+	CacheTime string `json:"cache_time,omitempty" yaml:"cache_time,omitempty"`
+	// Cache is the secondary filesystem of the sizecache, cacheonread,
+	// buffer and copyonwrite layers.
+	Cache *Config `json:"cache,omitempty" yaml:"cache,omitempty"`
+	// Sink of an instrumented layer, the name of a MetricsSink given to
+	// RegisterSink.
+	Sink string `json:"sink,omitempty" yaml:"sink,omitempty"`
+	// Label of an instrumented layer, telling apart the levels of the
+	// stack reporting to the same sink.
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+}
+
+// LayerFactory creates a Layer from its configuration. backends are the
+// named backends given to FromConfig, to be used when building nested stacks.
+type LayerFactory func(cfg LayerConfig, backends map[string]kafero.Fs) (Layer, error)
+
+var (
+	factoriesL sync.RWMutex
+	factories  = map[string]LayerFactory{}
+
+	sinksL sync.RWMutex
+	sinks  = map[string]kafero.MetricsSink{}
+)
+
+// RegisterLayer makes a layer type available to configurations. It
+// replaces any factory previously registered for the same type.
+func RegisterLayer(kind string, factory LayerFactory) {
+	factoriesL.Lock()
+	defer factoriesL.Unlock()
+	factories[kind] = factory
+}
+
+// RegisterSink makes a MetricsSink available to the instrumented layers
+// of configurations, under name. It replaces any sink previously
+// registered with the same name.
+func RegisterSink(name string, sink kafero.MetricsSink) {
+	sinksL.Lock()
+	defer sinksL.Unlock()
+	sinks[name] = sink
+}
+
+func init() {
+	RegisterLayer("readonly", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		return ReadOnly(), nil
+	})
+	RegisterLayer("basepath", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		if cfg.Path == "" {
+			return Layer{}, fmt.Errorf("basepath layer requires a path")
+		}
+		return BasePath(cfg.Path), nil
+	})
+	RegisterLayer("sizecache", func(cfg LayerConfig, backends map[string]kafero.Fs) (Layer, error) {
+		cache, cacheTime, err := cacheOptions(cfg, backends)
+		if err != nil {
+			return Layer{}, err
+		}
+		return withCache(cache, func(cache kafero.Fs) Layer {
+			return SizeCache(cache, cfg.Size, cacheTime)
+		}), nil
+	})
+	RegisterLayer("cacheonread", func(cfg LayerConfig, backends map[string]kafero.Fs) (Layer, error) {
+		cache, cacheTime, err := cacheOptions(cfg, backends)
+		if err != nil {
+			return Layer{}, err
+		}
+		return withCache(cache, func(cache kafero.Fs) Layer {
+			return CacheOnRead(cache, cacheTime)
+		}), nil
+	})
+	RegisterLayer("buffer", func(cfg LayerConfig, backends map[string]kafero.Fs) (Layer, error) {
+		cache, _, err := cacheOptions(cfg, backends)
+		if err != nil {
+			return Layer{}, err
+		}
+		return withCache(cache, func(cache kafero.Fs) Layer {
+			return Buffer(cache)
+		}), nil
+	})
+	RegisterLayer("copyonwrite", func(cfg LayerConfig, backends map[string]kafero.Fs) (Layer, error) {
+		cache, _, err := cacheOptions(cfg, backends)
+		if err != nil {
+			return Layer{}, err
+		}
+		return withCache(cache, func(cache kafero.Fs) Layer {
+			return CopyOnWrite(cache)
+		}), nil
+	})
+	RegisterLayer("instrumented", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		if cfg.Sink == "" {
+			return Layer{}, fmt.Errorf("instrumented layer requires a sink")
+		}
+		sinksL.RLock()
+		sink, ok := sinks[cfg.Sink]
+		sinksL.RUnlock()
+		if !ok {
+			return Layer{}, fmt.Errorf("unknown sink %q", cfg.Sink)
+		}
+		return Instrumented(cfg.Label, sink), nil
+	})
+	RegisterLayer("zstd", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		level := zstd.SpeedDefault
+		if cfg.Level != "" {
+			ok, l := zstd.EncoderLevelFromString(cfg.Level)
+			if !ok {
+				return Layer{}, fmt.Errorf("unknown zstd level %q", cfg.Level)
+			}
+			level = l
+		}
+		return Zstd(level), nil
+	})
+	RegisterLayer("lz4", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		level := lz4.Fast
+		if cfg.Level != "" {
+			l, err := lz4Level(cfg.Level)
+			if err != nil {
+				return Layer{}, err
+			}
+			level = l
+		}
+		return LZ4(level), nil
+	})
+	RegisterLayer("snappy", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		return Snappy(), nil
+	})
+}
+
+func lz4Level(name string) (lz4.CompressionLevel, error) {
+	levels := []lz4.CompressionLevel{lz4.Fast, lz4.Level1, lz4.Level2, lz4.Level3,
+		lz4.Level4, lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9}
+	for _, level := range levels {
+		if strings.EqualFold(level.String(), name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown lz4 level %q", name)
+}
+
+// cacheOptions returns the Builder of the cache filesystem of the cache
+// layers, validated but not built, and their cache time.
+func cacheOptions(cfg LayerConfig, backends map[string]kafero.Fs) (*Builder, time.Duration, error) {
+	if cfg.Cache == nil {
+		return nil, 0, fmt.Errorf("%s layer requires a cache filesystem", cfg.Type)
+	}
+	cache, err := cfg.Cache.Builder(backends)
+	if err == nil {
+		err = cache.Validate()
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("error configuring cache filesystem: %v", err)
+	}
+	var cacheTime time.Duration
+	if cfg.CacheTime != "" {
+		cacheTime, err = time.ParseDuration(cfg.CacheTime)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error parsing cache time: %v", err)
+		}
+	}
+	return cache, cacheTime, nil
+}
+
+// withCache returns the layer returned by layer for the cache filesystem,
+// which is only built along with the layer, when the stack is.
+func withCache(cache *Builder, layer func(cache kafero.Fs) Layer) Layer {
+	l := layer(nil)
+	l.Wrap = func(fs kafero.Fs) (kafero.Fs, error) {
+		c, err := cache.Build()
+		if err != nil {
+			return nil, fmt.Errorf("error building cache filesystem: %v", err)
+		}
+		return layer(c).Wrap(fs)
+	}
+	return l
+}
+
+// Builder returns a Builder for the configuration, with every layer
+// constructed but not applied yet.
+func (c *Config) Builder(backends map[string]kafero.Fs) (*Builder, error) {
+	var base kafero.Fs
+	switch c.Base.Type {
+	case "mem":
+		base = kafero.NewMemMapFs()
+	case "os":
+		base = kafero.NewOsFs()
+	case "named":
+		fs, ok := backends[c.Base.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q", c.Base.Name)
+		}
+		base = fs
+	default:
+		return nil, fmt.Errorf("unknown backend type %q", c.Base.Type)
+	}
+	b := New(base)
+	if c.Base.Seekable != nil {
+		b.Seekable(*c.Base.Seekable)
+	}
+	for i, lc := range c.Layers {
+		factoriesL.RLock()
+		factory, ok := factories[lc.Type]
+		factoriesL.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("layer %d: unknown layer type %q", i, lc.Type)
+		}
+		l, err := factory(lc, backends)
+		if err != nil {
+			return nil, fmt.Errorf("layer %d: %v", i, err)
+		}
+		b.With(l)
+	}
+	return b, nil
+}
+
+// FromConfig builds the stack described by the configuration.
+func FromConfig(c *Config, backends map[string]kafero.Fs) (kafero.Fs, error) {
+	b, err := c.Builder(backends)
+	if err != nil {
+		return nil, err
+	}
+	return b.Build()
+}
+
+// ParseConfig decodes a configuration. format is either "json" or "yaml".
+func ParseConfig(data []byte, format string) (*Config, error) {
+	c := &Config{}
+	switch strings.ToLower(format) {
+	case "json":
+		// Strict as the YAML, the unknown keys being mistakes
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(c); err != nil {
+			return nil, fmt.Errorf("error unmarshalling config: %v", err)
+		}
+	case "yaml", "yml":
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("error unmarshalling config: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
+	}
+	return c, nil
+}
+
+// LoadFile reads a configuration file from fs, guessing its format from
+// its extension, and builds the stack it describes.
+func LoadFile(fs kafero.Fs, name string, backends map[string]kafero.Fs) (kafero.Fs, error) {
+	data, err := kafero.ReadFile(fs, name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	c, err := ParseConfig(data, strings.TrimPrefix(filepath.Ext(name), "."))
+	if err != nil {
+		return nil, err
+	}
+	return FromConfig(c, backends)
+}
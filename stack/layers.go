@@ -0,0 +1,128 @@
+package stack
+
+import (
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/lz4fs"
+	"github.com/melaurent/kafero/snappyfs"
+	"github.com/melaurent/kafero/zstfs"
+	"github.com/pierrec/lz4/v4"
+)
+
+// ReadOnly returns a layer rejecting every write operation.
+func ReadOnly() Layer {
+	return Layer{
+		Kind: "readonly",
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewReadOnlyFs(fs), nil
+		},
+	}
+}
+
+// BasePath returns a layer restricting all operations to path.
+func BasePath(path string) Layer {
+	return Layer{
+		Kind: "basepath",
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewBasePathFs(fs, path), nil
+		},
+	}
+}
+
+// SizeCache returns a layer caching up to size bytes of the files of the
+// wrapped Fs in cache.
+func SizeCache(cache kafero.Fs, size int64, cacheTime time.Duration) Layer {
+	return Layer{
+		Kind:      "sizecache",
+		NeedsSeek: true,
+		Seek:      SeekProvide,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewSizeCacheFS(fs, cache, size, cacheTime)
+		},
+	}
+}
+
+// CacheOnRead returns a layer copying the files of the wrapped Fs to layer
+// when they are read.
+func CacheOnRead(layer kafero.Fs, cacheTime time.Duration) Layer {
+	return Layer{
+		Kind:      "cacheonread",
+		NeedsSeek: true,
+		Seek:      SeekProvide,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewCacheOnReadFs(fs, layer, cacheTime), nil
+		},
+	}
+}
+
+// Buffer returns a layer buffering opened files in layer.
+func Buffer(layer kafero.Fs) Layer {
+	return Layer{
+		Kind:      "buffer",
+		NeedsSeek: true,
+		Seek:      SeekProvide,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewBufferFs(fs, layer), nil
+		},
+	}
+}
+
+// CopyOnWrite returns a layer writing all changes to layer, leaving the
+// wrapped Fs untouched.
+func CopyOnWrite(layer kafero.Fs) Layer {
+	return Layer{
+		Kind: "copyonwrite",
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewCopyOnWriteFs(fs, layer), nil
+		},
+	}
+}
+
+// Instrumented returns a layer reporting the operations on the wrapped Fs
+// to sink, labelled with label.
+func Instrumented(label string, sink kafero.MetricsSink) Layer {
+	return Layer{
+		Kind: "instrumented",
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return kafero.NewInstrumentedFs(fs, label, sink), nil
+		},
+	}
+}
+
+// Zstd returns a layer compressing files with zstd, configured by opts.
+// Compressed files can't be seeked.
+func Zstd(level zstd.EncoderLevel, opts ...zstfs.Option) Layer {
+	return Layer{
+		Kind: "zstd",
+		Seek: SeekRemove,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return zstfs.NewFs(fs, level, opts...), nil
+		},
+	}
+}
+
+// LZ4 returns a layer compressing files with lz4, faster but compressing
+// less than Zstd. Compressed files can't be seeked.
+func LZ4(level lz4.CompressionLevel, opts ...lz4fs.Option) Layer {
+	return Layer{
+		Kind: "lz4",
+		Seek: SeekRemove,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return lz4fs.NewFs(fs, level, opts...), nil
+		},
+	}
+}
+
+// Snappy returns a layer compressing files with snappy, faster but
+// compressing less than Zstd. Compressed files can't be seeked.
+func Snappy(opts ...snappyfs.Option) Layer {
+	return Layer{
+		Kind: "snappy",
+		Seek: SeekRemove,
+		Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			return snappyfs.NewFs(fs, opts...), nil
+		},
+	}
+}
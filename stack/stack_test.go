@@ -0,0 +1,181 @@
+package stack
+
+import (
+	"testing"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+func TestFromYAML(t *testing.T) {
+	data := []byte(`
+base:
+  type: named
+  name: remote
+layers:
+  - type: sizecache
+    size: 1000000
+    cache_time: 1m
+    cache:
+      base: {type: mem}
+  - type: zstd
+    level: fastest
+`)
+	c, err := ParseConfig(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := FromConfig(c, map[string]kafero.Fs{"remote": kafero.NewMemMapFs()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fs.Name() != "ZSTFs" {
+		t.Fatalf("was expecting the top layer to be ZSTFs, got %s", fs.Name())
+	}
+	tests.TestWriteFile(t, fs, "file.txt", 1000)
+}
+
+func TestFromJSON(t *testing.T) {
+	data := []byte(`{"base": {"type": "mem"}, "layers": [{"type": "basepath", "path": "/data"}, {"type": "readonly"}]}`)
+	c, err := ParseConfig(data, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := FromConfig(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Create("file.txt"); err == nil {
+		t.Fatal("was expecting an error creating a file on a read only stack")
+	}
+}
+
+func TestIncompatibleLayers(t *testing.T) {
+	data := []byte(`
+base: {type: mem}
+layers:
+  - type: zstd
+  - type: buffer
+    cache:
+      base: {type: mem}
+`)
+	c, err := ParseConfig(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromConfig(c, nil); err == nil {
+		t.Fatal("was expecting an error stacking a buffer layer over zstd")
+	}
+}
+
+func TestUnknownLayer(t *testing.T) {
+	c := &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{{Type: "nope"}}}
+	if _, err := FromConfig(c, nil); err == nil {
+		t.Fatal("was expecting an error for an unknown layer type")
+	}
+}
+
+func TestCompressionLayers(t *testing.T) {
+	for name, layer := range map[string]LayerConfig{
+		"LZ4Fs":    {Type: "lz4", Level: "level9"},
+		"SnappyFs": {Type: "snappy"},
+	} {
+		c := &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{layer}}
+		fs, err := FromConfig(c, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fs.Name() != name {
+			t.Fatalf("was expecting the top layer to be %s, got %s", name, fs.Name())
+		}
+		tests.TestWriteFile(t, fs, "file.txt", 1000)
+	}
+	c := &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{{Type: "lz4", Level: "level10"}}}
+	if _, err := FromConfig(c, nil); err == nil {
+		t.Fatal("was expecting an error for an unknown lz4 level")
+	}
+}
+
+func TestParseConfigUnknownKeys(t *testing.T) {
+	for format, data := range map[string]string{
+		"json": `{"base": {"type": "mem"}, "layers": [{"type": "sizecache", "sise": 1000}]}`,
+		"yaml": "base: {type: mem}\nlayers: [{type: sizecache, sise: 1000}]\n",
+	} {
+		if _, err := ParseConfig([]byte(data), format); err == nil {
+			t.Errorf("%s: was expecting an error for an unknown key", format)
+		}
+	}
+}
+
+// The cache filesystems are built along with the stack
+func TestLazyCache(t *testing.T) {
+	built := 0
+	RegisterLayer("counting", func(cfg LayerConfig, _ map[string]kafero.Fs) (Layer, error) {
+		return Layer{Kind: "counting", Wrap: func(fs kafero.Fs) (kafero.Fs, error) {
+			built++
+			return fs, nil
+		}}, nil
+	})
+	c := &Config{
+		Base: BackendConfig{Type: "mem"},
+		Layers: []LayerConfig{
+			{Type: "cacheonread", Cache: &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{{Type: "counting"}}}},
+			{Type: "zstd"},
+			{Type: "buffer", Cache: &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{{Type: "counting"}}}},
+		},
+	}
+	b, err := c.Builder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built != 0 {
+		t.Fatalf("was expecting no cache built by the builder, got %d", built)
+	}
+	// The buffer layer over zstd is rejected before building anything
+	if _, err := b.Build(); err == nil {
+		t.Fatal("was expecting an error stacking a buffer layer over zstd")
+	}
+	if built != 0 {
+		t.Fatalf("was expecting no cache built for an invalid stack, got %d", built)
+	}
+
+	c.Layers = c.Layers[:2]
+	if _, err := FromConfig(c, nil); err != nil {
+		t.Fatal(err)
+	}
+	if built != 1 {
+		t.Fatalf("was expecting the cache built once, got %d", built)
+	}
+}
+
+func TestInstrumentedLayer(t *testing.T) {
+	recorder := kafero.NewMetricsRecorder()
+	RegisterSink("recorder", recorder)
+	data := []byte(`
+base: {type: mem}
+layers:
+  - type: instrumented
+    sink: recorder
+    label: base
+  - type: zstd
+`)
+	c, err := ParseConfig(data, "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := FromConfig(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests.TestWriteFile(t, fs, "file.txt", 1000)
+	if s := recorder.Stats("base", "write"); s.Count == 0 || s.Bytes == 0 {
+		t.Fatalf("was expecting the writes under zstd to be reported, got %+v", s)
+	}
+
+	for _, layer := range []LayerConfig{{Type: "instrumented"}, {Type: "instrumented", Sink: "nope"}} {
+		c := &Config{Base: BackendConfig{Type: "mem"}, Layers: []LayerConfig{layer}}
+		if _, err := FromConfig(c, nil); err == nil {
+			t.Fatalf("was expecting an error for the sink %q", layer.Sink)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package kafero
+
+import (
+	"context"
+	"sync"
+)
+
+// refresher refreshes the stale cached files in the background, at most
+// concurrency at a time and each once, for the caching filesystems serving
+// the stale files meanwhile.
+type refresher struct {
+	mu      sync.Mutex
+	pending map[string]bool
+	slots   chan struct{}
+	wg      sync.WaitGroup
+	stopped bool
+}
+
+func newRefresher(concurrency int) *refresher {
+	if concurrency <= 0 {
+		return nil
+	}
+	return &refresher{pending: make(map[string]bool), slots: make(chan struct{}, concurrency)}
+}
+
+// refresh runs fn, refreshing name, in the background, unless name is
+// already being refreshed, all the slots are taken or the refresher is
+// stopped. It returns whether fn was run.
+func (r *refresher) refresh(name string, fn func()) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped || r.pending[name] {
+		return false
+	}
+	select {
+	case r.slots <- struct{}{}:
+	default:
+		return false
+	}
+	r.pending[name] = true
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		fn()
+		r.mu.Lock()
+		delete(r.pending, name)
+		r.mu.Unlock()
+		<-r.slots
+	}()
+	return true
+}
+
+// wait waits for the refreshes running.
+func (r *refresher) wait() {
+	r.wg.Wait()
+}
+
+// stop stops starting refreshes, and waits for those running until ctx is
+// done.
+func (r *refresher) stop(ctx context.Context) error {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	done := make(chan struct{})
+	go func() {
+		r.wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// refreshPath returns the name of the temporary file holding the content
+// of name being refreshed, renamed over it once complete, so that the
+// files open on the stale content keep reading it.
+func refreshPath(name string) string {
+	return cacheTempPath(name, ".refresh")
+}
+
+// refreshLayer copies name again from base to layer.
+func refreshLayer(base Fs, layer Fs, name string) error {
+	tmp := refreshPath(name)
+	if err := copyToLayerAs(base, layer, name, tmp); err != nil {
+		return err
+	}
+	if err := layer.Rename(tmp, name); err != nil {
+		_ = layer.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package kafero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSizeCacheFSStaleWhileRevalidate(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	base := NewMemMapFs()
+	if err := WriteFile(base, "file.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Chtimes("file.txt", start, start); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewSizeCacheFS(base, NewMemMapFs(), 1<<20, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs.SetClock(clock)
+	fs.SetStaleWhileRevalidate(2)
+	if data, err := ReadFile(fs, "file.txt"); err != nil || string(data) != "old" {
+		t.Fatalf("was expecting old, got %q, %v", data, err)
+	}
+
+	// The base file changes once the cached copy expired
+	clock.Advance(time.Hour)
+	if err := WriteFile(base, "file.txt", []byte("new content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Chtimes("file.txt", clock.Now(), clock.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ReadFile(fs, "file.txt"); err != nil || string(data) != "old" {
+		t.Fatalf("was expecting the stale content served, got %q, %v", data, err)
+	}
+	fs.refresher.wait()
+	if data, err := ReadFile(fs, "file.txt"); err != nil || string(data) != "new content" {
+		t.Fatalf("was expecting the refreshed content, got %q, %v", data, err)
+	}
+	if exists, _ := Exists(fs.cache, refreshPath("file.txt")); exists {
+		t.Fatal("was expecting the refresh file renamed")
+	}
+	if size := fs.Size(); size != int64(len("new content")) {
+		t.Fatalf("was expecting the cache size updated, got %d", size)
+	}
+}
+
+func TestCacheOnReadFsStaleWhileRevalidate(t *testing.T) {
+	old := time.Now().Add(-time.Hour)
+	base := NewMemMapFs()
+	if err := WriteFile(base, "file.txt", []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := base.Chtimes("file.txt", old, old); err != nil {
+		t.Fatal(err)
+	}
+	fs := NewCacheOnReadFs(base, NewMemMapFs(), time.Minute).(*CacheOnReadFs)
+	fs.SetStaleWhileRevalidate(1)
+	if data, err := ReadFile(fs, "file.txt"); err != nil || string(data) != "old" {
+		t.Fatalf("was expecting old, got %q, %v", data, err)
+	}
+
+	if err := WriteFile(base, "file.txt", []byte("new content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Opened before the refresh, the stale file keeps its content
+	f, err := fs.Open("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	fs.refresher.wait()
+	if data, err := ReadFile(fs, "file.txt"); err != nil || string(data) != "new content" {
+		t.Fatalf("was expecting the refreshed content, got %q, %v", data, err)
+	}
+	b := make([]byte, 16)
+	if n, _ := f.Read(b); string(b[:n]) != "old" {
+		t.Fatalf("was expecting the stale file to read old, got %q", b[:n])
+	}
+}
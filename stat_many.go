@@ -0,0 +1,66 @@
+package kafero
+
+import (
+	"os"
+	"sync"
+)
+
+// StatManyer is an optional interface in Kafero. It is implemented by the
+// filesystems able to stat many files faster than one after the other,
+// typically remote backends issuing concurrent requests.
+type StatManyer interface {
+	// StatMany returns the FileInfo of the existing files among names.
+	// Missing files are absent from the result.
+	StatMany(names []string) (map[string]os.FileInfo, error)
+}
+
+func (a Afero) StatMany(names []string) (map[string]os.FileInfo, error) {
+	return StatMany(a.Fs, names)
+}
+
+// StatMany returns the FileInfo of the existing files among names, using
+// the StatManyer fast path if the filesystem has one. Missing files are
+// absent from the result.
+func StatMany(fs Fs, names []string) (map[string]os.FileInfo, error) {
+	if sfs, ok := fs.(StatManyer); ok {
+		return sfs.StatMany(names)
+	}
+	return statMany(names, 1, fs.Stat)
+}
+
+// statMany calls stat on names using up to workers goroutines.
+func statMany(names []string, workers int, stat func(string) (os.FileInfo, error)) (map[string]os.FileInfo, error) {
+	res := make(map[string]os.FileInfo, len(names))
+	if workers > len(names) {
+		workers = len(names)
+	}
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range queue {
+				fi, err := stat(name)
+				mu.Lock()
+				if err == nil {
+					res[name] = fi
+				} else if !os.IsNotExist(err) && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		queue <- name
+	}
+	close(queue)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return res, nil
+}
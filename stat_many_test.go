@@ -0,0 +1,35 @@
+package kafero
+
+import "testing"
+
+func TestStatMany(t *testing.T) {
+	fs := NewMemMapFs()
+	if err := WriteFile(fs, "a.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MkdirAll("dir", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := StatMany(fs, []string{"a.txt", "dir", "missing.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("was expecting 2 results, got %d", len(res))
+	}
+	if fi := res["a.txt"]; fi == nil || fi.Size() != 1 {
+		t.Fatal("was expecting a.txt of size 1")
+	}
+	if fi := res["dir"]; fi == nil || !fi.IsDir() {
+		t.Fatal("was expecting dir to be a directory")
+	}
+
+	res, err = statMany([]string{"a.txt", "dir", "missing.txt"}, 8, fs.Stat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("was expecting 2 results, got %d", len(res))
+	}
+}
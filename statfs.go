@@ -0,0 +1,36 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+)
+
+// Statfser is an optional interface in Kafero. It is only implemented by the
+// filesystems able to report the usage of the device holding a file, like
+// statfs(2) does.
+type Statfser interface {
+	Statfs(name string) (*FsUsage, error)
+}
+
+// FsUsage is the space usage of a filesystem, in bytes.
+type FsUsage struct {
+	// Total size of the filesystem.
+	Total uint64
+	// Free space, including the space reserved to the super-user.
+	Free uint64
+	// Available space for unprivileged users.
+	Available uint64
+}
+
+// ErrStatfsNotSupported is returned by the filesystems not implementing
+// Statfser.
+var ErrStatfsNotSupported = errors.New("statfs not supported")
+
+// Statfs returns the usage of the filesystem holding the named file, if the
+// filesystem supports it.
+func Statfs(fs Fs, name string) (*FsUsage, error) {
+	if sfs, ok := fs.(Statfser); ok {
+		return sfs.Statfs(name)
+	}
+	return nil, &os.PathError{Op: "statfs", Path: name, Err: ErrStatfsNotSupported}
+}
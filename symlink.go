@@ -0,0 +1,177 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Symlinker is an optional interface in Kafero. It is only implemented by the
+// filesystems saying so.
+// It indicates support for 3 symlink related interfaces that implement the
+// behaviors of the os methods:
+//   - Lstat
+//   - Symlink, and
+//   - Readlink
+type Symlinker interface {
+	Lstater
+	Linker
+	LinkReader
+}
+
+// Linker is an optional interface in Kafero. It is only implemented by the
+// filesystems saying so.
+// It will call Symlink if the filesystem itself is, or it delegates to, the os filesystem,
+// or the filesystem otherwise supports Symlink's.
+type Linker interface {
+	SymlinkIfPossible(oldname, newname string) error
+}
+
+// LinkReader is an optional interface in Kafero. It is only implemented by the
+// filesystems saying so.
+type LinkReader interface {
+	ReadlinkIfPossible(name string) (string, error)
+}
+
+var (
+	// ErrNoSymlink is the error returned by the filesystems not supporting
+	// symbolic links.
+	ErrNoSymlink = errors.New("symlink not supported")
+	// ErrNoReadlink is the error returned by the filesystems not supporting
+	// reading symbolic links.
+	ErrNoReadlink = errors.New("readlink not supported")
+	// ErrTooManyLinks is returned by EvalSymlinks when it follows too many
+	// links, usually because of a loop.
+	ErrTooManyLinks = errors.New("too many links")
+)
+
+// Maximum number of links followed by EvalSymlinks, as filepath.EvalSymlinks
+const maxLinksWalked = 255
+
+// EvalSymlinks returns the path name after the evaluation of any symbolic
+// links, like filepath.EvalSymlinks does on the os filesystem. On
+// filesystems without symbolic links, it returns the cleaned path if it
+// exists.
+// adapted from https://golang.org/src/path/filepath/symlink.go
+func EvalSymlinks(fs Fs, path string) (string, error) {
+	reader, ok := fs.(LinkReader)
+	if !ok {
+		if _, err := fs.Stat(path); err != nil {
+			return "", err
+		}
+		return filepath.Clean(path), nil
+	}
+
+	volLen := len(filepath.VolumeName(path))
+	if volLen < len(path) && os.IsPathSeparator(path[volLen]) {
+		volLen++
+	}
+	vol := path[:volLen]
+	dest := vol
+	linksWalked := 0
+	for start, end := volLen, volLen; start < len(path); start = end {
+		for start < len(path) && os.IsPathSeparator(path[start]) {
+			start++
+		}
+		end = start
+		for end < len(path) && !os.IsPathSeparator(path[end]) {
+			end++
+		}
+
+		if end == start {
+			// No more path components.
+			break
+		} else if path[start:end] == "." {
+			// Ignore path component ".".
+			continue
+		} else if path[start:end] == ".." {
+			// Back up to previous component if possible.
+			// Note that volLen includes any leading slash.
+			var r int
+			for r = len(dest) - 1; r >= volLen; r-- {
+				if os.IsPathSeparator(dest[r]) {
+					break
+				}
+			}
+			if r < volLen || dest[r+1:] == ".." {
+				// Either path has no slashes
+				// (it's empty or just "C:")
+				// or it ends in a ".." we had to keep.
+				// Either way, keep this "..".
+				if len(dest) > volLen {
+					dest += string(filepath.Separator)
+				}
+				dest += ".."
+			} else {
+				// Discard everything since the last slash.
+				dest = dest[:r]
+			}
+			continue
+		}
+
+		// Ordinary path component. Add it to result.
+		if len(dest) > len(filepath.VolumeName(dest)) && !os.IsPathSeparator(dest[len(dest)-1]) {
+			dest += string(filepath.Separator)
+		}
+		dest += path[start:end]
+
+		// Resolve symlink.
+		fi, err := lstatIfPossible(fs, dest)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			if !fi.Mode().IsDir() && end < len(path) {
+				return "", &os.PathError{Op: "evalsymlinks", Path: dest, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+
+		// Found symlink.
+		linksWalked++
+		if linksWalked > maxLinksWalked {
+			return "", &os.PathError{Op: "evalsymlinks", Path: path, Err: ErrTooManyLinks}
+		}
+
+		link, err := reader.ReadlinkIfPossible(dest)
+		if err != nil {
+			return "", err
+		}
+
+		path = link + path[end:]
+
+		v := len(filepath.VolumeName(link))
+		if v > 0 {
+			// Symlink to drive name is an absolute path.
+			if v < len(link) && os.IsPathSeparator(link[v]) {
+				v++
+			}
+			vol = link[:v]
+			dest = vol
+			end = len(vol)
+		} else if len(link) > 0 && os.IsPathSeparator(link[0]) {
+			// Symlink to absolute path.
+			dest = link[:1]
+			end = 1
+			vol = link[:1]
+			volLen = 1
+		} else {
+			// Symlink to relative path; replace last
+			// path component in dest.
+			var r int
+			for r = len(dest) - 1; r >= volLen; r-- {
+				if os.IsPathSeparator(dest[r]) {
+					break
+				}
+			}
+			if r < volLen {
+				dest = vol
+			} else {
+				dest = dest[:r]
+			}
+			end = 0
+		}
+	}
+	return filepath.Clean(dest), nil
+}
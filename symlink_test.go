@@ -0,0 +1,81 @@
+package kafero
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestEvalSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping on Windows.")
+	}
+	dir, err := ioutil.TempDir("", "kafero-symlink")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fs := NewBasePathFs(NewOsFs(), dir).(*BasePathFs)
+	if err := fs.MkdirAll("/data/raw", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(fs, "/data/raw/file.txt", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"/data/latest":   "raw",
+		"/data/abs":      "/data/raw/file.txt",
+		"/data/raw/up":   "../latest/file.txt",
+		"/data/loop1":    "loop2",
+		"/data/loop2":    "loop1",
+		"/data/dangling": "missing.txt",
+	}
+	for link, target := range links {
+		if err := fs.SymlinkIfPossible(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := map[string]string{
+		"/data/latest/file.txt":  "/data/raw/file.txt",
+		"/data/abs":              "/data/raw/file.txt",
+		"/data/raw/up":           "/data/raw/file.txt",
+		"/data/./latest/../raw/": "/data/raw",
+	}
+	for path, expected := range tests {
+		resolved, err := EvalSymlinks(fs, path)
+		if err != nil {
+			t.Fatalf("error evaluating %s: %v", path, err)
+		}
+		if resolved != expected {
+			t.Fatalf("was expecting %s to resolve to %s, got %s", path, expected, resolved)
+		}
+		// Same result as the os package
+		osResolved, err := filepath.EvalSymlinks(filepath.Join(dir, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		osDir, _ := filepath.EvalSymlinks(dir)
+		if osResolved != filepath.Join(osDir, expected) {
+			t.Fatalf("was expecting %s, got %s from the os", filepath.Join(osDir, expected), osResolved)
+		}
+	}
+
+	if _, err := EvalSymlinks(fs, "/data/loop1"); !errors.Is(err, ErrTooManyLinks) {
+		t.Fatalf("was expecting too many links, got %v", err)
+	}
+	if _, err := EvalSymlinks(fs, "/data/dangling"); !os.IsNotExist(err) {
+		t.Fatalf("was expecting a not exist error, got %v", err)
+	}
+
+	// Filesystems without links
+	mem := NewMemMapFs()
+	WriteFile(mem, "/a/b.txt", []byte("b"), 0644)
+	if resolved, err := EvalSymlinks(mem, "/a//b.txt"); err != nil || resolved != "/a/b.txt" {
+		t.Fatalf("was expecting /a/b.txt, got %s, %v", resolved, err)
+	}
+}
@@ -0,0 +1,124 @@
+package kafero
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// The TempManager creates temporary directories and files on a Fs, named
+// after a namespace, and keeps track of them so they can all be removed at
+// once. With HandleSignals, they are also removed when the process is
+// interrupted.
+type TempManager struct {
+	fs        Fs
+	dir       string
+	namespace string
+	mu        sync.Mutex
+	paths     []string
+	signals   chan os.Signal
+}
+
+// NewTempManager returns a TempManager creating its temporary files in dir,
+// os.TempDir() if empty, with names starting with namespace.
+func NewTempManager(fs Fs, dir, namespace string) *TempManager {
+	return &TempManager{fs: fs, dir: dir, namespace: namespace}
+}
+
+// TempDir creates a new temporary directory.
+func (m *TempManager) TempDir() (string, error) {
+	name, err := TempDir(m.fs, m.dir, m.namespace)
+	if err != nil {
+		return "", err
+	}
+	m.Track(name)
+	return name, nil
+}
+
+// TempFile creates a new temporary file, opened for reading and writing.
+func (m *TempManager) TempFile() (File, error) {
+	f, err := TempFile(m.fs, m.dir, m.namespace)
+	if err != nil {
+		return nil, err
+	}
+	m.Track(f.Name())
+	return f, nil
+}
+
+// Track registers a path created by other means to be removed with the
+// temporary files.
+func (m *TempManager) Track(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.paths = append(m.paths, path)
+}
+
+// Paths returns the tracked paths.
+func (m *TempManager) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.paths...)
+}
+
+// Cleanup removes all the tracked paths. The TempManager can be used again
+// afterwards.
+func (m *TempManager) Cleanup() error {
+	m.mu.Lock()
+	paths := m.paths
+	m.paths = nil
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, path := range paths {
+		if err := m.fs.RemoveAll(path); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("error removing temporary path %s: %v", path, err)
+		}
+	}
+	return firstErr
+}
+
+// HandleSignals removes the tracked paths when the process receives one of
+// sigs, os.Interrupt and SIGTERM if none is given, before delivering the
+// signal again with its default behavior.
+func (m *TempManager) HandleSignals(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	m.mu.Lock()
+	if m.signals != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.signals = make(chan os.Signal, 1)
+	ch := m.signals
+	m.mu.Unlock()
+
+	signal.Notify(ch, sigs...)
+	go func() {
+		sig, ok := <-ch
+		if !ok {
+			return
+		}
+		_ = m.Cleanup()
+		signal.Reset(sigs...)
+		if p, err := os.FindProcess(os.Getpid()); err == nil && p.Signal(sig) == nil {
+			return
+		}
+		os.Exit(1)
+	}()
+}
+
+// Close removes the tracked paths and stops handling the signals.
+func (m *TempManager) Close() error {
+	m.mu.Lock()
+	ch := m.signals
+	m.signals = nil
+	m.mu.Unlock()
+	if ch != nil {
+		signal.Stop(ch)
+		close(ch)
+	}
+	return m.Cleanup()
+}
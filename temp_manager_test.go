@@ -0,0 +1,45 @@
+package kafero
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTempManager(t *testing.T) {
+	fs := NewMemMapFs()
+	m := NewTempManager(fs, "/tmp", "loader")
+
+	dir, err := m.TempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(filepath.Base(dir), "loader") {
+		t.Fatalf("was expecting %s to be in the loader namespace", dir)
+	}
+	f, err := m.TempFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	other := filepath.Join("/tmp", "other")
+	if err := fs.MkdirAll(other, 0755); err != nil {
+		t.Fatal(err)
+	}
+	m.Track(other)
+	if len(m.Paths()) != 3 {
+		t.Fatalf("was expecting 3 tracked paths, got %d", len(m.Paths()))
+	}
+
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{dir, f.Name(), other} {
+		if exists, _ := Exists(fs, path); exists {
+			t.Fatalf("was expecting %s to be removed", path)
+		}
+	}
+	if len(m.Paths()) != 0 {
+		t.Fatal("was expecting no tracked paths")
+	}
+}
@@ -0,0 +1,178 @@
+package tenantfs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+var (
+	// ErrNoTenant is returned when the context carries no tenant.
+	ErrNoTenant = errors.New("no tenant in context")
+	// ErrInvalidTenant is returned for the tenant IDs which are not a
+	// single path element.
+	ErrInvalidTenant = errors.New("invalid tenant")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant carried by ctx.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey{}).(string)
+	return tenant, ok
+}
+
+// The Fs shares a base filesystem, such as a single GcsFs, between tenants,
+// each of them seeing only its own subtree, root/<tenant>, as the whole
+// filesystem. The paths of a tenant can't reach the subtrees of the others,
+// whatever their "..", and the names of the files and the errors of the
+// filesystem operations don't reveal the real paths.
+//
+// The symlinks can't be created through the tenant filesystems, as they
+// could lead out of the subtree.
+type Fs struct {
+	base kafero.Fs
+	root string
+}
+
+// NewFs returns an Fs storing the subtrees of the tenants under the
+// directory root of base.
+func NewFs(base kafero.Fs, root string) *Fs {
+	return &Fs{base: base, root: filepath.Clean(root)}
+}
+
+func validTenant(tenant string) bool {
+	return tenant != "" && tenant != "." && tenant != ".." &&
+		!strings.ContainsAny(tenant, "/\\\x00")
+}
+
+// Tenant returns the filesystem of the tenant carried by ctx.
+func (t *Fs) Tenant(ctx context.Context) (kafero.Fs, error) {
+	tenant, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	return t.ForTenant(tenant)
+}
+
+// ForTenant returns the filesystem of tenant.
+func (t *Fs) ForTenant(tenant string) (kafero.Fs, error) {
+	if !validTenant(tenant) {
+		return nil, ErrInvalidTenant
+	}
+	return &tenantFs{base: t.base, root: filepath.Join(t.root, tenant)}, nil
+}
+
+// tenantFs is the filesystem of a tenant.
+type tenantFs struct {
+	base kafero.Fs
+	root string
+}
+
+// realPath returns the path in the base of name, which can't escape the
+// root of the tenant.
+func (t *tenantFs) realPath(name string) string {
+	clean := filepath.Clean(string(filepath.Separator) + name)
+	return filepath.Join(t.root, clean)
+}
+
+// tenantErr replaces the real paths of err with the names given by the
+// tenant.
+func tenantErr(err error, name string) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return &os.PathError{Op: e.Op, Path: name, Err: e.Err}
+	}
+	return err
+}
+
+func (t *tenantFs) Name() string {
+	return "TenantFs"
+}
+
+// WithContext returns a view of the filesystem of the tenant bound to ctx,
+// whatever the tenant ctx carries.
+func (t *tenantFs) WithContext(ctx context.Context) kafero.Fs {
+	return &tenantFs{base: kafero.WithContext(t.base, ctx), root: t.root}
+}
+
+func (t *tenantFs) Create(name string) (kafero.File, error) {
+	f, err := t.base.Create(t.realPath(name))
+	if err != nil {
+		return nil, tenantErr(err, name)
+	}
+	return &tenantFile{File: f, name: name}, nil
+}
+
+func (t *tenantFs) Mkdir(name string, perm os.FileMode) error {
+	return tenantErr(t.base.Mkdir(t.realPath(name), perm), name)
+}
+
+func (t *tenantFs) MkdirAll(path string, perm os.FileMode) error {
+	return tenantErr(t.base.MkdirAll(t.realPath(path), perm), path)
+}
+
+func (t *tenantFs) Open(name string) (kafero.File, error) {
+	f, err := t.base.Open(t.realPath(name))
+	if err != nil {
+		return nil, tenantErr(err, name)
+	}
+	return &tenantFile{File: f, name: name}, nil
+}
+
+func (t *tenantFs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	f, err := t.base.OpenFile(t.realPath(name), flag, perm)
+	if err != nil {
+		return nil, tenantErr(err, name)
+	}
+	return &tenantFile{File: f, name: name}, nil
+}
+
+func (t *tenantFs) Remove(name string) error {
+	return tenantErr(t.base.Remove(t.realPath(name)), name)
+}
+
+func (t *tenantFs) RemoveAll(path string) error {
+	return tenantErr(t.base.RemoveAll(t.realPath(path)), path)
+}
+
+func (t *tenantFs) Rename(oldname, newname string) error {
+	err := t.base.Rename(t.realPath(oldname), t.realPath(newname))
+	if e, ok := err.(*os.LinkError); ok {
+		return &os.LinkError{Op: e.Op, Old: oldname, New: newname, Err: e.Err}
+	}
+	return tenantErr(err, oldname)
+}
+
+func (t *tenantFs) Stat(name string) (os.FileInfo, error) {
+	info, err := t.base.Stat(t.realPath(name))
+	return info, tenantErr(err, name)
+}
+
+func (t *tenantFs) Chmod(name string, mode os.FileMode) error {
+	return tenantErr(t.base.Chmod(t.realPath(name), mode), name)
+}
+
+func (t *tenantFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return tenantErr(t.base.Chtimes(t.realPath(name), atime, mtime), name)
+}
+
+// tenantFile is a file of a tenant, named as opened by the tenant.
+type tenantFile struct {
+	kafero.File
+	name string
+}
+
+func (f *tenantFile) Name() string {
+	return f.name
+}
@@ -0,0 +1,67 @@
+package tenantfs
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestTenants(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	fs := NewFs(base, "/tenants")
+
+	a, err := fs.Tenant(WithTenant(context.Background(), "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ab, err := fs.ForTenant("ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(a, "/data/file.txt", []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := kafero.WriteFile(ab, "/secret.txt", []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat("/tenants/a/data/file.txt"); err != nil {
+		t.Fatalf("was expecting the file in the subtree of a: %v", err)
+	}
+
+	// The other tenants can't be reached
+	for _, name := range []string{"../ab/secret.txt", "/../ab/secret.txt", "data/../../../tenants/ab/secret.txt"} {
+		_, err := kafero.ReadFile(a, name)
+		if !os.IsNotExist(err) {
+			t.Fatalf("was expecting a not exist error for %s, got %v", name, err)
+		}
+		if perr, ok := err.(*os.PathError); !ok || perr.Path != name {
+			t.Fatalf("the error reveals the real path: %v", err)
+		}
+	}
+	if err := a.Rename("/data/file.txt", "../ab/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := base.Stat("/tenants/a/ab/file.txt"); err != nil {
+		t.Fatalf("was expecting the file to stay in the subtree of a: %v", err)
+	}
+
+	f, err := a.Open("/ab/file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name() != "/ab/file.txt" {
+		t.Fatalf("was expecting /ab/file.txt, got %s", f.Name())
+	}
+	_ = f.Close()
+
+	if _, err := fs.Tenant(context.Background()); err != ErrNoTenant {
+		t.Fatalf("was expecting ErrNoTenant, got %v", err)
+	}
+	for _, tenant := range []string{"", ".", "..", "a/b"} {
+		if _, err := fs.ForTenant(tenant); err != ErrInvalidTenant {
+			t.Fatalf("was expecting ErrInvalidTenant for %q, got %v", tenant, err)
+		}
+	}
+}
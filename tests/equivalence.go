@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+// The paths the random operations work on, so that they often collide
+var equivalencePaths = []string{"a", "b", "d", "d/a", "d/b", "d/e", "d/e/a"}
+
+type equivalenceOp struct {
+	name string
+	run  func(fs kafero.Fs, root string, r *rand.Rand) error
+}
+
+// randomOp returns a random operation. The random choices are made
+// upfront, so that the operation is the same on every filesystem.
+func randomOp(r *rand.Rand) equivalenceOp {
+	p1 := equivalencePaths[r.Intn(len(equivalencePaths))]
+	p2 := equivalencePaths[r.Intn(len(equivalencePaths))]
+	content := []byte(strings.Repeat(string(rune('a'+r.Intn(26))), r.Intn(20)))
+	size := int64(r.Intn(20))
+	switch r.Intn(8) {
+	case 0:
+		return equivalenceOp{"WriteFile " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return kafero.WriteFile(fs, filepath.Join(root, p1), content, 0644)
+		}}
+	case 1:
+		return equivalenceOp{"Append " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			f, err := fs.OpenFile(filepath.Join(root, p1), os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write(content); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}}
+	case 2:
+		return equivalenceOp{fmt.Sprintf("Truncate %s %d", p1, size), func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			f, err := fs.OpenFile(filepath.Join(root, p1), os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			if err := f.Truncate(size); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		}}
+	case 3:
+		return equivalenceOp{"Mkdir " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return fs.Mkdir(filepath.Join(root, p1), 0755)
+		}}
+	case 4:
+		return equivalenceOp{"MkdirAll " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return fs.MkdirAll(filepath.Join(root, p1), 0755)
+		}}
+	case 5:
+		return equivalenceOp{"Remove " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return fs.Remove(filepath.Join(root, p1))
+		}}
+	case 6:
+		return equivalenceOp{"RemoveAll " + p1, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return fs.RemoveAll(filepath.Join(root, p1))
+		}}
+	default:
+		return equivalenceOp{"Rename " + p1 + " " + p2, func(fs kafero.Fs, root string, _ *rand.Rand) error {
+			return fs.Rename(filepath.Join(root, p1), filepath.Join(root, p2))
+		}}
+	}
+}
+
+// errorClass reduces an error to what must be the same on all filesystems.
+// The errors are often wrapped without their cause, so only their presence
+// is compared.
+func errorClass(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return "error"
+}
+
+// tree returns the files of root and their content, and its directories.
+func tree(fs kafero.Fs, root string) (map[string]string, error) {
+	res := make(map[string]string)
+	err := kafero.Walk(fs, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			res[rel] = "<dir>"
+			return nil
+		}
+		data, err := kafero.ReadFile(fs, path)
+		if err != nil {
+			return err
+		}
+		res[rel] = string(data)
+		return nil
+	})
+	return res, err
+}
+
+func diffTrees(expected, actual map[string]string) string {
+	var diffs []string
+	for path, content := range expected {
+		if other, ok := actual[path]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: missing", path))
+		} else if other != content {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %q, got %q", path, content, other))
+		}
+	}
+	for path := range actual {
+		if _, ok := expected[path]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: unexpected", path))
+		}
+	}
+	sort.Strings(diffs)
+	return strings.Join(diffs, ", ")
+}
+
+// TestEquivalence applies n random operations, generated from seed, to fs
+// and to the reference filesystem ref, each in a temporary directory. It
+// fails at the first operation whose error or resulting tree differs,
+// reporting the seed and the operations run to reproduce it.
+// The reference is usually an OsFs, with the layered filesystems over
+// OsFs directories: MemMapFs creates the missing parent directories.
+func TestEquivalence(t *testing.T, ref kafero.Fs, fs kafero.Fs, seed int64, n int) {
+	defer RemoveAllTestFiles(t)
+	refRoot := GetTmpDir(ref)
+	root := GetTmpDir(fs)
+
+	r := rand.New(rand.NewSource(seed))
+	var history []string
+	for i := 0; i < n; i++ {
+		op := randomOp(r)
+		history = append(history, op.name)
+		refErr := op.run(ref, refRoot, r)
+		err := op.run(fs, root, r)
+		if errorClass(refErr) != errorClass(err) {
+			t.Errorf("%v: seed %d: after %s: expected %s (%v), got %s (%v)",
+				fs.Name(), seed, strings.Join(history, ", "), errorClass(refErr), refErr, errorClass(err), err)
+			return
+		}
+		expected, err := tree(ref, refRoot)
+		if err != nil {
+			t.Fatalf("%v: seed %d: after %s: error walking reference: %v", ref.Name(), seed, strings.Join(history, ", "), err)
+		}
+		actual, err := tree(fs, root)
+		if err != nil {
+			t.Errorf("%v: seed %d: after %s: error walking: %v", fs.Name(), seed, strings.Join(history, ", "), err)
+			return
+		}
+		if diff := diffTrees(expected, actual); diff != "" {
+			t.Errorf("%v: seed %d: after %s: %s", fs.Name(), seed, strings.Join(history, ", "), diff)
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package tests
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+// A Fixture is a tree of files, from their slash separated path relative to
+// the root of the tree to their content. The paths ending with a slash are
+// empty directories, the parent directories of the files are implied.
+type Fixture map[string]string
+
+// FixtureFromDir reads the tree under dir of fs as a Fixture, such as a
+// testdata directory of the OsFs.
+func FixtureFromDir(fs kafero.Fs, dir string) (Fixture, error) {
+	fixture := make(Fixture)
+	err := kafero.Walk(fs, dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			fixture[rel+"/"] = ""
+			return nil
+		}
+		data, err := kafero.ReadFile(fs, p)
+		if err != nil {
+			return err
+		}
+		fixture[rel] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fixture, nil
+}
+
+// Load creates the files of the fixture under root of fs.
+func (f Fixture) Load(fs kafero.Fs, root string) error {
+	for name, content := range f {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if strings.HasSuffix(name, "/") {
+			if err := fs.MkdirAll(p, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if path.Dir(name) != "." {
+			if err := fs.MkdirAll(filepath.Dir(p), 0755); err != nil {
+				return err
+			}
+		}
+		if err := kafero.WriteFile(fs, p, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadFixture loads the fixture in a new temporary directory of fs, and
+// returns its path.
+func LoadFixture(t *testing.T, fs kafero.Fs, fixture Fixture) string {
+	root := GetTmpDir(fs)
+	if err := fixture.Load(fs, root); err != nil {
+		t.Fatal(fs.Name(), err)
+	}
+	return root
+}
+
+// CheckFixture fails if the tree under root of fs is not the fixture.
+func CheckFixture(t *testing.T, fs kafero.Fs, root string, fixture Fixture) {
+	actual, err := FixtureFromDir(fs, root)
+	if err != nil {
+		t.Fatal(fs.Name(), err)
+	}
+	// The parent directories are implied in the fixture
+	for name := range fixture {
+		for dir := path.Dir(strings.TrimSuffix(name, "/")); dir != "."; dir = path.Dir(dir) {
+			if _, ok := fixture[dir+"/"]; !ok {
+				delete(actual, dir+"/")
+			}
+		}
+	}
+	if diff := diffTrees(fixture, actual); diff != "" {
+		t.Errorf("%v: %s differs from the fixture: %s", fs.Name(), root, diff)
+	}
+}
@@ -16,6 +16,7 @@ package tests
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/melaurent/kafero"
 	"io"
@@ -26,38 +27,40 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 )
 
 var testName = "test.txt"
 
 // var gcsFs, _ = NewTestGcsFs()
 
-var testRegistry map[kafero.Fs][]string = make(map[kafero.Fs][]string)
+var testRegistry = make(map[kafero.Fs]*kafero.TempManager)
+
+func tempManager(fs kafero.Fs) *kafero.TempManager {
+	m, ok := testRegistry[fs]
+	if !ok {
+		m = kafero.NewTempManager(fs, "", "afero")
+		testRegistry[fs] = m
+	}
+	return m
+}
 
 func GetTmpDir(fs kafero.Fs) string {
-	name, err := kafero.TempDir(fs, "", "afero")
+	name, err := tempManager(fs).TempDir()
 	if err != nil {
 		panic(fmt.Sprint("unable to work with test dir", err))
 	}
-	testRegistry[fs] = append(testRegistry[fs], name)
-
 	return name
 }
 
 func GetTmpFile(fs kafero.Fs) kafero.File {
-	x, err := kafero.TempFile(fs, "", "afero")
-
+	x, err := tempManager(fs).TempFile()
 	if err != nil {
 		panic(fmt.Sprint("unable to work with temp file: ", err))
 	}
-
-	testRegistry[fs] = append(testRegistry[fs], x.Name())
-
 	return x
 }
 
-// TODO test "exotic" flags behavior with all the different file systems
-
 // Read with length 0 should not return EOF.
 func TestRead0(t *testing.T, fs kafero.Fs) {
 	f := GetTmpFile(fs)
@@ -147,6 +150,200 @@ func TestOpenFile(t *testing.T, fs kafero.Fs) {
 	f.Close()
 }
 
+// TestOpenFlags checks the behavior of the flag combinations of OpenFile
+// against the one of the os package.
+func TestOpenFlags(t *testing.T, fs kafero.Fs) {
+	defer RemoveAllTestFiles(t)
+	tmp := GetTmpDir(fs)
+	existing := filepath.Join(tmp, "existing.txt")
+	missing := filepath.Join(tmp, "missing.txt")
+	dir := filepath.Join(tmp, "dir")
+	setup := func() {
+		_ = fs.Remove(missing)
+		if err := kafero.WriteFile(fs, existing, []byte("initial"), 0644); err != nil {
+			t.Fatal(fs.Name(), "WriteFile failed:", err)
+		}
+		if err := fs.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(fs.Name(), "MkdirAll failed:", err)
+		}
+	}
+	contents := func(path string) string {
+		data, err := kafero.ReadFile(fs, path)
+		if err != nil {
+			return "<" + err.Error() + ">"
+		}
+		return string(data)
+	}
+
+	cases := []struct {
+		name  string
+		path  string
+		flag  int
+		check func(f kafero.File, err error) error
+	}{
+		{"O_RDONLY on missing file", missing, os.O_RDONLY, func(f kafero.File, err error) error {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("expected a not exist error, got %v", err)
+			}
+			return nil
+		}},
+		{"O_CREATE|O_EXCL on existing file", existing, os.O_RDWR | os.O_CREATE | os.O_EXCL, func(f kafero.File, err error) error {
+			if !os.IsExist(err) {
+				return fmt.Errorf("expected an exist error, got %v", err)
+			}
+			if c := contents(existing); c != "initial" {
+				return fmt.Errorf("expected untouched content, got %q", c)
+			}
+			return nil
+		}},
+		{"O_CREATE|O_EXCL on missing file", missing, os.O_RDWR | os.O_CREATE | os.O_EXCL, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(missing); c != "" {
+				return fmt.Errorf("expected an empty file, got %q", c)
+			}
+			return nil
+		}},
+		{"O_RDONLY|O_CREATE on missing file", missing, os.O_RDONLY | os.O_CREATE, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(missing); c != "" {
+				return fmt.Errorf("expected an empty file, got %q", c)
+			}
+			return nil
+		}},
+		{"O_WRONLY without O_CREATE on missing file", missing, os.O_WRONLY, func(f kafero.File, err error) error {
+			if !os.IsNotExist(err) {
+				return fmt.Errorf("expected a not exist error, got %v", err)
+			}
+			return nil
+		}},
+		{"O_RDONLY write attempt", existing, os.O_RDONLY, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			_, werr := f.Write([]byte("write"))
+			f.Close()
+			if werr == nil {
+				return fmt.Errorf("expected an error writing")
+			}
+			if c := contents(existing); c != "initial" {
+				return fmt.Errorf("expected untouched content, got %q", c)
+			}
+			return nil
+		}},
+		{"O_WRONLY|O_TRUNC", existing, os.O_WRONLY | os.O_TRUNC, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write([]byte("new")); err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(existing); c != "new" {
+				return fmt.Errorf("expected %q, got %q", "new", c)
+			}
+			return nil
+		}},
+		{"O_WRONLY without O_TRUNC", existing, os.O_WRONLY, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			// Filesystems unable to rewrite files in place refuse it
+			if _, err := f.Write([]byte("INI")); err == syscall.EPERM {
+				f.Close()
+				if c := contents(existing); c != "initial" {
+					return fmt.Errorf("expected untouched content, got %q", c)
+				}
+				return nil
+			} else if err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(existing); c != "INItial" {
+				return fmt.Errorf("expected %q, got %q", "INItial", c)
+			}
+			return nil
+		}},
+		{"O_APPEND|O_TRUNC", existing, os.O_WRONLY | os.O_APPEND | os.O_TRUNC, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write([]byte("new")); err != nil {
+				return err
+			}
+			if _, err := f.Write([]byte("|appended")); err != nil {
+				return err
+			}
+			if err := writeAfterSeek(f); err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(existing); c != "new|appended|end" {
+				return fmt.Errorf("expected %q, got %q", "new|appended|end", c)
+			}
+			return nil
+		}},
+		{"O_APPEND", existing, os.O_WRONLY | os.O_APPEND, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			if _, err := f.Write([]byte("|appended")); err != nil {
+				return err
+			}
+			if err := writeAfterSeek(f); err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(existing); c != "initial|appended|end" {
+				return fmt.Errorf("expected %q, got %q", "initial|appended|end", c)
+			}
+			return nil
+		}},
+		{"O_CREATE on existing file", existing, os.O_RDWR | os.O_CREATE, func(f kafero.File, err error) error {
+			if err != nil {
+				return err
+			}
+			f.Close()
+			if c := contents(existing); c != "initial" {
+				return fmt.Errorf("expected untouched content, got %q", c)
+			}
+			return nil
+		}},
+		{"O_WRONLY|O_CREATE on existing directory", dir, os.O_WRONLY | os.O_CREATE, func(f kafero.File, err error) error {
+			if err == nil {
+				f.Close()
+				return fmt.Errorf("expected an error")
+			}
+			if info, err := fs.Stat(dir); err != nil || !info.IsDir() {
+				return fmt.Errorf("expected the directory to be kept, got %v", err)
+			}
+			return nil
+		}},
+		{"O_CREATE|O_EXCL on existing directory", dir, os.O_RDWR | os.O_CREATE | os.O_EXCL, func(f kafero.File, err error) error {
+			if !os.IsExist(err) {
+				if err == nil {
+					f.Close()
+				}
+				return fmt.Errorf("expected an exist error, got %v", err)
+			}
+			return nil
+		}},
+	}
+
+	for _, c := range cases {
+		setup()
+		f, err := fs.OpenFile(c.path, c.flag, 0644)
+		if err := c.check(f, err); err != nil {
+			t.Errorf("%v: %s: %v", fs.Name(), c.name, err)
+		}
+	}
+}
+
 func TestCreate(t *testing.T, fs kafero.Fs) {
 	defer RemoveAllTestFiles(t)
 	tmp := GetTmpDir(fs)
@@ -318,6 +515,60 @@ func TestRemove(t *testing.T, fs kafero.Fs) {
 	}
 }
 
+// TestRemoveAll checks that RemoveAll behaves as os.RemoveAll: it removes
+// files and trees, returns nil for the missing paths, and doesn't follow
+// the symbolic links.
+func TestRemoveAll(t *testing.T, fs kafero.Fs) {
+	defer RemoveAllTestFiles(t)
+	tDir := GetTmpDir(fs)
+
+	for _, name := range []string{"missing", "missing/child"} {
+		if err := fs.RemoveAll(filepath.Join(tDir, name)); err != nil {
+			t.Errorf("%s: RemoveAll of the missing %s failed: %v", fs.Name(), name, err)
+		}
+	}
+
+	file := filepath.Join(tDir, "file")
+	if err := kafero.WriteFile(fs, file, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.RemoveAll(file); err != nil {
+		t.Errorf("%s: RemoveAll of a file failed: %v", fs.Name(), err)
+	}
+	if _, err := fs.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("%s: RemoveAll didn't remove the file: %v", fs.Name(), err)
+	}
+
+	tree := filepath.Join(tDir, "tree")
+	SetupTestFiles(t, fs, tree)
+	if err := fs.RemoveAll(tree); err != nil {
+		t.Errorf("%s: RemoveAll of a tree failed: %v", fs.Name(), err)
+	}
+	if _, err := fs.Stat(tree); !os.IsNotExist(err) {
+		t.Errorf("%s: RemoveAll didn't remove the tree: %v", fs.Name(), err)
+	}
+	if _, err := fs.Stat(tDir); err != nil {
+		t.Errorf("%s: RemoveAll removed the parent of the tree: %v", fs.Name(), err)
+	}
+
+	linker, ok := fs.(kafero.Linker)
+	if !ok {
+		return
+	}
+	target := filepath.Join(tDir, "target")
+	SetupTestFiles(t, fs, target)
+	link := filepath.Join(tDir, "link")
+	if err := linker.SymlinkIfPossible(target, link); err != nil {
+		return
+	}
+	if err := fs.RemoveAll(link); err != nil {
+		t.Errorf("%s: RemoveAll of a symbolic link failed: %v", fs.Name(), err)
+	}
+	if _, err := kafero.ReadFile(fs, filepath.Join(target, "more/subdirectories/for/testing/we/testfile1")); err != nil {
+		t.Errorf("%s: RemoveAll followed the symbolic link: %v", fs.Name(), err)
+	}
+}
+
 func TestTruncate(t *testing.T, fs kafero.Fs) {
 	defer RemoveAllTestFiles(t)
 	f := GetTmpFile(fs)
@@ -338,6 +589,100 @@ func TestTruncate(t *testing.T, fs kafero.Fs) {
 	}
 }
 
+// writeAfterSeek writes "|end" to f after seeking its start, which is
+// still appended with O_APPEND. The files which can't seek just append it.
+func writeAfterSeek(f kafero.File) error {
+	_, _ = f.Seek(0, io.SeekStart)
+	_, err := f.Write([]byte("|end"))
+	return err
+}
+
+// TestChtimes checks Chtimes sets the modification time, leaving it
+// unchanged when given the zero time, as os.Chtimes does.
+func TestChtimes(t *testing.T, fs kafero.Fs) {
+	defer RemoveAllTestFiles(t)
+	f := GetTmpFile(fs)
+	name := f.Name()
+	if err := f.Close(); err != nil {
+		t.Fatalf("%s: Close: %v", fs.Name(), err)
+	}
+
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := fs.Chtimes(name, mtime, mtime); err != nil {
+		t.Fatalf("%s: Chtimes: %v", fs.Name(), err)
+	}
+	checkModTime(t, fs, name, mtime)
+	if err := fs.Chtimes(name, time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("%s: Chtimes with zero times: %v", fs.Name(), err)
+	}
+	checkModTime(t, fs, name, mtime)
+	mtime = mtime.Add(time.Hour)
+	if err := fs.Chtimes(name, time.Time{}, mtime); err != nil {
+		t.Fatalf("%s: Chtimes with a zero atime: %v", fs.Name(), err)
+	}
+	checkModTime(t, fs, name, mtime)
+}
+
+func checkModTime(t *testing.T, fs kafero.Fs, name string, mtime time.Time) {
+	t.Helper()
+	fi, err := fs.Stat(name)
+	if err != nil {
+		t.Fatalf("%s: Stat: %v", fs.Name(), err)
+	}
+	if !fi.ModTime().Equal(mtime) {
+		t.Errorf("%s: was expecting the modification time %v, got %v", fs.Name(), mtime, fi.ModTime())
+	}
+}
+
+// TestWriteReadOnly checks the writes to a file opened read only fail with
+// an error matching os.ErrPermission.
+func TestWriteReadOnly(t *testing.T, fs kafero.Fs) {
+	defer RemoveAllTestFiles(t)
+	f := GetTmpFile(fs)
+	if _, err := f.WriteString("hello, world\n"); err != nil {
+		t.Fatalf("%s: WriteString: %v", fs.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("%s: Close: %v", fs.Name(), err)
+	}
+
+	f, err := fs.Open(f.Name())
+	if err != nil {
+		t.Fatalf("%s: Open: %v", fs.Name(), err)
+	}
+	defer f.Close()
+	writes := map[string]func() error{
+		"Write": func() error {
+			_, err := f.Write([]byte("hello"))
+			return err
+		},
+		"WriteString": func() error {
+			_, err := f.WriteString("hello")
+			return err
+		},
+		"WriteAt": func() error {
+			_, err := f.WriteAt([]byte("hello"), 0)
+			return err
+		},
+		"Truncate": func() error {
+			return f.Truncate(0)
+		},
+	}
+	for op, write := range writes {
+		err := write()
+		if !errors.Is(err, os.ErrPermission) || !os.IsPermission(err) {
+			t.Errorf("%s: %s on a read only handle: got %v, want a permission error", fs.Name(), op, err)
+		}
+	}
+	data, err := kafero.ReadFile(fs, f.Name())
+	if err != nil {
+		t.Fatalf("%s: ReadFile: %v", fs.Name(), err)
+	}
+	if string(data) != "hello, world\n" {
+		t.Errorf("%s: read only handle modified the file: %q", fs.Name(), data)
+	}
+}
+
 func TestSeek(t *testing.T, fs kafero.Fs) {
 	defer RemoveAllTestFiles(t)
 	f := GetTmpFile(fs)
@@ -374,6 +719,40 @@ func TestSeek(t *testing.T, fs kafero.Fs) {
 	}
 }
 
+func TestSeekInvalid(t *testing.T, fs kafero.Fs) {
+	defer RemoveAllTestFiles(t)
+	f := GetTmpFile(fs)
+	defer f.Close()
+
+	const data = "hello, world\n"
+	io.WriteString(f, data)
+	if _, err := f.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Seek(5, 0): %v", err)
+	}
+
+	type test struct {
+		in     int64
+		whence int
+	}
+	var tests = []test{
+		{-1, io.SeekStart},
+		{-6, io.SeekCurrent},
+		{-int64(len(data)) - 1, io.SeekEnd},
+		{0, 42},
+		{0, -1},
+	}
+	for i, tt := range tests {
+		_, err := f.Seek(tt.in, tt.whence)
+		if e, ok := err.(*os.PathError); !ok || e.Op != "seek" || e.Err != syscall.EINVAL {
+			t.Errorf("#%d: Seek(%v, %v) = %v want *os.PathError{seek, EINVAL}", i, tt.in, tt.whence, err)
+		}
+		// The invalid seeks don't move the offset
+		if off, err := f.Seek(0, io.SeekCurrent); off != 5 || err != nil {
+			t.Errorf("#%d: Seek(0, 1) = %v, %v want 5, nil", i, off, err)
+		}
+	}
+}
+
 func TestReadAt(t *testing.T, fs kafero.Fs) {
 	defer RemoveAllTestFiles(t)
 	f := GetTmpFile(fs)
@@ -392,6 +771,19 @@ func TestReadAt(t *testing.T, fs kafero.Fs) {
 	if string(b) != "world" {
 		t.Fatalf("ReadAt 7: have %q want %q", string(b), "world")
 	}
+
+	// The reads at the end of the file return io.EOF with the bytes read,
+	// as os.File does
+	b = make([]byte, 10)
+	n, err = f.ReadAt(b, 7)
+	if err != io.EOF || string(b[:n]) != "world\n" {
+		t.Fatalf("ReadAt 7: have %q, %v want %q, EOF", string(b[:n]), err, "world\n")
+	}
+	for _, off := range []int64{int64(len(data)), int64(len(data)) + 10} {
+		if n, err := f.ReadAt(b, off); n != 0 || err != io.EOF {
+			t.Fatalf("ReadAt %d: have %d, %v want 0, EOF", off, n, err)
+		}
+	}
 }
 
 func TestWriteAt(t *testing.T, fs kafero.Fs) {
@@ -645,14 +1037,12 @@ func (m myFileInfo) String() string {
 }
 
 func RemoveAllTestFiles(t *testing.T) {
-	for fs, list := range testRegistry {
-		for _, path := range list {
-			if err := fs.RemoveAll(path); err != nil {
-				t.Error(fs.Name(), err)
-			}
+	for fs, m := range testRegistry {
+		if err := m.Close(); err != nil {
+			t.Error(fs.Name(), err)
 		}
 	}
-	testRegistry = make(map[kafero.Fs][]string)
+	testRegistry = make(map[kafero.Fs]*kafero.TempManager)
 }
 
 func equal(name1, name2 string) (r bool) {
@@ -687,59 +1077,21 @@ func SetupTestDirRoot(t *testing.T, fs kafero.Fs) string {
 }
 
 func SetupTestDirReusePath(t *testing.T, fs kafero.Fs, path string) string {
-	testRegistry[fs] = append(testRegistry[fs], path)
+	tempManager(fs).Track(path)
 	return SetupTestFiles(t, fs, path)
 }
 
-func SetupTestFiles(t *testing.T, fs kafero.Fs, path string) string {
-	testSubDir := filepath.Join(path, "more", "subdirectories", "for", "testing", "we")
-	err := fs.MkdirAll(testSubDir, 0700)
-	if err != nil && !os.IsExist(err) {
-		t.Fatal(err)
-	}
-
-	f, err := fs.Create(filepath.Join(testSubDir, "testfile1"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	if _, err := f.WriteString("Testfile 1 content"); err != nil {
-		t.Fatal(err)
-	}
-	if err := f.Close(); err != nil {
-		t.Fatal(err)
-	}
-
-	f, err = fs.Create(filepath.Join(testSubDir, "testfile2"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	if _, err := f.WriteString("Testfile 2 content"); err != nil {
-		t.Fatal(err)
-	}
-	if err := f.Close(); err != nil {
-		t.Fatal(err)
-	}
-
-	f, err = fs.Create(filepath.Join(testSubDir, "testfile3"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	if _, err := f.WriteString("Testfile 3 content"); err != nil {
-		t.Fatal(err)
-	}
-	if err := f.Close(); err != nil {
-		t.Fatal(err)
-	}
+// testFiles is the fixture of SetupTestFiles.
+var testFiles = Fixture{
+	"more/subdirectories/for/testing/we/testfile1": "Testfile 1 content",
+	"more/subdirectories/for/testing/we/testfile2": "Testfile 2 content",
+	"more/subdirectories/for/testing/we/testfile3": "Testfile 3 content",
+	"more/subdirectories/for/testing/we/testfile4": "Testfile 4 content",
+}
 
-	f, err = fs.Create(filepath.Join(testSubDir, "testfile4"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	if _, err := f.WriteString("Testfile 4 content"); err != nil {
-		t.Fatal(err)
-	}
-	if err := f.Close(); err != nil {
+func SetupTestFiles(t *testing.T, fs kafero.Fs, path string) string {
+	if err := testFiles.Load(fs, path); err != nil {
 		t.Fatal(err)
 	}
-	return testSubDir
+	return filepath.Join(path, "more", "subdirectories", "for", "testing", "we")
 }
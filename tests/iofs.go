@@ -0,0 +1,71 @@
+//go:build go1.16
+// +build go1.16
+
+package tests
+
+import (
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/melaurent/kafero"
+)
+
+// ioStream is a file of kafero.IOFS without Seek and ReadAt, for the
+// filesystems which can't seek.
+type ioStream struct {
+	f fs.ReadDirFile
+}
+
+func (s ioStream) Stat() (fs.FileInfo, error)           { return s.f.Stat() }
+func (s ioStream) Read(b []byte) (int, error)           { return s.f.Read(b) }
+func (s ioStream) Close() error                         { return s.f.Close() }
+func (s ioStream) ReadDir(n int) ([]fs.DirEntry, error) { return s.f.ReadDir(n) }
+
+// streamFS opens the files of kafero.IOFS as ioStreams.
+type streamFS struct {
+	kafero.IOFS
+}
+
+func (s streamFS) Open(name string) (fs.File, error) {
+	f, err := s.IOFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioStream{f.(fs.ReadDirFile)}, nil
+}
+
+func (s streamFS) Sub(dir string) (fs.FS, error) {
+	sub, err := s.IOFS.Sub(dir)
+	if err != nil {
+		return nil, err
+	}
+	return streamFS{sub.(kafero.IOFS)}, nil
+}
+
+// TestIOFS loads the fixture in fs and checks, with fstest.TestFS, that fs
+// follows the contract of the io/fs interfaces when reading it through
+// kafero.IOFS. Seek and ReadAt are only checked if fs is seekable.
+func TestIOFS(t *testing.T, fs kafero.Fs, fixture Fixture, seekable bool) {
+	defer RemoveAllTestFiles(t)
+	root := LoadFixture(t, fs, fixture)
+
+	var expected []string
+	for name := range fixture {
+		expected = append(expected, strings.TrimSuffix(name, "/"))
+	}
+	sort.Strings(expected)
+	iofs := kafero.NewIOFS(kafero.NewBasePathFs(fs, root))
+	if !seekable {
+		err := fstest.TestFS(streamFS{iofs}, expected...)
+		if err != nil {
+			t.Errorf("%v: %v", fs.Name(), err)
+		}
+		return
+	}
+	if err := fstest.TestFS(iofs, expected...); err != nil {
+		t.Errorf("%v: %v", fs.Name(), err)
+	}
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// The paths the concurrent operations work on, so that they often collide
+var stressPaths = []string{"a", "b", "c", "d/a", "d/b"}
+
+// stressOp runs a random operation on fs. The errors are expected, as the
+// files are removed and renamed concurrently, so they are ignored.
+func stressOp(fs kafero.Fs, root string, r *rand.Rand) {
+	name := filepath.Join(root, stressPaths[r.Intn(len(stressPaths))])
+	switch r.Intn(5) {
+	case 0:
+		f, err := fs.Create(name)
+		if err != nil {
+			return
+		}
+		_, _ = f.Write([]byte(fmt.Sprintf("written by %d", r.Int())))
+		_ = f.Close()
+	case 1:
+		f, err := fs.Open(name)
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, f)
+		_ = f.Close()
+	case 2:
+		f, err := fs.OpenFile(name, os.O_RDWR|os.O_APPEND, 0644)
+		if err != nil {
+			return
+		}
+		_, _ = f.Write([]byte("appended"))
+		_ = f.Close()
+	case 3:
+		_ = fs.Remove(name)
+	default:
+		other := filepath.Join(root, stressPaths[r.Intn(len(stressPaths))])
+		_ = fs.Rename(name, other)
+	}
+}
+
+// TestStress runs n random operations on fs from each of the given number
+// of goroutines, on overlapping paths. It is meant to be run with -race:
+// it only fails on a deadlock, or if the resulting tree cannot be walked or
+// read.
+func TestStress(t *testing.T, fs kafero.Fs, goroutines, n int) {
+	defer RemoveAllTestFiles(t)
+	root := GetTmpDir(fs)
+	if err := fs.MkdirAll(filepath.Join(root, "d"), 0755); err != nil {
+		t.Fatal(fs.Name(), err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < n; j++ {
+				stressOp(fs, root, r)
+			}
+		}(int64(i))
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatalf("%v: operations still running after a minute, probably deadlocked", fs.Name())
+	}
+
+	if _, err := tree(fs, root); err != nil {
+		t.Errorf("%v: error reading the tree after the operations: %v", fs.Name(), err)
+	}
+}
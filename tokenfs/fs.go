@@ -0,0 +1,222 @@
+package tokenfs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+var (
+	// ErrInvalidToken is returned for the tokens which were not minted
+	// with the key, or were altered.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for the tokens past their expiry.
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// Claims are the scope of a token: the file, or the tree, it gives read
+// access to, until its expiry.
+type Claims struct {
+	Path string `json:"p"`
+	// Tree gives access to all the files under Path, rather than to Path
+	// only.
+	Tree bool `json:"t,omitempty"`
+	// Expiry is the Unix time of the expiry.
+	Expiry int64 `json:"e"`
+}
+
+// covers returns true if name, cleaned, is in the scope of the claims.
+func (c *Claims) covers(name string) bool {
+	if name == c.Path {
+		return true
+	}
+	if !c.Tree {
+		return false
+	}
+	if c.Path == string(filepath.Separator) {
+		return true
+	}
+	return strings.HasPrefix(name, c.Path+string(filepath.Separator))
+}
+
+// A Signer mints and verifies the tokens with an HMAC-SHA256 key. The
+// tokens are opaque strings, safe in URLs.
+type Signer struct {
+	key   []byte
+	clock kafero.Clock
+}
+
+// NewSigner returns a Signer of the tokens of key, which should be at
+// least 32 random bytes.
+func NewSigner(key []byte) *Signer {
+	return &Signer{key: key, clock: kafero.SystemClock}
+}
+
+// SetClock sets the clock telling the expiry of the tokens.
+func (s *Signer) SetClock(clock kafero.Clock) {
+	s.clock = clock
+}
+
+// Mint returns a token giving read access to the file name for ttl.
+func (s *Signer) Mint(name string, ttl time.Duration) (string, error) {
+	return s.mint(&Claims{Path: filepath.Clean(name)}, ttl)
+}
+
+// MintTree returns a token giving read access to the files under dir for
+// ttl.
+func (s *Signer) MintTree(dir string, ttl time.Duration) (string, error) {
+	return s.mint(&Claims{Path: filepath.Clean(dir), Tree: true}, ttl)
+}
+
+func (s *Signer) mint(claims *Claims, ttl time.Duration) (string, error) {
+	claims.Expiry = s.clock.Now().Add(ttl).Unix()
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+func (s *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// Verify returns the claims of token, failing with ErrInvalidToken or
+// ErrExpiredToken.
+func (s *Signer) Verify(token string) (*Claims, error) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(sig, s.sign(token[:i])) {
+		return nil, ErrInvalidToken
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token[:i])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := &Claims{}
+	if err := json.Unmarshal(data, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if s.expired(claims) {
+		return nil, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+func (s *Signer) expired(claims *Claims) bool {
+	return s.clock.Now().Unix() >= claims.Expiry
+}
+
+// The Fs gives read only access to the files of the scope of a token,
+// until it expires, so that the downloads of files behind a private stack
+// can be handed out. The files out of the scope fail with EACCES, the
+// writes with EPERM, and all the operations with ErrExpiredToken once the
+// token has expired.
+type Fs struct {
+	base   kafero.Fs
+	signer *Signer
+	claims *Claims
+}
+
+// NewFs returns the Fs of token, verified with signer, over base.
+func NewFs(base kafero.Fs, signer *Signer, token string) (*Fs, error) {
+	claims, err := signer.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return &Fs{base: base, signer: signer, claims: claims}, nil
+}
+
+// authorize returns the cleaned name if it can be read with the token.
+func (t *Fs) authorize(op, name string) (string, error) {
+	if t.signer.expired(t.claims) {
+		return name, &os.PathError{Op: op, Path: name, Err: ErrExpiredToken}
+	}
+	clean := filepath.Clean(name)
+	if !t.claims.covers(clean) {
+		return name, &os.PathError{Op: op, Path: name, Err: syscall.EACCES}
+	}
+	return clean, nil
+}
+
+func (t *Fs) Name() string {
+	return "TokenFs"
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+// WithContext returns a view of the Fs bound to ctx, with the same token.
+func (t *Fs) WithContext(ctx context.Context) kafero.Fs {
+	return &Fs{base: kafero.WithContext(t.base, ctx), signer: t.signer, claims: t.claims}
+}
+
+func (t *Fs) Open(name string) (kafero.File, error) {
+	clean, err := t.authorize("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return t.base.Open(clean)
+}
+
+func (t *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EPERM}
+	}
+	return t.Open(name)
+}
+
+func (t *Fs) Stat(name string) (os.FileInfo, error) {
+	clean, err := t.authorize("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return t.base.Stat(clean)
+}
+
+func (t *Fs) Create(name string) (kafero.File, error) {
+	return nil, &os.PathError{Op: "create", Path: name, Err: syscall.EPERM}
+}
+
+func (t *Fs) Mkdir(name string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: name, Err: syscall.EPERM}
+}
+
+func (t *Fs) MkdirAll(path string, perm os.FileMode) error {
+	return &os.PathError{Op: "mkdir", Path: path, Err: syscall.EPERM}
+}
+
+func (t *Fs) Remove(name string) error {
+	return &os.PathError{Op: "remove", Path: name, Err: syscall.EPERM}
+}
+
+func (t *Fs) RemoveAll(path string) error {
+	return &os.PathError{Op: "removeall", Path: path, Err: syscall.EPERM}
+}
+
+func (t *Fs) Rename(oldname, newname string) error {
+	return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: syscall.EPERM}
+}
+
+func (t *Fs) Chmod(name string, mode os.FileMode) error {
+	return &os.PathError{Op: "chmod", Path: name, Err: syscall.EPERM}
+}
+
+func (t *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return &os.PathError{Op: "chtimes", Path: name, Err: syscall.EPERM}
+}
@@ -0,0 +1,71 @@
+package tokenfs
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestToken(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	for _, name := range []string{"/share/a.txt", "/share/sub/b.txt", "/private.txt"} {
+		if err := kafero.WriteFile(base, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock := kafero.NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	signer := NewSigner([]byte("0123456789abcdef0123456789abcdef"))
+	signer.SetClock(clock)
+
+	token, err := signer.Mint("/share/a.txt", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err := NewFs(base, signer, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := kafero.ReadFile(fs, "/share/a.txt"); err != nil || string(data) != "/share/a.txt" {
+		t.Fatalf("was expecting to read /share/a.txt, got %v", err)
+	}
+	if _, err := fs.Open("/share/sub/b.txt"); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+	if _, err := fs.OpenFile("/share/a.txt", os.O_WRONLY, 0644); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+
+	token, err = signer.MintTree("/share", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs, err = NewFs(base, signer, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kafero.ReadFile(fs, "/share/sub/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Open("/share/../private.txt"); !os.IsPermission(err) {
+		t.Fatalf("was expecting a permission error, got %v", err)
+	}
+
+	// The altered tokens are rejected
+	if _, err := NewFs(base, signer, "x"+token); err != ErrInvalidToken {
+		t.Fatalf("was expecting ErrInvalidToken, got %v", err)
+	}
+	if _, err := NewFs(base, NewSigner([]byte("other key")), token); err != ErrInvalidToken {
+		t.Fatalf("was expecting ErrInvalidToken, got %v", err)
+	}
+
+	// And the expired ones
+	clock.Advance(2 * time.Hour)
+	if _, err := fs.Stat("/share/a.txt"); err == nil || err.(*os.PathError).Err != ErrExpiredToken {
+		t.Fatalf("was expecting ErrExpiredToken, got %v", err)
+	}
+	if _, err := NewFs(base, signer, token); err != ErrExpiredToken {
+		t.Fatalf("was expecting ErrExpiredToken, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package kafero
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// TreeOptions are the options of Tree.
+type TreeOptions struct {
+	// MaxDepth is the number of levels listed below the root, 0 listing
+	// all of them.
+	MaxDepth int
+	// Size adds a column with the size of the entries.
+	Size bool
+	// ModTime adds a column with the modification time of the entries.
+	ModTime bool
+}
+
+func (a Afero) Tree(root string, w io.Writer, opts TreeOptions) error {
+	return Tree(a.Fs, root, w, opts)
+}
+
+// Tree writes to w an indented listing of the tree rooted at root, like the
+// tree command does, followed by the count of directories and files. The
+// symlinks are not followed, and printed with their target when the
+// filesystem can read them. The directories which can't be listed are
+// printed with the error, only the errors writing to w and listing root
+// being returned.
+func Tree(fs Fs, root string, w io.Writer, opts TreeOptions) error {
+	info, err := lstatIfPossible(fs, root)
+	if err != nil {
+		return err
+	}
+	t := &treeWriter{fs: fs, w: bufio.NewWriter(w), opts: opts}
+	t.entry("", root, info)
+	if info.IsDir() {
+		infos, err := readDirLstat(fs, root)
+		if err != nil {
+			return err
+		}
+		t.dir("", root, infos, 1)
+	}
+	fmt.Fprintf(t.w, "\n%d directories, %d files\n", t.dirs, t.files)
+	return t.w.Flush()
+}
+
+type treeWriter struct {
+	fs    Fs
+	w     *bufio.Writer
+	opts  TreeOptions
+	dirs  int
+	files int
+}
+
+// dir prints the entries of the directory at path, depth levels below the
+// root, each line starting with prefix.
+func (t *treeWriter) dir(prefix, path string, infos []os.FileInfo, depth int) {
+	for i, info := range infos {
+		branch, indent := "├── ", "│   "
+		if i == len(infos)-1 {
+			branch, indent = "└── ", "    "
+		}
+		name := filepath.Join(path, info.Name())
+		t.entry(prefix+branch, name, info)
+		if !info.IsDir() {
+			t.files++
+			continue
+		}
+		t.dirs++
+		if t.opts.MaxDepth > 0 && depth >= t.opts.MaxDepth {
+			continue
+		}
+		sub, err := readDirLstat(t.fs, name)
+		if err != nil {
+			fmt.Fprintf(t.w, "%s%s[error: %v]\n", prefix, indent, err)
+			continue
+		}
+		t.dir(prefix+indent, name, sub, depth+1)
+	}
+}
+
+// entry prints the line of the entry at path.
+func (t *treeWriter) entry(prefix, path string, info os.FileInfo) {
+	t.w.WriteString(prefix)
+	if t.opts.Size || t.opts.ModTime {
+		t.w.WriteString("[")
+		if t.opts.Size {
+			fmt.Fprintf(t.w, "%10d", info.Size())
+		}
+		if t.opts.Size && t.opts.ModTime {
+			t.w.WriteString("  ")
+		}
+		if t.opts.ModTime {
+			t.w.WriteString(info.ModTime().Format("2006-01-02 15:04:05"))
+		}
+		t.w.WriteString("]  ")
+	}
+	if prefix == "" {
+		t.w.WriteString(path)
+	} else {
+		t.w.WriteString(info.Name())
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		if reader, ok := t.fs.(LinkReader); ok {
+			if target, err := reader.ReadlinkIfPossible(path); err == nil {
+				t.w.WriteString(" -> " + target)
+			}
+		}
+	}
+	t.w.WriteString("\n")
+}
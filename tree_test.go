@@ -0,0 +1,61 @@
+package kafero_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/melaurent/kafero"
+	"github.com/melaurent/kafero/tests"
+)
+
+func TestTree(t *testing.T) {
+	clock := kafero.NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	fs := kafero.NewMemMapFsWithClock(clock)
+	fixture := tests.Fixture{
+		"a.txt":         "a",
+		"dir/b.txt":     "bb",
+		"dir/sub/c.txt": "ccc",
+		"empty/":        "",
+	}
+	if err := fixture.Load(fs, "root"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := kafero.Tree(fs, "root", &buf, kafero.TreeOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `root
+├── a.txt
+├── dir
+│   ├── b.txt
+│   └── sub
+│       └── c.txt
+└── empty
+
+3 directories, 3 files
+`
+	if buf.String() != expected {
+		t.Fatalf("was expecting:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	buf.Reset()
+	if err := kafero.Tree(fs, "root", &buf, kafero.TreeOptions{MaxDepth: 1, Size: true, ModTime: true}); err != nil {
+		t.Fatal(err)
+	}
+	expected = `[        42  2020-01-02 15:04:05]  root
+├── [         1  2020-01-02 15:04:05]  a.txt
+├── [        42  2020-01-02 15:04:05]  dir
+└── [        42  2020-01-02 15:04:05]  empty
+
+2 directories, 1 files
+`
+	if buf.String() != expected {
+		t.Fatalf("was expecting:\n%s\ngot:\n%s", expected, buf.String())
+	}
+
+	if err := kafero.Tree(fs, "missing", &buf, kafero.TreeOptions{}); err == nil {
+		t.Fatal("was expecting an error for a missing root")
+	}
+}
@@ -0,0 +1,352 @@
+package kafero
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SyncStateName is the name of the file storing the state of the last two
+// way sync, at the root of both trees.
+const SyncStateName = ".kafero-sync.json"
+
+// A Conflict is a file changed on both sides since the last sync. A is nil
+// if the file was deleted from the first tree, B if deleted from the
+// second.
+type Conflict struct {
+	Path string
+	A, B os.FileInfo
+}
+
+// A Resolution is the outcome of a conflict.
+type Resolution int
+
+const (
+	// KeepA propagates the version of the first tree.
+	KeepA Resolution = iota
+	// KeepB propagates the version of the second tree.
+	KeepB
+	// KeepBoth renames both versions, to name.conflict-a.ext and
+	// name.conflict-b.ext, on both sides.
+	KeepBoth
+	// Skip leaves the file as is on both sides, in conflict until resolved.
+	Skip
+)
+
+// A ConflictResolver decides the outcome of a conflict.
+type ConflictResolver func(c Conflict) (Resolution, error)
+
+// NewestWins keeps the version modified last, the first tree winning ties.
+// A file modified wins over its deletion.
+func NewestWins(c Conflict) (Resolution, error) {
+	if c.A == nil || c.B != nil && c.B.ModTime().After(c.A.ModTime()) {
+		return KeepB, nil
+	}
+	return KeepA, nil
+}
+
+// RenameBoth keeps both versions of the files, the deletions losing.
+func RenameBoth(c Conflict) (Resolution, error) {
+	switch {
+	case c.A == nil:
+		return KeepB, nil
+	case c.B == nil:
+		return KeepA, nil
+	}
+	return KeepBoth, nil
+}
+
+// TwoWaySyncOptions are the options of TwoWaySync.
+type TwoWaySyncOptions struct {
+	// Resolve decides the outcome of the conflicts, NewestWins if nil.
+	Resolve ConflictResolver
+}
+
+// syncFileState is the state of a file of a tree at the last sync.
+type syncFileState struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+}
+
+// syncState is the state of the last sync, of both trees.
+type syncState struct {
+	Time int64                    `json:"time"`
+	A    map[string]syncFileState `json:"a"`
+	B    map[string]syncFileState `json:"b"`
+}
+
+func newSyncFileState(info os.FileInfo) syncFileState {
+	return syncFileState{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+}
+
+// TwoWaySync synchronizes the trees rooted at aDir in a and bDir in b, in
+// both directions: the files created, modified or deleted on one side
+// since the last sync are created, copied or deleted on the other. The
+// files changed on both sides are conflicts, resolved by the Resolve of
+// the options. The state of the sync is stored in the SyncStateName file
+// of both trees for the next run, the first run only creating and copying
+// files. Only the files are synchronized, the directories being created as
+// needed.
+func TwoWaySync(a Fs, aDir string, b Fs, bDir string, opts TwoWaySyncOptions) error {
+	if opts.Resolve == nil {
+		opts.Resolve = NewestWins
+	}
+	state, err := loadSyncState(a, aDir, b, bDir)
+	if err != nil {
+		return err
+	}
+	afiles, err := syncListFiles(a, aDir)
+	if err != nil {
+		return err
+	}
+	bfiles, err := syncListFiles(b, bDir)
+	if err != nil {
+		return err
+	}
+	s := &twoWaySync{a: a, aDir: aDir, b: b, bDir: bDir, skipped: make(map[string]bool)}
+
+	names := make(map[string]bool)
+	for name := range afiles {
+		names[name] = true
+	}
+	for name := range bfiles {
+		names[name] = true
+	}
+	for name := range names {
+		ainfo, binfo := afiles[name], bfiles[name]
+		astate, asynced := state.A[name]
+		bstate, bsynced := state.B[name]
+		achanged := ainfo != nil && (!asynced || newSyncFileState(ainfo) != astate) || ainfo == nil && asynced
+		bchanged := binfo != nil && (!bsynced || newSyncFileState(binfo) != bstate) || binfo == nil && bsynced
+		switch {
+		case !achanged && !bchanged:
+		case achanged && !bchanged:
+			err = s.propagate(name, ainfo, true)
+		case bchanged && !achanged:
+			err = s.propagate(name, binfo, false)
+		default:
+			err = s.conflict(name, ainfo, binfo, opts.Resolve)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The state is taken once synchronized, the skipped conflicts keeping
+	// their previous state to stay conflicts
+	next := &syncState{Time: time.Now().UnixNano()}
+	if next.A, err = s.state(a, aDir, state.A); err != nil {
+		return err
+	}
+	if next.B, err = s.state(b, bDir, state.B); err != nil {
+		return err
+	}
+	return saveSyncState(next, a, aDir, b, bDir)
+}
+
+type twoWaySync struct {
+	a       Fs
+	aDir    string
+	b       Fs
+	bDir    string
+	skipped map[string]bool
+}
+
+// propagate copies or deletes name from a to b if fromA, from b to a
+// otherwise, info being nil for deletions.
+func (s *twoWaySync) propagate(name string, info os.FileInfo, fromA bool) error {
+	src, srcDir, dst, dstDir := s.a, s.aDir, s.b, s.bDir
+	if !fromA {
+		src, srcDir, dst, dstDir = s.b, s.bDir, s.a, s.aDir
+	}
+	dstName := filepath.Join(dstDir, name)
+	if info == nil {
+		if err := dst.Remove(dstName); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("error removing %s: %v", dstName, err)
+		}
+		return nil
+	}
+	if err := dst.MkdirAll(filepath.Dir(dstName), 0777); err != nil {
+		return fmt.Errorf("error creating directory: %v", err)
+	}
+	return copyFile(src, filepath.Join(srcDir, name), dst, dstName, info)
+}
+
+func (s *twoWaySync) conflict(name string, ainfo, binfo os.FileInfo, resolve ConflictResolver) error {
+	if ainfo == nil && binfo == nil {
+		return nil
+	}
+	if ainfo != nil && binfo != nil {
+		same, err := sameContent(s.a, filepath.Join(s.aDir, name), s.b, filepath.Join(s.bDir, name))
+		if err != nil || same {
+			return err
+		}
+	}
+	res, err := resolve(Conflict{Path: name, A: ainfo, B: binfo})
+	if err != nil {
+		return err
+	}
+	switch res {
+	case KeepA:
+		return s.propagate(name, ainfo, true)
+	case KeepB:
+		return s.propagate(name, binfo, false)
+	case KeepBoth:
+		for _, side := range []struct {
+			fs   Fs
+			dir  string
+			info os.FileInfo
+			tag  string
+		}{{s.a, s.aDir, ainfo, "a"}, {s.b, s.bDir, binfo, "b"}} {
+			renamed := conflictName(name, side.tag)
+			if err := side.fs.Rename(filepath.Join(side.dir, name), filepath.Join(side.dir, renamed)); err != nil {
+				return fmt.Errorf("error renaming %s: %v", name, err)
+			}
+			if err := s.propagate(renamed, side.info, side.tag == "a"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case Skip:
+		s.skipped[name] = true
+		return nil
+	}
+	return fmt.Errorf("unknown resolution %d of %s", res, name)
+}
+
+// state returns the state of the files of the tree dir of fs, the skipped
+// conflicts keeping their previous state.
+func (s *twoWaySync) state(fs Fs, dir string, previous map[string]syncFileState) (map[string]syncFileState, error) {
+	files, err := syncListFiles(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[string]syncFileState, len(files))
+	for name, info := range files {
+		state[name] = newSyncFileState(info)
+	}
+	for name := range s.skipped {
+		if prev, ok := previous[name]; ok {
+			state[name] = prev
+		} else {
+			delete(state, name)
+		}
+	}
+	return state, nil
+}
+
+// conflictName returns name with .conflict-tag before its extension.
+func conflictName(name, tag string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".conflict-" + tag + ext
+}
+
+// syncListFiles returns the files of the tree dir of fs, by path relative
+// to dir.
+func syncListFiles(fs Fs, dir string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	if _, err := fs.Stat(dir); os.IsNotExist(err) {
+		return files, nil
+	}
+	err := Walk(fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel != SyncStateName {
+			files[rel] = info
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing directory: %v", err)
+	}
+	return files, nil
+}
+
+// sameContent returns true if the files have the same content.
+func sameContent(a Fs, aName string, b Fs, bName string) (bool, error) {
+	af, err := a.Open(aName)
+	if err != nil {
+		return false, err
+	}
+	defer af.Close()
+	bf, err := b.Open(bName)
+	if err != nil {
+		return false, err
+	}
+	defer bf.Close()
+	abuf, bbuf := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		an, aerr := io.ReadFull(af, abuf)
+		bn, berr := io.ReadFull(bf, bbuf)
+		if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		}
+		if aerr == io.EOF || aerr == io.ErrUnexpectedEOF {
+			return berr == io.EOF || berr == io.ErrUnexpectedEOF, nil
+		}
+		if aerr != nil {
+			return false, aerr
+		}
+		if berr != nil {
+			return false, berr
+		}
+	}
+}
+
+// loadSyncState returns the most recent of the states stored in the trees,
+// an empty state if none.
+func loadSyncState(a Fs, aDir string, b Fs, bDir string) (*syncState, error) {
+	state := &syncState{}
+	for _, side := range []struct {
+		fs  Fs
+		dir string
+	}{{a, aDir}, {b, bDir}} {
+		data, err := ReadFile(side.fs, filepath.Join(side.dir, SyncStateName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading sync state: %v", err)
+		}
+		s := &syncState{}
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("error unmarshalling sync state: %v", err)
+		}
+		if s.Time > state.Time {
+			state = s
+		}
+	}
+	return state, nil
+}
+
+func saveSyncState(state *syncState, a Fs, aDir string, b Fs, bDir string) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	for _, side := range []struct {
+		fs  Fs
+		dir string
+	}{{a, aDir}, {b, bDir}} {
+		if err := side.fs.MkdirAll(side.dir, 0777); err != nil {
+			return fmt.Errorf("error creating directory: %v", err)
+		}
+		if err := WriteFile(side.fs, filepath.Join(side.dir, SyncStateName), data, 0644); err != nil {
+			return fmt.Errorf("error writing sync state: %v", err)
+		}
+	}
+	return nil
+}
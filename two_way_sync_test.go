@@ -0,0 +1,98 @@
+package kafero
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func checkFiles(t *testing.T, fs Fs, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		data, err := ReadFile(fs, name)
+		if content == "" {
+			if !os.IsNotExist(err) {
+				t.Fatalf("was expecting %s to be deleted, got %v", name, err)
+			}
+			continue
+		}
+		if err != nil || string(data) != content {
+			t.Fatalf("was expecting %s in %s, got %s, %v", content, name, data, err)
+		}
+	}
+}
+
+func TestTwoWaySync(t *testing.T) {
+	clock := NewFakeClock(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC))
+	a := NewMemMapFsWithClock(clock)
+	b := NewMemMapFsWithClock(clock)
+	WriteFile(a, "/a/one.txt", []byte("one"), 0644)
+	WriteFile(a, "/a/sub/two.txt", []byte("two"), 0644)
+	WriteFile(b, "/b/three.txt", []byte("three"), 0644)
+
+	if err := TwoWaySync(a, "/a", b, "/b", TwoWaySyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []struct {
+		fs  Fs
+		dir string
+	}{{a, "/a"}, {b, "/b"}} {
+		checkFiles(t, fs.fs, map[string]string{fs.dir + "/one.txt": "one", fs.dir + "/sub/two.txt": "two", fs.dir + "/three.txt": "three"})
+	}
+
+	// The changes of each side are propagated to the other
+	clock.Advance(time.Minute)
+	WriteFile(a, "/a/one.txt", []byte("one v2"), 0644)
+	if err := b.Remove("/b/sub/two.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := TwoWaySync(a, "/a", b, "/b", TwoWaySyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, b, map[string]string{"/b/one.txt": "one v2"})
+	checkFiles(t, a, map[string]string{"/a/sub/two.txt": ""})
+
+	// The newest edit wins the conflicts by default
+	clock.Advance(time.Minute)
+	WriteFile(a, "/a/three.txt", []byte("three a"), 0644)
+	clock.Advance(time.Minute)
+	WriteFile(b, "/b/three.txt", []byte("three b"), 0644)
+	if err := TwoWaySync(a, "/a", b, "/b", TwoWaySyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	checkFiles(t, a, map[string]string{"/a/three.txt": "three b"})
+
+	// Or both are kept
+	clock.Advance(time.Minute)
+	WriteFile(a, "/a/one.txt", []byte("one a"), 0644)
+	WriteFile(b, "/b/one.txt", []byte("one b"), 0644)
+	if err := TwoWaySync(a, "/a", b, "/b", TwoWaySyncOptions{Resolve: RenameBoth}); err != nil {
+		t.Fatal(err)
+	}
+	for _, fs := range []struct {
+		fs  Fs
+		dir string
+	}{{a, "/a"}, {b, "/b"}} {
+		checkFiles(t, fs.fs, map[string]string{fs.dir + "/one.txt": "", fs.dir + "/one.conflict-a.txt": "one a", fs.dir + "/one.conflict-b.txt": "one b"})
+	}
+
+	// Or left until resolved
+	clock.Advance(time.Minute)
+	WriteFile(a, "/a/three.txt", []byte("three a2"), 0644)
+	WriteFile(b, "/b/three.txt", []byte("three b2"), 0644)
+	var conflicts []string
+	skip := func(c Conflict) (Resolution, error) {
+		conflicts = append(conflicts, c.Path)
+		return Skip, nil
+	}
+	for i := 0; i < 2; i++ {
+		if err := TwoWaySync(a, "/a", b, "/b", TwoWaySyncOptions{Resolve: skip}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(conflicts) != 2 || conflicts[0] != "three.txt" {
+		t.Fatalf("was expecting three.txt to stay in conflict, got %v", conflicts)
+	}
+	checkFiles(t, a, map[string]string{"/a/three.txt": "three a2"})
+	checkFiles(t, b, map[string]string{"/b/three.txt": "three b2"})
+}
@@ -75,8 +75,11 @@ func (f *UnionFile) ReadAt(s []byte, o int64) (int, error) {
 
 func (f *UnionFile) Seek(o int64, w int) (pos int64, err error) {
 	pos, err = f.Layer.Seek(o, w)
+	if err != nil {
+		return 0, err
+	}
 	f.off = pos
-	return pos, err
+	return pos, nil
 }
 
 func (f *UnionFile) Write(s []byte) (n int, err error) {
@@ -263,6 +266,11 @@ func (f *UnionFile) Munmap() error {
 }
 
 func copyToLayer(base Fs, layer Fs, name string) error {
+	return copyToLayerAs(base, layer, name, name)
+}
+
+// copyToLayerAs copies name from base to dst in layer.
+func copyToLayerAs(base Fs, layer Fs, name, dst string) error {
 	bfh, err := base.Open(name)
 	if err != nil {
 		if err == os.ErrNotExist {
@@ -273,45 +281,49 @@ func copyToLayer(base Fs, layer Fs, name string) error {
 	}
 
 	// First make sure the directory exists
-	exists, err := Exists(layer, filepath.Dir(name))
+	exists, err := Exists(layer, filepath.Dir(dst))
 	if err != nil {
 		return err
 	}
 	if !exists {
-		err = layer.MkdirAll(filepath.Dir(name), 0777) // FIXME?
+		err = layer.MkdirAll(filepath.Dir(dst), 0777) // FIXME?
 		if err != nil {
 			return err
 		}
 	}
 
 	// Create the file on the overlay
-	lfh, err := layer.Create(name)
+	lfh, err := layer.Create(dst)
 	if err != nil {
 		return err
 	}
 	n, err := io.Copy(lfh, bfh)
 	if err != nil {
 		// If anything fails, clean up the file
-		_ = layer.Remove(name)
+		_ = layer.Remove(dst)
 		_ = lfh.Close()
 		return fmt.Errorf("error copying layer to base: %v", err)
 	}
 
 	bfi, err := bfh.Stat()
 	if err != nil || bfi.Size() != n {
-		_ = layer.Remove(name)
+		_ = layer.Remove(dst)
 		_ = lfh.Close()
 		return syscall.EIO
 	}
 
 	err = lfh.Close()
 	if err != nil {
-		_ = layer.Remove(name)
+		_ = layer.Remove(dst)
 		_ = lfh.Close()
 		return err
 	}
 	if err := bfh.Close(); err != nil {
 		return fmt.Errorf("error closing base file: %v", err)
 	}
-	return layer.Chtimes(name, bfi.ModTime(), bfi.ModTime())
+	if err := copyMeta(base, name, layer, dst); err != nil {
+		_ = layer.Remove(dst)
+		return err
+	}
+	return layer.Chtimes(dst, bfi.ModTime(), bfi.ModTime())
 }
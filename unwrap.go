@@ -0,0 +1,73 @@
+package kafero
+
+import "reflect"
+
+// Unwrapper is an optional interface in Kafero. It is implemented by the
+// filesystems wrapping another one, such as BufferFs or BasePathFs, to
+// reach the APIs specific to the backends through a stack, with As.
+//
+// The filesystems confining their callers, such as those of tenantfs,
+// aclfs and tokenfs, don't unwrap, as that would let them out.
+type Unwrapper interface {
+	// Unwrap returns the filesystem wrapped, the base one if several.
+	Unwrap() Fs
+}
+
+var (
+	_ Unwrapper = (*BufferFs)(nil)
+	_ Unwrapper = (*SizeCacheFS)(nil)
+	_ Unwrapper = (*CacheOnReadFs)(nil)
+	_ Unwrapper = (*CopyOnWriteFs)(nil)
+	_ Unwrapper = (*BasePathFs)(nil)
+	_ Unwrapper = (*ReadOnlyFs)(nil)
+	_ Unwrapper = (*RegexpFs)(nil)
+	_ Unwrapper = (*ReadaheadFs)(nil)
+	_ Unwrapper = (*ListingCacheFs)(nil)
+	_ Unwrapper = (*BlockCacheFs)(nil)
+	_ Unwrapper = (*ScannerFs)(nil)
+	_ Unwrapper = (*HookFs)(nil)
+	_ Unwrapper = (*IntegrityFs)(nil)
+)
+
+// Unwrap returns the filesystem wrapped by fs, nil if fs isn't an
+// Unwrapper.
+func Unwrap(fs Fs) Fs {
+	if u, ok := fs.(Unwrapper); ok {
+		return u.Unwrap()
+	}
+	return nil
+}
+
+// As finds the first filesystem of the stack fs, unwrapped from the top,
+// assignable to the value pointed to by target, and if any sets target to
+// it and returns true, as errors.As. Target must be a non-nil pointer to a
+// type implementing Fs, or to an interface type, as:
+//
+//	var gcs *GcsFs
+//	if kafero.As(fs, &gcs) {
+//		...
+//	}
+func As(fs Fs, target interface{}) bool {
+	if target == nil {
+		panic("kafero: target cannot be nil")
+	}
+	val := reflect.ValueOf(target)
+	typ := val.Type()
+	if typ.Kind() != reflect.Ptr || val.IsNil() {
+		panic("kafero: target must be a non-nil pointer")
+	}
+	targetType := typ.Elem()
+	if targetType.Kind() != reflect.Interface && !targetType.Implements(fsType) {
+		panic("kafero: *target must be interface or implement Fs")
+	}
+	for fs != nil {
+		if reflect.TypeOf(fs).AssignableTo(targetType) {
+			val.Elem().Set(reflect.ValueOf(fs))
+			return true
+		}
+		fs = Unwrap(fs)
+	}
+	return false
+}
+
+var fsType = reflect.TypeOf((*Fs)(nil)).Elem()
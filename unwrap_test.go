@@ -0,0 +1,30 @@
+package kafero
+
+import (
+	"testing"
+)
+
+func TestAs(t *testing.T) {
+	mem := NewMemMapFs()
+	fs := NewBufferFs(NewReadOnlyFs(NewBasePathFs(mem, "/data")), NewMemMapFs())
+
+	var bp *BasePathFs
+	if !As(fs, &bp) || bp.path != "/data" {
+		t.Fatal("was expecting the BasePathFs")
+	}
+	var mm *MemMapFs
+	if !As(fs, &mm) || Fs(mm) != mem {
+		t.Fatal("was expecting the base MemMapFs")
+	}
+	var d Describer
+	if !As(fs, &d) || d.(Fs) != fs {
+		t.Fatal("was expecting the top Describer")
+	}
+	if As(mem, &d) {
+		t.Fatal("was expecting no Describer")
+	}
+	var rofs *ReadOnlyFs
+	if As(mem, &rofs) {
+		t.Fatal("was expecting no ReadOnlyFs")
+	}
+}
@@ -19,6 +19,7 @@ package kafero
 import (
 	"bytes"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
@@ -65,7 +66,33 @@ func (a Afero) SafeWriteReader(path string, r io.Reader) (err error) {
 	return SafeWriteReader(a.Fs, path, r)
 }
 
+// SafeWriteReader writes the content of r to a new file at path, removing
+// the partially written file on error.
 func SafeWriteReader(fs Fs, path string, r io.Reader) (err error) {
+	return SafeWriteReaderHash(fs, path, r, nil, nil)
+}
+
+// VerificationError is returned when the digest of the written content
+// doesn't match the expected one.
+type VerificationError struct {
+	Path     string
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s: digest mismatch, expected %x, got %x", e.Path, e.Expected, e.Actual)
+}
+
+func (a Afero) SafeWriteReaderHash(path string, r io.Reader, h hash.Hash, expected []byte) (err error) {
+	return SafeWriteReaderHash(a.Fs, path, r, h, expected)
+}
+
+// SafeWriteReaderHash is like SafeWriteReader, but also computes the digest
+// of the content with h while writing it. If it doesn't match expected,
+// the file is removed and a *VerificationError is returned. A nil h skips
+// the verification.
+func SafeWriteReaderHash(fs Fs, path string, r io.Reader, h hash.Hash, expected []byte) (err error) {
 	dir, _ := filepath.Split(path)
 	ospath := filepath.FromSlash(dir)
 
@@ -88,10 +115,32 @@ func SafeWriteReader(fs Fs, path string, r io.Reader) (err error) {
 	if err != nil {
 		return
 	}
-	defer file.Close()
+	// Don't leave a partial or corrupted file behind
+	defer func() {
+		if err != nil {
+			_ = fs.Remove(path)
+		}
+	}()
 
-	_, err = io.Copy(file, r)
-	return
+	w := io.Writer(file)
+	if h != nil {
+		h.Reset()
+		w = io.MultiWriter(file, h)
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		_ = file.Close()
+		return
+	}
+	// The content of remote files is only committed on close
+	if err = file.Close(); err != nil {
+		return
+	}
+	if h != nil {
+		if sum := h.Sum(nil); !bytes.Equal(sum, expected) {
+			return &VerificationError{Path: path, Expected: expected, Actual: sum}
+		}
+	}
+	return nil
 }
 
 func (a Afero) GetTempDir(subPath string) string {
@@ -320,6 +369,74 @@ func Exists(fs Fs, path string) (bool, error) {
 	return false, err
 }
 
+// Prefetcher is an optional interface in Kafero. It is implemented by the
+// filesystems able to list a whole tree in a single call, answering many
+// existence queries at once.
+type Prefetcher interface {
+	// Prefetch returns the FileInfo of dir and of all the files and
+	// directories under it, keyed by their cleaned path. A missing dir
+	// gives an empty result.
+	Prefetch(dir string) (map[string]os.FileInfo, error)
+}
+
+func (a Afero) ExistsMany(paths []string) (map[string]bool, error) {
+	return ExistsMany(a.Fs, paths)
+}
+
+// ExistsMany checks which of the paths exist. A Prefetcher answers all of
+// them by listing their common parent directory.
+func ExistsMany(fs Fs, paths []string) (map[string]bool, error) {
+	infos, err := statPaths(fs, paths)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		_, res[p] = infos[p]
+	}
+	return res, nil
+}
+
+// statPaths returns the FileInfo of the existing paths, using the
+// Prefetcher or StatManyer fast paths when available.
+func statPaths(fs Fs, paths []string) (map[string]os.FileInfo, error) {
+	pfs, ok := fs.(Prefetcher)
+	if !ok || len(paths) == 0 {
+		return StatMany(fs, paths)
+	}
+	infos, err := pfs.Prefetch(commonDir(paths))
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]os.FileInfo, len(paths))
+	for _, p := range paths {
+		if fi, ok := infos[filepath.Clean(p)]; ok {
+			res[p] = fi
+		}
+	}
+	return res, nil
+}
+
+// commonDir returns the deepest directory containing all the paths, "" if
+// the relative paths have no common parent.
+func commonDir(paths []string) string {
+	dir := filepath.Dir(filepath.Clean(paths[0]))
+	for _, p := range paths[1:] {
+		p = filepath.Clean(p)
+		for dir != "." && dir != p && !strings.HasPrefix(p, strings.TrimSuffix(dir, FilePathSeparator)+FilePathSeparator) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
 func FullBaseFsPath(basePathFs *BasePathFs, relativePath string) string {
 	combinedPath := filepath.Join(basePathFs.path, relativePath)
 	if parent, ok := basePathFs.source.(*BasePathFs); ok {
@@ -18,7 +18,10 @@
 package kafero
 
 import (
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -337,6 +340,42 @@ func TestSafeWriteToDisk(t *testing.T) {
 	}
 }
 
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+func TestSafeWriteReaderHash(t *testing.T) {
+	fs := NewMemMapFs()
+	content := "This is a random string!"
+	sum := sha256.Sum256([]byte(content))
+
+	if err := SafeWriteReaderHash(fs, "/ok.txt", strings.NewReader(content), sha256.New(), sum[:]); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile(fs, "/ok.txt"); string(data) != content {
+		t.Fatalf("was expecting %q, got %q", content, data)
+	}
+
+	err := SafeWriteReaderHash(fs, "/corrupted.txt", strings.NewReader(content[1:]), sha256.New(), sum[:])
+	var verr *VerificationError
+	if !errors.As(err, &verr) || verr.Path != "/corrupted.txt" {
+		t.Fatalf("was expecting a verification error, got %v", err)
+	}
+	if exists, _ := Exists(fs, "/corrupted.txt"); exists {
+		t.Fatal("was expecting the corrupted file to be removed")
+	}
+
+	r := io.MultiReader(strings.NewReader(content), failingReader{})
+	if err := SafeWriteReader(fs, "/partial.txt", r); err != io.ErrUnexpectedEOF {
+		t.Fatalf("was expecting an unexpected EOF, got %v", err)
+	}
+	if exists, _ := Exists(fs, "/partial.txt"); exists {
+		t.Fatal("was expecting the partial file to be removed")
+	}
+}
+
 func TestWriteToDisk(t *testing.T) {
 	emptyFile, _ := createZeroSizedFileInTempDir()
 	defer deleteFileInTempDir(emptyFile)
@@ -448,3 +487,137 @@ func TestFullBaseFsPath(t *testing.T) {
 		}
 	}
 }
+
+// prefetchFs answers the existence queries with Prefetch only.
+type prefetchFs struct {
+	Fs
+	prefetches int
+}
+
+func (p *prefetchFs) Stat(name string) (os.FileInfo, error) {
+	panic("unexpected Stat of " + name)
+}
+
+func (p *prefetchFs) Prefetch(dir string) (map[string]os.FileInfo, error) {
+	p.prefetches++
+	res := make(map[string]os.FileInfo)
+	err := Walk(p.Fs, dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		res[filepath.Clean(path)] = info
+		return nil
+	})
+	return res, err
+}
+
+func TestExistsMany(t *testing.T) {
+	fs := NewMemMapFs()
+	fs.MkdirAll("/data/a", 0777)
+	WriteFile(fs, "/data/a/1.txt", []byte("1"), 0644)
+	WriteFile(fs, "/data/b.txt", []byte("b"), 0644)
+
+	paths := []string{"/data/a", "/data/a/1.txt", "/data/a/2.txt", "/data/b.txt", "/data/c.txt"}
+	expected := map[string]bool{
+		"/data/a": true, "/data/a/1.txt": true, "/data/a/2.txt": false, "/data/b.txt": true, "/data/c.txt": false,
+	}
+	pfs := &prefetchFs{Fs: fs}
+	for _, f := range []Fs{fs, pfs} {
+		res, err := ExistsMany(f, paths)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for p, exists := range expected {
+			if res[p] != exists {
+				t.Errorf("%s: was expecting exists %v for %s", f.Name(), exists, p)
+			}
+		}
+	}
+	if pfs.prefetches != 1 {
+		t.Fatalf("was expecting a single prefetch, got %d", pfs.prefetches)
+	}
+
+	if dir := commonDir([]string{"/data/a/1.txt", "/data/b.txt"}); dir != "/data" {
+		t.Fatalf("was expecting /data, got %s", dir)
+	}
+	if dir := commonDir([]string{"a/1.txt", "b.txt"}); dir != "" {
+		t.Fatalf("was expecting an empty dir, got %s", dir)
+	}
+}
+
+func TestCopyDirSync(t *testing.T) {
+	src := NewMemMapFs()
+	src.MkdirAll("/src/sub", 0777)
+	WriteFile(src, "/src/a.txt", []byte("a"), 0644)
+	WriteFile(src, "/src/sub/b.txt", []byte("b"), 0644)
+
+	dst := NewMemMapFs()
+	if err := CopyDir(src, "/src", dst, "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"/dst/a.txt": "a", "/dst/sub/b.txt": "b"} {
+		data, err := ReadFile(dst, name)
+		if err != nil || string(data) != content {
+			t.Fatalf("was expecting %s in %s, got %s, %v", content, name, data, err)
+		}
+	}
+
+	// Only the modified files are transferred, extra files are kept
+	WriteFile(src, "/src/sub/b.txt", []byte("bb"), 0644)
+	WriteFile(dst, "/dst/a.txt", []byte("x"), 0644)
+	WriteFile(dst, "/dst/extra.txt", []byte("extra"), 0644)
+	pdst := &prefetchFs{Fs: dst}
+	if err := Sync(src, "/src", pdst, "/dst"); err != nil {
+		t.Fatal(err)
+	}
+	if pdst.prefetches != 1 {
+		t.Fatalf("was expecting a single prefetch, got %d", pdst.prefetches)
+	}
+	for name, content := range map[string]string{"/dst/a.txt": "x", "/dst/sub/b.txt": "bb", "/dst/extra.txt": "extra"} {
+		data, err := ReadFile(dst, name)
+		if err != nil || string(data) != content {
+			t.Fatalf("was expecting %s in %s, got %s, %v", content, name, data, err)
+		}
+	}
+}
+
+func TestCopyDirDedup(t *testing.T) {
+	src := NewMemMapFs()
+	WriteFile(src, "/src/same.txt", []byte("same"), 0644)
+	WriteFile(src, "/src/diff.txt", []byte("diff"), 0644)
+	WriteFile(src, "/src/new.txt", []byte("new"), 0644)
+
+	dst := NewMemMapFs()
+	WriteFile(dst, "/dst/same.txt", []byte("same"), 0644)
+	WriteFile(dst, "/dst/diff.txt", []byte("DIFF"), 0644)
+	stats := &CopyStats{}
+	if err := CopyDir(src, "/src", dst, "/dst", Dedup(), WithCopyStats(stats)); err != nil {
+		t.Fatal(err)
+	}
+	expected := CopyStats{Copied: 2, Skipped: 1, Deduplicated: 1, BytesCopied: 7, BytesAvoided: 4}
+	if *stats != expected {
+		t.Fatalf("was expecting %+v, got %+v", expected, *stats)
+	}
+	for name, content := range map[string]string{"/dst/same.txt": "same", "/dst/diff.txt": "diff", "/dst/new.txt": "new"} {
+		data, err := ReadFile(dst, name)
+		if err != nil || string(data) != content {
+			t.Fatalf("was expecting %s in %s, got %s, %v", content, name, data, err)
+		}
+	}
+
+	// The digests are compared when both sides have one, and copied along
+	isrc, dbase := NewIntegrityFs(newXattrMemFs()), newXattrMemFs()
+	WriteFile(isrc, "/src/a.txt", []byte("a"), 0644)
+	WriteFile(isrc, "/src/b.txt", []byte("b"), 0644)
+	WriteFile(NewIntegrityFs(dbase), "/dst/a.txt", []byte("a"), 0644)
+	stats = &CopyStats{}
+	if err := CopyDir(isrc, "/src", dbase, "/dst", Dedup(), WithCopyStats(stats)); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Deduplicated != 1 || stats.Copied != 1 {
+		t.Fatalf("was expecting a deduplicated file, got %+v", *stats)
+	}
+	if sum, err := Getxattr(dbase, "/dst/b.txt", XattrSHA256); err != nil || len(sum) == 0 {
+		t.Fatalf("was expecting the digest to be copied, got %s, %v", sum, err)
+	}
+}
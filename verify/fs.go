@@ -0,0 +1,249 @@
+package verify
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/melaurent/kafero"
+)
+
+// The Fs keeps the tree of the directory root of its source up to date
+// with the writes through it, storing it in the sidecar after each change.
+// The files are hashed again once closed after being written, the other
+// changes update the tree without reading any file. The writes outside of
+// root are not tracked.
+type Fs struct {
+	*state
+	source kafero.Fs
+	root   string
+}
+
+// state is the state of a Fs, shared with its views bound to contexts.
+type state struct {
+	mu   sync.Mutex
+	tree *Tree
+}
+
+// NewFs returns an Fs tracking the directory root of source, loading its
+// tree from the sidecar, or building it if there is none.
+func NewFs(source kafero.Fs, root string) (*Fs, error) {
+	root = filepath.Clean(root)
+	tree, err := Load(source, root)
+	if os.IsNotExist(err) {
+		if tree, err = Build(source, root); err == nil {
+			err = tree.Save(source, root)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Fs{state: &state{tree: tree}, source: source, root: root}, nil
+}
+
+// Tree returns a copy of the current tree.
+func (v *Fs) Tree() *Tree {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	t := newTree()
+	for rel, node := range v.tree.nodes {
+		n := *node
+		t.nodes[rel] = &n
+		if rel != "." {
+			t.link(rel)
+		}
+	}
+	return t
+}
+
+// tracked returns the path in the tree of name, false if not tracked.
+func (v *Fs) tracked(name string) (string, bool) {
+	rel, err := relPath(v.root, name)
+	if err != nil || rel == "." || rel == SidecarName {
+		return "", false
+	}
+	return rel, true
+}
+
+// update hashes name again, and its parents up to the root.
+func (v *Fs) update(name string) error {
+	rel, ok := v.tracked(name)
+	if !ok {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tree.remove(rel)
+	if err := v.tree.scan(v.source, filepath.Join(v.root, filepath.FromSlash(rel)), rel); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		v.attach(rel)
+	}
+	v.tree.rehash(rel)
+	return v.tree.Save(v.source, v.root)
+}
+
+// attach links rel to its parents, which may have been created with it.
+// Must be called with the Fs locked.
+func (v *Fs) attach(rel string) {
+	for child := rel; child != "."; child = path.Dir(child) {
+		if parent := path.Dir(child); v.tree.nodes[parent] == nil {
+			v.tree.nodes[parent] = &Node{Dir: true}
+		}
+		v.tree.link(child)
+	}
+}
+
+// move moves the nodes of oldname under newname, the files keeping their
+// hashes.
+func (v *Fs) move(oldname, newname string) error {
+	oldrel, oldok := v.tracked(oldname)
+	newrel, newok := v.tracked(newname)
+	if !oldok {
+		return v.update(newname)
+	}
+	if !newok {
+		return v.update(oldname)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	moved := make(map[string]*Node)
+	for rel, node := range v.tree.nodes {
+		if rel == oldrel || strings.HasPrefix(rel, oldrel+"/") {
+			moved[newrel+rel[len(oldrel):]] = node
+		}
+	}
+	v.tree.remove(oldrel)
+	v.tree.rehash(oldrel)
+	v.tree.remove(newrel)
+	for rel, node := range moved {
+		v.tree.nodes[rel] = node
+	}
+	for rel := range moved {
+		if rel != newrel {
+			v.tree.link(rel)
+		}
+	}
+	v.attach(newrel)
+	v.tree.rehash(newrel)
+	return v.tree.Save(v.source, v.root)
+}
+
+func (v *Fs) Name() string {
+	return "VerifyFs"
+}
+
+var _ kafero.Unwrapper = (*Fs)(nil)
+
+func (v *Fs) Unwrap() kafero.Fs {
+	return v.source
+}
+
+var _ kafero.ContextFs = (*Fs)(nil)
+
+func (v *Fs) WithContext(ctx context.Context) kafero.Fs {
+	return &Fs{state: v.state, source: kafero.WithContext(v.source, ctx), root: v.root}
+}
+
+func (v *Fs) Create(name string) (kafero.File, error) {
+	f, err := v.source.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, fs: v, name: name}, nil
+}
+
+func (v *Fs) Open(name string) (kafero.File, error) {
+	return v.source.Open(name)
+}
+
+func (v *Fs) OpenFile(name string, flag int, perm os.FileMode) (kafero.File, error) {
+	f, err := v.source.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return f, nil
+	}
+	return &file{File: f, fs: v, name: name}, nil
+}
+
+// updateDir adds the directory name, unless already in the tree.
+func (v *Fs) updateDir(name string) error {
+	if rel, ok := v.tracked(name); ok {
+		v.mu.Lock()
+		node := v.tree.nodes[rel]
+		v.mu.Unlock()
+		if node != nil && node.Dir {
+			return nil
+		}
+	}
+	return v.update(name)
+}
+
+func (v *Fs) Mkdir(name string, perm os.FileMode) error {
+	if err := v.source.Mkdir(name, perm); err != nil {
+		return err
+	}
+	return v.updateDir(name)
+}
+
+func (v *Fs) MkdirAll(path string, perm os.FileMode) error {
+	if err := v.source.MkdirAll(path, perm); err != nil {
+		return err
+	}
+	return v.updateDir(path)
+}
+
+func (v *Fs) Remove(name string) error {
+	if err := v.source.Remove(name); err != nil {
+		return err
+	}
+	return v.update(name)
+}
+
+func (v *Fs) RemoveAll(path string) error {
+	if err := v.source.RemoveAll(path); err != nil {
+		return err
+	}
+	return v.update(path)
+}
+
+func (v *Fs) Rename(oldname, newname string) error {
+	if err := v.source.Rename(oldname, newname); err != nil {
+		return err
+	}
+	return v.move(oldname, newname)
+}
+
+func (v *Fs) Stat(name string) (os.FileInfo, error) {
+	return v.source.Stat(name)
+}
+
+func (v *Fs) Chmod(name string, mode os.FileMode) error {
+	return v.source.Chmod(name, mode)
+}
+
+func (v *Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return v.source.Chtimes(name, atime, mtime)
+}
+
+// file is a file opened for writing, hashed again once closed.
+type file struct {
+	kafero.File
+	fs   *Fs
+	name string
+}
+
+func (f *file) Close() error {
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+	return f.fs.update(f.name)
+}
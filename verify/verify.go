@@ -0,0 +1,280 @@
+package verify
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/melaurent/kafero"
+)
+
+// SidecarName is the name of the file storing the tree of a directory, in
+// the directory.
+const SidecarName = ".kafero-merkle.json"
+
+// ErrOutsideTree is returned for the paths which are not under the root of
+// the tree.
+var ErrOutsideTree = errors.New("path outside of the tree")
+
+// A Node is a file or a directory of a tree. The hash of a file is the
+// SHA-256 of its content, the hash of a directory the SHA-256 of the
+// types, hashes and names of its children.
+type Node struct {
+	Hash string `json:"hash"`
+	Dir  bool   `json:"dir,omitempty"`
+	Size int64  `json:"size,omitempty"`
+}
+
+// A Tree is the Merkle tree of a directory, its nodes keyed by their path
+// relative to the directory, with slashes, "." being the directory itself.
+// The hash of the root changes with any file of the directory, so storing
+// it apart makes the tree tamper evident.
+type Tree struct {
+	nodes    map[string]*Node
+	children map[string]map[string]bool
+}
+
+type sidecar struct {
+	Nodes map[string]*Node `json:"nodes"`
+}
+
+func newTree() *Tree {
+	return &Tree{nodes: make(map[string]*Node), children: make(map[string]map[string]bool)}
+}
+
+// Build returns the tree of the directory root of fs, hashing all its
+// files.
+func Build(fs kafero.Fs, root string) (*Tree, error) {
+	t := newTree()
+	if err := t.scan(fs, root, "."); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Load returns the tree of the directory root of fs stored in its sidecar.
+func Load(fs kafero.Fs, root string) (*Tree, error) {
+	data, err := kafero.ReadFile(fs, filepath.Join(root, SidecarName))
+	if err != nil {
+		return nil, err
+	}
+	var s sidecar
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error unmarshalling tree: %v", err)
+	}
+	t := newTree()
+	for rel, node := range s.Nodes {
+		t.nodes[rel] = node
+		if rel != "." {
+			t.link(rel)
+		}
+	}
+	if root := t.nodes["."]; root == nil || !root.Dir {
+		return nil, fmt.Errorf("error loading tree: no root")
+	}
+	return t, nil
+}
+
+// Save stores the tree in the sidecar of the directory root of fs.
+func (t *Tree) Save(fs kafero.Fs, root string) error {
+	data, err := json.Marshal(&sidecar{Nodes: t.nodes})
+	if err != nil {
+		return err
+	}
+	return kafero.WriteFile(fs, filepath.Join(root, SidecarName), data, 0644)
+}
+
+// Root returns the hash of the root of the tree.
+func (t *Tree) Root() string {
+	return t.nodes["."].Hash
+}
+
+// Node returns the node of the path rel, relative to the root of the tree.
+func (t *Tree) Node(rel string) (*Node, bool) {
+	node, ok := t.nodes[path.Clean(rel)]
+	return node, ok
+}
+
+// link adds rel to the children of its parent.
+func (t *Tree) link(rel string) {
+	dir := path.Dir(rel)
+	if t.children[dir] == nil {
+		t.children[dir] = make(map[string]bool)
+	}
+	t.children[dir][path.Base(rel)] = true
+}
+
+// scan hashes the file or directory name of fs, at rel in the tree.
+func (t *Tree) scan(fs kafero.Fs, name, rel string) error {
+	info, err := fs.Stat(name)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		hash, err := hashFile(fs, name)
+		if err != nil {
+			return err
+		}
+		t.nodes[rel] = &Node{Hash: hash, Size: info.Size()}
+		return nil
+	}
+	t.nodes[rel] = &Node{Dir: true}
+	names, err := kafero.ReadDirNames(fs, name)
+	if err != nil {
+		return err
+	}
+	for _, child := range names {
+		if rel == "." && child == SidecarName {
+			continue
+		}
+		crel := path.Join(rel, child)
+		if err := t.scan(fs, filepath.Join(name, child), crel); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		t.link(crel)
+	}
+	t.nodes[rel].Hash = t.dirHash(rel)
+	return nil
+}
+
+// remove removes rel and the nodes under it.
+func (t *Tree) remove(rel string) {
+	if t.nodes[rel] == nil {
+		return
+	}
+	for child := range t.children[rel] {
+		t.remove(path.Join(rel, child))
+	}
+	delete(t.children, rel)
+	delete(t.nodes, rel)
+	if children := t.children[path.Dir(rel)]; children != nil {
+		delete(children, path.Base(rel))
+	}
+}
+
+// rehash updates the hashes of the directories from the parent of rel up
+// to the root.
+func (t *Tree) rehash(rel string) {
+	for rel != "." {
+		rel = path.Dir(rel)
+		if node := t.nodes[rel]; node != nil {
+			node.Hash = t.dirHash(rel)
+		}
+	}
+}
+
+// dirHash returns the hash of the directory rel from the hashes of its
+// children.
+func (t *Tree) dirHash(rel string) string {
+	names := make([]string, 0, len(t.children[rel]))
+	for name := range t.children[rel] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		node := t.nodes[path.Join(rel, name)]
+		kind := "f"
+		if node.Dir {
+			kind = "d"
+		}
+		_, _ = io.WriteString(h, kind+node.Hash+"\x00"+name+"\x00")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func hashFile(fs kafero.Fs, name string) (string, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// relPath returns the path of name relative to root, with slashes.
+func relPath(root, name string) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(root), filepath.Clean(name))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideTree
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// Verify checks the directory dir, root or under it, against the tree
+// stored in the sidecar of root. It returns the paths, relative to root,
+// of the files and directories modified, added or removed since the tree
+// was stored, and of the directories whose stored hash doesn't match their
+// stored children, the sidecar having been altered. No path is returned
+// if dir is intact.
+func Verify(fs kafero.Fs, root, dir string) ([]string, error) {
+	rel, err := relPath(root, dir)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := Load(fs, root)
+	if err != nil {
+		return nil, err
+	}
+	current := newTree()
+	if err := current.scan(fs, dir, rel); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var diffs []string
+	seen := make(map[string]bool)
+	for name, node := range current.nodes {
+		seen[name] = true
+		if snode, ok := stored.nodes[name]; !ok || snode.Hash != node.Hash || snode.Dir != node.Dir {
+			diffs = append(diffs, name)
+		}
+	}
+	// The stored hashes of the directories must follow from their stored
+	// children, from dir up to the root
+	inconsistent := func(name string) bool {
+		snode := stored.nodes[name]
+		return snode.Dir && snode.Hash != stored.dirHash(name)
+	}
+	prefix := rel + "/"
+	for name := range stored.nodes {
+		if rel != "." && name != rel && !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if !seen[name] || inconsistent(name) && !contains(diffs, name) {
+			diffs = append(diffs, name)
+		}
+	}
+	for name := path.Dir(rel); rel != "."; name = path.Dir(name) {
+		if _, ok := stored.nodes[name]; ok && inconsistent(name) {
+			diffs = append(diffs, name)
+		}
+		if name == "." {
+			break
+		}
+	}
+	sort.Strings(diffs)
+	return diffs, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
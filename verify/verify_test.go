@@ -0,0 +1,87 @@
+package verify
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/melaurent/kafero"
+)
+
+func TestVerify(t *testing.T) {
+	base := kafero.NewMemMapFs()
+	for _, name := range []string{"/data/a.txt", "/data/2020/b.txt", "/data/2020/c.txt", "/data/2021/d.txt"} {
+		if err := kafero.WriteFile(base, name, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fs, err := NewFs(base, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := fs.Tree().Root()
+	if diffs, err := Verify(base, "/data", "/data"); err != nil || len(diffs) != 0 {
+		t.Fatalf("was expecting no difference, got %v, %v", diffs, err)
+	}
+
+	// The writes through the Fs update the tree incrementally
+	if err := kafero.WriteFile(fs, "/data/2022/e.txt", []byte("e"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Rename("/data/2020", "/data/old"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Remove("/data/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Tree().Root() == root {
+		t.Fatalf("was expecting the root hash to change")
+	}
+	if diffs, err := Verify(base, "/data", "/data"); err != nil || len(diffs) != 0 {
+		t.Fatalf("was expecting no difference, got %v, %v", diffs, err)
+	}
+	built, err := Build(base, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if built.Root() != fs.Tree().Root() {
+		t.Fatalf("was expecting the incremental tree to match the built one")
+	}
+
+	// The changes made around the Fs are detected
+	if err := kafero.WriteFile(base, "/data/old/b.txt", []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := Verify(base, "/data", "/data/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(diffs, ",") != "old,old/b.txt" {
+		t.Fatalf("was expecting old/b.txt to differ, got %v", diffs)
+	}
+	if diffs, err := Verify(base, "/data", "/data/2021"); err != nil || len(diffs) != 0 {
+		t.Fatalf("was expecting 2021 to be intact, got %v, %v", diffs, err)
+	}
+
+	// And so is a sidecar updated for the tampered file only
+	tree, err := Load(base, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Build(base, "/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, _ := tree.Node("old/b.txt")
+	cnode, _ := current.Node("old/b.txt")
+	node.Hash = cnode.Hash
+	if err := tree.Save(base, "/data"); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = Verify(base, "/data", "/data/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(diffs, ",") != "old" {
+		t.Fatalf("was expecting the stored old to be inconsistent, got %v", diffs)
+	}
+}
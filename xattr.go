@@ -0,0 +1,62 @@
+package kafero
+
+import (
+	"errors"
+	"os"
+)
+
+// Xattrer is an optional interface in Kafero. It is only implemented by the
+// filesystems able to attach extended attributes to files.
+// Attribute names are namespaced: "user." attributes are free for
+// applications to use, other namespaces are owned by the backend (e.g.
+// "gcs.storage_class") and may be read only.
+type Xattrer interface {
+	Getxattr(name, attr string) ([]byte, error)
+	Setxattr(name, attr string, value []byte) error
+	Listxattr(name string) ([]string, error)
+	Removexattr(name, attr string) error
+}
+
+var (
+	// ErrNoAttr is returned when the requested attribute is not set.
+	ErrNoAttr = errors.New("attribute not found")
+	// ErrXattrNotSupported is returned when the filesystem doesn't
+	// implement Xattrer, or doesn't support the given attribute.
+	ErrXattrNotSupported = errors.New("extended attributes not supported")
+)
+
+// Getxattr returns the value of the attribute attr of the named file, if
+// the filesystem supports extended attributes.
+func Getxattr(fs Fs, name, attr string) ([]byte, error) {
+	if xfs, ok := fs.(Xattrer); ok {
+		return xfs.Getxattr(name, attr)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: name, Err: ErrXattrNotSupported}
+}
+
+// Setxattr sets the attribute attr of the named file, if the filesystem
+// supports extended attributes.
+func Setxattr(fs Fs, name, attr string, value []byte) error {
+	if xfs, ok := fs.(Xattrer); ok {
+		return xfs.Setxattr(name, attr, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: name, Err: ErrXattrNotSupported}
+}
+
+// Listxattr returns the names of the attributes set on the named file, if
+// the filesystem supports extended attributes.
+func Listxattr(fs Fs, name string) ([]string, error) {
+	if xfs, ok := fs.(Xattrer); ok {
+		return xfs.Listxattr(name)
+	}
+	return nil, &os.PathError{Op: "listxattr", Path: name, Err: ErrXattrNotSupported}
+}
+
+// Removexattr removes the attribute attr of the named file, if the
+// filesystem supports extended attributes.
+func Removexattr(fs Fs, name, attr string) error {
+	if xfs, ok := fs.(Xattrer); ok {
+		return xfs.Removexattr(name, attr)
+	}
+	return &os.PathError{Op: "removexattr", Path: name, Err: ErrXattrNotSupported}
+}
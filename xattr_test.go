@@ -0,0 +1,19 @@
+package kafero
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestXattrNotSupported(t *testing.T) {
+	fs := &MemMapFs{}
+	if err := WriteFile(fs, "file.txt", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Getxattr(fs, "file.txt", "user.origin"); !errors.Is(err, ErrXattrNotSupported) {
+		t.Fatalf("was expecting ErrXattrNotSupported, got %v", err)
+	}
+	if err := Setxattr(fs, "file.txt", "user.origin", []byte("test")); !errors.Is(err, ErrXattrNotSupported) {
+		t.Fatalf("was expecting ErrXattrNotSupported, got %v", err)
+	}
+}
@@ -1,48 +1,147 @@
 package zstfs
 
 import (
+	"bytes"
+	"encoding/binary"
 	"github.com/klauspost/compress/zstd"
 	"github.com/melaurent/kafero"
-	"os"
+	"github.com/melaurent/kafero/compressfs"
+	"io"
+	"sync"
 )
 
 // The Fs compress its files using the ZSTD compression algorithm.
 // It doesn't allow seeking.
-type Fs struct {
-	kafero.Fs
-	level zstd.EncoderLevel
+type Fs = compressfs.Fs
+
+// File is a compressed file of a Fs.
+type File = compressfs.File
+
+// codec compresses with zstd.
+type codec struct {
+	encOpts []zstd.EOption
+	decOpts []zstd.DOption
+	// The encoders reused by the writers, if enabled
+	encoders *sync.Pool
+	layer    []compressfs.Option
 }
 
-func NewFs(source kafero.Fs, level zstd.EncoderLevel) kafero.Fs {
-	return &Fs{Fs: source, level: level}
+// An Option configures a Fs.
+type Option func(c *codec)
+
+// CompressOnly compresses only the files whose base name matches one of
+// patterns, as compressfs.CompressOnly.
+func CompressOnly(patterns ...string) Option {
+	return func(c *codec) {
+		c.layer = append(c.layer, compressfs.CompressOnly(patterns...))
+	}
 }
 
-func (b *Fs) Name() string {
-	return "ZSTFs"
+// AutoDetect detects the format of the files read, as
+// compressfs.AutoDetect.
+func AutoDetect() Option {
+	return func(c *codec) {
+		c.layer = append(c.layer, compressfs.AutoDetect())
+	}
 }
 
-func (b *Fs) OpenFile(name string, flag int, mode os.FileMode) (f kafero.File, err error) {
-	sourcef, err := b.Fs.OpenFile(name, flag, mode)
-	if err != nil {
-		return nil, err
+// EncoderConcurrency sets the number of goroutines compressing each file
+// written, as zstd.WithEncoderConcurrency.
+func EncoderConcurrency(n int) Option {
+	return func(c *codec) {
+		c.encOpts = append(c.encOpts, zstd.WithEncoderConcurrency(n))
+	}
+}
+
+// DecoderConcurrency sets the number of goroutines decompressing each file
+// read, as zstd.WithDecoderConcurrency.
+func DecoderConcurrency(n int) Option {
+	return func(c *codec) {
+		c.decOpts = append(c.decOpts, zstd.WithDecoderConcurrency(n))
+	}
+}
+
+// WindowSize sets the size of the window of the compression, as
+// zstd.WithWindowSize, the larger windows compressing better at the cost
+// of the memory of both the writers and the readers.
+func WindowSize(size int) Option {
+	return func(c *codec) {
+		c.encOpts = append(c.encOpts, zstd.WithWindowSize(size))
+	}
+}
+
+// ReuseEncoders keeps the encoders of the closed files in a pool for the
+// next files written, instead of initializing an encoder per file, which
+// dominates the cost of writing many small files.
+func ReuseEncoders() Option {
+	return func(c *codec) {
+		c.encoders = &sync.Pool{}
 	}
-	return &File{File: sourcef, fs: b.Fs, flag: flag}, nil
 }
 
-func (b *Fs) Open(name string) (f kafero.File, err error) {
-	sourcef, err := b.Fs.Open(name)
+func NewFs(source kafero.Fs, level zstd.EncoderLevel, opts ...Option) kafero.Fs {
+	c := &codec{}
+	if level != 0 {
+		c.encOpts = append(c.encOpts, zstd.WithEncoderLevel(level))
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return compressfs.NewFs(source, "ZSTFs", c, c.layer...)
+}
+
+// NewWriter returns an encoder writing to w, from the pool if any.
+func (c *codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.encoders != nil {
+		if enc, ok := c.encoders.Get().(*zstd.Encoder); ok {
+			enc.Reset(w)
+			return &encoder{Encoder: enc, pool: c.encoders}, nil
+		}
+	}
+	enc, err := zstd.NewWriter(w, c.encOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return &File{File: sourcef, fs: b.Fs, flag: os.O_RDONLY}, nil
+	return &encoder{Encoder: enc, pool: c.encoders}, nil
 }
 
-func (b *Fs) Create(name string) (f kafero.File, err error) {
-	sourcef, err := b.Fs.Create(name)
+func (c *codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	dec, err := zstd.NewReader(r, c.decOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return &File{File: sourcef, fs: b.Fs, flag: os.O_RDWR}, nil
+	return dec.IOReadCloser(), nil
+}
+
+// Skippable returns a zstd skippable frame.
+func (c *codec) Skippable(payload []byte) []byte {
+	frame := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:], 0x184D2A5E)
+	binary.LittleEndian.PutUint32(frame[4:], uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+// Detect returns whether head starts with a zstd frame, or a skippable
+// frame as the footer of an empty file.
+func (c *codec) Detect(head []byte) bool {
+	return bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}) ||
+		len(head) >= 4 && head[0]&0xf0 == 0x50 && bytes.Equal(head[1:4], []byte{0x2a, 0x4d, 0x18})
+}
+
+// encoder returns to the pool, if any, when closed.
+type encoder struct {
+	*zstd.Encoder
+	pool *sync.Pool
+}
+
+func (e *encoder) Close() error {
+	if err := e.Encoder.Close(); err != nil {
+		return err
+	}
+	if e.pool != nil {
+		e.pool.Put(e.Encoder)
+	}
+	return nil
 }
 
 // vim: ts=4 sw=4 noexpandtab nolist syn=go
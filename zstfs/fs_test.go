@@ -1,9 +1,15 @@
 package zstfs
 
 import (
+	"bytes"
+	"errors"
 	"github.com/klauspost/compress/zstd"
 	"github.com/melaurent/kafero"
 	"github.com/melaurent/kafero/tests"
+	"io"
+	"io/ioutil"
+	"os"
+	"syscall"
 	"testing"
 )
 
@@ -13,3 +19,174 @@ func TestWrite(t *testing.T) {
 	// TODO
 	tests.TestWriteFile(t, zfs, "file.txt", 1000)
 }
+
+func TestLstatIfPossible(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	if err := kafero.WriteFile(fs, "file.txt", []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	zfs := NewFs(fs, zstd.SpeedDefault)
+	lsf, ok := zfs.(kafero.Lstater)
+	if !ok {
+		t.Fatal("was expecting a Lstater")
+	}
+	if fi, lstat, err := lsf.LstatIfPossible("file.txt"); err != nil || lstat || fi.Name() != "file.txt" {
+		t.Fatalf("was expecting a stat of file.txt, got %v, %t, %v", fi, lstat, err)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	zfs := NewFs(kafero.NewMemMapFs(), zstd.SpeedDefault)
+	if err := kafero.WriteFile(zfs, "file.txt", []byte("hello, world\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := zfs.Open("file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if off, err := f.Seek(2, io.SeekStart); off != 2 || err != nil {
+		t.Fatalf("Seek(2, 0) = %v, %v want 2, nil", off, err)
+	}
+	if off, err := f.Seek(5, io.SeekCurrent); off != 7 || err != nil {
+		t.Fatalf("Seek(5, 1) = %v, %v want 7, nil", off, err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(f, b); err != nil || string(b) != "world" {
+		t.Fatalf("was expecting world, got %q, %v", b, err)
+	}
+	if _, err := f.Seek(-13, io.SeekCurrent); !errors.Is(err, syscall.EINVAL) {
+		t.Fatalf("was expecting EINVAL, got %v", err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != syscall.EPERM {
+		t.Fatalf("was expecting EPERM, got %v", err)
+	}
+}
+
+func TestCompressOnly(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	zfs := NewFs(fs, zstd.SpeedDefault, CompressOnly("*.bin", "*.zst"))
+	for _, name := range []string{"data/file.bin", "data/meta.json"} {
+		if err := kafero.WriteFile(zfs, name, []byte("content"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := kafero.ReadFile(zfs, name)
+		if err != nil || string(data) != "content" {
+			t.Fatalf("was expecting content in %s, got %q, %v", name, data, err)
+		}
+	}
+	if data, err := kafero.ReadFile(fs, "data/meta.json"); err != nil || string(data) != "content" {
+		t.Fatalf("was expecting meta.json uncompressed, got %q, %v", data, err)
+	}
+	if data, err := kafero.ReadFile(fs, "data/file.bin"); err != nil || string(data) == "content" {
+		t.Fatalf("was expecting file.bin compressed, got %q, %v", data, err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	zfs := NewFs(fs, zstd.SpeedBestCompression, ReuseEncoders(), EncoderConcurrency(2), DecoderConcurrency(1), WindowSize(1<<20))
+	for i := 0; i < 10; i++ {
+		content := bytes.Repeat([]byte{byte('a' + i)}, 1000*i)
+		if err := kafero.WriteFile(zfs, "file.bin", content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		data, err := kafero.ReadFile(zfs, "file.bin")
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("was expecting %d bytes, got %d, %v", len(content), len(data), err)
+		}
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	content := bytes.Repeat([]byte("kafero zstfs benchmark "), 200)
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{"Default", nil},
+		{"ReuseEncoders", []Option{ReuseEncoders()}},
+		{"SingleThreaded", []Option{ReuseEncoders(), EncoderConcurrency(1)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			zfs := NewFs(kafero.NewMemMapFs(), zstd.SpeedDefault, bc.opts...)
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := kafero.WriteFile(zfs, "file.bin", content, 0644); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLogicalSize(t *testing.T) {
+	fs := kafero.NewMemMapFs()
+	zfs := NewFs(fs, zstd.SpeedDefault)
+	content := bytes.Repeat([]byte("content"), 100)
+	if err := kafero.WriteFile(zfs, "dir/file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The frames appended to
+	f, err := zfs.OpenFile("dir/file.bin", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := fs.Stat("dir/file.bin"); err != nil || fi.Size() >= int64(2*len(content)) {
+		t.Fatalf("was expecting the file compressed, got %v, %v", fi, err)
+	}
+
+	if fi, err := zfs.Stat("dir/file.bin"); err != nil || fi.Size() != int64(2*len(content)) {
+		t.Fatalf("was expecting the uncompressed size, got %v, %v", fi, err)
+	}
+	f, err = zfs.Open("dir/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := f.Stat(); err != nil || fi.Size() != int64(2*len(content)) {
+		t.Fatalf("was expecting the uncompressed size, got %v, %v", fi, err)
+	}
+	data, err := ioutil.ReadAll(f)
+	if err != nil || !bytes.Equal(data, append(content, content...)) {
+		t.Fatalf("was expecting the content twice, got %d bytes, %v", len(data), err)
+	}
+	f.Close()
+
+	fis, err := kafero.ReadDir(zfs, "dir")
+	if err != nil || len(fis) != 1 || fis[0].Size() != int64(2*len(content)) {
+		t.Fatalf("was expecting the uncompressed size listed, got %v, %v", fis, err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	zfs := NewFs(kafero.NewMemMapFs(), zstd.SpeedDefault).(*Fs)
+	content := bytes.Repeat([]byte("content"), 1000)
+	if err := kafero.WriteFile(zfs, "file.bin", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kafero.ReadFile(zfs, "file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	m := zfs.Metrics()
+	if m.RawWritten != int64(len(content)) || m.RawRead != int64(len(content)) {
+		t.Fatalf("was expecting %d bytes written and read, got %+v", len(content), m)
+	}
+	fi, err := zfs.Fs.Stat("file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CompressedWritten != fi.Size() || m.CompressedRead != fi.Size() {
+		t.Fatalf("was expecting %d compressed bytes written and read, got %+v", fi.Size(), m)
+	}
+	if m.Ratio() <= 1 || m.EncodeTime <= 0 || m.DecodeTime <= 0 {
+		t.Fatalf("was expecting the content compressed and timed, got %+v", m)
+	}
+}